@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// anonymizationMapFile is the default name of the --anonymize mapping,
+// kept beside the export it undoes.
+const anonymizationMapFile = "anonymization-map.json"
+
+// anonymizationMapPath is where --anonymize keeps its mapping: path when
+// given, otherwise next to the export.
+func anonymizationMapPath(path, exportFile string) string {
+	if path != "" {
+		return path
+	}
+	if exportFile == "" || exportFile == export.Stdout {
+		return anonymizationMapFile
+	}
+	return filepath.Join(filepath.Dir(exportFile), anonymizationMapFile)
+}
+
+// runDeanonymize restores the real names in an export written with
+// --anonymize, using the mapping that run kept.
+func runDeanonymize(args []string) {
+	flags := flag.NewFlagSet("deanonymize", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sf-deleted-fields deanonymize [flags] export")
+		flags.PrintDefaults()
+	}
+	mapPath := flags.String("map", anonymizationMapFile, "Mapping written by the --anonymize run")
+	output := flags.String("o", "", "File to write the restored export to (.json, .ndjson/.jsonl or .csv)")
+	format := flags.String("format", "", "Output format (json, ndjson or csv); defaults to the -o file extension")
+	logging := registerLogFlags(flags)
+	inputs := parseInterspersed(flags, args)
+	logging.apply()
+
+	if len(inputs) != 1 {
+		fatal("Please provide the anonymized export to restore")
+	}
+	if *output == "" {
+		fatal("Please provide an output file; use -o")
+	}
+	if filepath.Clean(inputs[0]) == filepath.Clean(*output) {
+		fatal("The output must not overwrite the anonymized export", "file", *output)
+	}
+	if *format == "" {
+		*format = export.FormatForPath(*output)
+	}
+	if !slices.Contains(export.Formats(), strings.ToLower(*format)) {
+		fatal("Unknown --format", "format", *format, "formats", export.Formats())
+	}
+
+	if _, err := os.Stat(*mapPath); err != nil {
+		fatal("Cannot read the anonymization map", "file", *mapPath, "error", err)
+	}
+	anonymizer, err := export.LoadAnonymizer(*mapPath)
+	if err != nil {
+		fatal("Invalid anonymization map", "error", err)
+	}
+
+	data, err := export.Read(inputs[0])
+	if err != nil {
+		fatal("Failed to read export", "file", inputs[0], "error", err)
+	}
+	records := anonymizer.Deanonymize(data.Results)
+
+	// The exporters append, so start the restored export from scratch.
+	if err := os.Remove(*output); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fatal("Failed to replace output", "file", *output, "error", err)
+	}
+	exporter, err := export.New(*format, *output)
+	if err != nil {
+		fatal("Failed to open output", "error", err)
+	}
+	if err := exporter.Write(export.Run{Append: true}, records); err != nil {
+		fatal("Failed to write restored export", "error", err)
+	}
+	slog.Info("Restored anonymized export", "records", len(records), "file", *output)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// apiName matches the object and field names archive splices into its
+// queries.
+var apiName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// runArchive exports a deleted field's values to CSV through the Bulk API
+// before its data is purged, so a team can restore what they find they
+// still needed. Records in the Recycle Bin are included, and with
+// --history the field's tracked changes too.
+func runArchive(args []string) {
+	flags := flag.NewFlagSet("archive", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sf-deleted-fields archive [flags] Object.Field")
+		flags.PrintDefaults()
+	}
+	org := flags.String("org", "", "Salesforce organization to use (default: the sf CLI's target-org)")
+	output := flags.String("output", "", "CSV file to write the values to (default: <Object>.<Field>.csv)")
+	history := flags.Bool("history", false, "Also export the field's tracked history to <output>.history.csv")
+	logging := registerLogFlags(flags)
+	inputs := parseInterspersed(flags, args)
+	logging.apply()
+
+	if *org == "" {
+		*org = defaultOrg()
+	}
+	redact.Add("org", *org)
+	if len(inputs) != 1 {
+		fatal("Please provide one field to archive, e.g. Account.Legacy_Status_del__c")
+	}
+	object, developerName, err := scanner.ParseFieldName(inputs[0])
+	if err != nil {
+		fatal("Invalid field", "error", err)
+	}
+	if !apiName.MatchString(object) || !apiName.MatchString(developerName) {
+		fatal("Invalid field; object and field must be API names", "field", inputs[0])
+	}
+	field := developerName + "__c"
+	if *output == "" {
+		*output = object + "." + field + ".csv"
+	}
+
+	ctx := context.Background()
+	client, err := sfclient.NewClient(*org)
+	if err != nil {
+		fatal("Failed to open REST session", "org", *org, "error", err)
+	}
+
+	soql := fmt.Sprintf("SELECT Id, IsDeleted, %s FROM %s WHERE %s != null", field, object, field)
+	records, err := archiveQuery(ctx, client, soql, *output)
+	if err != nil {
+		if strings.Contains(err.Error(), "INVALID_FIELD") {
+			fatal("Salesforce does not serve the field's data; undelete the field in Setup, archive it, then delete it again", "field", object+"."+field, "error", err)
+		}
+		fatal("Failed to archive field", "field", object+"."+field, "error", err)
+	}
+	slog.Info("Archived field values", "field", object+"."+field, "records", records, "file", *output)
+
+	if *history {
+		historyFile := strings.TrimSuffix(*output, ".csv") + ".history.csv"
+		soql := fmt.Sprintf("SELECT ParentId, CreatedDate, CreatedById, OldValue, NewValue FROM %s WHERE Field = '%s' ORDER BY ParentId, CreatedDate", historyObject(object), field)
+		records, err := archiveQuery(ctx, client, soql, historyFile)
+		if err != nil {
+			fatal("Failed to archive field history; is history tracked for the field?", "field", object+"."+field, "error", err)
+		}
+		slog.Info("Archived field history", "field", object+"."+field, "changes", records, "file", historyFile)
+	}
+}
+
+// archiveQuery writes the results of a Bulk API queryAll of soql to path,
+// readable by the owner only since it holds record data.
+func archiveQuery(ctx context.Context, client *sfclient.Client, soql, path string) (int, error) {
+	slog.Debug("Running bulk query", "soql", soql)
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	records, err := client.BulkQueryAll(ctx, soql, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return records, nil
+}
+
+// historyObject names the object Salesforce keeps object's field history
+// in: AccountHistory for Account, Invoice__History for Invoice__c.
+func historyObject(object string) string {
+	if base, ok := strings.CutSuffix(object, "__c"); ok {
+		return base + "__History"
+	}
+	return object + "History"
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// asciiReplacer spells out the non-ASCII characters this tool and the sf CLI
+// are known to print; anything else becomes '?'.
+var asciiReplacer = strings.NewReplacer(
+	"»", ">>", "«", "<<",
+	"‘", "'", "’", "'", "“", `"`, "”", `"`,
+	"–", "-", "—", "-", "…", "...", "•", "*",
+	"✓", "ok", "✔", "ok", "✗", "x", "✖", "x", "→", "->",
+	"▁", "_", "▂", ".", "▃", ",", "▄", "-", "▅", "~", "▆", "=", "▇", "*", "█", "#",
+)
+
+// toASCII rewrites s so it only contains printable ASCII, tabs and newlines.
+func toASCII(s string) string {
+	s = asciiReplacer.Replace(s)
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\t' || r == '\r':
+			b.WriteRune(r)
+		case r == utf8.RuneError || r < ' ' || r > '~':
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// asciiWriter passes writes through toASCII, for CI log processors that
+// reject anything but plain ASCII.
+type asciiWriter struct {
+	w io.Writer
+}
+
+func (a asciiWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(a.w, toASCII(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
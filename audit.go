@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+)
+
+const auditFileName = "audit.log"
+
+// auditConfig controls the audit log of invocations. It is kept in the user
+// config directory unless file points elsewhere; syslog also forwards each
+// entry, either to the local syslog ("local") or to network://host:port.
+type auditConfig struct {
+	Disabled bool   `yaml:"disabled"`
+	File     string `yaml:"file"`
+	Syslog   string `yaml:"syslog"`
+}
+
+// auditEntry records who ran which command against which orgs and how it
+// ended.
+type auditEntry struct {
+	Time            string   `json:"time"`
+	RunId           string   `json:"runId"`
+	User            string   `json:"user"`
+	Host            string   `json:"host"`
+	Command         string   `json:"command"`
+	Args            []string `json:"args"`
+	Orgs            []string `json:"orgs,omitempty"`
+	Targets         []string `json:"targets,omitempty"`
+	Outcome         string   `json:"outcome"`
+	ExitCode        int      `json:"exitCode"`
+	DurationSeconds float64  `json:"durationSeconds"`
+	Version         string   `json:"version"`
+}
+
+// auditLog writes one entry when the invocation ends. A nil auditLog, used
+// before the configuration is loaded or when auditing is disabled, does
+// nothing.
+type auditLog struct {
+	cfg     auditConfig
+	started time.Time
+
+	mu    sync.Mutex
+	done  bool
+	entry auditEntry
+}
+
+var audit *auditLog
+
+func startAudit(cfg auditConfig, command string, args []string) *auditLog {
+	if cfg.Disabled {
+		return nil
+	}
+
+	entry := auditEntry{
+		RunId:   runID,
+		Command: command,
+		Args:    args,
+		Version: version,
+	}
+	if u, err := user.Current(); err == nil {
+		entry.User = u.Username
+	}
+	entry.Host, _ = os.Hostname()
+	return &auditLog{cfg: cfg, started: time.Now(), entry: entry}
+}
+
+func (a *auditLog) setOrgs(orgs []string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entry.Orgs = orgs
+}
+
+// setTargets records what a command that changes an org or deletes data
+// acted on, e.g. the objects whose records it erased.
+func (a *auditLog) setTargets(targets []string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entry.Targets = targets
+}
+
+// finish records the outcome and writes the entry once. A failure to write
+// the audit log is logged but does not change the run's outcome.
+func (a *auditLog) finish(outcome string, exitCode int) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.done {
+		return
+	}
+	a.done = true
+
+	entry := a.entry
+	entry.Time = a.started.UTC().Format(time.RFC3339)
+	entry.Outcome = outcome
+	entry.ExitCode = exitCode
+	entry.DurationSeconds = time.Since(a.started).Seconds()
+	entry.User = redact.Apply(entry.User)
+	entry.Args = make([]string, len(a.entry.Args))
+	for i, arg := range a.entry.Args {
+		entry.Args[i] = redact.Apply(arg)
+	}
+	entry.Orgs = make([]string, len(a.entry.Orgs))
+	for i, org := range a.entry.Orgs {
+		entry.Orgs[i] = redact.Apply(org)
+	}
+	if a.entry.Targets != nil {
+		entry.Targets = make([]string, len(a.entry.Targets))
+		for i, target := range a.entry.Targets {
+			entry.Targets[i] = redact.Apply(target)
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		slog.Warn("Failed to encode audit entry", "error", err)
+		return
+	}
+
+	if err := a.appendFile(line); err != nil {
+		slog.Warn("Failed to write audit log", "error", err)
+	}
+	if a.cfg.Syslog != "" {
+		if err := forwardToSyslog(a.cfg.Syslog, outcome, line); err != nil {
+			slog.Warn("Failed to forward audit entry to syslog", "error", err)
+		}
+	}
+}
+
+func (a *auditLog) path() (string, error) {
+	if a.cfg.File != "" {
+		return a.cfg.File, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no audit log location: %w", err)
+	}
+	return filepath.Join(dir, "sf-deleted-fields", auditFileName), nil
+}
+
+func (a *auditLog) appendFile(line []byte) error {
+	path, err := a.path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to audit log: %w", err)
+	}
+	return file.Close()
+}
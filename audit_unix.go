@@ -0,0 +1,35 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+// forwardToSyslog sends an audit entry to the local syslog, or to a remote
+// one given as network://host:port.
+func forwardToSyslog(target, outcome string, line []byte) error {
+	network, addr := "", ""
+	if target != "local" {
+		var ok bool
+		network, addr, ok = strings.Cut(target, "://")
+		if !ok {
+			return fmt.Errorf("invalid syslog target %q: use local or network://host:port", target)
+		}
+	}
+
+	priority := syslog.LOG_AUTH | syslog.LOG_INFO
+	if outcome != outcomeOK {
+		priority = syslog.LOG_AUTH | syslog.LOG_WARNING
+	}
+	writer, err := syslog.Dial(network, addr, priority, "sf-deleted-fields")
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	_, err = writer.Write(line)
+	return err
+}
@@ -0,0 +1,9 @@
+package main
+
+import "errors"
+
+// Windows has no syslog; audit entries are only written to the audit log
+// file.
+func forwardToSyslog(target, outcome string, line []byte) error {
+	return errors.New("syslog forwarding is not supported on Windows")
+}
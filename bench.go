@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+const deletedFieldCountQuery = "SELECT Count() FROM CustomField WHERE DeveloperName LIKE '%_del'"
+
+// runBench measures how expensive a scan of the org would be so users can
+// pick concurrency and counting modes before starting a long run.
+func runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	org := flags.String("org", "", "Salesforce organization to use (default: the sf CLI's target-org)")
+	samples := flags.Int("samples", 3, "Number of timed samples per measurement")
+	concurrency := flags.Int("concurrency", scanner.MaxAutoConcurrency/2, "Concurrency to assume for the run time estimate")
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+
+	if *org == "" {
+		*org = defaultOrg()
+	}
+	*samples = max(*samples, 1)
+	*concurrency = max(*concurrency, 1)
+
+	slog.Info("Benchmarking Salesforce organization", "org", *org)
+
+	spawn := averageDuration(*samples, func() error {
+		return sfclient.Command(context.Background(), "version").Run()
+	})
+
+	ctx := context.Background()
+	cli := &sfclient.CLI{Org: *org}
+	cliQuery := averageDuration(*samples, func() error {
+		_, err := cli.Query(ctx, "SELECT Count() FROM Organization", false)
+		return err
+	})
+
+	client, err := sfclient.NewClient(*org)
+	if err != nil {
+		fatal("Benchmark failed", "error", err)
+	}
+
+	restQuery := averageDuration(*samples, func() error {
+		_, err := client.Query(ctx, "SELECT Count() FROM Organization", false)
+		return err
+	})
+
+	resp, err := client.Query(ctx, deletedFieldCountQuery, true)
+	if err != nil {
+		fatal("Benchmark failed", "error", err)
+	}
+	fields := resp.TotalSize
+
+	// Count queries run in waves of concurrency; composite subrequests run
+	// one after another on the server.
+	perWave := func(latency time.Duration, calls int) time.Duration {
+		waves := (calls + *concurrency - 1) / *concurrency
+		return time.Duration(waves) * latency
+	}
+	compositeCalls := (fields + sfclient.CompositeBatchMax - 1) / sfclient.CompositeBatchMax
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Deleted fields\t%d\n", fields)
+	fmt.Fprintf(w, "CLI spawn overhead\t%s\n", spawn.Round(time.Millisecond))
+	fmt.Fprintf(w, "CLI query latency\t%s\n", cliQuery.Round(time.Millisecond))
+	fmt.Fprintf(w, "REST query latency\t%s\n", restQuery.Round(time.Millisecond))
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "MODE\tAPI CALLS\tEST. DURATION\n")
+	fmt.Fprintf(w, "default (concurrency %d)\t%d\t%s\n", *concurrency, fields+1, perWave(cliQuery, fields).Round(100*time.Millisecond))
+	fmt.Fprintf(w, "--composite\t%d\t%s\n", compositeCalls+2, (time.Duration(fields) * restQuery).Round(100*time.Millisecond))
+	fmt.Fprintf(w, "--approx-counts\t%d\t%s\n", 3, restQuery.Round(100*time.Millisecond))
+	fmt.Fprintf(w, "--no-counts\t%d\t%s\n", 1, cliQuery.Round(100*time.Millisecond))
+	w.Flush()
+}
+
+// averageDuration times fn samples times and returns the mean, aborting on
+// the first failure.
+func averageDuration(samples int, fn func() error) time.Duration {
+	var total time.Duration
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		if err := fn(); err != nil {
+			fatal("Benchmark failed", "error", err)
+		}
+		total += time.Since(start)
+	}
+	return total / time.Duration(samples)
+}
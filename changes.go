@@ -0,0 +1,71 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// previousRun returns the records of org's latest run in its export, read
+// before this run's export replaces them, for --changes-only. An org never
+// exported before has none.
+func previousRun(org string, cfg scanConfig) ([]export.DeleteCountRecord, error) {
+	path := cfg.exportPath(org)
+	if cfg.layout != nil {
+		path = cfg.layout.latestExport(org)
+	}
+	if path == "" || path == export.Stdout {
+		return nil, nil
+	}
+
+	history, err := cfg.cipher.read(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []export.DeleteCountRecord
+	for _, record := range history.Results {
+		if record.Org == "" || record.Org == redact.Apply(org) {
+			records = append(records, record)
+		}
+	}
+	return export.LatestRunRecords(records), nil
+}
+
+// carryForward returns a run's records with the previous run's records of
+// the fields an incremental scan skipped as confirmed empty added back, so
+// that fields it did not count again compare as unchanged rather than gone.
+func carryForward(previous, records []export.DeleteCountRecord, skipped []string) []export.DeleteCountRecord {
+	if len(skipped) == 0 {
+		return records
+	}
+	carried := slices.Clone(records)
+	for _, record := range previous {
+		if slices.Contains(skipped, export.FieldKey(record.QualifiedApiName, record.DeveloperName)) {
+			carried = append(carried, record)
+		}
+	}
+	return carried
+}
+
+// changedSince reports whether a run found different deleted fields than
+// the previous one, or counted different records on them.
+func changedSince(previous, records []export.DeleteCountRecord) bool {
+	return !maps.Equal(runCounts(previous), runCounts(records))
+}
+
+// runCounts maps each of a run's fields to its count, or to "-" when it
+// was not counted.
+func runCounts(records []export.DeleteCountRecord) map[string]string {
+	counts := make(map[string]string, len(records))
+	for _, record := range records {
+		count := "-"
+		if !record.CountSkipped {
+			count = strconv.Itoa(record.Count)
+		}
+		counts[export.FieldKey(record.QualifiedApiName, record.DeveloperName)] = count
+	}
+	return counts
+}
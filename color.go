@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	ansiReset  = "\033[0m"
+	ansiBold   = "\033[1m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiGray   = "\033[90m"
+)
+
+// palette wraps text in ANSI colors when enabled.
+type palette struct {
+	enabled bool
+}
+
+// stdoutPalette colors human-facing reports written to stdout.
+var stdoutPalette palette
+
+// colorAllowed reports whether f should receive ANSI colors: it must be a
+// terminal, and neither --no-color nor NO_COLOR may be set.
+func colorAllowed(f *os.File, noColor bool) bool {
+	if noColor {
+		return false
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return isTerminal(f)
+}
+
+func (p palette) paint(code, s string) string {
+	if !p.enabled || s == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+func (p palette) bold(s string) string   { return p.paint(ansiBold, s) }
+func (p palette) red(s string) string    { return p.paint(ansiRed, s) }
+func (p palette) green(s string) string  { return p.paint(ansiGreen, s) }
+func (p palette) yellow(s string) string { return p.paint(ansiYellow, s) }
+
+// colorLogLine colors a text-format log line by its level.
+func (p palette) colorLogLine(line string) string {
+	switch {
+	case strings.Contains(line, " level=ERROR "):
+		return p.red(line)
+	case strings.Contains(line, " level=WARN "):
+		return p.yellow(line)
+	case strings.Contains(line, " level=DEBUG "):
+		return p.paint(ansiGray, line)
+	}
+	return line
+}
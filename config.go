@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/notify"
+)
+
+const configFileName = "sf-deleted-fields.yaml"
+
+// config is the optional YAML configuration file for settings that do not
+// fit on a command line.
+type config struct {
+	Notifiers []notify.Config `yaml:"notifiers"`
+	Hooks     hookConfig      `yaml:"hooks"`
+	Enrichers []enricher      `yaml:"enrichers"`
+	Telemetry telemetryConfig `yaml:"telemetry"`
+	Audit     auditConfig     `yaml:"audit"`
+
+	OpenTelemetry otelConfig `yaml:"opentelemetry"`
+
+	Profiles map[string]exportProfile `yaml:"profiles"`
+
+	// Normalize folds the names of fields deleted more than once into one
+	// logical field in reports and history.
+	Normalize []export.NameRule `yaml:"normalize"`
+
+	// Owners route each object's cleanup to its owning team in reports
+	// and notifications.
+	Owners ownerRules `yaml:"owners"`
+
+	Signing signingConfig `yaml:"signing"`
+
+	// CountFilters restrict objects' counts with a WHERE clause, e.g.
+	// "IsArchived__c = false", so records nobody acts on are not counted.
+	CountFilters countFilters `yaml:"count_filters"`
+}
+
+// countFilters maps object API names to the WHERE clause, without the
+// WHERE, their count is restricted to.
+type countFilters map[string]string
+
+func (f countFilters) check() error {
+	for object, filter := range f {
+		if strings.TrimSpace(filter) == "" {
+			return fmt.Errorf("count filter for %s is empty", object)
+		}
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(filter)), "WHERE ") {
+			return fmt.Errorf("count filter for %s must leave out the WHERE", object)
+		}
+	}
+	return nil
+}
+
+// defaultConfigPaths are searched in order when --config is not given.
+func defaultConfigPaths() []string {
+	paths := []string{configFileName}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "sf-deleted-fields", "config.yaml"))
+	}
+	return paths
+}
+
+// loadConfig reads the configuration at path, or from the first default
+// location that exists when path is empty. A missing default file yields
+// an empty configuration; unknown keys are rejected so typos do not go
+// unnoticed.
+func loadConfig(path string) (config, string, error) {
+	var cfg config
+
+	candidates := defaultConfigPaths()
+	if path != "" {
+		candidates = []string{path}
+	}
+
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate)
+		if errors.Is(err, os.ErrNotExist) && path == "" {
+			continue
+		}
+		if err != nil {
+			return cfg, candidate, fmt.Errorf("failed to read config: %w", err)
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && err != io.EOF {
+			return cfg, candidate, fmt.Errorf("failed to parse config %s: %w", candidate, err)
+		}
+		return cfg, candidate, nil
+	}
+
+	return cfg, "", nil
+}
+
+// configFlags is the --config of the commands that work on an existing
+// export rather than scan.
+type configFlags struct {
+	path *string
+}
+
+func registerConfigFlags(flags *flag.FlagSet) *configFlags {
+	return &configFlags{
+		path: flags.String("config", "", "YAML configuration file (default ./"+configFileName+", then the user config directory)"),
+	}
+}
+
+// apply loads the configuration, installs its normalize rules and returns
+// it.
+func (f *configFlags) apply() config {
+	settings, _, err := loadConfig(*f.path)
+	if err != nil {
+		fatal("Failed to load configuration", "error", err)
+	}
+	if err := export.SetNameRules(settings.Normalize); err != nil {
+		fatal("Invalid normalize configuration", "error", err)
+	}
+	if err := settings.Owners.check(); err != nil {
+		fatal("Invalid owners configuration", "error", err)
+	}
+	if err := settings.CountFilters.check(); err != nil {
+		fatal("Invalid count_filters configuration", "error", err)
+	}
+	return settings
+}
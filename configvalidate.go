@@ -0,0 +1,336 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/notify"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+// configCheckTimeout bounds each connection config validate opens.
+const configCheckTimeout = 5 * time.Second
+
+// configCommands are the subcommands of `config`.
+var configCommands = map[string]func(args []string){
+	"validate": runConfigValidate,
+}
+
+func runConfig(args []string) {
+	if len(args) == 0 || configCommands[args[0]] == nil {
+		names := make([]string, 0, len(configCommands))
+		for name := range configCommands {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		fmt.Fprintf(os.Stderr, "Usage: sf-deleted-fields config <%s> [flags]\n", strings.Join(names, "|"))
+		os.Exit(2)
+	}
+	configCommands[args[0]](args[1:])
+}
+
+// configProblem is one thing config validate found wrong, in the file or
+// setting named by Source.
+type configProblem struct {
+	Source string
+	Err    error
+}
+
+// configValidation collects every problem instead of stopping at the first,
+// so a single run lists all there is to fix.
+type configValidation struct {
+	offline  bool
+	problems []configProblem
+}
+
+func (v *configValidation) add(source string, err error) {
+	if err != nil {
+		v.problems = append(v.problems, configProblem{Source: source, Err: err})
+	}
+}
+
+// runConfigValidate checks the configuration file, org registry, query
+// overrides and export a scheduled scan would use, and every endpoint and
+// credential they name, reporting all problems at once so they are found
+// before the scan runs rather than when it fails partway.
+func runConfigValidate(args []string) {
+	flags := flag.NewFlagSet("config validate", flag.ExitOnError)
+	configPath := flags.String("config", "", "YAML configuration file (default ./"+configFileName+", then the user config directory)")
+	orgsFile := flags.String("orgs-file", "", "Org registry file (default ./"+registryFileName+", then the user config directory)")
+	queriesDir := flags.String("queries-dir", "", "Directory of .soql files overriding the built-in queries, as given to the scan")
+	exportFile := flags.String("export", "", "Export file or postgres:// URL the scan writes to, to check it can be written")
+	offline := flags.Bool("offline", false, "Do not connect to webhooks, SMTP servers, collectors or the export database; only check the settings themselves")
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+
+	v := &configValidation{offline: *offline}
+	v.checkConfig(*configPath)
+	v.checkRegistry(*orgsFile)
+	if *queriesDir != "" {
+		v.checkQueries("--queries-dir", *queriesDir)
+	}
+	if *exportFile != "" {
+		v.checkExport(*exportFile)
+	}
+
+	if failed := writeConfigProblems(stdout, v.problems); failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func (v *configValidation) checkConfig(path string) {
+	settings, settingsPath, err := loadConfig(path)
+	if err != nil {
+		v.add(cmp.Or(settingsPath, "config"), err)
+		return
+	}
+	if settingsPath == "" {
+		fmt.Fprintln(stdout, "No configuration file found")
+		return
+	}
+	source := settingsPath
+
+	v.add(source+": normalize", export.SetNameRules(settings.Normalize))
+	v.add(source+": owners", settings.Owners.check())
+	v.add(source+": count_filters", settings.CountFilters.check())
+	v.add(source+": enrichers", checkEnrichers(settings.Enrichers))
+
+	names := make([]string, 0, len(settings.Profiles))
+	for name := range settings.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, err := selectProfile(name, settings.Profiles)
+		v.add(source+": profiles", err)
+	}
+
+	for i, cfg := range settings.Notifiers {
+		where := fmt.Sprintf("%s: notifier %d", source, i+1)
+		if cfg.Name != "" {
+			where = fmt.Sprintf("%s: notifier %s", source, cfg.Name)
+		}
+		v.checkNotifier(where, cfg)
+	}
+
+	if settings.Telemetry.Enabled && settings.Telemetry.Endpoint != "" {
+		v.checkEndpoint(source+": telemetry", settings.Telemetry.Endpoint)
+	}
+	if settings.OpenTelemetry.Endpoint != "" {
+		v.checkEndpoint(source+": opentelemetry", settings.OpenTelemetry.Endpoint)
+	}
+
+	if settings.Audit.File != "" {
+		v.add(source+": audit", checkDir(filepath.Dir(settings.Audit.File)))
+	}
+
+	if settings.Signing.Key != "" {
+		_, err := loadSigningKey(settings.Signing.Key)
+		v.add(source+": signing", err)
+	}
+	if settings.Signing.PublicKey != "" {
+		_, err := loadVerifyKey(settings.Signing.PublicKey)
+		v.add(source+": signing", err)
+	}
+}
+
+// checkNotifier builds the notifier as a scan would, then checks the
+// endpoint it sends to.
+func (v *configValidation) checkNotifier(source string, cfg notify.Config) {
+	for _, value := range append([]string{cfg.URL, cfg.SMTPHost, cfg.Username, cfg.Password, cfg.From}, cfg.To...) {
+		v.add(source, checkEnvRefs(value))
+	}
+	if _, err := notify.New(cfg); err != nil {
+		v.add(source, err)
+		return
+	}
+
+	if strings.EqualFold(cfg.Type, "email") {
+		if os.ExpandEnv(cfg.Username) != "" && os.ExpandEnv(cfg.Password) == "" {
+			v.add(source, errors.New("username is set but password is empty"))
+		}
+		port := cfg.SMTPPort
+		if port == 0 {
+			port = 587
+		}
+		if !v.offline {
+			v.add(source, dialCheck(net.JoinHostPort(os.ExpandEnv(cfg.SMTPHost), strconv.Itoa(port))))
+		}
+		return
+	}
+	v.checkEndpoint(source, cfg.URL)
+}
+
+// checkEndpoint checks that raw, after expanding environment variables, is
+// an absolute http or https URL and, unless offline, that its host accepts
+// connections. Nothing is sent to it.
+func (v *configValidation) checkEndpoint(source, raw string) {
+	if err := checkEnvRefs(raw); err != nil {
+		v.add(source, err)
+		return
+	}
+	endpoint, err := url.Parse(os.ExpandEnv(raw))
+	if err != nil {
+		v.add(source, fmt.Errorf("invalid URL: %w", err))
+		return
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		v.add(source, fmt.Errorf("URL %s must use http or https", endpoint.Redacted()))
+		return
+	}
+	if endpoint.Host == "" {
+		v.add(source, fmt.Errorf("URL %s has no host", endpoint.Redacted()))
+		return
+	}
+	if v.offline {
+		return
+	}
+	port := endpoint.Port()
+	if port == "" {
+		port = "443"
+		if endpoint.Scheme == "http" {
+			port = "80"
+		}
+	}
+	v.add(source, dialCheck(net.JoinHostPort(endpoint.Hostname(), port)))
+}
+
+func (v *configValidation) checkRegistry(path string) {
+	registry, registryPath, err := loadRegistry(path)
+	if err != nil {
+		v.add(cmp.Or(registryPath, "org registry"), err)
+		return
+	}
+	if registryPath == "" {
+		fmt.Fprintln(stdout, "No org registry found")
+		return
+	}
+
+	orgs := make([]string, 0, len(registry.Orgs))
+	for org := range registry.Orgs {
+		orgs = append(orgs, org)
+	}
+	sort.Strings(orgs)
+	for _, org := range orgs {
+		settings := registry.Orgs[org]
+		source := fmt.Sprintf("%s: org %s", registryPath, org)
+		if settings.Concurrency != nil && *settings.Concurrency < 0 {
+			v.add(source, fmt.Errorf("concurrency cannot be negative: %d", *settings.Concurrency))
+		}
+		if settings.Pattern != nil && strings.TrimSpace(*settings.Pattern) == "" {
+			v.add(source, errors.New("pattern is empty"))
+		}
+		if settings.QueriesDir != nil {
+			v.checkQueries(source+": queries_dir", *settings.QueriesDir)
+		}
+	}
+
+	groups := make([]string, 0, len(registry.Groups))
+	for group := range registry.Groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		source := fmt.Sprintf("%s: group %s", registryPath, group)
+		if len(registry.Groups[group]) == 0 {
+			v.add(source, errors.New("group has no orgs"))
+		}
+		for _, org := range registry.Groups[group] {
+			if strings.TrimSpace(org) == "" {
+				v.add(source, errors.New("group lists an empty org alias"))
+			}
+		}
+	}
+}
+
+func (v *configValidation) checkQueries(source, dir string) {
+	for _, err := range scanner.CheckQueryOverrides(dir) {
+		v.add(source, err)
+	}
+}
+
+// checkExport checks the export's database accepts the credentials in its
+// URL or, for a file, that its directory exists.
+func (v *configValidation) checkExport(target string) {
+	if target == export.Stdout {
+		return
+	}
+	if !export.IsPostgres(target) {
+		v.add("--export", checkDir(filepath.Dir(target)))
+		return
+	}
+	if v.offline {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), configCheckTimeout)
+	defer cancel()
+	v.add("--export", export.CheckPostgres(ctx, target))
+}
+
+// checkEnvRefs reports environment variables value refers to as ${NAME}
+// that are not set, which would otherwise expand to nothing.
+func checkEnvRefs(value string) error {
+	var missing []string
+	os.Expand(value, func(name string) string {
+		if _, ok := os.LookupEnv(name); !ok && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+		return ""
+	})
+	if len(missing) > 0 {
+		return fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func checkDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+func dialCheck(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, configCheckTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot connect: %w", err)
+	}
+	return conn.Close()
+}
+
+// writeConfigProblems prints the problems, or that there are none, and
+// returns how many there are.
+func writeConfigProblems(w io.Writer, problems []configProblem) int {
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "Configuration is valid")
+		return 0
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tPROBLEM")
+	for _, problem := range problems {
+		fmt.Fprintf(tw, "%s\t%s\n", problem.Source, problem.Err)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "%d problems found\n", len(problems))
+	return len(problems)
+}
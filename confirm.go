@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// errNotConfirmed is returned when a mutating command needs confirmation but
+// cannot ask for it.
+var errNotConfirmed = errors.New("refusing to make changes without confirmation; rerun with --yes or --dry-run")
+
+// errProduction is returned when a mutating command targets a production
+// org, or one whose environment is unknown, without --allow-production.
+var errProduction = errors.New("refusing to change a production org; rerun with --allow-production")
+
+// plannedChange is one change a mutating command is about to make.
+type plannedChange struct {
+	Action string
+	Target string
+	Detail string
+}
+
+// confirmFlags are shared by every subcommand that changes an org or
+// deletes data, so they all preview and confirm the same way.
+type confirmFlags struct {
+	yes             *bool
+	dryRun          *bool
+	allowProduction *bool
+}
+
+func registerConfirmFlags(flags *flag.FlagSet) *confirmFlags {
+	return &confirmFlags{
+		yes:             flags.Bool("yes", false, "Apply changes without asking for confirmation"),
+		dryRun:          flags.Bool("dry-run", false, "Show what would change without changing anything"),
+		allowProduction: flags.Bool("allow-production", false, "Allow changes to production orgs"),
+	}
+}
+
+// guardProduction refuses to let a mutating command change a production
+// org unless --allow-production is set. An org whose environment could not
+// be determined counts as production. Dry runs change nothing and always
+// pass.
+func (f *confirmFlags) guardProduction(org string, environment sfclient.Environment) error {
+	if *f.dryRun || *f.allowProduction || environment == sfclient.Sandbox || environment == sfclient.Scratch {
+		return nil
+	}
+	return fmt.Errorf("%s is %s: %w", org, environment, errProduction)
+}
+
+// confirm prints the planned changes and reports whether the command should
+// go ahead. Dry runs never proceed; --yes always does; otherwise the user is
+// asked on the terminal, and non-interactive runs are refused.
+func (f *confirmFlags) confirm(title string, changes []plannedChange) (bool, error) {
+	return f.confirmWith(stdout, os.Stdin, isTerminal(os.Stdin), title, changes)
+}
+
+func (f *confirmFlags) confirmWith(w io.Writer, in io.Reader, interactive bool, title string, changes []plannedChange) (bool, error) {
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "%s: nothing to do\n", title)
+		return false, nil
+	}
+
+	fmt.Fprintf(w, "%s (%d changes):\n", stdoutPalette.bold(title), len(changes))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  ACTION\tTARGET\tDETAIL")
+	for _, change := range changes {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", change.Action, change.Target, change.Detail)
+	}
+	tw.Flush()
+
+	if *f.dryRun {
+		fmt.Fprintln(w, stdoutPalette.yellow("Dry run: no changes were made."))
+		return false, nil
+	}
+
+	if *f.yes {
+		return true, nil
+	}
+
+	if !interactive {
+		return false, errNotConfirmed
+	}
+
+	fmt.Fprint(w, "Proceed? [y/N] ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read confirmation: %w", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	fmt.Fprintln(w, "Aborted.")
+	return false, nil
+}
+
+// budgetPromptMu keeps the orgs scanned side by side from asking at once.
+var budgetPromptMu sync.Mutex
+
+// confirmOverBudget asks on the terminal whether a scan estimated to exceed
+// --max-api-calls should go ahead. Non-interactive runs never do.
+func confirmOverBudget(org string, estimate scanner.Estimate) bool {
+	if !isTerminal(os.Stdin) {
+		return false
+	}
+
+	budgetPromptMu.Lock()
+	defer budgetPromptMu.Unlock()
+
+	stderrConsole.clearStatus()
+	fmt.Fprintf(os.Stderr, "%s has %d deleted fields; scanning needs about %d API calls, over --max-api-calls. Proceed? [y/N] ",
+		redact.Apply(org), estimate.DeletedFields, estimate.Total)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
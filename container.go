@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// containerDefaults are the flags --container implies unless they are set
+// explicitly: structured logs and nothing drawn for a terminal.
+var containerDefaults = map[string]string{
+	"log-format":  "json",
+	"no-progress": "true",
+	"no-color":    "true",
+}
+
+// applyContainerDefaults sets the flags --container implies that the
+// command line left alone.
+func applyContainerDefaults(flags *flag.FlagSet) {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, value := range containerDefaults {
+		if !set[name] {
+			flags.Set(name, value)
+		}
+	}
+}
+
+// containerAuth reads the SFDX auth URL --container authenticates with
+// from authFile, or else from the environment, and registers it for org,
+// which defaults to the first label of the instance's host name, e.g. acme
+// for acme.my.salesforce.com. A refresh token Salesforce rotates is saved
+// back to authFile, so the next scheduled run can still log in.
+func containerAuth(envName, authFile, org string) (string, error) {
+	source := "$" + envName
+	value := os.Getenv(envName)
+	if authFile != "" {
+		data, err := os.ReadFile(authFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read auth URL: %w", err)
+		}
+		source, value = authFile, string(data)
+	}
+	if value == "" {
+		return "", fmt.Errorf("%s is empty; export the org's auth URL from sf org display --verbose", source)
+	}
+	auth, err := sfclient.ParseAuthUrl(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", source, err)
+	}
+	if authFile != "" {
+		auth.Persist = func(auth sfclient.AuthUrl) error {
+			return writeAuthUrlFile(authFile, auth)
+		}
+	}
+
+	if org == "" {
+		instance, err := url.Parse(auth.InstanceUrl)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", source, err)
+		}
+		org, _, _ = strings.Cut(instance.Hostname(), ".")
+	}
+	sfclient.UseAuthUrl(org, auth)
+	return org, nil
+}
+
+// writeAuthUrlFile replaces path with auth's URL atomically, so a run
+// killed halfway never leaves it without a working refresh token.
+func writeAuthUrlFile(path string, auth sfclient.AuthUrl) error {
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(auth.URL() + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkContainerExport makes sure a container run writes its export where
+// it outlives the container: standard output, or an absolute path in a
+// directory that already exists because a volume is mounted there. A
+// relative path would be checked against the working directory, which
+// always exists, whether or not anything is mounted on it.
+func checkContainerExport(path string) error {
+	if path == "" {
+		return fmt.Errorf("--container needs --export: a path on a mounted volume, or %s for standard output", export.Stdout)
+	}
+	if path == export.Stdout {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("--export %s is relative; give its absolute path on the mounted volume, or use --export %s", path, export.Stdout)
+	}
+	dir := filepath.Dir(path)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("export directory %s does not exist; mount a volume there or use --export %s", dir, export.Stdout)
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"text/template"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// digestReport is the document `report digest` writes: what changed in
+// each org over one period, compared with the end of the period before.
+type digestReport struct {
+	Title string
+	Unit  string
+	Start string
+	End   string
+	Orgs  []digestOrg
+}
+
+// digestOrg compares an org's last run in the period with its last run
+// before it.
+type digestOrg struct {
+	Org  string
+	Runs int
+
+	// Compared is false when no run predates the period, in which case
+	// every field counts as new.
+	Compared        bool
+	DeletedFields   int
+	FieldsChange    int
+	ResidualRecords int
+	RecordsChange   int
+
+	New      []digestField
+	Resolved []digestField
+	Movers   []digestMover
+}
+
+type digestField struct {
+	Object  string
+	Field   string
+	Label   string
+	Records int
+	Counted bool
+}
+
+// digestMover is an object whose residual records changed over the
+// period.
+type digestMover struct {
+	Object   string
+	Label    string
+	Previous int
+	Current  int
+	Change   int
+}
+
+// digestState is what an org's run found: its fields and the residual
+// records of each object.
+type digestState struct {
+	Fields  map[string]export.DeleteCountRecord
+	Objects map[string]int
+	Labels  map[string]string
+}
+
+// runReportDigest aggregates the export's daily history into a weekly or
+// monthly summary of new fields, resolved fields and the objects whose
+// residual records moved most, laid out for a recurring stakeholder
+// email. The html format uses inline styles and tables only, which mail
+// clients keep.
+func runReportDigest(args []string) {
+	flags := flag.NewFlagSet("report digest", flag.ExitOnError)
+	exportFile := flags.String("export", "deleted_fields.json", "Export file to report on")
+	period := flags.String("period", "weekly", "Period to summarize: weekly or monthly")
+	at := flags.String("at", "", "Date in the period to summarize, as YYYY-MM-DD (default the latest run's)")
+	output := flags.String("o", "", "File to write the digest to (default standard output)")
+	format := flags.String("format", "text", "Output format: text, markdown or html")
+	top := flags.Int("top", 10, "Number of biggest movers to list per org")
+	org := flags.String("org", "", "Org alias for records that do not name theirs")
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+	settings.apply()
+
+	if *period != "weekly" && *period != "monthly" {
+		fatal("Invalid --period: use weekly or monthly", "period", *period)
+	}
+	if *format != "text" && *format != "markdown" && *format != "html" {
+		fatal("Invalid --format: use text, markdown or html", "format", *format)
+	}
+
+	exportData, err := export.Read(*exportFile)
+	if err != nil {
+		fatal("Failed to read export", "file", *exportFile, "error", err)
+	}
+	runs := feedRuns(exportData.Results, *org)
+	if len(runs) == 0 {
+		fatal("Export has no results to report on", "file", *exportFile)
+	}
+
+	day := runs[len(runs)-1].Updated
+	if *at != "" {
+		if day, err = time.ParseInLocation("2006-01-02", *at, time.Local); err != nil {
+			fatal("Invalid --at: use YYYY-MM-DD", "at", *at)
+		}
+	}
+	report := buildDigest(runs, *period, day, max(*top, 0))
+	if len(report.Orgs) == 0 {
+		fatal("Export has no runs in the period", "file", *exportFile, "start", report.Start, "end", report.End)
+	}
+
+	w := stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fatal("Failed to create digest", "file", *output, "error", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := writeDigest(w, report, *format); err != nil {
+		fatal("Failed to write digest", "error", err)
+	}
+}
+
+// periodStart returns the start of the week, from Monday, or month holding
+// day.
+func periodStart(day time.Time, period string) time.Time {
+	y, m, d := day.Date()
+	if period == "monthly" {
+		return time.Date(y, m, 1, 0, 0, 0, 0, day.Location())
+	}
+	start := time.Date(y, m, d, 0, 0, 0, 0, day.Location())
+	return start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+}
+
+func buildDigest(runs []feedRun, period string, day time.Time, top int) digestReport {
+	start := periodStart(day, period)
+	report := digestReport{Title: "Weekly deleted fields digest", Unit: "week"}
+	end := start.AddDate(0, 0, 7)
+	if period == "monthly" {
+		report.Title, report.Unit = "Monthly deleted fields digest", "month"
+		end = start.AddDate(0, 1, 0)
+	}
+	report.Start, report.End = start.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02")
+
+	var orgs []string
+	byOrg := make(map[string][]feedRun)
+	for _, run := range runs {
+		if _, ok := byOrg[run.Org]; !ok {
+			orgs = append(orgs, run.Org)
+		}
+		byOrg[run.Org] = append(byOrg[run.Org], run)
+	}
+	slices.Sort(orgs)
+
+	for _, org := range orgs {
+		var current, before *feedRun
+		runsInPeriod := 0
+		for _, run := range byOrg[org] {
+			switch {
+			case run.Updated.Before(start):
+				before = &run
+			case run.Updated.Before(end):
+				current = &run
+				runsInPeriod++
+			}
+		}
+		if current == nil {
+			continue
+		}
+
+		now := newDigestState(current.Records)
+		var then digestState
+		if before != nil {
+			then = newDigestState(before.Records)
+		}
+		entry := digestOrg{
+			Org:             cmp.Or(org, "(unnamed org)"),
+			Runs:            runsInPeriod,
+			Compared:        before != nil,
+			DeletedFields:   len(now.Fields),
+			FieldsChange:    len(now.Fields) - len(then.Fields),
+			ResidualRecords: now.residual(),
+			RecordsChange:   now.residual() - then.residual(),
+		}
+		for key, record := range now.Fields {
+			if _, ok := then.Fields[key]; !ok {
+				entry.New = append(entry.New, newDigestField(record))
+			}
+		}
+		for key, record := range then.Fields {
+			if _, ok := now.Fields[key]; !ok {
+				entry.Resolved = append(entry.Resolved, newDigestField(record))
+			}
+		}
+		sortFields := func(a, b digestField) int {
+			return cmp.Or(cmp.Compare(b.Records, a.Records), cmp.Compare(a.Object, b.Object), cmp.Compare(a.Field, b.Field))
+		}
+		slices.SortFunc(entry.New, sortFields)
+		slices.SortFunc(entry.Resolved, sortFields)
+
+		if entry.Compared {
+			for object := range mergeKeys(now.Objects, then.Objects) {
+				change := now.Objects[object] - then.Objects[object]
+				if change == 0 {
+					continue
+				}
+				entry.Movers = append(entry.Movers, digestMover{
+					Object:   object,
+					Label:    cmp.Or(now.Labels[object], then.Labels[object]),
+					Previous: then.Objects[object],
+					Current:  now.Objects[object],
+					Change:   change,
+				})
+			}
+			slices.SortFunc(entry.Movers, func(a, b digestMover) int {
+				return cmp.Or(cmp.Compare(abs(b.Change), abs(a.Change)), cmp.Compare(a.Object, b.Object))
+			})
+			entry.Movers = entry.Movers[:min(top, len(entry.Movers))]
+		}
+		report.Orgs = append(report.Orgs, entry)
+	}
+	return report
+}
+
+func newDigestState(records []export.DeleteCountRecord) digestState {
+	state := digestState{
+		Fields:  make(map[string]export.DeleteCountRecord),
+		Objects: make(map[string]int),
+		Labels:  make(map[string]string),
+	}
+	for _, record := range records {
+		state.Fields[export.FieldIdentity(record.QualifiedApiName, record.DeveloperName)] = record
+		if record.ObjectLabel != "" {
+			state.Labels[record.QualifiedApiName] = record.ObjectLabel
+		}
+		if !record.CountSkipped {
+			state.Objects[record.QualifiedApiName] = max(state.Objects[record.QualifiedApiName], record.Count)
+		}
+	}
+	return state
+}
+
+func (s digestState) residual() int {
+	residual := 0
+	for _, count := range s.Objects {
+		residual += count
+	}
+	return residual
+}
+
+func newDigestField(record export.DeleteCountRecord) digestField {
+	return digestField{
+		Object:  record.QualifiedApiName,
+		Field:   export.LogicalName(record.DeveloperName),
+		Label:   record.FieldLabel,
+		Records: record.Count,
+		Counted: !record.CountSkipped,
+	}
+}
+
+func mergeKeys(maps ...map[string]int) map[string]bool {
+	keys := make(map[string]bool)
+	for _, m := range maps {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// signed renders a change with its sign, e.g. +3 or -120.
+func signed(n int) string {
+	if n > 0 {
+		return "+" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
+
+const digestText = `{{.Title}}, {{.Start}} to {{.End}}
+{{range .Orgs}}
+{{.Org}}
+  {{.DeletedFields}} deleted fields{{if .Compared}} ({{signed .FieldsChange}}){{end}}, {{.ResidualRecords}} residual records{{if .Compared}} ({{signed .RecordsChange}}){{end}}, {{.Runs}} run(s) this {{$.Unit}}.
+{{- if not .Compared}}
+  No run before {{$.Start}} to compare with, so every field is listed as new.
+{{- end}}
+
+  New fields: {{len .New}}
+{{- range .New}}
+    - {{.Object}}.{{.Field}}{{if .Label}} ({{.Label}}){{end}}: {{if .Counted}}{{.Records}} records{{else}}not counted{{end}}
+{{- end}}
+
+  Resolved fields: {{len .Resolved}}
+{{- range .Resolved}}
+    - {{.Object}}.{{.Field}}{{if .Label}} ({{.Label}}){{end}}
+{{- end}}
+{{- if .Compared}}
+
+  Biggest movers:{{if not .Movers}} none{{end}}
+{{- range .Movers}}
+    - {{.Object}}{{if .Label}} ({{.Label}}){{end}}: {{.Previous}} -> {{.Current}} records ({{signed .Change}})
+{{- end}}
+{{- end}}
+{{end}}`
+
+const digestMarkdown = `# {{.Title}}
+
+{{.Start}} to {{.End}}
+{{range .Orgs}}
+## {{.Org}}
+
+**{{.DeletedFields}}** deleted fields{{if .Compared}} ({{signed .FieldsChange}}){{end}}, **{{.ResidualRecords}}** residual records{{if .Compared}} ({{signed .RecordsChange}}){{end}}, {{.Runs}} run(s) this {{$.Unit}}.
+{{- if not .Compared}} No run before {{$.Start}} to compare with, so every field is listed as new.{{end}}
+
+### New fields ({{len .New}})
+{{if .New}}
+| Field | Label | Records |
+|---|---|--:|
+{{range .New}}| {{cell .Object}}.{{cell .Field}} | {{cell .Label}} | {{if .Counted}}{{.Records}}{{else}}not counted{{end}} |
+{{end}}{{else}}
+None.
+{{end}}
+### Resolved fields ({{len .Resolved}})
+{{if .Resolved}}
+| Field | Label |
+|---|---|
+{{range .Resolved}}| {{cell .Object}}.{{cell .Field}} | {{cell .Label}} |
+{{end}}{{else}}
+None.
+{{end}}
+{{- if .Compared}}
+### Biggest movers
+{{if .Movers}}
+| Object | Label | Before | Now | Change |
+|---|---|--:|--:|--:|
+{{range .Movers}}| {{cell .Object}} | {{cell .Label}} | {{.Previous}} | {{.Current}} | {{signed .Change}} |
+{{end}}{{else}}
+None.
+{{end}}
+{{- end}}
+{{- end}}`
+
+// digestHTML keeps to what mail clients render: tables, inline styles and
+// no external resources.
+const digestHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body style="margin:0;padding:16px;font-family:Arial,Helvetica,sans-serif;font-size:14px;color:#222;">
+<table role="presentation" width="100%" cellpadding="0" cellspacing="0" border="0" style="max-width:640px;">
+<tr><td>
+<h1 style="font-size:20px;margin:0 0 4px 0;">{{.Title}}</h1>
+<p style="margin:0 0 16px 0;color:#666;">{{.Start}} to {{.End}}</p>
+{{range .Orgs}}
+<h2 style="font-size:16px;margin:24px 0 8px 0;border-bottom:1px solid #ddd;">{{.Org}}</h2>
+<p style="margin:0 0 8px 0;"><strong>{{.DeletedFields}}</strong> deleted fields{{if .Compared}} ({{signed .FieldsChange}}){{end}}, <strong>{{.ResidualRecords}}</strong> residual records{{if .Compared}} ({{signed .RecordsChange}}){{end}}, {{.Runs}} run(s) this {{$.Unit}}.</p>
+{{if not .Compared}}<p style="margin:0 0 8px 0;color:#666;">No run before {{$.Start}} to compare with, so every field is listed as new.</p>{{end}}
+<h3 style="font-size:14px;margin:16px 0 4px 0;">New fields ({{len .New}})</h3>
+{{if .New}}<table cellpadding="4" cellspacing="0" border="1" style="border-collapse:collapse;border-color:#ccc;">
+<tr style="background:#f4f4f4;"><th align="left">Field</th><th align="left">Label</th><th align="right">Records</th></tr>
+{{range .New}}<tr><td>{{.Object}}.{{.Field}}</td><td>{{.Label}}</td><td align="right">{{if .Counted}}{{.Records}}{{else}}not counted{{end}}</td></tr>
+{{end}}</table>{{else}}<p style="margin:0;">None.</p>{{end}}
+<h3 style="font-size:14px;margin:16px 0 4px 0;">Resolved fields ({{len .Resolved}})</h3>
+{{if .Resolved}}<table cellpadding="4" cellspacing="0" border="1" style="border-collapse:collapse;border-color:#ccc;">
+<tr style="background:#f4f4f4;"><th align="left">Field</th><th align="left">Label</th></tr>
+{{range .Resolved}}<tr><td>{{.Object}}.{{.Field}}</td><td>{{.Label}}</td></tr>
+{{end}}</table>{{else}}<p style="margin:0;">None.</p>{{end}}
+{{if .Compared}}<h3 style="font-size:14px;margin:16px 0 4px 0;">Biggest movers</h3>
+{{if .Movers}}<table cellpadding="4" cellspacing="0" border="1" style="border-collapse:collapse;border-color:#ccc;">
+<tr style="background:#f4f4f4;"><th align="left">Object</th><th align="left">Label</th><th align="right">Before</th><th align="right">Now</th><th align="right">Change</th></tr>
+{{range .Movers}}<tr><td>{{.Object}}</td><td>{{.Label}}</td><td align="right">{{.Previous}}</td><td align="right">{{.Current}}</td><td align="right" style="color:{{if gt .Change 0}}#b00{{else}}#070{{end}};">{{signed .Change}}</td></tr>
+{{end}}</table>{{else}}<p style="margin:0;">None.</p>{{end}}{{end}}
+{{end}}
+</td></tr>
+</table>
+</body>
+</html>
+`
+
+func writeDigest(w io.Writer, report digestReport, format string) error {
+	switch format {
+	case "html":
+		tmpl := htmltemplate.Must(htmltemplate.New("digest").Funcs(htmltemplate.FuncMap{"signed": signed}).Parse(digestHTML))
+		return tmpl.Execute(w, report)
+	case "markdown":
+		tmpl := template.Must(template.New("digest").Funcs(template.FuncMap{"signed": signed, "cell": markdownCell}).Parse(digestMarkdown))
+		return tmpl.Execute(w, report)
+	}
+	tmpl := template.Must(template.New("digest").Funcs(template.FuncMap{"signed": signed}).Parse(digestText))
+	return tmpl.Execute(w, report)
+}
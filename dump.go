@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/signal"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+// watchProgressDumps logs a progress dump whenever the process receives
+// progressDumpSignals, or when Enter is pressed on an interactive terminal,
+// until done is closed. It is meant for runs that look stuck.
+func watchProgressDumps(scans []*scanner.Scan, done <-chan struct{}) {
+	requests := make(chan struct{}, 1)
+	request := func() {
+		select {
+		case requests <- struct{}{}:
+		default:
+		}
+	}
+
+	if len(progressDumpSignals) > 0 {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, progressDumpSignals...)
+		defer signal.Stop(signals)
+		go func() {
+			for range signals {
+				request()
+			}
+		}()
+	}
+
+	if isTerminal(os.Stdin) && stderrConsole.tty {
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				request()
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-requests:
+			dumpProgress(scans)
+		}
+	}
+}
+
+// dumpProgress logs each org's phase and counters, its worker pool, and every
+// query still in flight with how long it has been running.
+func dumpProgress(scans []*scanner.Scan) {
+	for _, scan := range scans {
+		progress := scan.Progress()
+		args := []any{"phase", progress.Phase, "elapsed", time.Since(progress.Started).Round(time.Second),
+			"deleted_fields", progress.DeletedFields, "resolved", progress.Resolved,
+			"counted", progress.Counted, "failed", progress.Failed, "api_calls", progress.ApiCalls}
+		if progress.Workers > 0 {
+			args = append(args, "workers_busy", progress.WorkersBusy, "workers", progress.Workers, "queued", progress.Queued)
+		}
+
+		log := scan.Logger()
+		log.Info("Progress dump", append(args, "in_flight", len(progress.InFlight))...)
+		for _, query := range progress.InFlight {
+			log.Info("In-flight query", "running", time.Since(query.Started).Round(time.Millisecond), "soql", query.SOQL)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// Windows has no SIGUSR1; progress dumps are only available by pressing
+// Enter on an interactive terminal.
+var progressDumpSignals []os.Signal
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// encryptedSuffix names the age-encrypted export kept in place of the
+// plain one; `age -d` decrypts it for other tools.
+const encryptedSuffix = ".age"
+
+// passphraseEnv holds the passphrase for --encrypt passphrase, so it stays
+// out of the process list and shell history.
+const passphraseEnv = "SF_DELETED_FIELDS_PASSPHRASE"
+
+// exportCipher keeps exports encrypted at rest. The export's history is
+// decrypted to a temporary file, so it can be read and appended to as usual,
+// and encrypted again once written, all under the export's lock.
+type exportCipher struct {
+	recipients []age.Recipient
+	identities []age.Identity
+
+	// trustPlaintext uses a plain export left beside the encrypted one as
+	// the history; see --trust-plaintext.
+	trustPlaintext bool
+}
+
+// newExportCipher encrypts to the comma-separated age recipients in
+// encrypt, or with the passphrase in $SF_DELETED_FIELDS_PASSPHRASE when
+// encrypt is "passphrase". Reading back an export encrypted to recipients
+// takes the identities in identityFile.
+func newExportCipher(encrypt, identityFile string) (*exportCipher, error) {
+	c := &exportCipher{}
+	if encrypt == "passphrase" {
+		passphrase := os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("$%s is not set", passphraseEnv)
+		}
+		recipient, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		c.recipients = []age.Recipient{recipient}
+		c.identities = []age.Identity{identity}
+	} else {
+		for _, value := range strings.Split(encrypt, ",") {
+			recipient, err := age.ParseX25519Recipient(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid recipient %q: %w", value, err)
+			}
+			c.recipients = append(c.recipients, recipient)
+		}
+	}
+
+	if identityFile != "" {
+		file, err := os.Open(identityFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read identities: %w", err)
+		}
+		defer file.Close()
+		identities, err := age.ParseIdentities(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity file %s: %w", identityFile, err)
+		}
+		c.identities = append(c.identities, identities...)
+	}
+	return c, nil
+}
+
+// decrypt returns a copy of path's history, decrypted from path.age into
+// a temporary file beside it readable by the owner only, for the caller to
+// read or write in the export's place and then seal or remove. When there
+// is no history yet the file does not exist. A plain export at path is the
+// history only when there is no encrypted one, as when --encrypt is first
+// given; beside an encrypted export it is left by a run that did not
+// finish, possibly stale or planted, and is refused unless trustPlaintext
+// is set. Callers that write hold the export's lock.
+func (c *exportCipher) decrypt(path string) (string, error) {
+	ext := filepath.Ext(path)
+	tmp, err := os.CreateTemp(filepath.Dir(path), strings.TrimSuffix(filepath.Base(path), ext)+".*.plain"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer tmp.Close()
+
+	_, encryptedErr := os.Stat(path + encryptedSuffix)
+	encrypted := encryptedErr == nil
+	plain, err := os.Open(path)
+	switch {
+	case err == nil && encrypted && !c.trustPlaintext:
+		plain.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("a plain %s was left beside %s by a run that did not finish; remove it, or give --trust-plaintext to use it as the history", path, path+encryptedSuffix)
+	case err == nil:
+		defer plain.Close()
+		if encrypted {
+			slog.Warn("Using the unencrypted export an earlier run left behind", "file", path)
+		}
+		_, err = io.Copy(tmp, plain)
+	case !errors.Is(err, os.ErrNotExist):
+		// The export cannot be read; err is returned below.
+	case !encrypted:
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return tmp.Name(), nil
+	case len(c.identities) == 0:
+		err = errors.New("the export is encrypted; give the --identity to decrypt its history with")
+	default:
+		err = c.decryptTo(tmp, path+encryptedSuffix)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// read reads the export at path, from a decrypted copy of its history when
+// it is kept encrypted. c may be nil, for an export that is not.
+func (c *exportCipher) read(path string) (export.Data, error) {
+	if c == nil {
+		return export.Read(path)
+	}
+	plain, err := c.decrypt(path)
+	if err != nil {
+		return export.Data{}, err
+	}
+	defer os.Remove(plain)
+	return export.Read(plain)
+}
+
+// decryptTo writes the contents of the encrypted file at path to w.
+func (c *exportCipher) decryptTo(w io.Writer, path string) error {
+	encrypted, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer encrypted.Close()
+	plain, err := age.Decrypt(encrypted, c.identities...)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	_, err = io.Copy(w, plain)
+	return err
+}
+
+// seal encrypts plain, the history decrypt returned, to path.age and
+// removes it, along with any plain export at path it was taken from.
+func (c *exportCipher) seal(plain, path string) error {
+	in, err := os.Open(plain)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := path + encryptedSuffix + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	encrypted, err := age.Encrypt(file, c.recipients...)
+	if err == nil {
+		_, err = io.Copy(encrypted, in)
+	}
+	if err == nil {
+		err = encrypted.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+encryptedSuffix)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to encrypt %s: %w", path, err)
+	}
+	in.Close()
+	if err := os.Remove(plain); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
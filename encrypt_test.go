@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestExportCipher(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(t.TempDir(), "identity.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// encrypted and plain are the history kept encrypted and the plain
+		// export beside it; empty means the file does not exist.
+		encrypted, plain string
+		trust            bool
+		want             string
+		wantErr          string
+	}{
+		{name: "no history"},
+		{name: "first encrypted run", plain: "plain history", want: "plain history"},
+		{name: "encrypted history", encrypted: "sealed history", want: "sealed history"},
+		{name: "leftover plaintext", encrypted: "sealed history", plain: "leftover", wantErr: "--trust-plaintext"},
+		{name: "trusted plaintext", encrypted: "sealed history", plain: "leftover", trust: true, want: "leftover"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cipher, err := newExportCipher(identity.Recipient().String(), identityFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cipher.trustPlaintext = tt.trust
+			path := filepath.Join(t.TempDir(), "deleted_fields.json")
+			if tt.encrypted != "" {
+				sealed := path + ".seed"
+				if err := os.WriteFile(sealed, []byte(tt.encrypted), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if err := cipher.seal(sealed, path); err != nil {
+					t.Fatalf("seal: %v", err)
+				}
+			}
+			if tt.plain != "" {
+				if err := os.WriteFile(path, []byte(tt.plain), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			plain, err := cipher.decrypt(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decrypt: got error %v, want one mentioning %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decrypt: %v", err)
+			}
+			if filepath.Dir(plain) != filepath.Dir(path) || plain == path {
+				t.Errorf("history decrypted to %s, want a temporary file beside %s", plain, path)
+			}
+			got, err := os.ReadFile(plain)
+			if tt.want == "" {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("got history %q for an export without one", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got history %q, want %q", got, tt.want)
+			}
+			if info, err := os.Stat(plain); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+				t.Errorf("decrypted history is readable by others: %v", info.Mode())
+			}
+
+			// Sealing it again leaves only the encrypted export.
+			if err := os.WriteFile(plain, append(got, " and more"...), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := cipher.seal(plain, path); err != nil {
+				t.Fatalf("seal: %v", err)
+			}
+			for _, gone := range []string{plain, path} {
+				if _, err := os.Stat(gone); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("%s left behind after sealing", gone)
+				}
+			}
+			again, err := cipher.decrypt(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(again)
+			if got, _ := os.ReadFile(again); string(got) != tt.want+" and more" {
+				t.Errorf("history after sealing is %q, want %q", got, tt.want+" and more")
+			}
+		})
+	}
+}
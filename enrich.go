@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+const defaultEnricherTimeout = 30 * time.Second
+
+// enricher is an external program that adds org-specific context to each
+// record. It reads the record as JSON on stdin and prints a JSON object
+// whose fields are merged into the record's Extra fields; printing nothing
+// adds nothing.
+type enricher struct {
+	Name    string        `yaml:"name"`
+	Command string        `yaml:"command"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// enrichRecords passes every record through each enricher in turn, later
+// enrichers overriding fields set by earlier ones. A failing enricher is
+// logged and leaves the record as it was.
+func enrichRecords(org string, enrichers []enricher, records []export.DeleteCountRecord) []export.DeleteCountRecord {
+	if len(enrichers) == 0 {
+		return records
+	}
+
+	for _, e := range enrichers {
+		start := time.Now()
+		failed := 0
+		for i := range records {
+			extra, err := e.enrich(org, records[i])
+			if err != nil {
+				failed++
+				slog.Warn("Enricher failed", "enricher", e.Name, "org", org, "object", records[i].QualifiedApiName, "field", records[i].DeveloperName, "error", err)
+				continue
+			}
+			if len(extra) == 0 {
+				continue
+			}
+			if records[i].Extra == nil {
+				records[i].Extra = make(map[string]any, len(extra))
+			}
+			for key, value := range extra {
+				records[i].Extra[key] = value
+			}
+		}
+		slog.Debug("Enricher finished", "enricher", e.Name, "org", org, "records", len(records), "failed", failed, "duration", time.Since(start).Round(time.Millisecond))
+	}
+	return records
+}
+
+// enrich runs the enricher for one record and returns the fields it added.
+func (e enricher) enrich(org string, record export.DeleteCountRecord) (map[string]any, error) {
+	input, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = defaultEnricherTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := shellCommand(ctx, e.Command)
+	cmd.Env = append(os.Environ(),
+		"SFDF_ENRICHER="+e.Name,
+		"SFDF_RUN_ID="+runID,
+		"SFDF_ORG="+org,
+	)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderrConsole
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil, nil
+	}
+	var extra map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &extra); err != nil {
+		return nil, fmt.Errorf("output is not a JSON object: %w", err)
+	}
+	return extra, nil
+}
+
+// checkEnrichers rejects enrichers without a command and names unnamed
+// ones after their command.
+func checkEnrichers(enrichers []enricher) error {
+	for i := range enrichers {
+		if strings.TrimSpace(enrichers[i].Command) == "" {
+			return fmt.Errorf("enricher %d has no command", i+1)
+		}
+		if enrichers[i].Name == "" {
+			enrichers[i].Name = enrichers[i].Command
+		}
+	}
+	return nil
+}
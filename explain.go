@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// explainMaxRows caps the rows printed per step; the count says how many
+// there were.
+const explainMaxRows = 20
+
+// runExplain shows how a scan resolves and counts a single deleted field,
+// with every query and its results, for debugging a field that is missing
+// from an export or miscounted.
+func runExplain(args []string) {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sf-deleted-fields explain [flags] Object.Field")
+		flags.PrintDefaults()
+	}
+	org := flags.String("org", "", "Salesforce organization to use (default: the sf CLI's target-org)")
+	useCli := flags.Bool("cli", false, "Run every query through the sf CLI instead of a shared REST session")
+	pattern := flags.String("pattern", scanner.DefaultPattern, "SOQL LIKE pattern the scan matches deleted field names with")
+	queriesDir := flags.String("queries-dir", "", "Directory of .soql files replacing the embedded queries of the same name")
+	asJson := flags.Bool("json", false, "Print the explanation as JSON")
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	inputs := parseInterspersed(flags, args)
+	logging.apply()
+	cfg := settings.apply()
+
+	if *org == "" {
+		*org = defaultOrg()
+	}
+	if len(inputs) != 1 {
+		fatal("Please provide one field to explain, e.g. Account.Legacy_Status_del__c")
+	}
+	object, developerName, err := scanner.ParseFieldName(inputs[0])
+	if err != nil {
+		fatal("Invalid field", "error", err)
+	}
+	if *queriesDir != "" {
+		checkQueriesDir(*queriesDir)
+	}
+	if _, err := sfclient.CheckInstalled(); err != nil {
+		fatal("sf is not installed", "error", err)
+	}
+
+	scan := scanner.New(*org, scanner.Config{UseCli: *useCli, Pattern: *pattern, QueriesDir: *queriesDir, CountFilters: cfg.CountFilters, NoCache: true})
+	explanation := scan.Explain(context.Background(), object, developerName)
+
+	if *asJson {
+		writeExplanationJson(stdout, explanation)
+		return
+	}
+	writeExplanation(stdout, explanation, stdoutPalette)
+}
+
+func writeExplanation(w io.Writer, explanation scanner.Explanation, p palette) {
+	fmt.Fprintf(w, "%s\n\n", p.bold(fmt.Sprintf("%s.%s", explanation.Object, explanation.DeveloperName)))
+	for i, step := range explanation.Steps {
+		fmt.Fprintf(w, "%d. %s\n", i+1, p.bold(step.Name))
+		if step.SOQL != "" {
+			api := "REST API"
+			if step.Tooling {
+				api = "Tooling API"
+			}
+			fmt.Fprintf(w, "   %s, %s:\n", api, step.Duration.Round(time.Millisecond))
+			for _, line := range strings.Split(step.SOQL, "\n") {
+				fmt.Fprintf(w, "     %s\n", line)
+			}
+		}
+		if len(step.Rows) > 0 {
+			writeExplainRows(w, step.Rows)
+		}
+		switch {
+		case step.Err != nil:
+			fmt.Fprintf(w, "   %s %s\n", p.red("Failed:"), redact.Apply(step.Err.Error()))
+		case step.Result != "":
+			fmt.Fprintf(w, "   %s %s\n", p.green("=>"), step.Result)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// writeExplainRows prints a step's rows as an indented table, columns in
+// name order.
+func writeExplainRows(w io.Writer, rows []map[string]string) {
+	var columns []string
+	for _, row := range rows {
+		for column := range row {
+			if !slices.Contains(columns, column) {
+				columns = append(columns, column)
+			}
+		}
+	}
+	slices.Sort(columns)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "   %s\n", strings.Join(columns, "\t"))
+	for _, row := range rows[:min(len(rows), explainMaxRows)] {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = row[column]
+		}
+		fmt.Fprintf(tw, "   %s\n", strings.Join(values, "\t"))
+	}
+	tw.Flush()
+	if len(rows) > explainMaxRows {
+		fmt.Fprintf(w, "   ... %d more rows\n", len(rows)-explainMaxRows)
+	}
+}
+
+// explainStepJson is a step of `explain --json`.
+type explainStepJson struct {
+	Name       string              `json:"name"`
+	SOQL       string              `json:"soql,omitempty"`
+	Tooling    bool                `json:"tooling,omitempty"`
+	DurationMs float64             `json:"durationMs"`
+	Rows       []map[string]string `json:"rows,omitempty"`
+	Result     string              `json:"result,omitempty"`
+	Error      string              `json:"error,omitempty"`
+}
+
+func writeExplanationJson(w io.Writer, explanation scanner.Explanation) {
+	steps := make([]explainStepJson, len(explanation.Steps))
+	for i, step := range explanation.Steps {
+		steps[i] = explainStepJson{
+			Name:       step.Name,
+			SOQL:       step.SOQL,
+			Tooling:    step.Tooling,
+			DurationMs: float64(step.Duration.Microseconds()) / 1000,
+			Rows:       step.Rows,
+			Result:     step.Result,
+		}
+		if step.Err != nil {
+			steps[i].Error = redact.Apply(step.Err.Error())
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(map[string]any{"object": explanation.Object, "field": explanation.DeveloperName, "steps": steps}); err != nil {
+		fatal("Failed to write explanation", "error", err)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"cmp"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// feedEntry is one deletion event: the fields a run found for the first
+// time, or a run that breached a threshold.
+type feedEntry struct {
+	Id      string
+	Title   string
+	Updated time.Time
+	Summary string
+	Content string
+}
+
+// feedRun is an org's records from one day, which is one run as far as
+// the export keeps it.
+type feedRun struct {
+	Org     string
+	Date    string
+	Updated time.Time
+	Records []export.DeleteCountRecord
+}
+
+// runFeed writes an Atom or RSS feed of an export's deletion events, for a
+// feed reader or chat integration to subscribe to. It is generated from the
+// export's history as a static file, so it can be rebuilt after every scan
+// and published with the export.
+func runFeed(args []string) {
+	flags := flag.NewFlagSet("feed", flag.ExitOnError)
+	exportFile := flags.String("export", "deleted_fields.json", "Export file to build the feed from")
+	output := flags.String("o", "", "File to write the feed to (default standard output)")
+	format := flags.String("format", "", "Feed format: atom or rss (default from the -o file extension, else atom)")
+	title := flags.String("title", "Deleted Salesforce fields", "Title of the feed")
+	link := flags.String("link", "", "URL the feed is published at, for readers to link back to")
+	org := flags.String("org", "", "Org alias for records that do not name theirs")
+	n := flags.Int("n", 50, "Number of events to keep, newest first")
+	failOnCount := flags.Int("fail-on-count", -1, "Add an event for runs with more residual records than this (negative disables)")
+	failOnFields := flags.Int("fail-on-fields", -1, "Add an event for runs with more deleted fields than this (negative disables)")
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+	settings.apply()
+
+	if *format == "" {
+		*format = "atom"
+		if ext := strings.ToLower(filepath.Ext(*output)); ext == ".rss" {
+			*format = "rss"
+		}
+	}
+	if *format != "atom" && *format != "rss" {
+		fatal("Invalid --format: use atom or rss", "format", *format)
+	}
+
+	exportData, err := export.Read(*exportFile)
+	if err != nil {
+		fatal("Failed to read export", "file", *exportFile, "error", err)
+	}
+
+	thresholds := failThresholds{Count: *failOnCount, Fields: *failOnFields}
+	entries := feedEntries(feedRuns(exportData.Results, *org), thresholds)
+	entries = entries[:min(max(*n, 0), len(entries))]
+
+	write := func(w io.Writer) error {
+		if *format == "rss" {
+			return writeRss(w, *title, *link, entries)
+		}
+		return writeAtom(w, *title, *link, entries)
+	}
+	if *output == "" {
+		if err := write(stdout); err != nil {
+			fatal("Failed to write feed", "error", err)
+		}
+		return
+	}
+
+	// Written aside and renamed, so a reader polling the published file
+	// never gets half a feed.
+	tmp := *output + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		fatal("Failed to create feed", "file", *output, "error", err)
+	}
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, *output)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		fatal("Failed to write feed", "file", *output, "error", err)
+	}
+}
+
+// feedRuns splits the history into runs, oldest first.
+func feedRuns(records []export.DeleteCountRecord, defaultOrg string) []feedRun {
+	var runs []feedRun
+	index := make(map[string]int)
+	for _, record := range records {
+		org := cmp.Or(record.Org, defaultOrg)
+		at := time.Unix(record.Timestamp, 0)
+		date := at.Format("2006-01-02")
+
+		key := org + "/" + date
+		i, ok := index[key]
+		if !ok {
+			i = len(runs)
+			index[key] = i
+			runs = append(runs, feedRun{Org: org, Date: date})
+		}
+		runs[i].Records = append(runs[i].Records, record)
+		if at.After(runs[i].Updated) {
+			runs[i].Updated = at
+		}
+	}
+	slices.SortStableFunc(runs, func(a, b feedRun) int {
+		return cmp.Or(a.Updated.Compare(b.Updated), cmp.Compare(a.Org, b.Org))
+	})
+	return runs
+}
+
+// feedEntries replays the runs in order, adding an event for each run over
+// the thresholds and for each run that found fields no earlier run of its
+// org had. The newest events come first.
+func feedEntries(runs []feedRun, thresholds failThresholds) []feedEntry {
+	var entries []feedEntry
+	seen := make(map[string]bool)
+	for _, run := range runs {
+		orgName := cmp.Or(run.Org, "the org")
+
+		var found []export.DeleteCountRecord
+		fields := make(map[string]bool)
+		objects := make(map[string]int)
+		for _, record := range run.Records {
+			key := export.FieldIdentity(record.QualifiedApiName, record.DeveloperName)
+			fields[key] = true
+			if !seen[run.Org+"/"+key] {
+				seen[run.Org+"/"+key] = true
+				found = append(found, record)
+			}
+			if !record.CountSkipped {
+				objects[record.QualifiedApiName] = max(objects[record.QualifiedApiName], record.Count)
+			}
+		}
+		residual := 0
+		for _, count := range objects {
+			residual += count
+		}
+
+		var breaches []string
+		if thresholds.Count >= 0 && residual > thresholds.Count {
+			breaches = append(breaches, fmt.Sprintf("%d residual records, over the limit of %d", residual, thresholds.Count))
+		}
+		if thresholds.Fields >= 0 && len(fields) > thresholds.Fields {
+			breaches = append(breaches, fmt.Sprintf("%d deleted fields, over the limit of %d", len(fields), thresholds.Fields))
+		}
+		if len(breaches) > 0 {
+			entries = append(entries, feedEntry{
+				Id:      feedId(run, "threshold"),
+				Title:   "Threshold exceeded in " + orgName,
+				Updated: run.Updated,
+				Summary: fmt.Sprintf("The scan of %s on %s found %s.", orgName, run.Date, strings.Join(breaches, " and ")),
+			})
+		}
+
+		if len(found) > 0 {
+			slices.SortFunc(found, func(a, b export.DeleteCountRecord) int {
+				return cmp.Or(cmp.Compare(a.QualifiedApiName, b.QualifiedApiName), cmp.Compare(a.DeveloperName, b.DeveloperName))
+			})
+			var content strings.Builder
+			content.WriteString("<ul>")
+			for _, record := range found {
+				content.WriteString("<li>" + html.EscapeString(export.FieldKey(record.QualifiedApiName, record.DeveloperName)))
+				if record.FieldLabel != "" {
+					content.WriteString(" (" + html.EscapeString(record.FieldLabel) + ")")
+				}
+				if record.CountSkipped {
+					content.WriteString(": not counted")
+				} else {
+					content.WriteString(fmt.Sprintf(": %d records", record.Count))
+				}
+				content.WriteString("</li>")
+			}
+			content.WriteString("</ul>")
+
+			entries = append(entries, feedEntry{
+				Id:      feedId(run, "new"),
+				Title:   fmt.Sprintf("%d new deleted field(s) in %s", len(found), orgName),
+				Updated: run.Updated,
+				Summary: fmt.Sprintf("The scan of %s on %s found %d deleted field(s) no earlier scan had.", orgName, run.Date, len(found)),
+				Content: content.String(),
+			})
+		}
+	}
+
+	slices.Reverse(entries)
+	return entries
+}
+
+// feedId identifies an event across rebuilds of the feed, so readers do
+// not show it again.
+func feedId(run feedRun, kind string) string {
+	return "urn:sf-deleted-fields:" + url.PathEscape(run.Org) + ":" + run.Date + ":" + kind
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title   string    `xml:"title"`
+	Id      string    `xml:"id"`
+	Updated string    `xml:"updated"`
+	Summary string    `xml:"summary"`
+	Content *atomText `xml:"content,omitempty"`
+}
+
+func writeAtom(w io.Writer, title, link string, entries []feedEntry) error {
+	feed := atomFeed{
+		Title:   title,
+		Id:      cmp.Or(link, "urn:sf-deleted-fields:feed"),
+		Updated: feedUpdated(entries).Format(time.RFC3339),
+		Author:  atomAuthor{Name: "sf-deleted-fields"},
+	}
+	if link != "" {
+		feed.Links = []atomLink{{Rel: "self", Href: link}}
+	}
+	for _, entry := range entries {
+		atom := atomEntry{Title: entry.Title, Id: entry.Id, Updated: entry.Updated.UTC().Format(time.RFC3339), Summary: entry.Summary}
+		if entry.Content != "" {
+			atom.Content = &atomText{Type: "html", Body: entry.Content}
+		}
+		feed.Entries = append(feed.Entries, atom)
+	}
+	return writeFeedXml(w, feed)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Guid        rssGuid `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+func writeRss(w io.Writer, title, link string, entries []feedEntry) error {
+	feed := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:         title,
+		Link:          link,
+		Description:   "Deleted fields and threshold breaches found by sf-deleted-fields",
+		LastBuildDate: feedUpdated(entries).Format(time.RFC1123Z),
+	}}
+	for _, entry := range entries {
+		description := html.EscapeString(entry.Summary)
+		if entry.Content != "" {
+			description = "<p>" + description + "</p>" + entry.Content
+		}
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       entry.Title,
+			Guid:        rssGuid{Value: entry.Id},
+			PubDate:     entry.Updated.UTC().Format(time.RFC1123Z),
+			Description: description,
+		})
+	}
+	return writeFeedXml(w, feed)
+}
+
+// feedUpdated is when the newest event happened, so rebuilding an
+// unchanged feed gives the same file.
+func feedUpdated(entries []feedEntry) time.Time {
+	var updated time.Time
+	for _, entry := range entries {
+		if entry.Updated.After(updated) {
+			updated = entry.Updated
+		}
+	}
+	return updated.UTC()
+}
+
+func writeFeedXml(w io.Writer, feed any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(feed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// fixturePath is where --record saves, and --replay reads, org's fixture.
+func fixturePath(dir, org string) string {
+	return filepath.Join(dir, org+".json")
+}
+
+// checkFixtureFlags rejects --record and --replay combinations that cannot
+// work and creates the --record directory.
+func checkFixtureFlags(record, replay string, composite, approxCounts bool) {
+	if record != "" && replay != "" {
+		fatal("--record and --replay cannot be combined")
+	}
+	if composite || approxCounts {
+		// Batched counts go through REST resources the fixtures do not hold.
+		fatal("--record and --replay need one COUNT() per object; they cannot be combined with --composite or --approx-counts")
+	}
+	if record != "" {
+		if err := os.MkdirAll(record, 0o755); err != nil {
+			fatal("Cannot create --record directory", "dir", record, "error", err)
+		}
+	}
+}
@@ -1,3 +1,14 @@
 module git.dmoruzzi.com/sf-deleted-fields
 
 go 1.22.5
+
+require (
+	filippo.io/age v1.2.1
+	github.com/lib/pq v1.10.9
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
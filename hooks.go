@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+const defaultHookTimeout = 5 * time.Minute
+
+// hookConfig lists shell commands run at points of each org's scan. They
+// receive the run's metadata in SFDF_* environment variables.
+type hookConfig struct {
+	PreScan    string        `yaml:"pre_scan"`
+	PostExport string        `yaml:"post_export"`
+	OnFailure  string        `yaml:"on_failure"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+// hookEnv is the metadata handed to a hook.
+type hookEnv struct {
+	Org     string
+	Export  string
+	Outcome string
+	Summary *scanner.Summary
+	Err     error
+}
+
+func (e hookEnv) environ(hook string) []string {
+	env := append(os.Environ(),
+		"SFDF_HOOK="+hook,
+		"SFDF_RUN_ID="+runID,
+		"SFDF_ORG="+e.Org,
+		"SFDF_EXPORT="+e.Export,
+	)
+	if e.Outcome != "" {
+		env = append(env, "SFDF_OUTCOME="+e.Outcome)
+	}
+	if s := e.Summary; s != nil {
+		env = append(env,
+			"SFDF_ENVIRONMENT="+string(s.Environment),
+			"SFDF_DELETED_FIELDS="+strconv.FormatInt(s.DeletedFields, 10),
+			"SFDF_RESIDUAL_RECORDS="+strconv.Itoa(s.ResidualRecords),
+			"SFDF_OBJECTS_AFFECTED="+strconv.Itoa(len(s.Objects)),
+			"SFDF_FAILURES="+strconv.FormatInt(s.Failures, 10),
+			"SFDF_API_CALLS="+strconv.FormatInt(s.ApiCalls, 10),
+			"SFDF_DURATION_SECONDS="+strconv.FormatFloat(s.Duration.Seconds(), 'f', 1, 64),
+		)
+	}
+	if e.Err != nil {
+		env = append(env, "SFDF_ERROR="+e.Err.Error())
+	}
+	return env
+}
+
+// run executes the named hook's command, if one is configured, through the
+// platform shell. Its output goes to stderr alongside the log.
+func (h hookConfig) run(hook, command string, env hookEnv) error {
+	if command == "" {
+		return nil
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, command)
+	cmd.Env = env.environ(hook)
+	cmd.Stdout = stderrConsole
+	cmd.Stderr = stderrConsole
+
+	slog.Debug("Running hook", "hook", hook, "org", env.Org, "command", command)
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %w", hook, err)
+	}
+	slog.Debug("Hook finished", "hook", hook, "org", env.Org, "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// shellCommand runs command through the platform shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// runOnFailure runs the on_failure hook, logging rather than returning its
+// own failure since the run is already failing.
+func (h hookConfig) runOnFailure(env hookEnv) {
+	if err := h.run("on_failure", h.OnFailure, env); err != nil {
+		slog.Warn("Hook failed", "hook", "on_failure", "org", env.Org, "error", err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// runImport carries a spreadsheet of deleted field counts kept before this
+// tool into an export, so the trend lines of teams migrating to it start
+// from their old history rather than from their first scan.
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sf-deleted-fields import [flags] legacy.csv...")
+		fmt.Fprintln(flags.Output(), "Columns are found by their usual headers (Object, Field, Count, Date, Org) unless named with the -column flags.")
+		fmt.Fprintln(flags.Output(), "Counts the export already holds for a field, org and day are kept over imported ones, so importing twice is harmless.")
+		flags.PrintDefaults()
+	}
+	exportFile := flags.String("export", "deleted_fields.json", "Export to import into (.json, .ndjson/.jsonl or .csv)")
+	org := flags.String("org", "", "Org to record for rows without an org column")
+	dateFormat := flags.String("date-format", "", "Go layout of the date column, e.g. 02.01.2006 (default: try common layouts)")
+	var columns export.LegacyColumns
+	flags.StringVar(&columns.Object, "object-column", "", "Header of the object API name column; may be omitted when fields are given as Object.Field")
+	flags.StringVar(&columns.Field, "field-column", "", "Header of the field API name column")
+	flags.StringVar(&columns.Count, "count-column", "", "Header of the record count column")
+	flags.StringVar(&columns.Date, "date-column", "", "Header of the date counted column")
+	flags.StringVar(&columns.Org, "org-column", "", "Header of the org alias column")
+	dryRun := flags.Bool("dry-run", false, "Report what would be imported without writing the export")
+	encrypt := flags.String("encrypt", "", "Recipients, or \"passphrase\", the export is kept encrypted to as <export>.age, as given to the scan")
+	identity := flags.String("identity", "", "age identity file to decrypt an export kept encrypted to --encrypt recipients")
+	trustPlaintext := flags.Bool("trust-plaintext", false, "Use a plain export an unfinished run left beside the encrypted one as its history, instead of refusing to import")
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	inputs := parseInterspersed(flags, args)
+	logging.apply()
+	cfg := settings.apply()
+
+	if len(inputs) == 0 {
+		fatal("Please provide the spreadsheets to import")
+	}
+
+	var legacy []export.DeleteCountRecord
+	for _, input := range inputs {
+		records, err := export.ReadLegacyCSV(input, columns, *dateFormat)
+		if err != nil {
+			fatal("Failed to read spreadsheet", "file", input, "error", err)
+		}
+		for _, record := range records {
+			if record.Org == "" {
+				record.Org = *org
+			}
+			record.RunId = runID
+			legacy = append(legacy, record)
+		}
+		slog.Debug("Read spreadsheet", "file", input, "rows", len(records))
+	}
+
+	// The export is written as a scan writes it, all under its lock:
+	// decrypted for the import and encrypted again after, and signed again
+	// once verified.
+	target := *exportFile
+	var cipher *exportCipher
+	unlock := func() {}
+	// fail removes the decrypted history and releases the lock, which
+	// fatal's exit would skip.
+	fail := func(msg string, args ...any) {
+		if cipher != nil {
+			os.Remove(target)
+		}
+		unlock()
+		fatal(msg, args...)
+	}
+	if !export.IsPostgres(*exportFile) {
+		var err error
+		if unlock, err = export.Lock(*exportFile); err != nil {
+			fatal("Failed to lock export", "file", *exportFile, "error", err)
+		}
+		defer unlock()
+	}
+	if _, err := os.Stat(*exportFile + encryptedSuffix); err == nil || *encrypt != "" {
+		if *encrypt == "" {
+			fail("Export is encrypted; give the --encrypt and --identity it is kept with", "file", *exportFile+encryptedSuffix)
+		}
+		c, err := newExportCipher(*encrypt, *identity)
+		if err != nil {
+			fail("Invalid --encrypt", "error", err)
+		}
+		c.trustPlaintext = *trustPlaintext
+		if target, err = c.decrypt(*exportFile); err != nil {
+			fail("Cannot read the encrypted export", "error", err)
+		}
+		cipher = c
+		defer os.Remove(target)
+	}
+
+	var signingKey ed25519.PrivateKey
+	if cfg.Signing.Key != "" {
+		key, err := loadSigningKey(cfg.Signing.Key)
+		if err != nil {
+			fail("Cannot use the signing key", "error", err)
+		}
+		signingKey = key
+	}
+	if hasSignature(*exportFile) {
+		if signingKey == nil {
+			fail("Export is signed; configure signing.key to verify and re-sign it", "file", *exportFile)
+		}
+		if err := verifyFile(target, *exportFile+signatureSuffix, signingKey.Public().(ed25519.PublicKey)); err != nil {
+			fail("Refusing to import into a signed export that fails verification", "file", *exportFile, "error", err)
+		}
+	}
+
+	var imported []export.DeleteCountRecord
+	var duplicates int
+	if *dryRun {
+		data, err := export.Read(target)
+		if err != nil {
+			fail("Failed to read export", "file", *exportFile, "error", err)
+		}
+		imported, duplicates = newImports(data.Results, legacy)
+	} else {
+		err := export.Backfill(target, export.Run{Locked: true}, func(existing []export.DeleteCountRecord) []export.DeleteCountRecord {
+			imported, duplicates = newImports(existing, legacy)
+			return imported
+		})
+		if err != nil {
+			fail("Failed to write export", "file", *exportFile, "error", err)
+		}
+	}
+
+	if duplicates > 0 {
+		slog.Info("Skipping rows the export already has counts for", "rows", duplicates)
+	}
+	switch {
+	case len(imported) == 0:
+		slog.Info("Nothing to import", "file", *exportFile)
+	case *dryRun:
+		slog.Info("Dry run, not writing the export", "records", len(imported), "file", *exportFile)
+	default:
+		slog.Info("Imported history", "files", len(inputs), "records", len(imported), "file", *exportFile)
+	}
+
+	if signingKey != nil && !*dryRun && len(imported) > 0 && !export.IsPostgres(*exportFile) {
+		if err := signFile(target, *exportFile+signatureSuffix, signingKey); err != nil {
+			fail("Failed to sign export", "error", err)
+		}
+		slog.Debug("Signed export", "file", *exportFile, "signature", *exportFile+signatureSuffix)
+	}
+	if cipher != nil {
+		if err := cipher.seal(target, *exportFile); err != nil {
+			fail("Failed to encrypt export", "error", err)
+		}
+	}
+}
+
+// newImports returns the legacy records the export does not already hold
+// a count for, and how many it does.
+func newImports(existing, legacy []export.DeleteCountRecord) (imported []export.DeleteCountRecord, duplicates int) {
+	counted := make(map[string]bool, len(existing))
+	for _, record := range existing {
+		counted[importKey(record)] = true
+	}
+	for _, record := range legacy {
+		if counted[importKey(record)] {
+			duplicates++
+			continue
+		}
+		counted[importKey(record)] = true
+		imported = append(imported, record)
+	}
+	return imported, duplicates
+}
+
+// importKey identifies a field's count for one org and day.
+func importKey(record export.DeleteCountRecord) string {
+	return record.Org + "/" + export.FieldKey(record.QualifiedApiName, record.DeveloperName) + "/" + time.Unix(record.Timestamp, 0).Format("2006-01-02")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+func TestNewImports(t *testing.T) {
+	day := time.Date(2024, 1, 5, 9, 0, 0, 0, time.Local)
+	count := func(org, field string, count int, at time.Time) export.DeleteCountRecord {
+		return export.DeleteCountRecord{Org: org, QualifiedApiName: "Account", DeveloperName: field, Count: count, Timestamp: at.Unix()}
+	}
+	existing := []export.DeleteCountRecord{
+		count("dev", "Region_del", 12, day),
+	}
+
+	tests := []struct {
+		name           string
+		legacy         []export.DeleteCountRecord
+		wantImported   []int
+		wantDuplicates int
+	}{
+		{"new field", []export.DeleteCountRecord{count("dev", "Legacy_del", 7, day)}, []int{7}, 0},
+		{"counted the same day", []export.DeleteCountRecord{count("dev", "Region_del", 9, day.Add(5*time.Hour))}, nil, 1},
+		{"counted another day", []export.DeleteCountRecord{count("dev", "Region_del", 9, day.AddDate(0, 0, -1))}, []int{9}, 0},
+		{"another org", []export.DeleteCountRecord{count("prod", "Region_del", 40, day)}, []int{40}, 0},
+		{"repeated in the spreadsheet", []export.DeleteCountRecord{count("dev", "Legacy_del", 7, day), count("dev", "Legacy_del", 8, day)}, []int{7}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imported, duplicates := newImports(existing, tt.legacy)
+			if duplicates != tt.wantDuplicates {
+				t.Errorf("got %d duplicates, want %d", duplicates, tt.wantDuplicates)
+			}
+			var counts []int
+			for _, record := range imported {
+				counts = append(counts, record.Count)
+			}
+			if !slices.Equal(counts, tt.wantImported) {
+				t.Errorf("imported counts %v, want %v", counts, tt.wantImported)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Package redact replaces org aliases, org IDs and usernames with stable
+// hashes in logs and reports.
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// redactor replaces org aliases, org IDs and usernames with stable hashes so
+// logs and reports can be shared outside the organization. The same value
+// always hashes to the same token, keeping redacted runs comparable.
+type redactor struct {
+	mu      sync.RWMutex
+	enabled bool
+	values  map[string]string
+	// keys are the registered values, longest first.
+	keys []string
+}
+
+var redactions = &redactor{}
+
+// Enable turns redaction on or off. Values added while it is off are not
+// remembered.
+func Enable(enabled bool) {
+	redactions.mu.Lock()
+	defer redactions.mu.Unlock()
+	redactions.enabled = enabled
+}
+
+// Add registers a sensitive value of the given kind (org, user, id, host).
+func Add(kind, value string) {
+	redactions.add(kind, value)
+}
+
+// Apply returns s with every registered value replaced by its token. Values
+// are only replaced as whole words, so an org alias such as dev does not
+// mangle a longer word such as device.
+func Apply(s string) string {
+	return redactions.apply(s)
+}
+
+// Token returns the token value of the given kind is replaced with, whether
+// or not redaction is enabled, e.g. to find an org in an export written
+// with redaction on.
+func Token(kind, value string) string {
+	return redactToken(kind, value)
+}
+
+func redactToken(kind, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return kind + "-" + hex.EncodeToString(sum[:])[:10]
+}
+
+func (r *redactor) add(kind, value string) {
+	if value == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.enabled {
+		return
+	}
+	if r.values == nil {
+		r.values = make(map[string]string)
+	}
+	if _, ok := r.values[value]; ok {
+		return
+	}
+	r.values[value] = redactToken(kind, value)
+
+	// Replace longer values first so an alias inside a username does not
+	// leave the rest of the username behind.
+	r.keys = append(r.keys, value)
+	sort.SliceStable(r.keys, func(i, j int) bool { return len(r.keys[i]) > len(r.keys[j]) })
+}
+
+func (r *redactor) apply(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.keys) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(s); {
+		matched := ""
+		for _, key := range r.keys {
+			if strings.HasPrefix(s[i:], key) && !joinsWord(s, i, key) {
+				matched = key
+				break
+			}
+		}
+		if matched == "" {
+			i++
+			continue
+		}
+		b.WriteString(s[last:i])
+		b.WriteString(r.values[matched])
+		i += len(matched)
+		last = i
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// joinsWord reports whether key, found in s at i, is part of a longer word
+// there rather than a word of its own.
+func joinsWord(s string, i int, key string) bool {
+	end := i + len(key)
+	return (i > 0 && isWordByte(s[i-1]) && isWordByte(key[0])) ||
+		(end < len(s) && isWordByte(s[end]) && isWordByte(key[len(key)-1]))
+}
+
+// isWordByte reports whether c continues a word: a letter, digit or
+// underscore, or any byte of a multi-byte character.
+func isWordByte(c byte) bool {
+	return c == '_' || c >= utf8.RuneSelf || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// Attr is a slog ReplaceAttr hook applying the redactor to log output.
+func Attr(_ []string, attr slog.Attr) slog.Attr {
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, redactions.apply(attr.Value.String()))
+	case slog.KindAny:
+		switch v := attr.Value.Any().(type) {
+		case error:
+			return slog.String(attr.Key, redactions.apply(v.Error()))
+		case []string:
+			redacted := make([]string, len(v))
+			for i, s := range v {
+				redacted[i] = redactions.apply(s)
+			}
+			return slog.Any(attr.Key, redacted)
+		}
+	}
+	return attr
+}
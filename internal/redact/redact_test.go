@@ -0,0 +1,47 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyWholeWords(t *testing.T) {
+	r := &redactor{enabled: true}
+	for _, value := range []string{"dev", "dev-eu", "jo@acme.example", "00D5g000000abcd"} {
+		r.add("org", value)
+	}
+	token := func(value string) string { return redactToken("org", value) }
+
+	tests := []struct {
+		name, text, want string
+	}{
+		{"alias", "scanning dev", "scanning " + token("dev")},
+		{"inside a longer word", "device developer", "device developer"},
+		{"longer value first", "dev-eu and dev", token("dev-eu") + " and " + token("dev")},
+		{"quoted", `org="dev"`, `org="` + token("dev") + `"`},
+		{"joined by underscore", "dev_backup", "dev_backup"},
+		{"username", "user jo@acme.example", "user " + token("jo@acme.example")},
+		{"id", "00D5g000000abcdEAA 00D5g000000abcd", "00D5g000000abcdEAA " + token("00D5g000000abcd")},
+		{"file name", "deleted_fields.dev.json", "deleted_fields." + token("dev") + ".json"},
+		{"nothing registered", "Account", "Account"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.apply(tt.text); got != tt.want {
+				t.Errorf("apply(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddWhileDisabled(t *testing.T) {
+	r := &redactor{}
+	r.add("org", "dev")
+	r.enabled = true
+	if got := r.apply("dev"); got != "dev" {
+		t.Errorf("value added while disabled was redacted: %q", got)
+	}
+	if !strings.HasPrefix(redactToken("org", "dev"), "org-") {
+		t.Errorf("token %q does not name its kind", redactToken("org", "dev"))
+	}
+}
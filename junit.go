@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+// junitReport is the --junit file: one test suite per org and one test case
+// per deleted field, which fails when the field still holds more records
+// than --junit-max-count. Jenkins and GitLab render it like any test run, so
+// cleanup progress shows up in their test dashboards.
+type junitReport struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     float64      `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+
+	maxCount int
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       float64         `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+}
+
+func newJunitReport(maxCount int) *junitReport {
+	return &junitReport{Name: "sf-deleted-fields", maxCount: maxCount}
+}
+
+// addScan adds a suite for the org's scan. Counts that failed are errors
+// and fields that were not counted are skipped, so neither passes as clean;
+// a scan that failed altogether, with failure, is an error of its own.
+func (r *junitReport) addScan(summary scanner.Summary, records []export.DeleteCountRecord, started time.Time, failure error) {
+	suite := junitSuite{
+		Name:      redact.Apply(summary.Org),
+		Time:      summary.Duration.Seconds(),
+		Timestamp: started.UTC().Format("2006-01-02T15:04:05"),
+	}
+	if summary.Environment != "" {
+		suite.Properties = append(suite.Properties, junitProperty{Name: "environment", Value: string(summary.Environment)})
+	}
+	suite.Properties = append(suite.Properties,
+		junitProperty{Name: "runId", Value: runID},
+		junitProperty{Name: "maxCount", Value: fmt.Sprint(r.maxCount)},
+	)
+
+	for _, record := range records {
+		test := junitCase{Classname: record.QualifiedApiName, Name: record.DeveloperName}
+		switch status := record.CountStatus(); status {
+		case export.StatusOK:
+			if record.Count > r.maxCount {
+				message := fmt.Sprintf("%d residual records exceed the limit of %d", record.Count, r.maxCount)
+				if record.Approximate {
+					message = fmt.Sprintf("about %d residual records exceed the limit of %d", record.Count, r.maxCount)
+				}
+				test.Failure = &junitMessage{Message: message, Type: "residual_records"}
+				suite.Failures++
+			}
+			test.SystemOut = fmt.Sprintf("%d records", record.Count)
+			if record.CountFilter != "" {
+				test.SystemOut += " WHERE " + record.CountFilter
+			}
+		case export.StatusCountFailed:
+			test.Error = &junitMessage{Message: redact.Apply(record.Error), Type: string(status)}
+			suite.Errors++
+		default:
+			test.Skipped = &junitMessage{Message: "not counted: " + string(status)}
+			suite.Skipped++
+		}
+		suite.Cases = append(suite.Cases, test)
+	}
+	if failure != nil {
+		suite.Cases = append(suite.Cases, junitCase{
+			Classname: "scan",
+			Name:      redact.Apply(summary.Org),
+			Error:     &junitMessage{Message: redact.Apply(failure.Error()), Type: outcomeError},
+		})
+		suite.Errors++
+	}
+	suite.Tests = len(suite.Cases)
+
+	r.Suites = append(r.Suites, suite)
+	r.Tests += suite.Tests
+	r.Failures += suite.Failures
+	r.Errors += suite.Errors
+	r.Skipped += suite.Skipped
+	r.Time += suite.Time
+}
+
+// write stores the report at path.
+func (r *junitReport) write(path string) error {
+	data, err := xml.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JUnit report: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append([]byte(xml.Header), append(data, '\n')...), 0o644); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace JUnit report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+)
+
+const fleetIndexFile = "index.json"
+
+// outputLayout places each org's export by a path template such as
+// out/{{.Org}}/{{.Date}}.json, for fleet scans that keep every org's
+// history apart.
+type outputLayout struct {
+	tmpl    *template.Template
+	root    string
+	started time.Time
+}
+
+// layoutFields are the values an --output-layout template can use.
+type layoutFields struct {
+	Org   string
+	Date  string
+	Time  string
+	RunId string
+}
+
+func newOutputLayout(text string, started time.Time) (*outputLayout, error) {
+	tmpl, err := template.New("output-layout").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --output-layout: %w", err)
+	}
+
+	// The index lives in the deepest directory shared by every path the
+	// template can produce: the one before the first placeholder.
+	root := filepath.Dir(text)
+	if i := strings.Index(text, "{{"); i >= 0 {
+		root = filepath.Dir(text[:i] + "x")
+	}
+	return &outputLayout{tmpl: tmpl, root: root, started: started}, nil
+}
+
+// path renders the export path of org for this run.
+func (l *outputLayout) path(org string) (string, error) {
+	var b strings.Builder
+	err := l.tmpl.Execute(&b, layoutFields{
+		Org:   sanitizePathElement(redact.Apply(org)),
+		Date:  l.started.Format("2006-01-02"),
+		Time:  l.started.Format("150405"),
+		RunId: runID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid --output-layout: %w", err)
+	}
+	return filepath.Clean(b.String()), nil
+}
+
+// check renders every org's path up front, so a template that would put
+// two orgs in one file fails before any scan starts.
+func (l *outputLayout) check(orgs []string) error {
+	var paths []string
+	for _, org := range orgs {
+		path, err := l.path(org)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(paths, path) {
+			return fmt.Errorf("--output-layout gives several orgs the export %s; use {{.Org}}", path)
+		}
+		paths = append(paths, path)
+	}
+	return nil
+}
+
+// sanitizePathElement keeps an org alias or username from adding
+// directories to a path.
+func sanitizePathElement(s string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(s)
+}
+
+// fleetOrg is one org's entry in the fleet index.
+type fleetOrg struct {
+	orgRunSummary
+	LastRunId string   `json:"lastRunId"`
+	LastRunAt string   `json:"lastRunAt"`
+	Exports   []string `json:"exports"`
+}
+
+// fleetIndex lists every org a layout has exported, the latest export of
+// each and how its last run went, so dashboards need not walk the tree.
+type fleetIndex struct {
+	UpdatedAt string               `json:"updatedAt"`
+	Orgs      map[string]*fleetOrg `json:"orgs"`
+}
+
+func (l *outputLayout) indexPath() string {
+	return filepath.Join(l.root, fleetIndexFile)
+}
+
+func (l *outputLayout) readIndex() (*fleetIndex, error) {
+	index := &fleetIndex{Orgs: make(map[string]*fleetOrg)}
+
+	data, err := os.ReadFile(l.indexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fleet index: %w", err)
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse fleet index: %w", err)
+	}
+	if index.Orgs == nil {
+		index.Orgs = make(map[string]*fleetOrg)
+	}
+	return index, nil
+}
+
+// latestExport returns the export the index last recorded for org, so
+// --incremental can read history from an earlier dated file.
+func (l *outputLayout) latestExport(org string) string {
+	index, err := l.readIndex()
+	if err != nil {
+		return ""
+	}
+	if entry, ok := index.Orgs[redact.Apply(org)]; ok {
+		return entry.Export
+	}
+	return ""
+}
+
+// updateIndex records this run's orgs in the fleet index.
+func (l *outputLayout) updateIndex(run *runSummary) (string, error) {
+	index, err := l.readIndex()
+	if err != nil {
+		return "", err
+	}
+
+	for _, org := range run.Orgs {
+		entry, ok := index.Orgs[org.Org]
+		if !ok {
+			entry = &fleetOrg{}
+			index.Orgs[org.Org] = entry
+		}
+		entry.orgRunSummary = org
+		entry.LastRunId = run.RunId
+		entry.LastRunAt = run.FinishedAt
+		if !slices.Contains(entry.Exports, org.Export) {
+			entry.Exports = append(entry.Exports, org.Export)
+		}
+	}
+	index.UpdatedAt = run.FinishedAt
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode fleet index: %w", err)
+	}
+
+	path := l.indexPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create fleet index directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write fleet index: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to replace fleet index: %w", err)
+	}
+	return path, nil
+}
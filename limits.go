@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// runLimits prints the org limits that decide whether a scan can run: the
+// daily API allowance, storage and the concurrency limits.
+func runLimits(args []string) {
+	flags := flag.NewFlagSet("limits", flag.ExitOnError)
+	org := flags.String("org", "", "Salesforce organization to use (default: the sf CLI's target-org)")
+	all := flags.Bool("all", false, "Print every limit the org reports")
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+
+	if *org == "" {
+		*org = defaultOrg()
+	}
+
+	slog.Debug("Reading org limits", "org", *org)
+	limits, err := sfclient.FetchOrgLimits(*org)
+	if err != nil {
+		fatal("Failed to read org limits", "org", *org, "error", err)
+	}
+
+	names := []string{sfclient.DailyApiRequests, sfclient.DataStorageMB, sfclient.FileStorageMB}
+	var rest []string
+	for name := range limits {
+		if (*all || strings.HasPrefix(name, "Concurrent")) && !slices.Contains(names, name) {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	names = append(names, rest...)
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "LIMIT\tUSED\tMAX\tREMAINING\tUSED %%\n")
+	for _, name := range names {
+		limit, ok := limits[name]
+		if !ok {
+			continue
+		}
+		// Only the last column is colored, as escape codes would throw
+		// off the alignment of the others.
+		used := usedPercent(limit)
+		if limit.Max > 0 && limit.Remaining*10 < limit.Max {
+			used = stdoutPalette.red(used)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", name, limit.Used(), limit.Max, limit.Remaining, used)
+	}
+	w.Flush()
+}
+
+func usedPercent(limit sfclient.OrgLimit) string {
+	if limit.Max <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(limit.Used())*100/float64(limit.Max))
+}
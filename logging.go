@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+)
+
+// logFlags are the logging options shared by the scan and every subcommand.
+type logFlags struct {
+	// flags is the command's flag set, whose --org, if it has one, is
+	// redacted.
+	flags *flag.FlagSet
+
+	format *string
+	level  *string
+
+	noColor *bool
+	plain   *bool
+	redact  *bool
+
+	file        *string
+	fileMaxSize *int
+	fileMaxAge  *time.Duration
+	fileBackups *int
+}
+
+func registerLogFlags(flags *flag.FlagSet) *logFlags {
+	return &logFlags{
+		flags: flags,
+
+		format: flags.String("log-format", "text", "Log output format: text or json"),
+		level:  flags.String("log-level", "info", "Minimum log level: debug, info, warn or error"),
+
+		noColor: flags.Bool("no-color", false, "Disable colored output (also honors NO_COLOR)"),
+		plain:   flags.Bool("plain", false, "CI-safe output: plain ASCII only, no colors, spinners or status line"),
+		redact:  flags.Bool("redact", false, "Replace org aliases, org IDs and usernames with hashes in logs and reports"),
+
+		file:        flags.String("log-file", "", "Also write debug-level logs to this file"),
+		fileMaxSize: flags.Int("log-file-max-size", 10, "Rotate the log file after this many megabytes (0 = never)"),
+		fileMaxAge:  flags.Duration("log-file-max-age", 24*time.Hour, "Rotate the log file after this long (0 = never)"),
+		fileBackups: flags.Int("log-file-backups", 5, "Number of rotated log files to keep"),
+	}
+}
+
+// stdout receives human-facing reports; --plain routes it through an
+// asciiWriter.
+var stdout io.Writer = os.Stdout
+
+// runID identifies this invocation in logs and run artifacts.
+var runID = newRunID()
+
+// apply installs the default logger. Every entry carries the run ID so the
+// lines of one run can be picked out of an aggregated log stream.
+func (f *logFlags) apply() {
+	if err := f.setup(runID); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+func (f *logFlags) setup(runID string) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*f.level)); err != nil {
+		return fmt.Errorf("invalid --log-level %q: %w", *f.level, err)
+	}
+
+	redact.Enable(*f.redact)
+	// The orgs a command is given are redacted here, so that no
+	// subcommand taking --org can leave them out.
+	if org := f.flags.Lookup("org"); org != nil {
+		for _, alias := range strings.Split(org.Value.String(), ",") {
+			redact.Add("org", strings.TrimSpace(alias))
+		}
+	}
+
+	stdoutPalette.enabled = colorAllowed(os.Stdout, *f.noColor)
+	stderrConsole.colors.enabled = colorAllowed(os.Stderr, *f.noColor) && strings.ToLower(*f.format) == "text"
+
+	if *f.plain {
+		stdout = asciiWriter{os.Stdout}
+		stdoutPalette.enabled = false
+		stderrConsole.w = asciiWriter{os.Stderr}
+		stderrConsole.tty = false
+		stderrConsole.colors.enabled = false
+	}
+
+	handler, err := newLogHandler(stderrConsole, *f.format, level)
+	if err != nil {
+		return err
+	}
+
+	if *f.file != "" {
+		file, err := openRotatingFile(*f.file, int64(*f.fileMaxSize)<<20, *f.fileMaxAge, *f.fileBackups)
+		if err != nil {
+			return err
+		}
+
+		fileHandler, err := newLogHandler(file, *f.format, slog.LevelDebug)
+		if err != nil {
+			return err
+		}
+		handler = multiHandler{handler, fileHandler}
+	}
+
+	objectLogs = newObjectLogHandler(handler)
+	slog.SetDefault(slog.New(objectLogs).With("run_id", runID))
+	return nil
+}
+
+func newLogHandler(w io.Writer, format string, level slog.Level) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact.Attr}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("invalid --log-format %q: use text or json", format)
+	}
+}
+
+// multiHandler fans each record out to every handler whose level admits it,
+// so the console and the log file can run at different verbosity.
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, h := range m {
+		if h.Enabled(ctx, record.Level) {
+			errs = append(errs, h.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+func newRunID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// fatal logs an error and exits, the slog counterpart of log.Fatal.
+func fatal(msg string, args ...any) {
+	objectLogs.flush()
+	slog.Error(msg, args...)
+	telemetry.recordError(errorClass(msg))
+	telemetry.send()
+	audit.finish("error", 1)
+	os.Exit(1)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// objectLogs is the handler installed by logFlags.apply; --group-object-logs
+// turns on its grouping.
+var objectLogs *objectLogHandler
+
+// objectLogHandler tags every entry about an object with an object_ref,
+// the same for all of one object's entries in a run, so one object's
+// processing can be followed through the interleaved entries of parallel
+// workers. With grouping on, it holds those entries back instead, and
+// flush writes each object's entries as one block, in org and object order,
+// so the log reads the same however the workers were scheduled.
+type objectLogHandler struct {
+	next  slog.Handler
+	org   string
+	state *objectLogState
+}
+
+type objectLogState struct {
+	mu     sync.Mutex
+	group  bool
+	blocks map[objectLogKey][]heldLogEntry
+}
+
+type objectLogKey struct {
+	org, object string
+}
+
+type heldLogEntry struct {
+	handler slog.Handler
+	record  slog.Record
+}
+
+func newObjectLogHandler(next slog.Handler) *objectLogHandler {
+	return &objectLogHandler{next: next, state: &objectLogState{}}
+}
+
+// setGrouping turns holding back each object's entries on or off.
+func (h *objectLogHandler) setGrouping(group bool) {
+	h.state.mu.Lock()
+	defer h.state.mu.Unlock()
+	h.state.group = group
+}
+
+func (h *objectLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *objectLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	var object string
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == "object" {
+			object = attr.Value.String()
+			return false
+		}
+		return true
+	})
+	if object == "" {
+		return h.next.Handle(ctx, record)
+	}
+
+	record = record.Clone()
+	record.AddAttrs(slog.String("object_ref", objectRef(h.org, object)))
+
+	h.state.mu.Lock()
+	if h.state.group {
+		if h.state.blocks == nil {
+			h.state.blocks = make(map[objectLogKey][]heldLogEntry)
+		}
+		key := objectLogKey{h.org, object}
+		h.state.blocks[key] = append(h.state.blocks[key], heldLogEntry{h.next, record})
+		h.state.mu.Unlock()
+		return nil
+	}
+	h.state.mu.Unlock()
+	return h.next.Handle(ctx, record)
+}
+
+func (h *objectLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	org := h.org
+	for _, attr := range attrs {
+		if attr.Key == "org" {
+			org = attr.Value.String()
+		}
+	}
+	return &objectLogHandler{next: h.next.WithAttrs(attrs), org: org, state: h.state}
+}
+
+func (h *objectLogHandler) WithGroup(name string) slog.Handler {
+	return &objectLogHandler{next: h.next.WithGroup(name), org: h.org, state: h.state}
+}
+
+// flush writes the entries held back so far, each object's as one block.
+func (h *objectLogHandler) flush() {
+	if h == nil {
+		return
+	}
+	h.state.mu.Lock()
+	blocks := h.state.blocks
+	h.state.blocks = nil
+	h.state.mu.Unlock()
+
+	keys := make([]objectLogKey, 0, len(blocks))
+	for key := range blocks {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b objectLogKey) int {
+		return cmp.Or(cmp.Compare(a.org, b.org), cmp.Compare(a.object, b.object))
+	})
+	for _, key := range keys {
+		for _, entry := range blocks[key] {
+			entry.handler.Handle(context.Background(), entry.record)
+		}
+	}
+}
+
+// objectRef is a short ID for org's object, stable within a run and
+// distinct between runs, so it also tells runs apart in aggregated logs.
+func objectRef(org, object string) string {
+	sum := sha256.Sum256([]byte(runID + "\x00" + org + "\x00" + object))
+	return hex.EncodeToString(sum[:4])
+}
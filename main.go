@@ -1,403 +1,841 @@
 package main
 
 import (
-	"crypto/md5"
-	"embed"
-	"encoding/hex"
-	"encoding/json"
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
-)
 
-//go:embed soql/*.soql
-var queries embed.FS
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
 
-type DeleteCountRecord struct {
-	DeveloperName    string `json:"DeveloperName"`
-	TableEnumOrId    string `json:"TableEnumOrId"`
-	QualifiedApiName string `json:"QualifiedApiName"`
-	ApiName          string `json:"ApiName"`
-	Count            int    `json:"Count"`
-	Timestamp        int64  `json:"Timestamp"`
+// commands are selected by the first argument; without one, main runs a scan.
+var commands = map[string]func(args []string){
+	"archive":           runArchive,
+	"bench":             runBench,
+	"config":            runConfig,
+	"deanonymize":       runDeanonymize,
+	"empty-recycle-bin": runEmptyRecycleBin,
+	"explain":           runExplain,
+	"feed":              runFeed,
+	"import":            runImport,
+	"limits":            runLimits,
+	"merge":             runMerge,
+	"plan":              runPlan,
+	"report":            runReport,
+	"selftest":          runSelftest,
+	"sign":              runSign,
+	"tui":               runTui,
+	"verify":            runVerify,
+	"version":           runVersion,
+	"warm-cache":        runWarmCache,
 }
 
-type LastCount struct {
-	Date  string `json:"date"`
-	Count int    `json:"count"`
+// scanConfig carries the command line settings shared by every org's scan.
+type scanConfig struct {
+	export       string
+	exportFormat string
+	multiOrg     bool
+	opts         scanner.Config
+	hooks        hookConfig
+	enrichers    []enricher
+	registry     orgRegistry
+	layout       *outputLayout
+	ephemeral    bool
+	profile      *exportProfile
+	appendRuns   bool
+	omitZero     bool
+
+	// signingKey, when configured, verifies a signed export before the
+	// scan appends to it and signs the export after.
+	signingKey ed25519.PrivateKey
+
+	// cipher keeps the export encrypted at rest; see --encrypt.
+	cipher *exportCipher
+
+	// schemaDir receives each org's schema snapshot; see --schema-snapshot.
+	schemaDir string
+
+	// record and replay are directories of per-org fixtures: every
+	// Salesforce answer is saved to record, or read back from replay
+	// instead of asking the org.
+	record string
+	replay string
+
+	// anonymizer, when set, pseudonymizes the exported records and keeps
+	// its mapping in anonymizeMap; see --anonymize.
+	anonymizer   *export.Anonymizer
+	anonymizeMap string
 }
 
-type ExportData struct {
-	Results      []DeleteCountRecord `json:"results"`
-	LastRunCount []LastCount         `json:"lastRunCount"`
+// exportPath is where org's results are exported: nowhere for --ephemeral
+// runs or profiles without records, the --output-layout path when one is
+// set, otherwise the --export file.
+func (c scanConfig) exportPath(org string) string {
+	if c.ephemeral || !c.profile.has(sectionRecords) {
+		return ""
+	}
+	if c.layout != nil {
+		path, err := c.layout.path(org)
+		if err != nil {
+			fatal("Failed to place export", "org", org, "error", err)
+		}
+		return path
+	}
+	return exportPathForOrg(c.export, org, c.multiOrg)
 }
 
-var (
-	deleteCounts []DeleteCountRecord
-	mu           sync.Mutex
-)
-
 func main() {
-	org := flag.String("org", "", "Salesforce organization to use")
-	export := flag.String("export", "deleted_fields.json", "File to export the results as JSON")
-	flag.Parse()
-
-	if *org == "" {
-		log.Fatal("[ERROR] Please provide a Salesforce organization alias; use --org")
-		os.Exit(1)
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
 	}
 
-	log.Printf("[DEBUG] Using Salesforce organization: %s", *org)
+	org := flag.String("org", "", "Salesforce organization(s) to use, comma-separated (default: the sf CLI's target-org)")
+	group := flag.String("group", "", "Scan every org of these org registry group(s), comma-separated (\"all\" = every registered org)")
+	orgsFile := flag.String("orgs-file", "", "Org registry file (default ./"+registryFileName+", then the user config directory)")
+	exportFile := flag.String("export", "deleted_fields.json", "File to export the results as JSON (.ndjson/.jsonl appends one record per line, .csv one row), or a postgres:// URL to keep the history in a database several machines can write to")
+	outputLayout := flag.String("output-layout", "", "Export each org to a path built from this template instead of --export, e.g. out/{{.Org}}/{{.Date}}.json ({{.Time}} and {{.RunId}} also work); keeps an "+fleetIndexFile+" of every org's latest export")
+	exportFormat := flag.String("export-format", "", "Export format (json, grouped, ndjson or csv); defaults to the --export file extension")
+	anonymize := flag.Bool("anonymize", false, "Replace org, custom object and field names in the export with consistent pseudonyms, for sharing reproductions")
+	anonymizeMap := flag.String("anonymize-map", "", "Mapping --anonymize keeps to reuse pseudonyms and restore the names with deanonymize (default "+anonymizationMapFile+" beside the export)")
+	omitZero := flag.Bool("omit-zero", false, "Leave fields counted at zero out of reports; JSON exports list them under confirmedEmpty instead of results")
+	grouped := flag.Bool("grouped", false, "Nest the JSON export by object and field, each field holding its count history (same as --export-format grouped)")
+	noCache := flag.Bool("no-cache", false, "Do not read or write the on-disk metadata cache")
+	cacheTTL := flag.Duration("cache-ttl", 7*24*time.Hour, "How long cached metadata lookups remain valid")
+	useCli := flag.Bool("cli", false, "Run every query through the sf CLI instead of a shared REST session")
+	sfCli := flag.String("sf-cli", "", "How to run the Salesforce CLI: a path to sf, \"wsl\" to run it inside WSL from Windows or \"windows\" to run the Windows one from WSL (default $"+sfclient.CliEnv+", else found automatically)")
+	composite := flag.Bool("composite", false, "Batch count queries through the Composite REST API instead of one sf call each")
+	approxCounts := flag.Bool("approx-counts", false, "Use the platform's approximate record counts (one request) instead of COUNT() queries")
+	noFieldDetails := flag.Bool("no-field-details", false, "Do not look up deleted fields' labels and data types (saves one query per object)")
+	noDescribe := flag.Bool("no-describe", false, "Do not use the global describe to skip objects that cannot be counted")
+	noCounts := flag.Bool("no-counts", false, "Only inventory deleted fields; do not run any COUNT() queries")
+	incremental := flag.Bool("incremental", false, "Only count fields that are new or were non-zero on recent runs")
+	concurrency := flag.Int("concurrency", 0, "Number of parallel count queries per org (0 = adapt to API limits and latency)")
+	maxWorkers := flag.Int("max-workers", 0, "Maximum count queries in flight across all orgs (0 = no shared limit)")
+	incrementalWindow := flag.Duration("incremental-window", 7*24*time.Hour, "How long a zero count is trusted by --incremental")
+	failOnCount := flag.Int("fail-on-count", -1, "Exit with status 3 when residual records exceed this number (-1 = disabled)")
+	failOnFields := flag.Int("fail-on-fields", -1, "Exit with status 3 when deleted fields exceed this number (-1 = disabled)")
+	junitPath := flag.String("junit", "", "Also write a JUnit XML report to this file, one test case per deleted field, for CI test dashboards")
+	junitMaxCount := flag.Int("junit-max-count", 0, "Residual records a deleted field may hold before its --junit test case fails")
+	maxFailures := flag.Int("max-consecutive-failures", 20, "Stop an org's scan after this many Salesforce calls fail in a row, export what was counted and exit with status 4 (0 = never)")
+	maxApiCalls := flag.Int("max-api-calls", 0, "Estimate each org's API calls before counting and stop if they exceed this (0 = no limit); asks first on a terminal. A scan reaching the limit anyway stops there and exports what it has")
+	appendRuns := flag.Bool("append", false, "Keep every run's records in the export; by default a re-run replaces the org's records from earlier the same day")
+	lockTimeout := flag.Duration("lock-timeout", export.LockTimeout, "How long to wait for another run writing the same export before failing")
+	verifyCounts := flag.Bool("verify-counts", false, "Run every COUNT() twice and flag records whose counts changed in between, such as during a data load")
+	verifyTolerance := flag.Float64("verify-tolerance", 0, "Share of a count the two --verify-counts reads may differ by before the record is flagged (0.01 = 1%)")
+	sample := flag.Bool("sample", false, "Estimate the counts of objects with at least --sample-threshold records from a few sampled Id ranges instead of counting every record")
+	sampleThreshold := flag.Int("sample-threshold", 5_000_000, "Record count from which --sample estimates an object's count")
+	largeScanFields := flag.Int("large-scan-fields", 500, "Check the daily API allowance before counting an org with at least this many deleted fields (0 = never)")
+	ephemeral := flag.Bool("ephemeral", false, "Print every deleted field instead of exporting, and keep no history, cache or run summary (for scratch orgs in CI)")
+	noRunSummary := flag.Bool("no-run-summary", false, "Do not write run-summary.json next to the export")
+	encrypt := flag.String("encrypt", "", "Keep the export encrypted at rest as <export>.age, for these comma-separated age recipients (age1...) or \"passphrase\" for the passphrase in $"+passphraseEnv+"; decrypt it with age -d")
+	identity := flag.String("identity", "", "age identity file to decrypt the history of an export kept encrypted to --encrypt recipients")
+	trustPlaintext := flag.Bool("trust-plaintext", false, "Use a plain export an unfinished run left beside the encrypted one as its history, instead of refusing to scan")
+	schemaDir := flag.String("schema-snapshot", "", "Also save the current field list of every object holding deleted fields to <org>-<date>.json in this directory")
+	changesOnly := flag.Bool("changes-only", false, "Only print the summary and send notifications for orgs whose deleted fields or counts changed since the previous run in the export")
+	record := flag.String("record", "", "Save every Salesforce answer to <org>.json in this directory, for --replay")
+	replay := flag.String("replay", "", "Run offline from the <org>.json fixtures --record saved in this directory")
+	queriesDir := flag.String("queries-dir", "", "Directory of .soql files overriding the built-in queries of the same name")
+	profileName := flag.String("profile", "", "Export profile selecting the sections and record fields emitted: executive, admin, auditor or one from the config file")
+	configPath := flag.String("config", "", "YAML configuration file (default ./"+configFileName+", then the user config directory)")
+	noProgress := flag.Bool("no-progress", false, "Do not show the progress status line")
+	heartbeat := flag.Duration("heartbeat", time.Minute, "Log a heartbeat line with each org's phase this often (0 = never)")
+	tracePath := flag.String("trace", "", "Write every Salesforce call (query, start, duration, rows, success) to this file as JSON lines")
+	slowQuery := flag.Duration("slow-query", 30*time.Second, "Log any query taking longer than this with its SOQL (0 = never)")
+	container := flag.Bool("container", false, "Non-interactive mode for Docker/Kubernetes: authenticate from an SFDX auth URL instead of the sf CLI, log JSON, never prompt, and export only to a mounted volume or - (stdout)")
+	authUrlEnv := flag.String("auth-url-env", sfclient.AuthUrlEnv, "Environment variable holding the SFDX auth URL --container authenticates with")
+	authUrlFile := flag.String("auth-url-file", "", "File holding the SFDX auth URL --container authenticates with, instead of the environment; refresh tokens Salesforce rotates are saved back to it")
+	groupObjectLogs := flag.Bool("group-object-logs", false, "Hold back each object's log entries and write them as one block per object, in order, once the scans finish")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+	logging := registerLogFlags(flag.CommandLine)
+	flag.Parse()
+	if *container {
+		applyContainerDefaults(flag.CommandLine)
+	}
+	logging.apply()
+	objectLogs.setGrouping(*groupObjectLogs)
+	if *exportFile == export.Stdout {
+		// Keep reports out of the exported data.
+		stdout = os.Stderr
+	}
 
-	sfCliInstallCheck()
+	if *showVersion {
+		runVersion(nil)
+		return
+	}
+	slog.Debug("Starting", "version", version, "commit", commit)
 
-	log.Println("[DEBUG] Querying deleted fields data")
-	deletedFieldsCSV, err := queryFieldData(*org, "soql/deleted_fields.soql", "", true)
+	settings, settingsPath, err := loadConfig(*configPath)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Failed to load configuration", "error", err)
+	}
+	if settingsPath != "" {
+		slog.Debug("Loaded configuration", "file", settingsPath)
 	}
 
-	log.Println("[TRACE] Deleted fields data:\n\t", strings.ReplaceAll(deletedFieldsCSV, "\n", "\n\t"))
+	if err := export.SetNameRules(settings.Normalize); err != nil {
+		fatal("Invalid normalize configuration", "error", err)
+	}
+	if err := settings.Owners.check(); err != nil {
+		fatal("Invalid owners configuration", "error", err)
+	}
+	if err := settings.CountFilters.check(); err != nil {
+		fatal("Invalid count_filters configuration", "error", err)
+	}
 
-	log.Println("[DEBUG] Processing deleted fields data")
-	processDeletedFields(deletedFieldsCSV, *org)
+	profile, err := selectProfile(*profileName, settings.Profiles)
+	if err != nil {
+		fatal("Invalid --profile", "error", err)
+	}
+	if profile != nil && profile.has(sectionAudit) {
+		settings.Audit.Disabled = false
+	}
+	if *container && settings.Audit.File == "" {
+		// The default audit log lives in the image, which is thrown away.
+		settings.Audit.Disabled = true
+	}
 
-	if *export != "" {
-		log.Printf("[DEBUG] Exporting results to %s", *export)
-		exportResultsAsJSON(*export)
+	audit = startAudit(settings.Audit, "scan", os.Args[1:])
+	telemetry = newTelemetryReporter(settings.Telemetry)
+	telemetry.useFlags(flag.CommandLine)
+	for feature, used := range map[string]bool{
+		"notifiers": len(settings.Notifiers) > 0,
+		"hooks":     settings.Hooks != (hookConfig{}),
+		"enrichers": len(settings.Enrichers) > 0,
+	} {
+		if used {
+			telemetry.useFeature(feature)
+		}
 	}
-}
 
-func calculateMD5(file *os.File) (string, error) {
-	hasher := md5.New()
-	if _, err := io.Copy(hasher, file); err != nil {
-		return "", fmt.Errorf("failed to calculate MD5 hash: %w", err)
+	notifiers, err := loadNotifiers(settings.Notifiers)
+	if err != nil {
+		fatal("Invalid notifier configuration", "error", err)
 	}
 
-	md5Hash := hex.EncodeToString(hasher.Sum(nil))
-	return md5Hash, nil
-}
+	if err := checkEnrichers(settings.Enrichers); err != nil {
+		fatal("Invalid enricher configuration", "error", err)
+	}
 
-func sfCliInstallCheck() {
-	log.Println("[DEBUG] Checking Salesforce CLI installation")
-	cmd := exec.Command("sf", "version")
-	output, err := cmd.CombinedOutput()
+	registry, registryPath, err := loadRegistry(*orgsFile)
 	if err != nil {
-		log.Fatal("[ERROR] sf is not installed:", err)
+		fatal("Failed to load org registry", "error", err)
+	}
+	if registryPath != "" {
+		slog.Debug("Loaded org registry", "file", registryPath, "orgs", len(registry.Orgs), "groups", len(registry.Groups))
 	}
 
-	for _, line := range strings.Split(string(output), "\n") {
-		if line != "" && !strings.Contains(line, "Warning:") {
-			log.Println("[DEBUG] Salesforce CLI Version:", line)
+	if *container {
+		if *group != "" || len(splitOrgs(*org)) > 1 {
+			fatal("--container scans the single org of its auth URL; it cannot be combined with --group or several --org")
+		}
+		if *useCli {
+			fatal("--container runs without the sf CLI; it cannot be combined with --cli")
+		}
+		if *outputLayout == "" {
+			if err := checkContainerExport(*exportFile); err != nil {
+				fatal("Invalid export for --container", "error", err)
+			}
+		}
+		if *org, err = containerAuth(*authUrlEnv, *authUrlFile, *org); err != nil {
+			fatal("Cannot authenticate", "error", err)
 		}
 	}
-}
 
-func queryFieldData(sfOrg, queryFile, queryId string, useToolingApi bool) (string, error) {
-	log.Printf("[DEBUG] Reading query file: %s", queryFile)
+	if *sfCli != "" {
+		sfclient.UseCli(*sfCli)
+	}
 
-	queryData, err := queries.ReadFile(queryFile)
+	orgs, err := registry.resolveOrgs(splitOrgs(*org), splitOrgs(*group))
 	if err != nil {
-		return "", fmt.Errorf("query file read failed: %w", err)
+		fatal("Invalid --group", "error", err)
 	}
-
-	queryDataStr := strings.ReplaceAll(string(queryData), "\n", " ")
-	if queryId != "" {
-		queryDataStr = strings.ReplaceAll(queryDataStr, "#", queryId)
+	if len(orgs) == 0 && *group != "" {
+		fatal("Please provide a Salesforce organization alias; use --org or --group")
+	}
+	if len(orgs) == 0 {
+		orgs = []string{defaultOrg()}
 	}
 
-	cmdArgs := []string{"data", "query", "-o", sfOrg, "-r", "csv", "-q", queryDataStr}
-	if useToolingApi {
-		cmdArgs = append(cmdArgs, "-t")
+	for _, alias := range orgs {
+		redact.Add("org", alias)
 	}
-	log.Printf("[DEBUG] Executing query [Tooling API: %t]: %v", useToolingApi, cmdArgs)
 
-	cmd := exec.Command("sf", cmdArgs...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("command execution failed: %w\nOUTPUT: %s", err, string(output))
+	if *verifyCounts && (*approxCounts || *noCounts) {
+		fatal("--verify-counts needs exact counts; it cannot be combined with --approx-counts or --no-counts")
 	}
 
-	return extractCSVData(output), nil
-}
+	if *sample && (*approxCounts || *composite || *noCounts) {
+		fatal("--sample replaces single COUNT() queries; it cannot be combined with --approx-counts, --composite or --no-counts")
+	}
 
-func extractCSVData(output []byte) string {
-	log.Println("[DEBUG] Extracting CSV data from query output")
-	var csvData strings.Builder
-	processingCSV := false
-	for _, line := range strings.Split(string(output), "\n") {
-		if processingCSV {
-			if line != "" {
-				csvData.WriteString(line + "\n")
-				log.Println("[DEBUG] CSV data:", line)
-			}
-		} else if strings.Contains(line, ",") {
-			processingCSV = true
-			csvData.WriteString(line + "\n")
-			log.Println("[DEBUG] CSV data:", line)
-		}
+	if *sample && *sampleThreshold <= 0 {
+		fatal("--sample-threshold must be positive", "threshold", *sampleThreshold)
 	}
-	return csvData.String()
-}
 
-func processDeletedFields(deletedFieldsCSV, org string) {
-	var wg sync.WaitGroup
+	if *junitMaxCount < 0 {
+		fatal("--junit-max-count cannot be negative", "limit", *junitMaxCount)
+	}
 
-	for _, line := range strings.Split(deletedFieldsCSV, "\n") {
-		if line == "" || strings.HasPrefix(line, "DeveloperName") {
-			log.Printf("[DEBUG] Skipping line: %s", line)
-			continue
-		}
+	if *incremental && *ephemeral {
+		fatal("--incremental needs export history, which --ephemeral does not keep")
+	}
 
-		data := strings.Split(line, ",")
-		if !strings.HasSuffix(data[0], "_del") {
-			log.Printf("[DEBUG] Skipping non-deleted field: DeveloperName=%s, TableEnumOrId=%s", data[0], data[1])
-			continue // Skip non-deleted fields
-		}
+	if *incremental && (*exportFile == "" || *exportFile == export.Stdout) && *outputLayout == "" {
+		fatal("--incremental needs an --export file to read history from")
+	}
 
-		wg.Add(1)
-		go func(data []string) {
-			defer wg.Done()
+	if *anonymize && *incremental {
+		fatal("--incremental reads real names back from the export, which --anonymize replaces")
+	}
 
-			if strings.HasPrefix(data[1], "01I") {
-				log.Printf("[DEBUG] Processing deleted field: DeveloperName=%s, TableEnumOrId=%s", data[0], data[1])
-				devNameCSV, err := queryFieldData(org, "soql/enum_to_developer_name.soql", data[1], true)
-				if err != nil {
-					log.Fatal(err)
-				}
+	if *encrypt != "" && (*ephemeral || *outputLayout != "" || *exportFile == "" || *exportFile == export.Stdout || export.IsPostgres(*exportFile)) {
+		fatal("--encrypt keeps an --export file encrypted; it cannot be combined with --ephemeral, --output-layout, a database or exporting to standard output")
+	}
 
-				processDeveloperNames(devNameCSV, data[0], data[1], org)
-			} else {
-				log.Printf("[DEBUG] Processing deleted field: DeveloperName=%s, TableEnumOrId=%s", data[0], data[1])
-				devNameCSV := data[0] + ",DeveloperName\n" + data[0] + "," + data[0]
+	if *schemaDir != "" && (*ephemeral || *anonymize || *noFieldDetails) {
+		fatal("--schema-snapshot reads the field lists with the field details and keeps real names; it cannot be combined with --ephemeral, --anonymize or --no-field-details")
+	}
 
-				processDeveloperNames(devNameCSV, data[0], data[1], org)
-			}
-		}(data)
+	if *changesOnly && (*ephemeral || *anonymize) {
+		fatal("--changes-only compares with the previous run in the export, which --ephemeral does not keep and --anonymize renames")
 	}
 
-	wg.Wait()
-}
+	if *changesOnly && (*exportFile == "" || *exportFile == export.Stdout) && *outputLayout == "" {
+		fatal("--changes-only needs an --export file to read the previous run from")
+	}
 
-func processDeveloperNames(devNameCSV, developerName, tableEnumOrId, org string) {
-	var wg sync.WaitGroup
+	if *exportFormat != "" && !slices.Contains(export.Formats(), strings.ToLower(*exportFormat)) {
+		fatal("Unknown --export-format", "format", *exportFormat, "formats", export.Formats())
+	}
 
-	for _, devLine := range strings.Split(devNameCSV, "\n") {
-		if devLine == "" {
-			log.Printf("[DEBUG] Skipping line: %s", devLine)
-			continue
+	if *omitZero {
+		for _, path := range []string{*exportFile, *outputLayout} {
+			if format := cmp.Or(strings.ToLower(*exportFormat), export.FormatForPath(path)); path != "" && format != "json" && format != "grouped" {
+				fatal("--omit-zero only applies to JSON exports, which keep zero counts under confirmedEmpty", "file", path, "format", format)
+			}
 		}
+	}
 
-		apiData := strings.Split(devLine, ",")
-		if apiData[1] == "DeveloperName" {
-			log.Printf("[DEBUG] Skipping line: %s", devLine)
-			continue
+	if *grouped {
+		for _, path := range []string{*exportFile, *outputLayout} {
+			if format := cmp.Or(strings.ToLower(*exportFormat), export.FormatForPath(path)); path != "" && format != "json" && format != "grouped" {
+				fatal("--grouped only applies to JSON exports", "file", path, "format", format)
+			}
 		}
+		*exportFormat = "grouped"
+	}
 
-		wg.Add(1)
-		go func(apiData []string) {
-			defer wg.Done()
+	if *queriesDir != "" {
+		checkQueriesDir(*queriesDir)
+	}
+	if *record != "" || *replay != "" {
+		checkFixtureFlags(*record, *replay, *composite, *approxCounts)
+	}
+	export.LockTimeout = *lockTimeout
+
+	telemetry.setOrgs(len(orgs))
+	audit.setOrgs(orgs)
+	slog.Debug("Using Salesforce organizations", "orgs", strings.Join(orgs, ","))
+
+	if *container || *replay != "" {
+		slog.Debug("Not checking for sf", "container", *container, "replay", *replay)
+	} else if _, err := sfclient.CheckInstalled(); errors.Is(err, sfclient.ErrCliTooOld) {
+		fatal("Salesforce CLI is too old", "error", err)
+	} else if err != nil {
+		fatal("sf is not installed", "error", err)
+	}
 
-			log.Printf("[DEBUG] Processing developer name: DeveloperName=%s, API Name=%s", developerName, apiData[1])
-			apiNameCSV, err := queryFieldData(org, "soql/developer_name_to_api_name.soql", apiData[1], false)
-			if err != nil {
-				log.Fatal(err)
-			}
+	cfg := scanConfig{
+		export:       *exportFile,
+		exportFormat: *exportFormat,
+		multiOrg:     len(orgs) > 1,
+		hooks:        settings.Hooks,
+		enrichers:    settings.Enrichers,
+		registry:     registry,
+		ephemeral:    *ephemeral,
+		profile:      profile,
+		appendRuns:   *appendRuns,
+		omitZero:     *omitZero,
+		record:       *record,
+		replay:       *replay,
+		schemaDir:    *schemaDir,
+		opts: scanner.Config{
+			UseCli:            *useCli,
+			Composite:         *composite,
+			NoCounts:          *noCounts,
+			ApproxCounts:      *approxCounts,
+			Incremental:       *incremental,
+			IncrementalWindow: *incrementalWindow,
+			NoDescribe:        *noDescribe,
+			NoFieldDetails:    *noFieldDetails,
+			NoCache:           *noCache || *ephemeral || *container || *record != "" || *replay != "",
+			CacheTTL:          *cacheTTL,
+			Concurrency:       *concurrency,
+			Budget:            scanner.NewWorkerBudget(*maxWorkers),
+			SlowQuery:         *slowQuery,
+			QueriesDir:        *queriesDir,
+			MaxApiCalls:       *maxApiCalls,
+			OnBudgetExceeded:  confirmOverBudget,
+			LargeScanFields:   *largeScanFields,
+			VerifyCounts:      *verifyCounts,
+			VerifyTolerance:   *verifyTolerance,
+			CountFilters:      settings.CountFilters,
+			Sample:            *sample,
+			SampleThreshold:   *sampleThreshold,
+
+			MaxConsecutiveFailures: *maxFailures,
+		},
+	}
 
-			processApiNames(apiNameCSV, developerName, tableEnumOrId, apiData[1], org)
-		}(apiData)
+	if *container {
+		cfg.opts.OnBudgetExceeded = nil
 	}
 
-	wg.Wait()
-}
+	if settings.Signing.Key != "" {
+		if cfg.signingKey, err = loadSigningKey(settings.Signing.Key); err != nil {
+			fatal("Cannot use the signing key", "error", err)
+		}
+	}
 
-func processApiNames(apiNameCSV, developerName, tableEnumOrId, apiName, org string) {
-	var wg sync.WaitGroup
+	if *encrypt != "" {
+		if cfg.cipher, err = newExportCipher(*encrypt, *identity); err != nil {
+			fatal("Invalid --encrypt", "error", err)
+		}
+		cfg.cipher.trustPlaintext = *trustPlaintext
+	}
 
-	for _, apiLine := range strings.Split(apiNameCSV, "\n") {
-		if apiLine == "" {
-			continue
+	if *anonymize {
+		cfg.anonymizeMap = anonymizationMapPath(*anonymizeMap, *exportFile)
+		if cfg.anonymizer, err = export.LoadAnonymizer(cfg.anonymizeMap); err != nil {
+			fatal("Cannot use the anonymization map", "error", err)
 		}
+	}
 
-		apiData := strings.Split(apiLine, ",")
-		if apiData[2] == "QualifiedApiName" {
-			continue
+	var trace *traceFile
+	if *tracePath != "" {
+		if trace, err = openTraceFile(*tracePath); err != nil {
+			fatal("Cannot write --trace", "error", err)
 		}
+		cfg.opts.OnCall = trace.add
+	}
+	otel := newOtelExporter(settings.OpenTelemetry)
+	if otel != nil {
+		onCall := cfg.opts.OnCall
+		cfg.opts.OnCall = func(call scanner.Call) {
+			if onCall != nil {
+				onCall(call)
+			}
+			otel.addCall(call)
+		}
+	}
 
-		wg.Add(1)
-		go func(apiData []string) {
-			defer wg.Done()
+	started := time.Now()
+	if *outputLayout != "" && !*ephemeral {
+		cfg.layout, err = newOutputLayout(*outputLayout, started)
+		if err == nil {
+			err = cfg.layout.check(orgs)
+		}
+		if err != nil {
+			fatal("Invalid output layout", "error", err)
+		}
+	}
 
-			log.Printf("[DEBUG] Processing API name: QualifiedApiName=%s", apiData[2])
+	scans := make([]*scanner.Scan, len(orgs))
+	for i, alias := range orgs {
+		scans[i] = newOrgScan(alias, cfg)
+	}
 
-			if skipSelectCountLineIfNeeded(apiData[2]) {
-				log.Printf("[INFO] Skipping select count line: %s", apiData[2])
-				return
+	// The previous runs are read before the scans export over them.
+	diffNotifiers := wantsChanges(settings.Notifiers)
+	if diffNotifiers && !*changesOnly && (*ephemeral || *anonymize) {
+		slog.Warn("Diff notifiers compare with the previous run in the export, which --ephemeral does not keep and --anonymize renames; they send nothing")
+		diffNotifiers = false
+	}
+	previous := make(map[string][]export.DeleteCountRecord)
+	if *changesOnly || diffNotifiers {
+		for _, alias := range orgs {
+			if previous[alias], err = previousRun(alias, cfg); err != nil {
+				fatal("Failed to read the previous run", "org", alias, "error", err)
 			}
+		}
+	}
 
-			query := fmt.Sprintf("SELECT Count() FROM %s", apiData[2])
-			cmdArgs := []string{"data", "query", "-q", query, "-o", org, "-r", "json"}
+	done := make(chan struct{})
+	progressDone := make(chan struct{})
+	if *noProgress && *heartbeat <= 0 {
+		close(progressDone)
+	} else {
+		go func() {
+			reportProgress(scans, done, !*noProgress, *heartbeat)
+			close(progressDone)
+		}()
+	}
 
-			count, err := queryCount(cmdArgs)
-			if err != nil {
-				log.Fatal(err)
-			}
+	go watchProgressDumps(scans, done)
 
-			timestamp := time.Now().Unix()
-			record := DeleteCountRecord{
-				DeveloperName:    developerName,
-				TableEnumOrId:    tableEnumOrId,
-				QualifiedApiName: apiData[2],
-				ApiName:          apiData[1],
-				Count:            count,
-				Timestamp:        timestamp,
+	// An org that fails does not stop the others; the run exits with an
+	// error once they are all done.
+	failures := make([]error, len(scans))
+	var wg sync.WaitGroup
+	for i, scan := range scans {
+		wg.Add(1)
+		go func(i int, scan *scanner.Scan) {
+			defer wg.Done()
+			failures[i] = runOrgScan(scan, cfg)
+		}(i, scan)
+	}
+	wg.Wait()
+	close(done)
+	<-progressDone
+	objectLogs.flush()
+	if trace != nil {
+		if err := trace.close(); err != nil {
+			slog.Warn("Trace is incomplete", "file", *tracePath, "error", err)
+		} else {
+			slog.Debug("Wrote trace", "file", *tracePath)
+		}
+	}
+
+	thresholds := failThresholds{Count: *failOnCount, Fields: *failOnFields}
+	circuitOpen, callLimit := false, false
+	run := newRunSummary(started, time.Now())
+	breached, failed := false, false
+	var junit *junitReport
+	if *junitPath != "" {
+		junit = newJunitReport(*junitMaxCount)
+	}
+	for i, scan := range scans {
+		summary := summarize(scan)
+		orgFailed := failures[i] != nil
+		failed = failed || orgFailed
+		current := carryForward(previous[scan.Org()], scan.Records(), scan.Skipped())
+		quiet := *changesOnly && !changedSince(previous[scan.Org()], current)
+		if quiet {
+			slog.Info("No changes since the previous run, skipping the summary and notifications", "org", summary.Org)
+		}
+		if profile.has(sectionSummary) && !quiet && !orgFailed {
+			top := 0
+			if profile.has(sectionTopObjects) {
+				top = summaryTopObjects
+			}
+			shown := summary
+			if cfg.omitZero {
+				shown.Objects = omitEmptyObjects(summary.Objects)
 			}
+			printSummary(stdout, shown, top, stdoutPalette)
+		}
+		if cfg.ephemeral {
+			records := scan.Records()
+			if cfg.omitZero {
+				records = omitCountedEmpty(records)
+			}
+			printRecords(stdout, records, stdoutPalette)
+		}
 
-			log.Printf("[DEBUG] Appending delete count record: %+v", record)
+		circuitOpen = circuitOpen || summary.CircuitOpen
+		callLimit = callLimit || summary.CallLimitReached
+		orgBreached := thresholds.breached(summary)
+		breached = breached || orgBreached
+		path := cfg.exportPath(scan.Org())
+		outcome := orgOutcome(summary, orgBreached, orgFailed)
+		run.addOrg(summary, path, outcome)
+		if junit != nil {
+			junit.addScan(summary, scan.Records(), started, failures[i])
+		}
+		if !quiet && !orgFailed {
+			event := notifyEvent(summary, outcome, settings.Owners)
+			event.Changes = notifyChanges(previous[scan.Org()], current, settings.Owners)
+			sendNotifications(notifiers, event)
+		}
 
-			mu.Lock()
-			deleteCounts = append(deleteCounts, record)
-			mu.Unlock()
-		}(apiData)
+		otel.addScan(scan, summary, outcome)
+		// A failed org has had its on_failure hook run already.
+		if outcome != outcomeOK && !orgFailed {
+			telemetry.recordError(outcome)
+			cfg.hooks.runOnFailure(hookEnv{Org: scan.Org(), Export: path, Outcome: outcome, Summary: &summary})
+		}
 	}
 
-	wg.Wait()
-}
+	summaryAt := cfg.export
+	if cfg.layout != nil {
+		summaryAt = cfg.layout.indexPath()
+		path, err := cfg.layout.updateIndex(run)
+		if err != nil {
+			slog.Warn("Failed to update fleet index", "error", err)
+		} else {
+			slog.Debug("Updated fleet index", "file", path)
+		}
+	}
 
-func skipSelectCountLineIfNeeded(apiName string) bool {
-	if apiName == "" {
-		return true
+	if !*noRunSummary && !cfg.ephemeral && profile.has(sectionRunSummary) && summaryAt != "" && summaryAt != export.Stdout && !export.IsPostgres(summaryAt) {
+		path, err := run.write(summaryAt)
+		if err != nil {
+			slog.Warn("Failed to write run summary", "error", err)
+		} else {
+			slog.Debug("Wrote run summary", "file", path, "outcome", run.Outcome)
+		}
 	}
 
-	if strings.HasSuffix(apiName, "__e") {
-		return true
+	if junit != nil {
+		if err := junit.write(*junitPath); err != nil {
+			slog.Warn("Failed to write JUnit report", "error", err)
+		} else {
+			slog.Debug("Wrote JUnit report", "file", *junitPath, "tests", junit.Tests, "failures", junit.Failures)
+		}
 	}
 
-	return false
+	telemetry.send()
+	otel.send(run.Outcome)
+	if failed {
+		audit.finish(run.Outcome, 1)
+		os.Exit(1)
+	}
+	if circuitOpen {
+		audit.finish(run.Outcome, exitCircuitOpen)
+		os.Exit(exitCircuitOpen)
+	}
+	if callLimit {
+		audit.finish(run.Outcome, exitCallLimit)
+		os.Exit(exitCallLimit)
+	}
+	if breached {
+		audit.finish(run.Outcome, exitThresholdExceeded)
+		os.Exit(exitThresholdExceeded)
+	}
+	audit.finish(run.Outcome, 0)
 }
 
-func queryCount(cmdArgs []string) (int, error) {
-	log.Printf("[DEBUG] Querying count with args: %v", cmdArgs)
-	cmd := exec.Command("sf", cmdArgs...)
-	output, err := cmd.CombinedOutput()
+// defaultOrg returns the sf CLI's default org, for when --org is omitted.
+func defaultOrg() string {
+	org, source, err := sfclient.DefaultOrg()
 	if err != nil {
-		return 0, fmt.Errorf("command execution failed: %w\nOUTPUT: %s", err, string(output))
-	}
-
-	output = skipFirstLineIfNeeded(output)
-	var jsonData map[string]interface{}
-	if err := json.Unmarshal(output, &jsonData); err != nil {
-		return 0, fmt.Errorf("JSON Unmarshal failed: %w\nOUTPUT: %s", err, string(output))
+		fatal("Please provide a Salesforce organization alias; use --org", "error", err)
 	}
+	slog.Info("No --org given, using the sf CLI's default org", "org", org, "source", source)
+	return org
+}
 
-	result, ok := jsonData["result"].(map[string]interface{})
-	if !ok {
-		return 0, fmt.Errorf("'result' field is not a map")
+func splitOrgs(value string) []string {
+	var orgs []string
+	for _, org := range strings.Split(value, ",") {
+		if org = strings.TrimSpace(org); org != "" {
+			orgs = append(orgs, org)
+		}
 	}
+	return orgs
+}
 
-	totalSize, ok := result["totalSize"].(float64)
-	if !ok {
-		return 0, fmt.Errorf("'totalSize' field is not a float64")
+// exportPathForOrg gives each org its own export file when several orgs are
+// scanned in one run: deleted_fields.json becomes deleted_fields.<org>.json.
+// Standard output and databases are shared by every org.
+func exportPathForOrg(file, org string, multiOrg bool) string {
+	if !multiOrg || file == "" || file == export.Stdout || export.IsPostgres(file) {
+		return file
 	}
 
-	return int(totalSize), nil
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "." + redact.Apply(org) + ext
 }
 
-func skipFirstLineIfNeeded(output []byte) []byte {
-	outputStr := string(output)
-	if strings.Contains(outputStr, "»") || strings.Contains(outputStr, "update available") {
-		if index := strings.Index(outputStr, "\n"); index != -1 {
-			return []byte(outputStr[index+1:])
+// newOrgScan prepares the scan of one org with its org registry settings,
+// loading its export history first when the scan is incremental.
+func newOrgScan(org string, cfg scanConfig) *scanner.Scan {
+	opts := cfg.opts
+	if settings, ok := cfg.registry.Orgs[org]; ok {
+		settings.apply(&opts)
+	}
+	switch {
+	case cfg.record != "":
+		opts.Recorder = sfclient.NewRecorder()
+	case cfg.replay != "":
+		fake, err := sfclient.LoadFake(fixturePath(cfg.replay, org))
+		if err != nil {
+			fatal("Failed to load replay fixture", "org", org, "error", err)
 		}
+		opts.Executor = fake
 	}
-	return output
+	if opts.Incremental {
+		path := cfg.exportPath(org)
+		if cfg.layout != nil {
+			if latest := cfg.layout.latestExport(org); latest != "" {
+				path = latest
+			}
+		}
+		history, err := cfg.cipher.read(path)
+		if err != nil {
+			fatal("Failed to read history", "org", org, "error", err)
+		}
+		opts.History = export.LastCountedRecords(history.Results)
+		slog.Debug("Loaded history", "org", org, "fields", len(opts.History))
+	}
+	return scanner.New(org, opts)
 }
 
-func exportResultsAsJSON(filename string) {
-	log.Printf("[DEBUG] Exporting results to JSON file: %s", filename)
-	var exportData ExportData
+// runOrgScan scans a single org and exports its results, running the
+// configured hooks around them. It returns why the org's scan or export
+// failed, leaving the other orgs of the run to finish.
+func runOrgScan(scan *scanner.Scan, cfg scanConfig) error {
+	path := cfg.exportPath(scan.Org())
 
-	if _, err := os.Stat(filename); err == nil {
-		log.Printf("[DEBUG] Reading existing data from file: %s", filename)
-		file, err := os.Open(filename)
-		if err != nil {
-			log.Fatalf("Failed to open existing file: %s", err)
-		}
-		defer file.Close()
+	if err := cfg.hooks.run("pre_scan", cfg.hooks.PreScan, hookEnv{Org: scan.Org(), Export: path}); err != nil {
+		return failOrgScan(scan, cfg, path, "Pre-scan hook failed", err)
+	}
 
-		decoder := json.NewDecoder(file)
-		if err := decoder.Decode(&exportData); err != nil {
-			log.Fatalf("Failed to decode existing JSON data: %s", err)
+	err := scan.Run(context.Background())
+	if errors.Is(err, scanner.ErrCircuitOpen) || errors.Is(err, scanner.ErrApiCallLimit) {
+		scan.Logger().Error("Scan stopped early, exporting partial results", "error", err)
+		err = nil
+	}
+	if recorder := scan.Recorder(); recorder != nil {
+		// Save failed scans too, so they can be reproduced offline.
+		fixture := fixturePath(cfg.record, scan.Org())
+		if err := recorder.Save(fixture); err != nil {
+			scan.Logger().Warn("Failed to save recording", "file", fixture, "error", err)
+		} else {
+			scan.Logger().Info("Saved recording", "file", fixture)
 		}
 	}
-
-	exportData.Results = append(exportData.Results, deleteCounts...)
-	exportData.LastRunCount = calculateCurCounts(deleteCounts)
-
-	file, err := os.Create(filename)
 	if err != nil {
-		log.Fatalf("Failed to create file: %s", err)
+		return failOrgScan(scan, cfg, path, "Scan failed", err)
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(exportData); err != nil {
-		log.Fatalf("Failed to encode JSON: %s", err)
+	if cfg.schemaDir != "" {
+		file, err := writeSchemaSnapshot(cfg.schemaDir, redact.Apply(scan.Org()), scan.Progress().Finished, scan.Schema())
+		if err != nil {
+			scan.Logger().Warn("Failed to save schema snapshot", "error", err)
+		} else {
+			scan.Logger().Debug("Saved schema snapshot", "file", file)
+		}
+	}
+
+	if path == "" {
+		return nil
 	}
 
-	md5Hash, err := calculateMD5(file)
+	format := cfg.exportFormat
+	if format == "" {
+		format = export.FormatForPath(path)
+	}
+	if cfg.layout != nil {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return failOrgScan(scan, cfg, path, "Failed to create export directory", err)
+		}
+	}
+	progress := scan.Progress()
+	run := export.Run{Org: redact.Apply(scan.Org()), Started: progress.Started, Finished: progress.Finished, Fields: cfg.profile.fields(), Append: cfg.appendRuns, OmitZero: cfg.omitZero, Skipped: scan.Skipped()}
+	if cfg.profile.has(sectionAudit) {
+		run.Id, run.Version, run.Commit = runID, version, commit
+	}
+	scan.Logger().Debug("Exporting results", "file", path, "format", format)
+	records := enrichRecords(scan.Org(), cfg.enrichers, scan.Records())
+	if cfg.anonymizer != nil {
+		run.Org = cfg.anonymizer.Org(run.Org)
+		records = cfg.anonymizer.Records(records)
+		// Save the mapping first, so no anonymized export exists that it
+		// cannot undo.
+		if err := cfg.anonymizer.Save(cfg.anonymizeMap); err != nil {
+			return failOrgScan(scan, cfg, path, "Failed to save the anonymization map", err)
+		}
+	}
+	// The lock is held from decrypting and verifying the export to signing
+	// and encrypting what was written, so no other run's write lands in
+	// between.
+	if path != export.Stdout && !export.IsPostgres(path) {
+		unlock, err := export.Lock(path)
+		if err != nil {
+			return failOrgScan(scan, cfg, path, "Failed to lock export", err)
+		}
+		defer unlock()
+		run.Locked = true
+	}
+	// Under --encrypt the run is written to a decrypted copy of the
+	// history, which only this user can read and is removed once sealed.
+	target := path
+	if cfg.cipher != nil {
+		plain, err := cfg.cipher.decrypt(path)
+		if err != nil {
+			return failOrgScan(scan, cfg, path, "Cannot read the encrypted export", err)
+		}
+		defer os.Remove(plain)
+		target = plain
+	}
+	exporter, err := export.New(format, target)
 	if err != nil {
-		log.Fatalf("Failed to calculate MD5 hash: %s", err)
+		return failOrgScan(scan, cfg, path, "Failed to open export", err)
+	}
+	if hasSignature(path) {
+		if cfg.signingKey == nil {
+			return failOrgScan(scan, cfg, path, "Export is signed; configure signing.key to verify and re-sign it", errors.New("no signing key"))
+		}
+		if err := verifyFile(target, path+signatureSuffix, cfg.signingKey.Public().(ed25519.PublicKey)); err != nil {
+			return failOrgScan(scan, cfg, path, "Refusing to append to a signed export that fails verification", err)
+		}
+	}
+	if err := exporter.Write(run, records); err != nil {
+		return failOrgScan(scan, cfg, path, "Failed to export results", err)
+	}
+	if cfg.signingKey != nil && path != export.Stdout && !export.IsPostgres(path) {
+		if err := signFile(target, path+signatureSuffix, cfg.signingKey); err != nil {
+			return failOrgScan(scan, cfg, path, "Failed to sign export", err)
+		}
+		scan.Logger().Debug("Signed export", "file", path, "signature", path+signatureSuffix)
+	}
+	if cfg.cipher != nil {
+		if err := cfg.cipher.seal(target, path); err != nil {
+			return failOrgScan(scan, cfg, path, "Failed to encrypt export", err)
+		}
+		scan.Logger().Debug("Encrypted export", "file", path+encryptedSuffix)
 	}
 
-	log.Printf("[INFO] Successfully exported results to JSON file: %s with MD5 hash: %s", filename, md5Hash)
+	summary := summarize(scan)
+	if err := cfg.hooks.run("post_export", cfg.hooks.PostExport, hookEnv{Org: scan.Org(), Export: path, Summary: &summary}); err != nil {
+		scan.Logger().Warn("Hook failed", "hook", "post_export", "error", err)
+	}
+	return nil
 }
 
-func calculateCurCounts(records []DeleteCountRecord) []LastCount {
-	log.Println("[DEBUG] Calculating current counts from records")
+// failOrgScan runs the on_failure hook for a scan that cannot continue and
+// returns the failure for the run to report once every org is done.
+func failOrgScan(scan *scanner.Scan, cfg scanConfig, path, msg string, err error) error {
+	cfg.hooks.runOnFailure(hookEnv{Org: scan.Org(), Export: path, Outcome: "error", Err: err})
+	scan.Logger().Error(msg, "error", err)
+	telemetry.recordError(errorClass(msg))
+	return fmt.Errorf("%s: %w", msg, err)
+}
 
-	if len(records) == 0 {
-		todayDate := time.Now().Format("2006-01-02")
-		log.Printf("[INFO] No records found, setting count to 0 and date to %s", todayDate)
-		return []LastCount{
-			{
-				Date:  todayDate,
-				Count: 0,
-			},
-		}
+// checkQueriesDir makes sure --queries-dir exists and reports which built-in
+// queries it overrides, warning about files that override nothing.
+func checkQueriesDir(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fatal("Cannot read --queries-dir", "dir", dir, "error", err)
 	}
 
-	counts := make(map[string]int)
-	processed := make(map[string]map[string]bool) // QualifiedApiName -> Date
-
-	for _, record := range records {
-		date := time.Unix(record.Timestamp, 0).Format("2006-01-02")
-
-		if _, exists := processed[date]; !exists {
-			processed[date] = make(map[string]bool)
+	known := scanner.QueryFiles()
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".soql" {
+			continue
 		}
-
-		if !processed[date][record.QualifiedApiName] {
-			counts[date] += record.Count
-			processed[date][record.QualifiedApiName] = true
+		if slices.Contains(known, entry.Name()) {
+			slog.Info("Overriding built-in query", "file", filepath.Join(dir, entry.Name()))
+		} else {
+			slog.Warn("Ignoring unknown query file", "file", filepath.Join(dir, entry.Name()), "known", known)
 		}
 	}
-
-	var curCounts []LastCount
-	for date, count := range counts {
-		log.Printf("[INFO] Count for date %s: %d", date, count)
-		curCounts = append(curCounts, LastCount{
-			Date:  date,
-			Count: count,
-		})
-	}
-
-	return curCounts
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// runMerge combines the exports of several orgs into one dataset whose
+// records carry an Org, for fleet-wide dashboards.
+func runMerge(args []string) {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sf-deleted-fields merge [flags] [org=]export...")
+		fmt.Fprintln(flags.Output(), "Records without an Org take it from org= or, failing that, from the export's path.")
+		flags.PrintDefaults()
+	}
+	output := flags.String("o", "", "File to write the merged dataset to (.json, .ndjson/.jsonl or .csv)")
+	format := flags.String("format", "", "Output format (json, ndjson or csv); defaults to the -o file extension")
+	latest := flags.Bool("latest", false, "Only keep each export's latest run")
+	logging := registerLogFlags(flags)
+	inputs := parseInterspersed(flags, args)
+	logging.apply()
+
+	if *output == "" {
+		fatal("Please provide an output file; use -o")
+	}
+	if len(inputs) == 0 {
+		fatal("Please provide the exports to merge")
+	}
+	if *format == "" {
+		*format = export.FormatForPath(*output)
+	}
+	if !slices.Contains(export.Formats(), strings.ToLower(*format)) {
+		fatal("Unknown --format", "format", *format, "formats", export.Formats())
+	}
+
+	var merged []export.DeleteCountRecord
+	var orgs []string
+	for _, input := range inputs {
+		org, input := splitMergeInput(input)
+		if filepath.Clean(input) == filepath.Clean(*output) {
+			slog.Warn("Skipping the output file", "file", input)
+			continue
+		}
+
+		data, err := export.Read(input)
+		if err != nil {
+			fatal("Failed to read export", "file", input, "error", err)
+		}
+
+		records := data.Results
+		if *latest {
+			records = export.LatestRunRecords(records)
+		}
+
+		if org == "" {
+			org = orgFromExportPath(input)
+		}
+		for _, record := range records {
+			if record.Org == "" {
+				record.Org = org
+			}
+			if !slices.Contains(orgs, record.Org) {
+				orgs = append(orgs, record.Org)
+			}
+			merged = append(merged, record)
+		}
+		slog.Debug("Read export", "file", input, "records", len(records), "org", org)
+	}
+
+	// The exporters append, so start the merged dataset from scratch.
+	if err := os.Remove(*output); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fatal("Failed to replace output", "file", *output, "error", err)
+	}
+	exporter, err := export.New(*format, *output)
+	if err != nil {
+		fatal("Failed to open output", "error", err)
+	}
+	if err := exporter.Write(export.Run{}, merged); err != nil {
+		fatal("Failed to write merged dataset", "error", err)
+	}
+
+	slog.Info("Merged exports", "files", len(inputs), "orgs", len(orgs), "records", len(merged), "file", *output)
+}
+
+// splitMergeInput separates an optional org= prefix from an export path.
+func splitMergeInput(input string) (string, string) {
+	org, path, ok := strings.Cut(input, "=")
+	if !ok || org == "" || strings.ContainsAny(org, `/\`) {
+		return "", input
+	}
+	return org, path
+}
+
+// orgFromExportPath names the org of an export whose records predate the
+// Org field: out/<org>/<date>.json from --output-layout gives the
+// directory, deleted_fields.<org>.json from a multi-org run the middle of
+// the file name, and anything else the file name itself.
+func orgFromExportPath(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if dir := filepath.Base(filepath.Dir(path)); dir != "." && dir != string(filepath.Separator) && !strings.Contains(name, ".") {
+		return dir
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// parseInterspersed parses flags that may follow positional arguments, as
+// in merge out/*/latest.json -o fleet.json, and returns the positional ones.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
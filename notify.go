@@ -0,0 +1,132 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/notify"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+// loadNotifiers builds the notifiers listed in the configuration.
+func loadNotifiers(configs []notify.Config) ([]*notify.Configured, error) {
+	notifiers := make([]*notify.Configured, 0, len(configs))
+	for _, cfg := range configs {
+		notifier, err := notify.New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers, nil
+}
+
+// notifyEvent describes the org's scan, with its outcome, for notifiers,
+// naming each object's owner.
+func notifyEvent(summary scanner.Summary, outcome string, owners ownerRules) notify.Event {
+	event := notify.Event{
+		RunId:           runID,
+		Org:             summary.Org,
+		Environment:     string(summary.Environment),
+		Outcome:         outcome,
+		DeletedFields:   summary.DeletedFields,
+		ResidualRecords: summary.ResidualRecords,
+		ObjectsAffected: len(summary.Objects),
+		Failures:        summary.Failures,
+		Duration:        summary.Duration,
+	}
+	for _, object := range summary.Objects {
+		entry := notify.Object{Name: object.Object, Records: object.Count, DeletedFields: object.Fields}
+		if owner, ok := owners.owner(object.Object); ok {
+			entry.Owner, entry.OwnerEmail = owner.name(), owner.Email
+		}
+		event.Objects = append(event.Objects, entry)
+	}
+	event.TopObjects = event.Objects[:min(summaryTopObjects, len(event.Objects))]
+	return event
+}
+
+// wantsChanges reports whether any notifier sends the changes since the
+// previous run, which then has to be read.
+func wantsChanges(configs []notify.Config) bool {
+	return slices.ContainsFunc(configs, func(cfg notify.Config) bool { return cfg.Diff })
+}
+
+// notifyChanges compares a run's records with the previous run's, naming
+// each field's owner. It returns nil when there was no previous run.
+func notifyChanges(previous, records []export.DeleteCountRecord, owners ownerRules) *notify.Changes {
+	if len(previous) == 0 {
+		return nil
+	}
+
+	changes := &notify.Changes{Previous: time.Unix(previous[0].Timestamp, 0).Format("2006-01-02")}
+	change := func(record export.DeleteCountRecord) notify.FieldChange {
+		field := notify.FieldChange{
+			Object:  record.QualifiedApiName,
+			Field:   record.DeveloperName,
+			Label:   record.FieldLabel,
+			Records: record.Count,
+			Counted: !record.CountSkipped,
+		}
+		if owner, ok := owners.owner(record.QualifiedApiName); ok {
+			field.Owner, field.OwnerEmail = owner.name(), owner.Email
+		}
+		return field
+	}
+
+	before := make(map[string]export.DeleteCountRecord, len(previous))
+	for _, record := range previous {
+		before[export.FieldKey(record.QualifiedApiName, record.DeveloperName)] = record
+	}
+	seen := make(map[string]bool, len(records))
+	for _, record := range records {
+		key := export.FieldKey(record.QualifiedApiName, record.DeveloperName)
+		seen[key] = true
+		then, ok := before[key]
+		switch {
+		case !ok:
+			changes.New = append(changes.New, change(record))
+		case !record.CountSkipped && !then.CountSkipped && record.Count != then.Count:
+			field := change(record)
+			field.Previous, field.Change = then.Count, record.Count-then.Count
+			changes.Counts = append(changes.Counts, field)
+		}
+	}
+	for key, record := range before {
+		if !seen[key] {
+			field := change(record)
+			field.Previous, field.Records, field.Counted = record.Count, 0, false
+			changes.Cleared = append(changes.Cleared, field)
+		}
+	}
+
+	byField := func(a, b notify.FieldChange) int {
+		return cmp.Or(cmp.Compare(a.Object, b.Object), cmp.Compare(a.Field, b.Field))
+	}
+	slices.SortFunc(changes.New, byField)
+	slices.SortFunc(changes.Cleared, byField)
+	slices.SortFunc(changes.Counts, func(a, b notify.FieldChange) int {
+		return cmp.Or(cmp.Compare(abs(b.Change), abs(a.Change)), byField(a, b))
+	})
+	return changes
+}
+
+// sendNotifications delivers the event to every notifier whose thresholds it
+// meets. Delivery failures are logged and do not fail the run.
+func sendNotifications(notifiers []*notify.Configured, event notify.Event) {
+	for _, notifier := range notifiers {
+		sent, err := notifier.Notify(context.Background(), event)
+		switch {
+		case err != nil:
+			slog.Warn("Failed to send notification", "notifier", notifier.Name, "org", event.Org, "error", err)
+		case sent:
+			slog.Info("Sent notification", "notifier", notifier.Name, "org", event.Org)
+		default:
+			slog.Debug("Notification below thresholds", "notifier", notifier.Name, "org", event.Org)
+		}
+	}
+}
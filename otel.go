@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+const (
+	otlpTimeout     = 10 * time.Second
+	otlpBatchSpans  = 512
+	otlpScopeName   = "git.dmoruzzi.com/sf-deleted-fields"
+	otlpDefaultName = "sf-deleted-fields"
+	otlpEndpointEnv = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otlpHeadersEnv  = "OTEL_EXPORTER_OTLP_HEADERS"
+	otlpServiceEnv  = "OTEL_SERVICE_NAME"
+	otlpSpanKindInt = 1 // SPAN_KIND_INTERNAL
+	otlpSpanKindCli = 3 // SPAN_KIND_CLIENT
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+// otelConfig sends a run's traces and metrics to an OpenTelemetry
+// collector over OTLP/HTTP. The standard OTEL_EXPORTER_OTLP_ENDPOINT,
+// OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME variables fill in
+// whatever is left empty.
+type otelConfig struct {
+	// Endpoint is the collector's base URL, e.g. http://collector:4318;
+	// /v1/traces and /v1/metrics are appended.
+	Endpoint    string            `yaml:"endpoint"`
+	Headers     map[string]string `yaml:"headers"`
+	ServiceName string            `yaml:"service_name"`
+}
+
+// otelExporter collects one span per Salesforce call, under a span per
+// org scan and one for the whole run, and the run's metrics, and sends them
+// when the run ends. A nil exporter, the default, collects nothing.
+type otelExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+
+	traceId string
+	runSpan string
+	started time.Time
+
+	mu       sync.Mutex
+	orgSpans map[string]string
+	spans    []otlpSpan
+	metrics  []otlpMetric
+}
+
+func newOtelExporter(cfg otelConfig) *otelExporter {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv(otlpEndpointEnv)
+	}
+	if endpoint == "" {
+		return nil
+	}
+
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(otlpHeadersEnv), ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	for key, value := range cfg.Headers {
+		headers[key] = value
+	}
+
+	service := cfg.ServiceName
+	if service == "" {
+		service = os.Getenv(otlpServiceEnv)
+	}
+	if service == "" {
+		service = otlpDefaultName
+	}
+
+	return &otelExporter{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		headers:  headers,
+		service:  service,
+		traceId:  otlpId(16),
+		runSpan:  otlpId(8),
+		started:  time.Now(),
+		orgSpans: make(map[string]string),
+	}
+}
+
+// orgSpan returns the ID of org's scan span, under which its calls go.
+// Callers hold mu.
+func (o *otelExporter) orgSpan(org string) string {
+	id, ok := o.orgSpans[org]
+	if !ok {
+		id = otlpId(8)
+		o.orgSpans[org] = id
+	}
+	return id
+}
+
+// addCall records a Salesforce call as a client span.
+func (o *otelExporter) addCall(call scanner.Call) {
+	if o == nil {
+		return
+	}
+	outcome, status := "ok", otlpStatus{Code: otlpStatusOK}
+	if call.Err != nil {
+		outcome, status = "error", otlpStatus{Code: otlpStatusError, Message: redact.Apply(call.Err.Error())}
+	}
+	attributes := []otlpAttribute{
+		otlpString("sf.org", redact.Apply(call.Org)),
+		otlpString("sf.call", call.Kind),
+		otlpString("sf.outcome", outcome),
+		otlpInt("sf.rows", int64(call.Rows)),
+	}
+	if call.Query != "" {
+		attributes = append(attributes, otlpString("db.system", "salesforce"), otlpString("db.statement", call.Query))
+	}
+	if object := queryObject(call.Query); object != "" {
+		attributes = append(attributes, otlpString("sf.object", object))
+	}
+	if call.Tooling {
+		attributes = append(attributes, otlpBool("sf.tooling", true))
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.spans = append(o.spans, otlpSpan{
+		TraceId:           o.traceId,
+		SpanId:            otlpId(8),
+		ParentSpanId:      o.orgSpan(call.Org),
+		Name:              "salesforce." + call.Kind,
+		Kind:              otlpSpanKindCli,
+		StartTimeUnixNano: otlpTime(call.Started),
+		EndTimeUnixNano:   otlpTime(call.Started.Add(call.Duration)),
+		Attributes:        attributes,
+		Status:            status,
+	})
+}
+
+// addScan records an org's scan as a span, with its summary as metrics.
+func (o *otelExporter) addScan(scan *scanner.Scan, summary scanner.Summary, outcome string) {
+	if o == nil {
+		return
+	}
+	progress := scan.Progress()
+	org := attributesOf(otlpString("sf.org", summary.Org))
+	status := otlpStatus{Code: otlpStatusOK}
+	if outcome != outcomeOK {
+		status = otlpStatus{Code: otlpStatusError, Message: outcome}
+	}
+	now := otlpTime(time.Now())
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.spans = append(o.spans, otlpSpan{
+		TraceId:           o.traceId,
+		SpanId:            o.orgSpan(scan.Org()),
+		ParentSpanId:      o.runSpan,
+		Name:              "scan",
+		Kind:              otlpSpanKindInt,
+		StartTimeUnixNano: otlpTime(progress.Started),
+		EndTimeUnixNano:   otlpTime(progress.Finished),
+		Attributes: append(org,
+			otlpString("sf.outcome", outcome),
+			otlpString("sf.environment", string(summary.Environment)),
+			otlpInt("sf.deleted_fields", summary.DeletedFields),
+			otlpInt("sf.residual_records", int64(summary.ResidualRecords)),
+		),
+		Status: status,
+	})
+
+	for _, metric := range []struct {
+		name, unit, description string
+		value                   float64
+	}{
+		{"sfdf.deleted_fields", "{field}", "Deleted fields found", float64(summary.DeletedFields)},
+		{"sfdf.residual_records", "{record}", "Records still stored on objects with deleted fields", float64(summary.ResidualRecords)},
+		{"sfdf.objects_affected", "{object}", "Objects with deleted fields holding records", float64(len(summary.Objects))},
+		{"sfdf.failures", "{count}", "Counts that failed", float64(summary.Failures)},
+		{"sfdf.api_calls", "{call}", "Salesforce API calls made", float64(summary.ApiCalls)},
+		{"sfdf.scan.duration", "s", "Time taken to scan the org", summary.Duration.Seconds()},
+	} {
+		o.metrics = append(o.metrics, otlpMetric{
+			Name:        metric.name,
+			Unit:        metric.unit,
+			Description: metric.description,
+			Gauge: &otlpGauge{DataPoints: []otlpDataPoint{{
+				Attributes:   append(attributesOf(otlpString("sf.outcome", outcome)), org...),
+				TimeUnixNano: now,
+				AsDouble:     metric.value,
+			}}},
+		})
+	}
+}
+
+// send posts the run span, every collected span and the metrics to the
+// collector. Failures are logged but never fail the run.
+func (o *otelExporter) send(outcome string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	spans := append(o.spans, otlpSpan{
+		TraceId:           o.traceId,
+		SpanId:            o.runSpan,
+		Name:              "sf-deleted-fields run",
+		Kind:              otlpSpanKindInt,
+		StartTimeUnixNano: otlpTime(o.started),
+		EndTimeUnixNano:   otlpTime(time.Now()),
+		Attributes:        attributesOf(otlpString("sf.run_id", runID), otlpString("sf.outcome", outcome)),
+		Status:            otlpStatus{Code: otlpStatusOK},
+	})
+	metrics := o.metrics
+	o.mu.Unlock()
+
+	resource := otlpResource{Attributes: attributesOf(
+		otlpString("service.name", o.service),
+		otlpString("service.version", version),
+	)}
+	scope := otlpScope{Name: otlpScopeName, Version: version}
+
+	for start := 0; start < len(spans); start += otlpBatchSpans {
+		batch := spans[start:min(start+otlpBatchSpans, len(spans))]
+		payload := map[string]any{"resourceSpans": []any{map[string]any{
+			"resource":   resource,
+			"scopeSpans": []any{map[string]any{"scope": scope, "spans": batch}},
+		}}}
+		if err := o.post("/v1/traces", payload); err != nil {
+			slog.Warn("Failed to send OpenTelemetry traces", "endpoint", o.endpoint, "error", err)
+			return
+		}
+	}
+	payload := map[string]any{"resourceMetrics": []any{map[string]any{
+		"resource":     resource,
+		"scopeMetrics": []any{map[string]any{"scope": scope, "metrics": metrics}},
+	}}}
+	if err := o.post("/v1/metrics", payload); err != nil {
+		slog.Warn("Failed to send OpenTelemetry metrics", "endpoint", o.endpoint, "error", err)
+		return
+	}
+	slog.Debug("Sent OpenTelemetry data", "endpoint", o.endpoint, "spans", len(spans), "metrics", len(metrics), "trace_id", o.traceId)
+}
+
+func (o *otelExporter) post(path string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), otlpTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", o.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range o.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("request to %s failed with status %d", path, resp.StatusCode)
+	}
+	return nil
+}
+
+var fromClause = regexp.MustCompile(`(?i)\bFROM\s+([A-Za-z0-9_]+)`)
+
+// queryObject returns the object a SOQL query reads, or "" if it has none.
+func queryObject(soql string) string {
+	if match := fromClause.FindStringSubmatch(soql); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// The OTLP/JSON encoding: IDs are hex, times and integers are strings.
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]any{"stringValue": value}}
+}
+
+func otlpInt(key string, value int64) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]any{"intValue": strconv.FormatInt(value, 10)}}
+}
+
+func otlpBool(key string, value bool) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]any{"boolValue": value}}
+}
+
+func attributesOf(attributes ...otlpAttribute) []otlpAttribute {
+	return attributes
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Unit        string     `json:"unit"`
+	Description string     `json:"description"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpId returns a random trace (16 bytes) or span (8 bytes) ID.
+func otlpId(size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// ownerRule assigns the cleanup of the deleted fields on matching objects
+// to a team. Object is a glob such as "Invoice__c" or "*__c", Namespace the
+// object's namespace prefix; an empty one matches every object.
+type ownerRule struct {
+	Object    string `yaml:"object"`
+	Namespace string `yaml:"namespace"`
+	Team      string `yaml:"team"`
+	Email     string `yaml:"email"`
+}
+
+// ownerRules map objects to their owning teams; the first matching rule
+// wins, so specific rules go before catch-alls.
+type ownerRules []ownerRule
+
+func (r ownerRules) check() error {
+	for i, rule := range r {
+		if rule.Team == "" && rule.Email == "" {
+			return fmt.Errorf("owner rule %d: team or email is required", i+1)
+		}
+		if _, err := path.Match(rule.Object, ""); err != nil {
+			return fmt.Errorf("owner rule %d: invalid object pattern %q: %w", i+1, rule.Object, err)
+		}
+	}
+	return nil
+}
+
+// owner returns the rule owning object, if any.
+func (r ownerRules) owner(object string) (ownerRule, bool) {
+	for _, rule := range r {
+		if rule.Namespace != "" && rule.Namespace != export.Namespace(object) {
+			continue
+		}
+		if matched, _ := path.Match(rule.Object, object); rule.Object != "" && !matched {
+			continue
+		}
+		return rule, true
+	}
+	return ownerRule{}, false
+}
+
+// name is how reports show the owner: the team, else the email.
+func (o ownerRule) name() string {
+	if o.Team == "" {
+		return o.Email
+	}
+	return o.Team
+}
+
+// ownerName returns the name of object's owner for reports, or "" when no
+// rule matches.
+func (r ownerRules) ownerName(object string) string {
+	owner, ok := r.owner(object)
+	if !ok {
+		return ""
+	}
+	return owner.name()
+}
@@ -0,0 +1,389 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Anonymizer replaces the org, custom object and field names in records
+// with pseudonyms, so an export can be shared as a reproduction without
+// revealing the org's schema. The same name always gets the same
+// pseudonym, and the mapping is kept in a file so later runs reuse it and
+// Deanonymize can restore the real names.
+//
+// Standard objects such as Account keep their names, which say nothing
+// about the org. Custom objects keep their namespace structure and
+// suffix, e.g. acme__Invoice__c becomes ns1__Object001__c, and deleted
+// fields keep their _del suffix, so collisions between Region_del and
+// Region_del1 survive anonymization.
+type Anonymizer struct {
+	mu      sync.Mutex
+	mapping anonymizerMapping
+}
+
+// anonymizerMapping is the mapping file: every section maps a real value
+// to its pseudonym.
+type anonymizerMapping struct {
+	Orgs       map[string]string `json:"orgs"`
+	Namespaces map[string]string `json:"namespaces"`
+	Objects    map[string]string `json:"objects"`
+	Ids        map[string]string `json:"ids"`
+	Fields     map[string]string `json:"fields"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// deletedSuffix matches the suffix Salesforce gives deleted fields.
+var deletedSuffix = regexp.MustCompile(`_del\d*$`)
+
+// LoadAnonymizer reads the mapping at path, or starts an empty one if the
+// file does not exist yet.
+func LoadAnonymizer(path string) (*Anonymizer, error) {
+	a := &Anonymizer{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read anonymization map: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &a.mapping); err != nil {
+			return nil, fmt.Errorf("failed to decode anonymization map %s: %w", path, err)
+		}
+	}
+	for _, section := range a.mapping.sections() {
+		if *section == nil {
+			*section = make(map[string]string)
+		}
+	}
+	return a, nil
+}
+
+func (m *anonymizerMapping) sections() []*map[string]string {
+	return []*map[string]string{&m.Orgs, &m.Namespaces, &m.Objects, &m.Ids, &m.Fields, &m.Labels}
+}
+
+// Save writes the mapping to path, readable only by its owner since it
+// undoes the anonymization.
+func (a *Anonymizer) Save(path string) error {
+	// Held throughout, so concurrent saves land in order and the last
+	// holds every pseudonym.
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	data, err := json.MarshalIndent(a.mapping, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode anonymization map: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create anonymization map: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write anonymization map: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write anonymization map: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Org returns org's pseudonym.
+func (a *Anonymizer) Org(org string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.org(org)
+}
+
+// Records returns records with every name replaced by its pseudonym.
+// Enrichment data may hold anything, and a count filter quotes field names
+// and the org's data, so Extra and CountFilter are dropped.
+func (a *Anonymizer) Records(records []DeleteCountRecord) []DeleteCountRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	anonymized := make([]DeleteCountRecord, len(records))
+	for i, record := range records {
+		object := a.object(record.QualifiedApiName)
+		record.ObjectLabel = a.objectLabel(record.QualifiedApiName, record.ObjectLabel)
+		record.ObjectPluralLabel = a.objectLabel(record.QualifiedApiName, record.ObjectPluralLabel)
+		record.FieldLabel = a.fieldLabel(record.DeveloperName, record.FieldLabel)
+		record.DeveloperName = a.field(record.DeveloperName)
+		record.ActiveField = a.activeField(record.ActiveField)
+		if record.ApiName == objectDeveloperName(record.QualifiedApiName) {
+			record.ApiName = objectDeveloperName(object)
+		}
+		record.QualifiedApiName = object
+		record.TableEnumOrId = a.table(record.TableEnumOrId)
+		record.ReferenceTo = a.object(record.ReferenceTo)
+		record.Org = a.org(record.Org)
+		record.Extra = nil
+		record.CountFilter = ""
+		anonymized[i] = record
+	}
+
+	// Errors and lookup types quote names, so anything mapped so far is
+	// replaced in them too.
+	replacer := a.mapping.replacer(false)
+	for i := range anonymized {
+		anonymized[i].Error = replacer.Replace(anonymized[i].Error)
+		anonymized[i].DataType = replacer.Replace(anonymized[i].DataType)
+	}
+	return anonymized
+}
+
+// Deanonymize restores the real names in records anonymized with this
+// mapping. Records carrying pseudonyms the mapping does not know keep them.
+func (a *Anonymizer) Deanonymize(records []DeleteCountRecord) []DeleteCountRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	reverse := func(m map[string]string) map[string]string {
+		inverse := make(map[string]string, len(m))
+		for real, pseudonym := range m {
+			inverse[pseudonym] = real
+		}
+		return inverse
+	}
+	lookup := func(m map[string]string, value string) string {
+		if real, ok := m[value]; ok {
+			return real
+		}
+		return value
+	}
+	orgs, objects, ids, labels := reverse(a.mapping.Orgs), reverse(a.mapping.Objects), reverse(a.mapping.Ids), reverse(a.mapping.Labels)
+	fields, namespaces := reverse(a.mapping.Fields), reverse(a.mapping.Namespaces)
+	replacer := a.mapping.replacer(true)
+
+	restored := make([]DeleteCountRecord, len(records))
+	for i, record := range records {
+		suffix := deletedSuffix.FindString(record.DeveloperName)
+		record.DeveloperName = lookup(fields, strings.TrimSuffix(record.DeveloperName, suffix)) + suffix
+		if parts := strings.Split(record.ActiveField, "__"); len(parts) > 1 {
+			if len(parts) > 2 {
+				parts[0] = lookup(namespaces, parts[0])
+			}
+			parts[len(parts)-2] = lookup(fields, parts[len(parts)-2])
+			record.ActiveField = strings.Join(parts, "__")
+		}
+		real := lookup(objects, record.QualifiedApiName)
+		if record.ApiName == objectDeveloperName(record.QualifiedApiName) {
+			record.ApiName = objectDeveloperName(real)
+		}
+		record.QualifiedApiName = real
+		record.ReferenceTo = lookup(objects, record.ReferenceTo)
+		record.TableEnumOrId = lookup(ids, lookup(objects, record.TableEnumOrId))
+		record.Org = lookup(orgs, record.Org)
+		record.FieldLabel = lookup(labels, record.FieldLabel)
+		record.ObjectLabel = lookup(labels, record.ObjectLabel)
+		record.ObjectPluralLabel = lookup(labels, record.ObjectPluralLabel)
+		record.Error = replacer.Replace(record.Error)
+		record.DataType = replacer.Replace(record.DataType)
+		restored[i] = record
+	}
+	return restored
+}
+
+// pseudonym returns value's pseudonym in section, numbering a new one
+// after those already there.
+func pseudonym(section map[string]string, value, format string) string {
+	if value == "" {
+		return ""
+	}
+	if p, ok := section[value]; ok {
+		return p
+	}
+	p := fmt.Sprintf(format, len(section)+1)
+	section[value] = p
+	return p
+}
+
+func (a *Anonymizer) org(org string) string {
+	return pseudonym(a.mapping.Orgs, org, "Org%02d")
+}
+
+// object pseudonymizes a custom object's API name part by part; standard
+// objects have no __ and are kept.
+func (a *Anonymizer) object(name string) string {
+	parts := strings.Split(name, "__")
+	if len(parts) < 2 {
+		return name
+	}
+	if p, ok := a.mapping.Objects[name]; ok {
+		return p
+	}
+
+	if len(parts) > 2 {
+		parts[0] = pseudonym(a.mapping.Namespaces, parts[0], "ns%d")
+	}
+	parts[len(parts)-2] = fmt.Sprintf("Object%03d", len(a.mapping.Objects)+1)
+	p := strings.Join(parts, "__")
+	a.mapping.Objects[name] = p
+	return p
+}
+
+// objectDeveloperName returns an object's name without its namespace and
+// suffix, as EntityDefinition.DeveloperName gives it.
+func objectDeveloperName(qualifiedApiName string) string {
+	parts := strings.Split(qualifiedApiName, "__")
+	if len(parts) < 2 {
+		return qualifiedApiName
+	}
+	return parts[len(parts)-2]
+}
+
+// table pseudonymizes TableEnumOrId: a custom object's ID or, for standard
+// objects, their name.
+func (a *Anonymizer) table(table string) string {
+	if strings.Contains(table, "__") {
+		return a.object(table)
+	}
+	if strings.HasPrefix(table, "01I") {
+		return pseudonym(a.mapping.Ids, table, "01I%012d")
+	}
+	return table
+}
+
+// field pseudonymizes a deleted field's developer name, keeping its _del
+// suffix so numbered duplicates share a pseudonym stem.
+func (a *Anonymizer) field(name string) string {
+	suffix := deletedSuffix.FindString(name)
+	stem := strings.TrimSuffix(name, suffix)
+	return pseudonym(a.mapping.Fields, stem, "Field%03d") + suffix
+}
+
+// activeField pseudonymizes the API name of the field re-created under a
+// deleted field's name with the deleted field's stem, so Region__c goes
+// with Region_del, and its namespace like an object's.
+func (a *Anonymizer) activeField(name string) string {
+	parts := strings.Split(name, "__")
+	if len(parts) < 2 {
+		return name
+	}
+	if len(parts) > 2 {
+		parts[0] = pseudonym(a.mapping.Namespaces, parts[0], "ns%d")
+	}
+	parts[len(parts)-2] = pseudonym(a.mapping.Fields, parts[len(parts)-2], "Field%03d")
+	return strings.Join(parts, "__")
+}
+
+func (a *Anonymizer) fieldLabel(name, label string) string {
+	if label == "" {
+		return ""
+	}
+	return a.label(label, strings.TrimSuffix(a.field(name), deletedSuffix.FindString(name)))
+}
+
+func (a *Anonymizer) objectLabel(object, label string) string {
+	if label == "" || !strings.Contains(object, "__") {
+		return label
+	}
+	parts := strings.Split(a.object(object), "__")
+	return a.label(label, parts[len(parts)-2])
+}
+
+// label maps a real label to the pseudonym it is first seen with, numbered
+// apart if another label already took it, e.g. when a field is labeled
+// differently on two objects.
+func (a *Anonymizer) label(label, p string) string {
+	if existing, ok := a.mapping.Labels[label]; ok {
+		return existing
+	}
+	for _, taken := range a.mapping.Labels {
+		if taken == p {
+			p = fmt.Sprintf("%s (%d)", p, len(a.mapping.Labels)+1)
+			break
+		}
+	}
+	a.mapping.Labels[label] = p
+	return p
+}
+
+// replacer swaps every mapped name in free text for its pseudonym, or back
+// when reverse is set.
+func (m *anonymizerMapping) replacer(reverse bool) nameReplacer {
+	r := nameReplacer{pairs: make(map[string]string), stems: make(map[string]bool)}
+	for _, section := range []map[string]string{m.Objects, m.Ids, m.Labels, m.Orgs} {
+		for real, p := range section {
+			if reverse {
+				real, p = p, real
+			}
+			r.pairs[real] = p
+		}
+	}
+	for stem, p := range m.Fields {
+		if reverse {
+			stem, p = p, stem
+		}
+		r.pairs[stem] = p
+		r.stems[stem] = true
+	}
+
+	for key := range r.pairs {
+		r.keys = append(r.keys, key)
+	}
+	sort.Slice(r.keys, func(i, j int) bool { return len(r.keys[i]) > len(r.keys[j]) })
+	return r
+}
+
+// fieldNameSuffix matches what follows a field's stem in its API name: the
+// suffix of a deleted field, or the __c of the active one.
+var fieldNameSuffix = regexp.MustCompile(`^(_del\d*|__c)`)
+
+// nameReplacer replaces mapped names in text only where they stand as whole
+// names, so Account is replaced in Lookup(Account) but not inside
+// AccountContactRelation or Account__c. A field's stem also stands whole
+// before its suffix, as in Region_del1. Longer names go first so one name
+// inside another is not replaced piecemeal.
+type nameReplacer struct {
+	pairs map[string]string
+	stems map[string]bool
+	keys  []string
+}
+
+func (r nameReplacer) Replace(s string) string {
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(s); i++ {
+		if i > 0 && isNameByte(s[i-1]) && isNameByte(s[i]) {
+			continue
+		}
+		for _, key := range r.keys {
+			if !strings.HasPrefix(s[i:], key) {
+				continue
+			}
+			end := i + len(key)
+			if r.stems[key] {
+				end += len(fieldNameSuffix.FindString(s[end:]))
+			}
+			if end < len(s) && isNameByte(s[end]) && isNameByte(s[end-1]) {
+				continue
+			}
+			b.WriteString(s[last:i])
+			b.WriteString(r.pairs[key])
+			b.WriteString(s[i+len(key) : end])
+			last = end
+			i = end - 1
+			break
+		}
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// isNameByte reports whether c continues an API name: a letter, digit or
+// underscore, or any byte of a multi-byte character.
+func isNameByte(c byte) bool {
+	return c == '_' || c >= utf8.RuneSelf || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
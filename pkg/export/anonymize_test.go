@@ -0,0 +1,109 @@
+package export
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizeRoundTrip(t *testing.T) {
+	records := []DeleteCountRecord{
+		{Org: "acme-prod", QualifiedApiName: "Account", ApiName: "Account", TableEnumOrId: "Account", DeveloperName: "Legacy_Status_del", FieldLabel: "Legacy Status", ActiveField: "Legacy_Status__c", Count: 120},
+		{Org: "acme-prod", QualifiedApiName: "acme__Invoice__c", ApiName: "Invoice", TableEnumOrId: "01I000000000001", DeveloperName: "Region_del1", FieldLabel: "Sales Region", DataType: "Lookup(acme__Invoice__c)", ReferenceTo: "acme__Invoice__c", ActiveField: "acme__Region__c", Count: 7},
+		{Org: "acme-prod", QualifiedApiName: "Contact", ApiName: "Contact", TableEnumOrId: "Contact", DeveloperName: "Notes_del", Status: StatusCountFailed, Error: "No such column 'Notes_del' on acme__Invoice__c"},
+	}
+
+	tests := []struct {
+		field string
+		real  func(DeleteCountRecord) string
+	}{
+		{"Org", func(r DeleteCountRecord) string { return r.Org }},
+		{"QualifiedApiName", func(r DeleteCountRecord) string { return r.QualifiedApiName }},
+		{"DeveloperName", func(r DeleteCountRecord) string { return r.DeveloperName }},
+		{"ActiveField", func(r DeleteCountRecord) string { return r.ActiveField }},
+		{"FieldLabel", func(r DeleteCountRecord) string { return r.FieldLabel }},
+		{"DataType", func(r DeleteCountRecord) string { return r.DataType }},
+		{"Error", func(r DeleteCountRecord) string { return r.Error }},
+	}
+
+	anonymizer, err := LoadAnonymizer(filepath.Join(t.TempDir(), "map.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymized := anonymizer.Records(records)
+	for i, record := range anonymized {
+		for _, tt := range tests {
+			got := tt.real(record)
+			for _, secret := range []string{"acme", "Invoice", "Legacy_Status", "Region", "Notes", "Sales Region"} {
+				if strings.Contains(got, secret) {
+					t.Errorf("record %d: %s %q still holds %q", i, tt.field, got, secret)
+				}
+			}
+		}
+	}
+	if got := anonymized[0].ActiveField; got != strings.TrimSuffix(anonymized[0].DeveloperName, "_del")+"__c" {
+		t.Errorf("ActiveField %q does not share the pseudonym of %q", got, anonymized[0].DeveloperName)
+	}
+
+	// A second load of the saved mapping undoes it.
+	path := filepath.Join(t.TempDir(), "map.json")
+	if err := anonymizer.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadAnonymizer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := reloaded.Deanonymize(anonymized)
+	for i := range records {
+		if !reflect.DeepEqual(restored[i], records[i]) {
+			t.Errorf("record %d:\n got %+v\nwant %+v", i, restored[i], records[i])
+		}
+	}
+}
+
+func TestAnonymizeDropsCountFilter(t *testing.T) {
+	anonymizer, err := LoadAnonymizer(filepath.Join(t.TempDir(), "map.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []DeleteCountRecord{{Org: "acme-prod", QualifiedApiName: "acme__Invoice__c", DeveloperName: "Region_del", Count: 3, CountFilter: "acme__Region__c = 'EMEA' AND Owner.Email = 'jo@acme.example'"}}
+	if got := anonymizer.Records(records)[0].CountFilter; got != "" {
+		t.Errorf("CountFilter kept as %q", got)
+	}
+}
+
+func TestNameReplacer(t *testing.T) {
+	mapping := anonymizerMapping{
+		Objects: map[string]string{"Invoice__c": "Object001__c", "acme__Invoice__c": "ns1__Object002__c"},
+		Fields:  map[string]string{"Region": "Field001", "Region_Code": "Field002"},
+		Labels:  map[string]string{"Account": "Object001", "Sales Region": "Label001"},
+		Orgs:    map[string]string{"acme": "Org01"},
+	}
+
+	tests := []struct {
+		name, text, want string
+	}{
+		{"lookup", "Lookup(Invoice__c)", "Lookup(Object001__c)"},
+		{"namespaced object", "Lookup(acme__Invoice__c)", "Lookup(ns1__Object002__c)"},
+		{"label inside longer name", "AccountContactRelation is not Account", "AccountContactRelation is not Object001"},
+		{"label as object name", "Lookup(Account__c)", "Lookup(Account__c)"},
+		{"deleted field", "No such column 'Region_del1'", "No such column 'Field001_del1'"},
+		{"longer stem", "Region_Code_del and Region__c", "Field002_del and Field001__c"},
+		{"stem inside longer name", "RegionalManager__c", "RegionalManager__c"},
+		{"label with spaces", "Sales Region (old)", "Label001 (old)"},
+		{"org", "acme-prod and acme", "Org01-prod and Org01"},
+		{"nothing mapped", "SELECT Count() FROM Contact", "SELECT Count() FROM Contact"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapping.replacer(false).Replace(tt.text); got != tt.want {
+				t.Errorf("Replace(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if got := mapping.replacer(true).Replace(tt.want); got != tt.text {
+				t.Errorf("reverse Replace(%q) = %q, want %q", tt.want, got, tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Backfill adds to the export at filename the records add returns for its
+// current ones, e.g. counts kept from before the first run. The export is
+// read and rewritten under its lock, so no run writes to it in between, and
+// the new history is written to a temporary file renamed over the export,
+// so a failed write leaves the export as it was. The export keeps its
+// format, grouped JSON included, and its lastRunCount still counts its
+// latest run. A database only has the added records
+// inserted, and nothing is written when add returns none.
+func Backfill(filename string, run Run, add func(existing []DeleteCountRecord) []DeleteCountRecord) error {
+	run.Append = true
+	run.History = true
+	if IsPostgres(filename) {
+		data, err := readPostgresExport(filename)
+		if err != nil {
+			return err
+		}
+		added := add(data.Results)
+		if len(added) == 0 {
+			return nil
+		}
+		return postgresExporter{dsn: filename}.Write(run, added)
+	}
+
+	unlock, err := run.lock(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := Read(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read existing export: %w", err)
+	}
+	added := add(data.Results)
+	if len(added) == 0 {
+		return nil
+	}
+	records := append(data.Results, added...)
+
+	format := FormatForPath(filename)
+	if format == "json" && isGroupedJSON(filename) {
+		format = "grouped"
+	}
+
+	// The exporters read what is at their path first, so they are given
+	// one that does not exist yet.
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	defer os.Remove(tmp.Name())
+
+	exporter, err := New(format, tmp.Name())
+	if err != nil {
+		return err
+	}
+	if err := exporter.Write(run, records); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", filename, err)
+	}
+	return nil
+}
+
+// isGroupedJSON reports whether the JSON export at filename nests its
+// records by object and field.
+func isGroupedJSON(filename string) bool {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	var document struct {
+		Objects json.RawMessage `json:"objects"`
+	}
+	return json.NewDecoder(file).Decode(&document) == nil && document.Objects != nil
+}
@@ -0,0 +1,79 @@
+package export
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackfill(t *testing.T) {
+	scanned := time.Date(2026, 3, 10, 8, 0, 0, 0, time.Local)
+	legacy := time.Date(2024, 1, 5, 0, 0, 0, 0, time.Local)
+	latest := LastCount{Date: "2026-03-10", Count: 120}
+
+	tests := []struct {
+		name    string
+		format  string
+		ext     string
+		added   []DeleteCountRecord
+		results int
+	}{
+		{"json", "json", ".json", []DeleteCountRecord{record("dev", "Account", "Old_del", 7, legacy), record("dev", "Contact", "Old_del", 9, legacy)}, 3},
+		{"grouped", "grouped", ".json", []DeleteCountRecord{record("dev", "Account", "Old_del", 7, legacy)}, 2},
+		{"ndjson", "ndjson", ".ndjson", []DeleteCountRecord{record("dev", "Account", "Old_del", 7, legacy)}, 2},
+		{"csv", "csv", ".csv", []DeleteCountRecord{record("dev", "Account", "Old_del", 7, legacy)}, 2},
+		{"nothing added", "json", ".json", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "deleted_fields"+tt.ext)
+			exporter, err := New(tt.format, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := exporter.Write(Run{Org: "dev"}, []DeleteCountRecord{record("dev", "Account", "Region_del", 120, scanned)}); err != nil {
+				t.Fatal(err)
+			}
+			before, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var existing int
+			err = Backfill(path, Run{}, func(records []DeleteCountRecord) []DeleteCountRecord {
+				existing = len(records)
+				return tt.added
+			})
+			if err != nil {
+				t.Fatalf("Backfill: %v", err)
+			}
+			if existing != 1 {
+				t.Errorf("add was given %d existing records, want 1", existing)
+			}
+
+			after, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.added) == 0 && !bytes.Equal(before, after) {
+				t.Errorf("export rewritten although nothing was added")
+			}
+			if tt.format == "grouped" && !isGroupedJSON(path) {
+				t.Errorf("grouped export was flattened")
+			}
+
+			data, err := Read(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data.Results) != tt.results {
+				t.Errorf("got %d records, want %d", len(data.Results), tt.results)
+			}
+			if tt.ext == ".json" && (len(data.LastRunCount) != 1 || data.LastRunCount[0] != latest) {
+				t.Errorf("lastRunCount = %v, want the latest run's %v", data.LastRunCount, latest)
+			}
+		})
+	}
+}
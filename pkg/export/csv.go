@@ -0,0 +1,236 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// csvExporter appends one row per record, writing the header when the file
+// is created, so spreadsheets and BI tools can load the history directly.
+// Rows follow the existing file's header, so files written before a column
+// was added keep their layout; a new file gets a column per record field,
+// or per Run.Fields when set.
+type csvExporter struct {
+	path string
+}
+
+func (e csvExporter) Write(run Run, records []DeleteCountRecord) error {
+	slog.Debug("Appending records to CSV file", "records", len(records), "file", e.path)
+	unlock, err := run.lock(e.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	records = run.stamp(records)
+	if err := run.replacementFor(records).dropReplacedRows(e.path); err != nil {
+		return err
+	}
+
+	header, err := readCSVHeader(e.path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(e.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open file for append: %w", err)
+	}
+	defer file.Close()
+
+	if err := writeCSVRecords(file, header, run, records); err != nil {
+		return err
+	}
+
+	slog.Info("Successfully appended results to CSV file", "file", e.path)
+	return file.Close()
+}
+
+// writeCSVRecords writes records as rows in the columns of header, first
+// writing a header of every record field, or of run.Fields when set, when
+// header is nil.
+func writeCSVRecords(w io.Writer, header []string, run Run, records []DeleteCountRecord) error {
+	writer := csv.NewWriter(w)
+	if header == nil {
+		header = RecordFields()
+		if len(run.Fields) > 0 {
+			header = slices.DeleteFunc(header, func(name string) bool { return !slices.Contains(run.Fields, name) })
+		}
+		writer.Write(header)
+	}
+	sortRecords(records)
+	for _, record := range records {
+		values := map[string]string{
+			"RunId":             record.RunId,
+			"Org":               record.Org,
+			"DeveloperName":     record.DeveloperName,
+			"TableEnumOrId":     record.TableEnumOrId,
+			"QualifiedApiName":  record.QualifiedApiName,
+			"ApiName":           record.ApiName,
+			"FieldLabel":        record.FieldLabel,
+			"ObjectLabel":       record.ObjectLabel,
+			"ObjectPluralLabel": record.ObjectPluralLabel,
+			"DataType":          record.DataType,
+			"ReferenceTo":       record.ReferenceTo,
+			"FormulaType":       record.FormulaType,
+			"Count":             strconv.Itoa(record.Count),
+			"Timestamp":         strconv.FormatInt(record.Timestamp, 10),
+			"TimestampISO":      record.TimestampISO,
+			"CountSkipped":      strconv.FormatBool(record.CountSkipped),
+			"Approximate":       strconv.FormatBool(record.Approximate),
+			"Sampled":           strconv.FormatBool(record.Sampled),
+			"CountFilter":       record.CountFilter,
+			"Status":            string(record.Status),
+			"Error":             record.Error,
+			"Unstable":          strconv.FormatBool(record.Unstable),
+			"Recount":           strconv.Itoa(record.Recount),
+			"DeleteCandidate":   strconv.FormatBool(record.DeleteCandidate),
+			"ActiveField":       record.ActiveField,
+			"Version":           record.Version,
+			"Commit":            record.Commit,
+			"Extra":             csvExtra(record.Extra),
+		}
+		row := make([]string, len(header))
+		for i, name := range header {
+			row[i] = values[name]
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write records: %w", err)
+	}
+	return nil
+}
+
+// csvExtra encodes enrichment fields as a JSON object in a single column.
+func csvExtra(extra map[string]any) string {
+	if len(extra) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(extra)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// readCSVHeader returns the header of an existing CSV export, or nil when
+// the file is missing or empty.
+func readCSVHeader(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open existing file: %w", err)
+	}
+	defer file.Close()
+
+	header, err := csv.NewReader(file).Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	return header, nil
+}
+
+func readCSVExport(filename string) (Data, error) {
+	var exportData Data
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return exportData, nil
+	}
+	if err != nil {
+		return exportData, fmt.Errorf("failed to open existing file: %w", err)
+	}
+	defer file.Close()
+
+	slog.Debug("Reading existing records from file", "file", filename)
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return exportData, nil
+	}
+	if err != nil {
+		return exportData, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	value := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return exportData, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		record := DeleteCountRecord{
+			DeveloperName:     value(row, "DeveloperName"),
+			TableEnumOrId:     value(row, "TableEnumOrId"),
+			QualifiedApiName:  value(row, "QualifiedApiName"),
+			ApiName:           value(row, "ApiName"),
+			FieldLabel:        value(row, "FieldLabel"),
+			ObjectLabel:       value(row, "ObjectLabel"),
+			ObjectPluralLabel: value(row, "ObjectPluralLabel"),
+			DataType:          value(row, "DataType"),
+			ReferenceTo:       value(row, "ReferenceTo"),
+			FormulaType:       value(row, "FormulaType"),
+			TimestampISO:      value(row, "TimestampISO"),
+			RunId:             value(row, "RunId"),
+			Org:               value(row, "Org"),
+			Version:           value(row, "Version"),
+			Commit:            value(row, "Commit"),
+			Status:            Status(value(row, "Status")),
+			Error:             value(row, "Error"),
+		}
+		// Exports limited to some fields may lack either column.
+		if count := value(row, "Count"); count != "" {
+			if record.Count, err = strconv.Atoi(count); err != nil {
+				return exportData, fmt.Errorf("invalid Count on line %d: %w", line, err)
+			}
+		}
+		if timestamp := value(row, "Timestamp"); timestamp != "" {
+			if record.Timestamp, err = strconv.ParseInt(timestamp, 10, 64); err != nil {
+				return exportData, fmt.Errorf("invalid Timestamp on line %d: %w", line, err)
+			}
+		}
+		record.CountSkipped, _ = strconv.ParseBool(value(row, "CountSkipped"))
+		record.Approximate, _ = strconv.ParseBool(value(row, "Approximate"))
+		record.Sampled, _ = strconv.ParseBool(value(row, "Sampled"))
+		record.CountFilter = value(row, "CountFilter")
+		record.Unstable, _ = strconv.ParseBool(value(row, "Unstable"))
+		record.Recount, _ = strconv.Atoi(value(row, "Recount"))
+		record.DeleteCandidate, _ = strconv.ParseBool(value(row, "DeleteCandidate"))
+		record.ActiveField = value(row, "ActiveField")
+		if extra := value(row, "Extra"); extra != "" {
+			if err := json.Unmarshal([]byte(extra), &record.Extra); err != nil {
+				return exportData, fmt.Errorf("invalid Extra on line %d: %w", line, err)
+			}
+		}
+		exportData.Results = append(exportData.Results, record)
+	}
+
+	exportData.LastRunCount = calculateCurCounts(LatestRunRecords(exportData.Results))
+	return exportData, nil
+}
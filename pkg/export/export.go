@@ -0,0 +1,365 @@
+// Package export reads and writes the deleted field count history: a JSON
+// document rewritten on every run, or an NDJSON file appended to.
+package export
+
+import (
+	"cmp"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// DeleteCountRecord is one deleted field and the record count of its object
+// at the time of a run.
+type DeleteCountRecord struct {
+	DeveloperName    string `json:"DeveloperName"`
+	TableEnumOrId    string `json:"TableEnumOrId"`
+	QualifiedApiName string `json:"QualifiedApiName"`
+	ApiName          string `json:"ApiName"`
+	Count            int    `json:"Count"`
+	Timestamp        int64  `json:"Timestamp"`
+	TimestampISO     string `json:"TimestampISO"`
+	CountSkipped     bool   `json:"CountSkipped,omitempty"`
+	Approximate      bool   `json:"Approximate,omitempty"`
+
+	// Sampled marks an Approximate count estimated from a sample of the
+	// object's records; see scanner.Config.Sample.
+	Sampled bool `json:"Sampled,omitempty"`
+
+	// CountFilter is the WHERE clause Count was restricted to; see
+	// scanner.Config.CountFilters.
+	CountFilter string `json:"CountFilter,omitempty"`
+
+	// Status tells a genuine count from one that was never taken, and
+	// Error says why a count failed. Count is only meaningful for
+	// StatusOK; every other status also sets CountSkipped.
+	Status Status `json:"Status,omitempty"`
+	Error  string `json:"Error,omitempty"`
+
+	// Unstable marks a count that changed when read a second time, with
+	// Recount holding the second read; see scanner.Config.VerifyCounts.
+	Unstable bool `json:"Unstable,omitempty"`
+	Recount  int  `json:"Recount,omitempty"`
+
+	// DeleteCandidate marks a field on a custom object that has no custom
+	// fields left but deleted ones, so the whole object may be deleted.
+	DeleteCandidate bool `json:"DeleteCandidate,omitempty"`
+
+	// ActiveField is the active field re-created under the deleted field's
+	// original API name, e.g. after re-adding it. The object's count then
+	// also reflects that field's data.
+	ActiveField string `json:"ActiveField,omitempty"`
+
+	// FieldLabel, ObjectLabel and ObjectPluralLabel are the names business
+	// users know the field and its object by; exports written before they
+	// were added, and fields Salesforce no longer labels, leave them empty.
+	FieldLabel        string `json:"FieldLabel,omitempty"`
+	ObjectLabel       string `json:"ObjectLabel,omitempty"`
+	ObjectPluralLabel string `json:"ObjectPluralLabel,omitempty"`
+
+	// DataType is the field's type as Setup shows it, e.g. "Text(255)".
+	// ReferenceTo is the object a lookup pointed at and FormulaType the
+	// type a formula returned.
+	DataType    string `json:"DataType,omitempty"`
+	ReferenceTo string `json:"ReferenceTo,omitempty"`
+	FormulaType string `json:"FormulaType,omitempty"`
+
+	// RunId, Org, Version and Commit trace the record to the run, org and
+	// binary that wrote it; records from older exports leave them empty.
+	RunId   string `json:"RunId,omitempty"`
+	Org     string `json:"Org,omitempty"`
+	Version string `json:"Version,omitempty"`
+	Commit  string `json:"Commit,omitempty"`
+
+	// Extra holds fields added by enrichment plugins.
+	Extra map[string]any `json:"Extra,omitempty"`
+}
+
+// Status is the outcome of counting a record's object.
+type Status string
+
+const (
+	StatusOK           Status = "ok"
+	StatusCountFailed  Status = "count_failed"
+	StatusNotQueryable Status = "not_queryable"
+	StatusSkipped      Status = "skipped"
+)
+
+// CountStatus returns the record's Status, inferring it from CountSkipped
+// for records written before the field existed.
+func (r DeleteCountRecord) CountStatus() Status {
+	switch {
+	case r.Status != "":
+		return r.Status
+	case r.CountSkipped:
+		return StatusSkipped
+	default:
+		return StatusOK
+	}
+}
+
+// CountedEmpty reports whether the record's object was counted and found
+// to hold no records.
+func (r DeleteCountRecord) CountedEmpty() bool {
+	return r.CountStatus() == StatusOK && r.Count == 0
+}
+
+type LastCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// Data is the layout of a JSON export.
+type Data struct {
+	Results      []DeleteCountRecord `json:"results"`
+	LastRunCount []LastCount         `json:"lastRunCount"`
+}
+
+// RecordFields lists the names of a record's fields, as used in JSON keys
+// and CSV columns.
+func RecordFields() []string {
+	return []string{"RunId", "Org", "DeveloperName", "TableEnumOrId", "QualifiedApiName", "ApiName", "FieldLabel", "ObjectLabel", "ObjectPluralLabel", "DataType", "ReferenceTo", "FormulaType", "Count", "Timestamp", "TimestampISO", "CountSkipped", "Approximate", "Sampled", "CountFilter", "Status", "Error", "Unstable", "Recount", "DeleteCandidate", "ActiveField", "Version", "Commit", "Extra"}
+}
+
+// projectRecords returns records as they should be encoded: unchanged, or
+// reduced to the named fields when fields is set.
+func projectRecords(records []DeleteCountRecord, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return records, nil
+	}
+
+	projected := make([]map[string]json.RawMessage, len(records))
+	for i, record := range records {
+		projected[i] = make(map[string]json.RawMessage, len(fields))
+		if err := projectRecord(record, fields, projected[i]); err != nil {
+			return nil, err
+		}
+	}
+	return projected, nil
+}
+
+func projectRecord(record DeleteCountRecord, fields []string, into map[string]json.RawMessage) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			into[field] = value
+		}
+	}
+	return nil
+}
+
+// Write adds records to the export at filename in the format its extension
+// selects; see ForPath.
+func Write(filename string, records []DeleteCountRecord) error {
+	exporter, err := ForPath(filename)
+	if err != nil {
+		return err
+	}
+	return exporter.Write(Run{}, records)
+}
+
+// writeJSON rewrites the JSON document at filename with the run's records
+// added, replacing those of an earlier run the same day unless run.Append is
+// set, and an updated lastRunCount. The records are a flat list, or nested
+// by object and field when grouped is set.
+func writeJSON(filename string, run Run, records []DeleteCountRecord, grouped bool) error {
+	slog.Debug("Exporting results to JSON file", "file", filename)
+
+	unlock, err := run.lock(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	exportData, err := readJSONExport(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read existing export: %w", err)
+	}
+
+	backfillTimestampISO(exportData.Results)
+	if replacement := run.replacementFor(records); replacement != nil {
+		existing := len(exportData.Results)
+		exportData.Results = replacement.filter(exportData.Results)
+		if dropped := existing - len(exportData.Results); dropped > 0 {
+			slog.Info("Replacing records from an earlier run today", "records", dropped, "file", filename)
+		}
+	}
+	exportData.Results = append(exportData.Results, records...)
+	sortRecords(exportData.Results)
+	latest := records
+	if run.History {
+		latest = LatestRunRecords(records)
+	}
+	if len(latest) > 0 && !hasCountedRecords(latest) {
+		slog.Info("No counts were taken this run, keeping previous lastRunCount")
+	} else {
+		exportData.LastRunCount = calculateCurCounts(latest)
+	}
+
+	document, err := jsonDocument(run, exportData, grouped)
+	if err != nil {
+		return err
+	}
+
+	// The document is written beside the export and renamed over it, so
+	// a failed write leaves the previous history in place.
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hasher := md5.New()
+	encoder := json.NewEncoder(io.MultiWriter(file, hasher))
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(file.Name(), filename); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", filename, err)
+	}
+
+	slog.Info("Successfully exported results to JSON file", "file", filename, "md5", hex.EncodeToString(hasher.Sum(nil)))
+	return nil
+}
+
+// jsonDocument lays out a JSON export of data: the summary of its newest
+// day, the records, flat or nested by object and field when grouped is set,
+// and lastRunCount.
+func jsonDocument(run Run, data Data, grouped bool) (any, error) {
+	// The summary describes the newest day's records, like lastRunCount.
+	totals := CalculateTotals(LatestRunRecords(data.Results))
+
+	results, confirmedEmpty := data.Results, []DeleteCountRecord(nil)
+	if run.OmitZero {
+		results, confirmedEmpty = splitCountedEmpty(results)
+	}
+	projectedEmpty, err := projectRecords(confirmedEmpty, run.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if grouped {
+		objects, err := groupRecords(results, run.Fields)
+		if err != nil {
+			return nil, err
+		}
+		return struct {
+			Summary        Totals           `json:"summary"`
+			Objects        []map[string]any `json:"objects"`
+			ConfirmedEmpty any              `json:"confirmedEmpty,omitempty"`
+			LastRunCount   []LastCount      `json:"lastRunCount"`
+		}{totals, objects, projectedEmpty, data.LastRunCount}, nil
+	}
+
+	projected, err := projectRecords(results, run.Fields)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Summary        Totals      `json:"summary"`
+		Results        any         `json:"results"`
+		ConfirmedEmpty any         `json:"confirmedEmpty,omitempty"`
+		LastRunCount   []LastCount `json:"lastRunCount"`
+	}{totals, projected, projectedEmpty, data.LastRunCount}, nil
+}
+
+// splitCountedEmpty separates the records counted at zero from the rest.
+func splitCountedEmpty(records []DeleteCountRecord) (rest, empty []DeleteCountRecord) {
+	for _, record := range records {
+		if record.CountedEmpty() {
+			empty = append(empty, record)
+		} else {
+			rest = append(rest, record)
+		}
+	}
+	return rest, empty
+}
+
+// sortRecords puts records in canonical order, by object, field and then
+// time, so rewriting an export only changes the lines that really changed
+// and exports can be diffed. Org breaks ties between merged exports.
+func sortRecords(records []DeleteCountRecord) {
+	slices.SortStableFunc(records, func(a, b DeleteCountRecord) int {
+		return cmp.Or(
+			cmp.Compare(a.QualifiedApiName, b.QualifiedApiName),
+			cmp.Compare(a.DeveloperName, b.DeveloperName),
+			cmp.Compare(a.Timestamp, b.Timestamp),
+			cmp.Compare(a.Org, b.Org),
+		)
+	})
+}
+
+func hasCountedRecords(records []DeleteCountRecord) bool {
+	for _, record := range records {
+		if !record.CountSkipped {
+			return true
+		}
+	}
+	return false
+}
+
+func calculateCurCounts(records []DeleteCountRecord) []LastCount {
+	slog.Debug("Calculating current counts from records")
+
+	if len(records) == 0 {
+		todayDate := time.Now().Format("2006-01-02")
+		slog.Info("No records found, setting count to 0", "date", todayDate)
+		return []LastCount{
+			{
+				Date:  todayDate,
+				Count: 0,
+			},
+		}
+	}
+
+	counts := make(map[string]int)
+	processed := make(map[string]map[string]bool) // QualifiedApiName -> Date
+
+	for _, record := range records {
+		if record.CountSkipped {
+			continue
+		}
+
+		date := time.Unix(record.Timestamp, 0).Format("2006-01-02")
+
+		if _, exists := processed[date]; !exists {
+			processed[date] = make(map[string]bool)
+		}
+
+		if !processed[date][record.QualifiedApiName] {
+			counts[date] += record.Count
+			processed[date][record.QualifiedApiName] = true
+		}
+	}
+
+	var curCounts []LastCount
+	for date, count := range counts {
+		slog.Info("Count for date", "date", date, "count", count)
+		curCounts = append(curCounts, LastCount{
+			Date:  date,
+			Count: count,
+		})
+	}
+	slices.SortFunc(curCounts, func(a, b LastCount) int { return cmp.Compare(a.Date, b.Date) })
+
+	return curCounts
+}
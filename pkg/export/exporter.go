@@ -0,0 +1,183 @@
+package export
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Run describes the scan that produced a set of records.
+type Run struct {
+	Id       string
+	Org      string
+	Started  time.Time
+	Finished time.Time
+
+	// Version and Commit identify the binary that produced the run; they
+	// are stamped on every record so old exports can be traced to it.
+	Version string
+	Commit  string
+
+	// Fields, when set, limits the record fields written to these names
+	// (see RecordFields), e.g. for an audience that needs less detail.
+	Fields []string
+
+	// Append keeps the records of earlier runs on the same day. Without
+	// it, a run replaces the org's records from the days it writes, so a
+	// re-run does not double that day's counts.
+	Append bool
+
+	// Locked tells Write the caller holds the export's lock, taken with
+	// Lock, so it does not wait for it again.
+	Locked bool
+
+	// History marks the records written as an export's whole history,
+	// e.g. rewritten by Backfill, rather than one run's, so lastRunCount
+	// only counts the latest run among them.
+	History bool
+
+	// Skipped lists the FieldKey of every field an incremental run found
+	// but did not count, as it was confirmed empty. Their records from
+	// earlier runs on the same day are kept rather than replaced, so the
+	// history still holds their last count.
+	Skipped []string
+
+	// OmitZero moves records counted at zero out of a JSON export's results
+	// into its confirmedEmpty list, so the results focus on fields with
+	// residual data while the history still shows the others were checked.
+	OmitZero bool
+}
+
+// stamp returns records tagged with the run's ID, org and version. Fields
+// the run leaves empty keep the record's own value, so re-exporting records
+// from earlier runs, as merge does, preserves where they came from.
+func (r Run) stamp(records []DeleteCountRecord) []DeleteCountRecord {
+	stamped := make([]DeleteCountRecord, len(records))
+	for i, record := range records {
+		record.RunId = cmp.Or(r.Id, record.RunId)
+		record.Org = cmp.Or(r.Org, record.Org)
+		record.Version = cmp.Or(r.Version, record.Version)
+		record.Commit = cmp.Or(r.Commit, record.Commit)
+		stamped[i] = record
+	}
+	return stamped
+}
+
+// Exporter writes a run's records to some output target.
+type Exporter interface {
+	Write(run Run, records []DeleteCountRecord) error
+}
+
+// Factory opens an exporter for target, e.g. a file path.
+type Factory func(target string) (Exporter, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes an export format available to New. Registering a format
+// twice replaces the earlier factory.
+func Register(format string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(format)] = factory
+}
+
+// Formats lists the registered export formats.
+func Formats() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	formats := make([]string, 0, len(registry))
+	for format := range registry {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// New opens an exporter of the named format for target. The Stdout target
+// writes the run alone to standard output.
+func New(format, target string) (Exporter, error) {
+	if target == Stdout {
+		return newStdoutExporter(format)
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[strings.ToLower(format)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown export format %q: use one of %s", format, strings.Join(Formats(), ", "))
+	}
+	return factory(target)
+}
+
+// FormatForPath picks the export format from a file extension: .ndjson and
+// .jsonl are appended to line by line, .csv is appended as rows, and
+// anything else is a JSON document. A postgres:// URL is a database.
+func FormatForPath(path string) string {
+	if IsPostgres(path) {
+		return "postgres"
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	case ".csv":
+		return "csv"
+	}
+	return "json"
+}
+
+// ForPath opens the exporter FormatForPath selects for path.
+func ForPath(path string) (Exporter, error) {
+	return New(FormatForPath(path), path)
+}
+
+func init() {
+	Register("json", func(target string) (Exporter, error) { return jsonExporter{path: target}, nil })
+	Register("ndjson", func(target string) (Exporter, error) { return ndjsonExporter{path: target}, nil })
+	Register("csv", func(target string) (Exporter, error) { return csvExporter{path: target}, nil })
+	Register("grouped", func(target string) (Exporter, error) { return groupedExporter{path: target}, nil })
+	Register("postgres", func(target string) (Exporter, error) { return postgresExporter{dsn: target}, nil })
+}
+
+type jsonExporter struct {
+	path string
+}
+
+// Write rewrites the whole document with the history in canonical order;
+// the appending formats below sort only the records they add, so earlier
+// lines never move.
+func (e jsonExporter) Write(run Run, records []DeleteCountRecord) error {
+	return writeJSON(e.path, run, run.stamp(records), false)
+}
+
+type ndjsonExporter struct {
+	path string
+}
+
+func (e ndjsonExporter) Write(run Run, records []DeleteCountRecord) error {
+	slog.Debug("Appending records to NDJSON file", "records", len(records), "file", e.path)
+	unlock, err := run.lock(e.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	records = run.stamp(records)
+	sortRecords(records)
+	if err := run.replacementFor(records).dropReplacedLines(e.path); err != nil {
+		return fmt.Errorf("failed to export results: %w", err)
+	}
+	if err := appendResultsAsNDJSON(e.path, records, run.Fields); err != nil {
+		return fmt.Errorf("failed to export results: %w", err)
+	}
+	slog.Info("Successfully appended results to NDJSON file", "file", e.path)
+	return nil
+}
@@ -0,0 +1,127 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The grouped JSON document nests the history under its object and field:
+//
+//	{"objects": [{"QualifiedApiName": "Account", ..., "Fields": [
+//		{"DeveloperName": "Region_del", ..., "History": [{"Count": 120, ...}]}]}],
+//	 "lastRunCount": [...]}
+//
+// Each level holds the record keys that describe it, so a record is the
+// union of its object, field and history entry, and reading the document
+// back yields the same records as the flat one.
+var (
+	groupedObjectKeys = []string{"QualifiedApiName", "ApiName", "ObjectLabel", "ObjectPluralLabel"}
+	groupedFieldKeys  = []string{"DeveloperName", "TableEnumOrId", "FieldLabel", "DataType", "ReferenceTo", "FormulaType"}
+)
+
+type groupedExporter struct {
+	path string
+}
+
+func (e groupedExporter) Write(run Run, records []DeleteCountRecord) error {
+	return writeJSON(e.path, run, run.stamp(records), true)
+}
+
+// groupRecords nests records, already in canonical order, by object and
+// field, keeping only the named fields when fields is set.
+func groupRecords(records []DeleteCountRecord, fields []string) ([]map[string]any, error) {
+	if len(fields) == 0 {
+		fields = RecordFields()
+	}
+
+	var objects []map[string]any
+	var objectFields []map[string]any
+	var history []map[string]json.RawMessage
+	for i, record := range records {
+		entry := make(map[string]json.RawMessage, len(fields))
+		if err := projectRecord(record, fields, entry); err != nil {
+			return nil, err
+		}
+		object := takeKeys(entry, groupedObjectKeys)
+		field := takeKeys(entry, groupedFieldKeys)
+
+		newObject := i == 0 || record.QualifiedApiName != records[i-1].QualifiedApiName
+		if newObject {
+			objects = append(objects, object)
+			objectFields = nil
+		}
+		if newObject || record.DeveloperName != records[i-1].DeveloperName {
+			objectFields = append(objectFields, field)
+			history = nil
+		}
+		history = append(history, entry)
+
+		objectFields[len(objectFields)-1]["History"] = history
+		objects[len(objects)-1]["Fields"] = objectFields
+	}
+	return objects, nil
+}
+
+// takeKeys moves the named keys out of entry into a new map.
+func takeKeys(entry map[string]json.RawMessage, keys []string) map[string]any {
+	taken := make(map[string]any, len(keys)+1)
+	for _, key := range keys {
+		if value, ok := entry[key]; ok {
+			taken[key] = value
+			delete(entry, key)
+		}
+	}
+	return taken
+}
+
+// ungroupRecords flattens the objects of a grouped document back into
+// records.
+func ungroupRecords(objects []map[string]json.RawMessage) ([]DeleteCountRecord, error) {
+	var records []DeleteCountRecord
+	for _, object := range objects {
+		var fields []map[string]json.RawMessage
+		if err := unmarshalKey(object, "Fields", &fields); err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			var history []map[string]json.RawMessage
+			if err := unmarshalKey(field, "History", &history); err != nil {
+				return nil, err
+			}
+			for _, entry := range history {
+				for _, key := range groupedFieldKeys {
+					if value, ok := field[key]; ok {
+						entry[key] = value
+					}
+				}
+				for _, key := range groupedObjectKeys {
+					if value, ok := object[key]; ok {
+						entry[key] = value
+					}
+				}
+
+				data, err := json.Marshal(entry)
+				if err != nil {
+					return nil, fmt.Errorf("failed to rebuild record: %w", err)
+				}
+				var record DeleteCountRecord
+				if err := json.Unmarshal(data, &record); err != nil {
+					return nil, fmt.Errorf("invalid History entry: %w", err)
+				}
+				records = append(records, record)
+			}
+		}
+	}
+	return records, nil
+}
+
+func unmarshalKey(values map[string]json.RawMessage, key string, into any) error {
+	value, ok := values[key]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal(value, into); err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return nil
+}
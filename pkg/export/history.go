@@ -0,0 +1,207 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Read loads a previous export, returning empty data when the file does not
+// exist yet.
+func Read(filename string) (Data, error) {
+	switch FormatForPath(filename) {
+	case "ndjson":
+		return readNDJSONExport(filename)
+	case "csv":
+		return readCSVExport(filename)
+	case "postgres":
+		return readPostgresExport(filename)
+	}
+	return readJSONExport(filename)
+}
+
+// readJSONExport reads a JSON export in either shape, the flat results list
+// or the grouped objects.
+func readJSONExport(filename string) (Data, error) {
+	var exportData Data
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return exportData, nil
+	}
+	if err != nil {
+		return exportData, fmt.Errorf("failed to open existing file: %w", err)
+	}
+	defer file.Close()
+
+	slog.Debug("Reading existing data from file", "file", filename)
+	var document struct {
+		Data
+		Objects        []map[string]json.RawMessage `json:"objects"`
+		ConfirmedEmpty []DeleteCountRecord          `json:"confirmedEmpty"`
+	}
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&document); err != nil {
+		return exportData, fmt.Errorf("failed to decode existing JSON data: %w", err)
+	}
+
+	exportData = document.Data
+	if document.Objects != nil {
+		records, err := ungroupRecords(document.Objects)
+		if err != nil {
+			return exportData, fmt.Errorf("failed to decode grouped JSON data: %w", err)
+		}
+		exportData.Results = append(exportData.Results, records...)
+	}
+	exportData.Results = append(exportData.Results, document.ConfirmedEmpty...)
+	return exportData, nil
+}
+
+func readNDJSONExport(filename string) (Data, error) {
+	var exportData Data
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return exportData, nil
+	}
+	if err != nil {
+		return exportData, fmt.Errorf("failed to open existing file: %w", err)
+	}
+	defer file.Close()
+
+	slog.Debug("Reading existing records from file", "file", filename)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var record DeleteCountRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return exportData, fmt.Errorf("failed to decode record on line %d: %w", line, err)
+		}
+		exportData.Results = append(exportData.Results, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return exportData, fmt.Errorf("failed to read existing file: %w", err)
+	}
+
+	exportData.LastRunCount = calculateCurCounts(LatestRunRecords(exportData.Results))
+	return exportData, nil
+}
+
+// LatestRunRecords returns the records sharing the newest record's date,
+// which is what the JSON export keeps as lastRunCount.
+func LatestRunRecords(records []DeleteCountRecord) []DeleteCountRecord {
+	var newest int64
+	for _, record := range records {
+		newest = max(newest, record.Timestamp)
+	}
+
+	date := time.Unix(newest, 0).Format("2006-01-02")
+	var latest []DeleteCountRecord
+	for _, record := range records {
+		if time.Unix(record.Timestamp, 0).Format("2006-01-02") == date {
+			latest = append(latest, record)
+		}
+	}
+	return latest
+}
+
+// appendResultsAsNDJSON writes only this run's records to the end of the
+// export, so the cost of exporting does not grow with the history.
+func appendResultsAsNDJSON(filename string, records []DeleteCountRecord, fields []string) error {
+	projected, err := projectRecords(records, fields)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open file for append: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	if err := encodeEach(encoder, projected); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write records: %w", err)
+	}
+
+	return file.Close()
+}
+
+// backfillTimestampISO fills TimestampISO on records written before the field
+// existed, so rewritten exports are consistent throughout.
+func backfillTimestampISO(records []DeleteCountRecord) {
+	for i := range records {
+		if records[i].TimestampISO == "" && records[i].Timestamp != 0 {
+			records[i].TimestampISO = time.Unix(records[i].Timestamp, 0).Format(time.RFC3339)
+		}
+	}
+}
+
+// FieldKey identifies a deleted field across runs.
+func FieldKey(qualifiedApiName, developerName string) string {
+	return qualifiedApiName + "." + developerName
+}
+
+// LastCountedRecords returns the most recent counted record for every field
+// in the history, keyed by FieldKey.
+func LastCountedRecords(records []DeleteCountRecord) map[string]DeleteCountRecord {
+	latest := make(map[string]DeleteCountRecord)
+	for _, record := range records {
+		if record.CountSkipped {
+			continue
+		}
+
+		key := FieldKey(record.QualifiedApiName, record.DeveloperName)
+		if prev, ok := latest[key]; !ok || record.Timestamp > prev.Timestamp {
+			latest[key] = record
+		}
+	}
+	return latest
+}
+
+// ConfirmedEmpty reports whether the field was counted at zero within the
+// incremental window, in which case an incremental run can skip it.
+func ConfirmedEmpty(history map[string]DeleteCountRecord, qualifiedApiName, developerName string, window time.Duration) bool {
+	record, ok := history[FieldKey(qualifiedApiName, developerName)]
+	if !ok || record.Count != 0 {
+		return false
+	}
+
+	return time.Since(time.Unix(record.Timestamp, 0)) <= window
+}
+
+// encodeEach writes every element of records, as returned by
+// projectRecords, as its own JSON value.
+func encodeEach(encoder *json.Encoder, records any) error {
+	var err error
+	switch records := records.(type) {
+	case []DeleteCountRecord:
+		for _, record := range records {
+			if err = encoder.Encode(record); err != nil {
+				break
+			}
+		}
+	case []map[string]json.RawMessage:
+		for _, record := range records {
+			if err = encoder.Encode(record); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	return nil
+}
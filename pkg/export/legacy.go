@@ -0,0 +1,180 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LegacyColumns names the columns of a spreadsheet of deleted field counts
+// kept before this tool. Empty names are guessed from the header; see
+// legacyColumnGuesses.
+type LegacyColumns struct {
+	Object string
+	Field  string
+	Count  string
+	Date   string
+	Org    string
+}
+
+// legacyColumnGuesses are the headers, lower-cased, commonly given to each
+// column by hand-kept sheets and other tools.
+var legacyColumnGuesses = map[string][]string{
+	"object": {"object", "sobject", "object api name", "qualifiedapiname", "entity"},
+	"field":  {"field", "field api name", "field name", "developername", "api name"},
+	"count":  {"count", "records", "record count", "residual records", "rows"},
+	"date":   {"date", "run date", "counted", "counted on", "timestamp", "timestampiso"},
+	"org":    {"org", "org alias", "alias"},
+}
+
+// legacyDateLayouts are tried in order when no date layout is given.
+var legacyDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02",
+	"01/02/2006",
+	"1/2/2006",
+	"02-Jan-2006",
+	"Jan 2, 2006",
+}
+
+// ReadLegacyCSV maps a spreadsheet of deleted field counts onto records,
+// one per row, so its history can be carried into an export. Dates are
+// parsed with dateLayout, or by trying common layouts when it is empty, in
+// the local time zone like the tool's own runs. A field given as
+// Object.Field needs no object column, and rows without a count become
+// skipped records.
+func ReadLegacyCSV(filename string, columns LegacyColumns, dateLayout string) ([]DeleteCountRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	// Spreadsheets exported from Excel start with a byte order mark.
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+	}
+
+	index := func(name, guess string) (int, error) {
+		if name != "" {
+			if i := slices.Index(header, strings.ToLower(name)); i >= 0 {
+				return i, nil
+			}
+			return -1, fmt.Errorf("no %s column named %q", guess, name)
+		}
+		for _, candidate := range legacyColumnGuesses[guess] {
+			if i := slices.Index(header, candidate); i >= 0 {
+				return i, nil
+			}
+		}
+		return -1, nil
+	}
+
+	objectColumn, err := index(columns.Object, "object")
+	if err != nil {
+		return nil, err
+	}
+	fieldColumn, err := index(columns.Field, "field")
+	if err != nil {
+		return nil, err
+	}
+	countColumn, err := index(columns.Count, "count")
+	if err != nil {
+		return nil, err
+	}
+	dateColumn, err := index(columns.Date, "date")
+	if err != nil {
+		return nil, err
+	}
+	orgColumn, err := index(columns.Org, "org")
+	if err != nil {
+		return nil, err
+	}
+	if fieldColumn < 0 || countColumn < 0 || dateColumn < 0 {
+		return nil, fmt.Errorf("could not find the field, count and date columns in %q; name them explicitly", header)
+	}
+
+	value := func(row []string, i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var records []DeleteCountRecord
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		object, field := value(row, objectColumn), value(row, fieldColumn)
+		if object == "" {
+			object, field, _ = strings.Cut(field, ".")
+			if field == "" {
+				return nil, fmt.Errorf("line %d: no object for field %q", line, object)
+			}
+		}
+		if field == "" {
+			continue
+		}
+
+		date, err := parseLegacyDate(value(row, dateColumn), dateLayout)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		record := DeleteCountRecord{
+			DeveloperName:    field,
+			QualifiedApiName: object,
+			ApiName:          object,
+			Timestamp:        date.Unix(),
+			TimestampISO:     date.Format(time.RFC3339),
+			Org:              value(row, orgColumn),
+			Status:           StatusOK,
+		}
+		if count := strings.NewReplacer(",", "", " ", "", "_", "").Replace(value(row, countColumn)); count == "" {
+			record.CountSkipped = true
+			record.Status = StatusSkipped
+		} else if record.Count, err = strconv.Atoi(count); err != nil {
+			return nil, fmt.Errorf("line %d: invalid count %q", line, value(row, countColumn))
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func parseLegacyDate(value, layout string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("missing date")
+	}
+	if layout != "" {
+		return time.ParseInLocation(layout, value, time.Local)
+	}
+	for _, layout := range legacyDateLayouts {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q; give its layout with --date-format", value)
+}
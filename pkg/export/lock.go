@@ -0,0 +1,145 @@
+package export
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// ErrLocked is returned by Write when another run held the export's lock
+// for longer than LockTimeout.
+var ErrLocked = errors.New("export is locked by another run")
+
+// LockTimeout is how long Write waits for another run to finish writing the
+// same export before giving up with ErrLocked.
+var LockTimeout = 5 * time.Minute
+
+const (
+	// lockExpiry is the age past which a lock is taken to belong to a run
+	// that died while writing, and is broken. Writing an export takes
+	// seconds, so a lock this old is never still in use.
+	lockExpiry = 15 * time.Minute
+
+	lockPollInterval = 250 * time.Millisecond
+)
+
+// lockHolder is written to the lock file so a run kept waiting can say
+// which process it is waiting for. Token tells one holder's lock from
+// another's, even in the same process.
+type lockHolder struct {
+	Pid      int       `json:"pid"`
+	Host     string    `json:"host"`
+	Acquired time.Time `json:"acquired"`
+	Token    string    `json:"token"`
+}
+
+// Lock takes the lock on the export at filename for a caller that works on
+// the export beyond a single Write, e.g. verifying, signing or encrypting
+// it around the write, and returns the function releasing it. Writes made
+// while holding it must set Run.Locked, as the lock is not reentrant.
+func Lock(filename string) (func(), error) {
+	return lockExport(filename)
+}
+
+// lock takes the export's lock for a Write, unless the caller holds it.
+func (r Run) lock(filename string) (func(), error) {
+	if r.Locked {
+		return func() {}, nil
+	}
+	return lockExport(filename)
+}
+
+// lockExport takes the lock on the export at filename, a filename.lock file
+// created exclusively, so overlapping runs, e.g. from cron, cannot
+// interleave reading the history with truncating and rewriting it. The
+// returned function releases the lock.
+func lockExport(filename string) (func(), error) {
+	path := filename + ".lock"
+	host, _ := os.Hostname()
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	self := lockHolder{Pid: os.Getpid(), Host: host, Acquired: time.Now(), Token: hex.EncodeToString(nonce)}
+	holder, err := json.Marshal(self)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lock: %w", err)
+	}
+
+	deadline := time.Now().Add(LockTimeout)
+	waiting := false
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = file.Write(holder)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock %s: %w", path, err)
+			}
+			return func() { releaseLock(path, self.Token) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock %s: %w", path, err)
+		}
+
+		current := readLockHolder(path)
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockExpiry {
+			slog.Warn("Breaking stale export lock", "lock", path, "pid", current.Pid, "host", current.Host, "age", time.Since(info.ModTime()).Round(time.Second))
+			breakLock(path, current)
+			continue
+		}
+		if time.Now().After(deadline) {
+			if current.Pid == 0 {
+				return nil, fmt.Errorf("%w: %s (remove %s if no run is writing it)", ErrLocked, filename, path)
+			}
+			return nil, fmt.Errorf("%w: %s held by pid %d on %s since %s", ErrLocked, filename, current.Pid, current.Host, current.Acquired.Format(time.RFC3339))
+		}
+		if !waiting {
+			slog.Info("Waiting for another run to finish writing the export", "file", filename, "pid", current.Pid, "host", current.Host)
+			waiting = true
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// breakLock removes the stale lock at path that stale was read from. The
+// lock is first moved aside, which only one of several waiters breaking it
+// at once can do, and is only removed if it still is the stale one: a lock
+// another waiter took in the meantime is put back.
+func breakLock(path string, stale lockHolder) {
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	aside := path + "." + hex.EncodeToString(nonce) + ".stale"
+	if err := os.Rename(path, aside); err != nil {
+		return
+	}
+	if moved := readLockHolder(aside); moved != stale {
+		// os.Link does not replace a lock taken since, unlike os.Rename.
+		os.Link(aside, path)
+	}
+	os.Remove(aside)
+}
+
+// releaseLock removes the lock at path if it is still the one token took,
+// so a run whose lock was broken as stale cannot remove the next run's.
+func releaseLock(path, token string) {
+	if readLockHolder(path).Token == token {
+		os.Remove(path)
+	}
+}
+
+// readLockHolder returns who holds the lock at path, or a zero holder when
+// the file is unreadable or was released in the meantime.
+func readLockHolder(path string) lockHolder {
+	var holder lockHolder
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &holder)
+	}
+	return holder
+}
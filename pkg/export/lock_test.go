@@ -0,0 +1,113 @@
+package export
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	defer func(timeout time.Duration) { LockTimeout = timeout }(LockTimeout)
+	LockTimeout = 300 * time.Millisecond
+
+	tests := []struct {
+		name string
+		// held prepares the lock another run holds on path, if any.
+		held    func(t *testing.T, path string)
+		wantErr error
+	}{
+		{"free", func(t *testing.T, path string) {}, nil},
+		{"held", func(t *testing.T, path string) {
+			unlock, err := Lock(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(unlock)
+		}, ErrLocked},
+		{"stale", func(t *testing.T, path string) {
+			if err := os.WriteFile(path+".lock", []byte(`{"pid":1,"host":"gone","token":"old"}`), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			old := time.Now().Add(-2 * lockExpiry)
+			if err := os.Chtimes(path+".lock", old, old); err != nil {
+				t.Fatal(err)
+			}
+		}, nil},
+		{"unreadable holder", func(t *testing.T, path string) {
+			if err := os.WriteFile(path+".lock", nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}, ErrLocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "deleted_fields.json")
+			tt.held(t, path)
+
+			unlock, err := Lock(path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Lock: got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if _, err := os.Stat(path + ".lock"); err != nil {
+				t.Errorf("lock file missing while held: %v", err)
+			}
+			unlock()
+			if _, err := os.Stat(path + ".lock"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("lock file left after unlock: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnlockKeepsNextHoldersLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deleted_fields.json")
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock is broken as stale and taken by another run, before the
+	// first run releases its own.
+	breakLock(path+".lock", readLockHolder(path+".lock"))
+	next, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next()
+
+	unlock()
+	if _, err := os.Stat(path + ".lock"); err != nil {
+		t.Errorf("releasing a broken lock removed the next holder's: %v", err)
+	}
+}
+
+func TestRunLockedSkipsLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deleted_fields.json")
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	exporter, err := New("json", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- exporter.Write(Run{Locked: true}, []DeleteCountRecord{record("dev", "Account", "Region_del", 1, time.Now())})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write waited for the lock its caller holds")
+	}
+}
@@ -0,0 +1,54 @@
+package export
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// NameRule rewrites the developer names matching Match to Replace, which
+// may refer to Match's groups as $1 or ${name}. Salesforce renames a field
+// deleted again after its name was freed to Name_del1, Name_del2 and so on,
+// and a rule such as `^(.+_del)\d+$` -> `$1` folds those generations back
+// into one logical field.
+type NameRule struct {
+	Match   string `yaml:"match"`
+	Replace string `yaml:"replace"`
+}
+
+type nameRule struct {
+	match   *regexp.Regexp
+	replace string
+}
+
+// nameRules are applied, in order, by LogicalName.
+var nameRules []nameRule
+
+// SetNameRules replaces the rules LogicalName applies.
+func SetNameRules(rules []NameRule) error {
+	compiled := make([]nameRule, 0, len(rules))
+	for i, rule := range rules {
+		match, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return fmt.Errorf("invalid match of normalize rule %d: %w", i+1, err)
+		}
+		compiled = append(compiled, nameRule{match: match, replace: rule.Replace})
+	}
+	nameRules = compiled
+	return nil
+}
+
+// LogicalName returns the name developerName is reported under once the
+// normalize rules have been applied.
+func LogicalName(developerName string) string {
+	for _, rule := range nameRules {
+		developerName = rule.match.ReplaceAllString(developerName, rule.replace)
+	}
+	return developerName
+}
+
+// FieldIdentity identifies a logical field across runs: like FieldKey, but
+// with every generation of a field that was deleted more than once under
+// the same identity.
+func FieldIdentity(qualifiedApiName, developerName string) string {
+	return FieldKey(qualifiedApiName, LogicalName(developerName))
+}
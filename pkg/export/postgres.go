@@ -0,0 +1,184 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// The postgres format keeps the history in a table shared by every machine
+// that scans, instead of a file. Each run is written in one transaction
+// holding an advisory lock for its org, so concurrent runs neither
+// interleave nor lose each other's records.
+const postgresTable = "sf_deleted_fields_records"
+
+const postgresSchema = `CREATE TABLE IF NOT EXISTS ` + postgresTable + ` (
+	id bigserial PRIMARY KEY,
+	org text NOT NULL,
+	day text NOT NULL,
+	ts bigint NOT NULL,
+	record jsonb NOT NULL
+);
+CREATE INDEX IF NOT EXISTS ` + postgresTable + `_org_day ON ` + postgresTable + ` (org, day)`
+
+// postgresSchemaLock serializes creating the table, which CREATE ... IF NOT
+// EXISTS alone does not make safe.
+const postgresSchemaLock = 0x73666466
+
+// IsPostgres reports whether target names a Postgres database rather than
+// a file.
+func IsPostgres(target string) bool {
+	return strings.HasPrefix(target, "postgres://") || strings.HasPrefix(target, "postgresql://")
+}
+
+// CheckPostgres connects to the database at dsn, checking that it is
+// reachable and accepts its credentials.
+func CheckPostgres(ctx context.Context, dsn string) error {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return nil
+}
+
+type postgresExporter struct {
+	dsn string
+}
+
+func (e postgresExporter) Write(run Run, records []DeleteCountRecord) error {
+	records = run.stamp(records)
+	sortRecords(records)
+
+	db, err := sql.Open("postgres", e.dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := createPostgresTable(ctx, tx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", run.Org); err != nil {
+		return fmt.Errorf("failed to lock the org's history: %w", err)
+	}
+
+	if r := run.replacementFor(records); r != nil {
+		days := make([]string, 0, len(r.days))
+		for day := range r.days {
+			days = append(days, day)
+		}
+		slices.Sort(days)
+		keep := make([]string, 0, len(r.keep))
+		for key := range r.keep {
+			keep = append(keep, key)
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM "+postgresTable+" WHERE day = ANY($1) AND ($2 = '' OR org = '' OR org = $2)"+
+			" AND NOT (COALESCE(record->>'QualifiedApiName', '') || '.' || COALESCE(record->>'DeveloperName', '')) = ANY($3)", pq.Array(days), r.org, pq.Array(keep))
+		if err != nil {
+			return fmt.Errorf("failed to replace earlier records: %w", err)
+		}
+		if dropped, _ := result.RowsAffected(); dropped > 0 {
+			slog.Info("Replacing records from an earlier run today", "records", dropped, "database", postgresTable)
+		}
+	}
+
+	fields := run.Fields
+	if len(fields) == 0 {
+		fields = RecordFields()
+	}
+	insert, err := tx.PrepareContext(ctx, "INSERT INTO "+postgresTable+" (org, day, ts, record) VALUES ($1, $2, $3, $4)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer insert.Close()
+	for _, record := range records {
+		entry := make(map[string]json.RawMessage, len(fields))
+		if err := projectRecord(record, fields, entry); err != nil {
+			return err
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode record: %w", err)
+		}
+		if _, err := insert.ExecContext(ctx, record.Org, recordDate(record.Timestamp), record.Timestamp, string(data)); err != nil {
+			return fmt.Errorf("failed to insert record: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit run: %w", err)
+	}
+	slog.Info("Successfully exported results to Postgres", "records", len(records), "table", postgresTable)
+	return nil
+}
+
+func createPostgresTable(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", postgresSchemaLock); err != nil {
+		return fmt.Errorf("failed to lock the schema: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, postgresSchema); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", postgresTable, err)
+	}
+	return nil
+}
+
+// readPostgresExport loads the whole history from the database, returning
+// empty data when the table does not exist yet.
+func readPostgresExport(dsn string) (Data, error) {
+	var exportData Data
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return exportData, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	slog.Debug("Reading existing records from Postgres", "table", postgresTable)
+	rows, err := db.Query("SELECT record FROM " + postgresTable + " ORDER BY ts, id")
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "42P01" {
+		// undefined_table: nothing was exported yet.
+		return exportData, nil
+	}
+	if err != nil {
+		return exportData, fmt.Errorf("failed to read records: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return exportData, fmt.Errorf("failed to read record: %w", err)
+		}
+		var record DeleteCountRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return exportData, fmt.Errorf("failed to decode record: %w", err)
+		}
+		exportData.Results = append(exportData.Results, record)
+	}
+	if err := rows.Err(); err != nil {
+		return exportData, fmt.Errorf("failed to read records: %w", err)
+	}
+
+	exportData.LastRunCount = calculateCurCounts(LatestRunRecords(exportData.Results))
+	return exportData, nil
+}
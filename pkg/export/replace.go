@@ -0,0 +1,209 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// replacement selects the existing records a run supersedes: those written
+// for the same org on a day the run also writes. Re-running a scan on the
+// same day then replaces that day's records instead of doubling them.
+// Records of the fields in keep, which the run skipped, are not replaced.
+type replacement struct {
+	org  string
+	days map[string]bool
+	keep map[string]bool
+}
+
+// replacementFor returns what a run writing records replaces, or nil when
+// the run appends or has nothing to replace.
+func (r Run) replacementFor(records []DeleteCountRecord) *replacement {
+	if r.Append {
+		return nil
+	}
+
+	days := make(map[string]bool)
+	for _, record := range records {
+		if record.Timestamp != 0 {
+			days[recordDate(record.Timestamp)] = true
+		}
+	}
+	if !r.Started.IsZero() {
+		days[r.Started.Format("2006-01-02")] = true
+	}
+	if len(days) == 0 {
+		return nil
+	}
+	keep := make(map[string]bool, len(r.Skipped))
+	for _, key := range r.Skipped {
+		keep[key] = true
+	}
+	return &replacement{org: r.Org, days: days, keep: keep}
+}
+
+// replaces reports whether an existing record of the field key is
+// superseded. Records without an org come from exports of a single org and
+// match any run.
+func (r *replacement) replaces(timestamp int64, org, key string) bool {
+	if r == nil || timestamp == 0 || !r.days[recordDate(timestamp)] || r.keep[key] {
+		return false
+	}
+	return r.org == "" || org == "" || org == r.org
+}
+
+// filter returns records without those r replaces.
+func (r *replacement) filter(records []DeleteCountRecord) []DeleteCountRecord {
+	kept := records[:0]
+	for _, record := range records {
+		if !r.replaces(record.Timestamp, record.Org, FieldKey(record.QualifiedApiName, record.DeveloperName)) {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+func recordDate(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("2006-01-02")
+}
+
+// dropReplacedLines rewrites the NDJSON export at filename without the
+// records r replaces, leaving every other line byte for byte as it was.
+func (r *replacement) dropReplacedLines(filename string) error {
+	if r == nil {
+		return nil
+	}
+	return rewriteExport(filename, func(in io.Reader, out io.Writer) (int, error) {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		dropped := 0
+		for scanner.Scan() {
+			var record struct {
+				Timestamp        int64
+				Org              string
+				QualifiedApiName string
+				DeveloperName    string
+			}
+			line := scanner.Bytes()
+			if len(bytes.TrimSpace(line)) > 0 && json.Unmarshal(line, &record) == nil && r.replaces(record.Timestamp, record.Org, FieldKey(record.QualifiedApiName, record.DeveloperName)) {
+				dropped++
+				continue
+			}
+			if _, err := fmt.Fprintf(out, "%s\n", line); err != nil {
+				return 0, err
+			}
+		}
+		return dropped, scanner.Err()
+	})
+}
+
+// dropReplacedRows rewrites the CSV export at filename without the rows r
+// replaces. Files without a Timestamp column are left alone, as their rows
+// cannot be dated.
+func (r *replacement) dropReplacedRows(filename string) error {
+	if r == nil {
+		return nil
+	}
+	return rewriteExport(filename, func(in io.Reader, out io.Writer) (int, error) {
+		reader := csv.NewReader(in)
+		reader.FieldsPerRecord = -1
+		writer := csv.NewWriter(out)
+
+		header, err := reader.Read()
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		writer.Write(header)
+
+		timestampColumn, orgColumn, objectColumn, fieldColumn := -1, -1, -1, -1
+		for i, name := range header {
+			switch name {
+			case "Timestamp":
+				timestampColumn = i
+			case "Org":
+				orgColumn = i
+			case "QualifiedApiName":
+				objectColumn = i
+			case "DeveloperName":
+				fieldColumn = i
+			}
+		}
+		column := func(row []string, i int) string {
+			if i >= 0 && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+
+		dropped := 0
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return 0, err
+			}
+			if timestampColumn >= 0 && timestampColumn < len(row) {
+				timestamp, _ := strconv.ParseInt(row[timestampColumn], 10, 64)
+				key := FieldKey(column(row, objectColumn), column(row, fieldColumn))
+				if r.replaces(timestamp, column(row, orgColumn), key) {
+					dropped++
+					continue
+				}
+			}
+			writer.Write(row)
+		}
+		writer.Flush()
+		return dropped, writer.Error()
+	})
+}
+
+// rewriteExport passes the export at filename through filter and, if it
+// dropped anything, replaces the file with the result. A missing file is
+// left missing.
+func rewriteExport(filename string, filter func(in io.Reader, out io.Writer) (dropped int, err error)) error {
+	in, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open existing file: %w", err)
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	dropped, err := filter(in, tmp)
+	if err != nil {
+		return fmt.Errorf("failed to rewrite %s: %w", filename, err)
+	}
+	if dropped == 0 {
+		return nil
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to rewrite %s: %w", filename, err)
+	}
+	in.Close()
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", filename, err)
+	}
+	slog.Info("Replacing records from an earlier run today", "records", dropped, "file", filename)
+	return nil
+}
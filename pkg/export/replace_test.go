@@ -0,0 +1,142 @@
+package export
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// record is a count of field on object for org, taken at when.
+func record(org, object, field string, count int, when time.Time) DeleteCountRecord {
+	return DeleteCountRecord{Org: org, QualifiedApiName: object, DeveloperName: field, Count: count, Timestamp: when.Unix(), Status: StatusOK}
+}
+
+// countsByField returns the counts in records, by org, field key and day.
+func countsByField(records []DeleteCountRecord) map[string][]int {
+	counts := make(map[string][]int)
+	for _, r := range records {
+		key := r.Org + "/" + FieldKey(r.QualifiedApiName, r.DeveloperName) + "/" + recordDate(r.Timestamp)
+		counts[key] = append(counts[key], r.Count)
+	}
+	for _, c := range counts {
+		sort.Ints(c)
+	}
+	return counts
+}
+
+func TestWriteReplacesSameDay(t *testing.T) {
+	morning := time.Date(2026, 3, 10, 8, 0, 0, 0, time.Local)
+	evening := morning.Add(10 * time.Hour)
+	yesterday := morning.AddDate(0, 0, -1)
+
+	earlier := []DeleteCountRecord{
+		record("dev", "Account", "Region_del", 10, yesterday),
+		record("dev", "Account", "Region_del", 12, morning),
+		record("dev", "Account", "Legacy_del", 5, morning),
+		record("prod", "Account", "Region_del", 40, morning),
+	}
+	rerun := []DeleteCountRecord{
+		record("dev", "Account", "Region_del", 15, evening),
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		ext     string
+		append  bool
+		skipped []string
+		want    map[string][]int
+	}{
+		{
+			name:    "skipped field kept",
+			format:  "json",
+			ext:     ".json",
+			skipped: []string{FieldKey("Account", "Legacy_del")},
+			want: map[string][]int{
+				"dev/Account.Region_del/2026-03-09":  {10},
+				"dev/Account.Region_del/2026-03-10":  {15},
+				"dev/Account.Legacy_del/2026-03-10":  {5},
+				"prod/Account.Region_del/2026-03-10": {40},
+			},
+		},
+		{
+			name:   "field not skipped replaced",
+			format: "json",
+			ext:    ".json",
+			want: map[string][]int{
+				"dev/Account.Region_del/2026-03-09":  {10},
+				"dev/Account.Region_del/2026-03-10":  {15},
+				"prod/Account.Region_del/2026-03-10": {40},
+			},
+		},
+		{
+			name:    "ndjson",
+			format:  "ndjson",
+			ext:     ".ndjson",
+			skipped: []string{FieldKey("Account", "Legacy_del")},
+			want: map[string][]int{
+				"dev/Account.Region_del/2026-03-09":  {10},
+				"dev/Account.Region_del/2026-03-10":  {15},
+				"dev/Account.Legacy_del/2026-03-10":  {5},
+				"prod/Account.Region_del/2026-03-10": {40},
+			},
+		},
+		{
+			name:    "csv",
+			format:  "csv",
+			ext:     ".csv",
+			skipped: []string{FieldKey("Account", "Legacy_del")},
+			want: map[string][]int{
+				"dev/Account.Region_del/2026-03-09":  {10},
+				"dev/Account.Region_del/2026-03-10":  {15},
+				"dev/Account.Legacy_del/2026-03-10":  {5},
+				"prod/Account.Region_del/2026-03-10": {40},
+			},
+		},
+		{
+			name:   "append",
+			format: "json",
+			ext:    ".json",
+			append: true,
+			want: map[string][]int{
+				"dev/Account.Region_del/2026-03-09":  {10},
+				"dev/Account.Region_del/2026-03-10":  {12, 15},
+				"dev/Account.Legacy_del/2026-03-10":  {5},
+				"prod/Account.Region_del/2026-03-10": {40},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "deleted_fields"+tt.ext)
+			exporter, err := New(tt.format, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := exporter.Write(Run{Append: true}, earlier); err != nil {
+				t.Fatalf("Write earlier: %v", err)
+			}
+
+			run := Run{Org: "dev", Started: evening, Append: tt.append, Skipped: tt.skipped}
+			if err := exporter.Write(run, rerun); err != nil {
+				t.Fatalf("Write rerun: %v", err)
+			}
+
+			data, err := Read(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := countsByField(data.Results)
+			if len(got) != len(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			for key, want := range tt.want {
+				if !slices.Equal(got[key], want) {
+					t.Errorf("%s: got counts %v, want %v", key, got[key], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Stdout is the export target that writes to standard output instead of a
+// file, e.g. in a container whose output is collected from the pipe.
+const Stdout = "-"
+
+// stdoutExporter writes a run's records to standard output in any format.
+// There is no history to read back, so JSON documents hold this run alone
+// and nothing earlier is replaced.
+type stdoutExporter struct {
+	format string
+}
+
+func (e stdoutExporter) Write(run Run, records []DeleteCountRecord) error {
+	slog.Debug("Writing records to standard output", "records", len(records), "format", e.format)
+	records = run.stamp(records)
+	sortRecords(records)
+
+	var err error
+	switch e.format {
+	case "ndjson":
+		var projected any
+		if projected, err = projectRecords(records, run.Fields); err == nil {
+			err = encodeEach(json.NewEncoder(os.Stdout), projected)
+		}
+	case "csv":
+		err = writeCSVRecords(os.Stdout, nil, run, records)
+	default:
+		var document any
+		data := Data{Results: records, LastRunCount: calculateCurCounts(records)}
+		if document, err = jsonDocument(run, data, e.format == "grouped"); err == nil {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(document)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write results to standard output: %w", err)
+	}
+	return nil
+}
+
+func newStdoutExporter(format string) (Exporter, error) {
+	format = strings.ToLower(format)
+	switch format {
+	case "json", "grouped", "ndjson", "csv":
+		return stdoutExporter{format: format}, nil
+	}
+	return nil, fmt.Errorf("export format %q cannot be written to standard output", format)
+}
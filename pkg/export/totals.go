@@ -0,0 +1,76 @@
+package export
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// Totals are the headline numbers of an export, written as its summary
+// block so consumers need not aggregate the records themselves.
+type Totals struct {
+	DeletedFields   int `json:"deletedFields"`
+	ResidualRecords int `json:"residualRecords"`
+	ObjectsAffected int `json:"objectsAffected"`
+
+	// Namespaces breaks the totals down by the namespace prefix of the
+	// objects; unmanaged and standard objects have an empty namespace.
+	Namespaces []NamespaceTotals `json:"namespaces"`
+}
+
+// NamespaceTotals are the totals of one namespace's objects.
+type NamespaceTotals struct {
+	Namespace       string `json:"namespace"`
+	DeletedFields   int    `json:"deletedFields"`
+	ResidualRecords int    `json:"residualRecords"`
+	ObjectsAffected int    `json:"objectsAffected"`
+}
+
+// CalculateTotals sums records from a single run. Every deleted field on an
+// object reports the same object count, so each object's records count
+// once; objects with no count taken are not affected.
+func CalculateTotals(records []DeleteCountRecord) Totals {
+	type objectKey struct{ org, object string }
+	counted := make(map[objectKey]bool)
+	byNamespace := make(map[string]*NamespaceTotals)
+
+	var totals Totals
+	for _, record := range records {
+		namespace := Namespace(record.QualifiedApiName)
+		ns, ok := byNamespace[namespace]
+		if !ok {
+			ns = &NamespaceTotals{Namespace: namespace}
+			byNamespace[namespace] = ns
+		}
+
+		totals.DeletedFields++
+		ns.DeletedFields++
+
+		key := objectKey{record.Org, record.QualifiedApiName}
+		if record.CountSkipped || counted[key] {
+			continue
+		}
+		counted[key] = true
+		totals.ResidualRecords += record.Count
+		totals.ObjectsAffected++
+		ns.ResidualRecords += record.Count
+		ns.ObjectsAffected++
+	}
+
+	totals.Namespaces = make([]NamespaceTotals, 0, len(byNamespace))
+	for _, ns := range byNamespace {
+		totals.Namespaces = append(totals.Namespaces, *ns)
+	}
+	slices.SortFunc(totals.Namespaces, func(a, b NamespaceTotals) int { return cmp.Compare(a.Namespace, b.Namespace) })
+	return totals
+}
+
+// Namespace returns the namespace prefix of an object's API name, e.g.
+// "acme" for acme__Invoice__c, or "" when it has none.
+func Namespace(qualifiedApiName string) string {
+	parts := strings.Split(qualifiedApiName, "__")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[0]
+}
@@ -0,0 +1,97 @@
+package notify
+
+import (
+	htmltemplate "html/template"
+	"strconv"
+)
+
+// Changes is what an org's scan found different from its previous run:
+// the fields that appeared, the fields that are gone and the fields whose
+// counts moved.
+type Changes struct {
+	Previous string        `json:"previous"`
+	New      []FieldChange `json:"new,omitempty"`
+	Cleared  []FieldChange `json:"cleared,omitempty"`
+	Counts   []FieldChange `json:"counts,omitempty"`
+}
+
+// FieldChange is one deleted field in Changes. Previous and Records are its
+// count on the previous run and this one; Counted is false when this run
+// could not count it.
+type FieldChange struct {
+	Object     string `json:"object"`
+	Field      string `json:"field"`
+	Label      string `json:"label,omitempty"`
+	Previous   int    `json:"previous"`
+	Records    int    `json:"records"`
+	Change     int    `json:"change"`
+	Counted    bool   `json:"counted"`
+	Owner      string `json:"owner,omitempty"`
+	OwnerEmail string `json:"ownerEmail,omitempty"`
+}
+
+// Empty reports whether nothing changed.
+func (c *Changes) Empty() bool {
+	return c == nil || len(c.New)+len(c.Cleared)+len(c.Counts) == 0
+}
+
+// ownedBy narrows the changes to the fields of owner's objects.
+func (c *Changes) ownedBy(owner string) *Changes {
+	if c == nil {
+		return nil
+	}
+	owned := func(fields []FieldChange) []FieldChange {
+		var kept []FieldChange
+		for _, field := range fields {
+			if field.Owner == owner || field.OwnerEmail == owner {
+				kept = append(kept, field)
+			}
+		}
+		return kept
+	}
+	return &Changes{Previous: c.Previous, New: owned(c.New), Cleared: owned(c.Cleared), Counts: owned(c.Counts)}
+}
+
+// signed renders a change with its sign, e.g. +3 or -120.
+func signed(n int) string {
+	if n > 0 {
+		return "+" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
+
+// defaultDiffTemplate is the HTML email diff notifiers send. Like the
+// digest report, it keeps to tables and inline styles, which mail clients
+// render. New fields and growing counts are red, cleared fields and
+// shrinking counts green.
+var defaultDiffTemplate = htmltemplate.Must(htmltemplate.New("diff").Funcs(htmltemplate.FuncMap{"signed": signed}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Deleted fields changes in {{.Org}}</title>
+</head>
+<body style="margin:0;padding:16px;font-family:Arial,Helvetica,sans-serif;font-size:14px;color:#222;">
+<table role="presentation" width="100%" cellpadding="0" cellspacing="0" border="0" style="max-width:640px;">
+<tr><td>
+<h1 style="font-size:20px;margin:0 0 4px 0;">Deleted fields changes in {{.Org}}{{with .Environment}} ({{.}}){{end}}</h1>
+<p style="margin:0 0 16px 0;color:#666;">Since the run of {{.Changes.Previous}}: {{.DeletedFields}} deleted fields, {{.ResidualRecords}} residual records now.</p>
+{{with .Changes.New}}<h2 style="font-size:16px;margin:16px 0 4px 0;">New fields ({{len .}})</h2>
+<table cellpadding="4" cellspacing="0" border="1" style="border-collapse:collapse;border-color:#ccc;">
+<tr style="background:#f4f4f4;"><th align="left">Field</th><th align="left">Label</th><th align="right">Records</th></tr>
+{{range .}}<tr style="color:#b00;"><td>{{.Object}}.{{.Field}}</td><td>{{.Label}}</td><td align="right">{{if .Counted}}{{.Records}}{{else}}not counted{{end}}</td></tr>
+{{end}}</table>{{end}}
+{{with .Changes.Cleared}}<h2 style="font-size:16px;margin:16px 0 4px 0;">Cleared fields ({{len .}})</h2>
+<table cellpadding="4" cellspacing="0" border="1" style="border-collapse:collapse;border-color:#ccc;">
+<tr style="background:#f4f4f4;"><th align="left">Field</th><th align="left">Label</th><th align="right">Records before</th></tr>
+{{range .}}<tr style="color:#070;"><td>{{.Object}}.{{.Field}}</td><td>{{.Label}}</td><td align="right">{{.Previous}}</td></tr>
+{{end}}</table>{{end}}
+{{with .Changes.Counts}}<h2 style="font-size:16px;margin:16px 0 4px 0;">Changed counts ({{len .}})</h2>
+<table cellpadding="4" cellspacing="0" border="1" style="border-collapse:collapse;border-color:#ccc;">
+<tr style="background:#f4f4f4;"><th align="left">Field</th><th align="left">Label</th><th align="right">Before</th><th align="right">Now</th><th align="right">Change</th></tr>
+{{range .}}<tr><td>{{.Object}}.{{.Field}}</td><td>{{.Label}}</td><td align="right">{{.Previous}}</td><td align="right">{{.Records}}</td><td align="right" style="color:{{if gt .Change 0}}#b00{{else}}#070{{end}};">{{signed .Change}}</td></tr>
+{{end}}</table>{{end}}
+</td></tr>
+</table>
+</body>
+</html>
+`))
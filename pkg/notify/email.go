@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("email", newEmail)
+}
+
+// email sends the message over SMTP, authenticating when a username is set.
+type email struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+
+	toOwners bool
+	html     bool
+}
+
+func newEmail(cfg Config) (Notifier, error) {
+	if cfg.SMTPHost == "" || cfg.From == "" || (len(cfg.To) == 0 && !cfg.ToOwners) {
+		return nil, errors.New("smtp_host, from and to (or to_owners) are required")
+	}
+
+	port := cfg.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.SMTPHost)
+	}
+
+	return email{
+		addr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(port)),
+		auth: auth,
+		from: cfg.From,
+		to:   cfg.To,
+
+		toOwners: cfg.ToOwners,
+		html:     cfg.Diff,
+	}, nil
+}
+
+func (e email) Notify(_ context.Context, event Event, message string) error {
+	subject := fmt.Sprintf("Deleted fields scan of %s: %s", event.Org, event.Outcome)
+	contentType := "text/plain"
+	if e.html {
+		subject = fmt.Sprintf("Deleted fields changes in %s: %d new, %d cleared, %d counts changed", event.Org, len(event.Changes.New), len(event.Changes.Cleared), len(event.Changes.Counts))
+		contentType = "text/html"
+	}
+
+	to := slices.Clone(e.to)
+	if e.toOwners {
+		owners := make([]string, 0, len(event.Objects))
+		for _, object := range event.Objects {
+			owners = append(owners, object.OwnerEmail)
+		}
+		// A diff goes to the owners of the fields that changed, cleared
+		// ones included, whose objects the event may no longer list.
+		if changes := event.Changes; changes != nil {
+			for _, fields := range [][]FieldChange{changes.New, changes.Cleared, changes.Counts} {
+				for _, field := range fields {
+					owners = append(owners, field.OwnerEmail)
+				}
+			}
+		}
+		for _, owner := range owners {
+			if owner != "" && !slices.Contains(to, owner) {
+				to = append(to, owner)
+			}
+		}
+	}
+	if len(to) == 0 {
+		return errors.New("no recipients: none of the objects has an owner email")
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", e.from)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", subject)
+	body.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&body, "Content-Type: %s; charset=utf-8\r\n\r\n", contentType)
+	body.WriteString(strings.ReplaceAll(message, "\n", "\r\n"))
+	body.WriteString("\r\n")
+
+	if err := smtp.SendMail(e.addr, e.auth, e.from, to, []byte(body.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
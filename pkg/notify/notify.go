@@ -0,0 +1,265 @@
+// Package notify sends scan outcomes to chat, email and webhook targets.
+// Each notifier has its own thresholds and message template, so a channel
+// can be told only about the orgs it cares about.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Event is the outcome of one org's scan.
+type Event struct {
+	RunId           string        `json:"runId"`
+	Org             string        `json:"org"`
+	Environment     string        `json:"environment,omitempty"`
+	Outcome         string        `json:"outcome"`
+	DeletedFields   int64         `json:"deletedFields"`
+	ResidualRecords int           `json:"residualRecords"`
+	ObjectsAffected int           `json:"objectsAffected"`
+	Failures        int64         `json:"failures"`
+	Duration        time.Duration `json:"-"`
+	TopObjects      []Object      `json:"topObjects,omitempty"`
+
+	// Objects are all the objects affected, for notifiers that only report
+	// one owner's share.
+	Objects []Object `json:"-"`
+
+	// Changes compares the scan with the org's previous run in the export;
+	// it is nil when there was no previous run to compare with.
+	Changes *Changes `json:"changes,omitempty"`
+}
+
+// Object is an object with residual records on deleted fields.
+type Object struct {
+	Name          string `json:"name"`
+	Records       int    `json:"records"`
+	DeletedFields int    `json:"deletedFields"`
+	Owner         string `json:"owner,omitempty"`
+	OwnerEmail    string `json:"ownerEmail,omitempty"`
+}
+
+// Notifier delivers a message about an event.
+type Notifier interface {
+	Notify(ctx context.Context, event Event, message string) error
+}
+
+// Config configures one notifier. Only the settings of its Type apply;
+// values may reference environment variables as ${NAME}.
+type Config struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+
+	// URL is the Slack or Teams incoming webhook, or the webhook endpoint.
+	URL string `yaml:"url"`
+
+	// SMTP settings for email.
+	SMTPHost string   `yaml:"smtp_host"`
+	SMTPPort int      `yaml:"smtp_port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+
+	// ToOwners also emails the owners of the objects in the event.
+	ToOwners bool `yaml:"to_owners"`
+
+	// Owner limits the notifier to the objects of one owning team, named
+	// by team or email; its thresholds then apply to that team's share.
+	Owner string `yaml:"owner"`
+
+	// Template is a text/template rendered with the Event; each type has a
+	// sensible default.
+	Template string `yaml:"template"`
+
+	// Diff makes an email notifier send an HTML email of only what changed
+	// since the previous run, and nothing when nothing did, instead of the
+	// full message. Its Template is then an html/template.
+	Diff bool `yaml:"diff"`
+
+	// An event is only sent when it reaches one of the thresholds that are
+	// set, or when the scan had failures and OnFailure is set. With no
+	// thresholds every event is sent.
+	MinResidualRecords int  `yaml:"min_residual_records"`
+	MinDeletedFields   int  `yaml:"min_deleted_fields"`
+	OnFailure          bool `yaml:"on_failure"`
+}
+
+// Factory builds a notifier from its configuration.
+type Factory func(cfg Config) (Notifier, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a notifier type available to configuration.
+func Register(kind string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(kind)] = factory
+}
+
+// Types lists the registered notifier types.
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	kinds := make([]string, 0, len(registry))
+	for kind := range registry {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+const defaultTemplate = `Deleted fields scan of {{.Org}}{{with .Environment}} ({{.}}){{end}}: {{.Outcome}}
+{{.DeletedFields}} deleted fields, {{.ResidualRecords}} residual records on {{.ObjectsAffected}} objects{{if .Failures}}, {{.Failures}} failures{{end}}
+{{range .TopObjects}}- {{.Name}}: {{.Records}} records, {{.DeletedFields}} deleted fields{{with .Owner}} (owner: {{.}}){{end}}
+{{end}}`
+
+// Configured is a notifier together with when and what it sends.
+type Configured struct {
+	Name     string
+	notifier Notifier
+	template executor
+	cfg      Config
+}
+
+// executor is the text or HTML template a notifier renders messages with.
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// New builds the notifier described by cfg.
+func New(cfg Config) (*Configured, error) {
+	cfg = expandEnv(cfg)
+	if cfg.Name == "" {
+		cfg.Name = cfg.Type
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[strings.ToLower(cfg.Type)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("notifier %s: unknown type %q: use one of %s", cfg.Name, cfg.Type, strings.Join(Types(), ", "))
+	}
+
+	var tmpl executor
+	switch {
+	case cfg.Diff && !strings.EqualFold(cfg.Type, "email"):
+		return nil, fmt.Errorf("notifier %s: diff is only supported by email notifiers", cfg.Name)
+	case cfg.Diff && cfg.Template == "":
+		tmpl = defaultDiffTemplate
+	case cfg.Diff:
+		parsed, err := htmltemplate.New(cfg.Name).Funcs(htmltemplate.FuncMap{"signed": signed}).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: invalid template: %w", cfg.Name, err)
+		}
+		tmpl = parsed
+	default:
+		text := cfg.Template
+		if text == "" {
+			text = defaultTemplate
+		}
+		parsed, err := template.New(cfg.Name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: invalid template: %w", cfg.Name, err)
+		}
+		tmpl = parsed
+	}
+
+	notifier, err := factory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("notifier %s: %w", cfg.Name, err)
+	}
+	return &Configured{Name: cfg.Name, notifier: notifier, template: tmpl, cfg: cfg}, nil
+}
+
+// Wants reports whether event meets the notifier's thresholds.
+func (c *Configured) Wants(event Event) bool {
+	cfg := c.cfg
+	if cfg.MinResidualRecords <= 0 && cfg.MinDeletedFields <= 0 && !cfg.OnFailure {
+		return true
+	}
+
+	return (cfg.MinResidualRecords > 0 && event.ResidualRecords >= cfg.MinResidualRecords) ||
+		(cfg.MinDeletedFields > 0 && event.DeletedFields >= int64(cfg.MinDeletedFields)) ||
+		(cfg.OnFailure && event.Failures > 0)
+}
+
+// Notify renders the message for event and sends it if the event meets the
+// notifier's thresholds. It reports whether a message was sent.
+func (c *Configured) Notify(ctx context.Context, event Event) (bool, error) {
+	if c.cfg.Owner != "" {
+		event = event.ownedBy(c.cfg.Owner)
+		// A diff notifier is about the owner's changes, which include
+		// fields cleared from objects no longer in the event.
+		if !c.cfg.Diff && len(event.Objects) == 0 {
+			return false, nil
+		}
+	}
+	if c.cfg.Diff && event.Changes.Empty() {
+		return false, nil
+	}
+	if !c.Wants(event) {
+		return false, nil
+	}
+
+	var message bytes.Buffer
+	if err := c.template.Execute(&message, event); err != nil {
+		return false, fmt.Errorf("notifier %s: failed to render message: %w", c.Name, err)
+	}
+
+	if err := c.notifier.Notify(ctx, event, strings.TrimSpace(message.String())); err != nil {
+		return false, fmt.Errorf("notifier %s: %w", c.Name, err)
+	}
+	return true, nil
+}
+
+// ownedBy narrows event to the objects of owner, with the totals of those
+// objects alone.
+func (e Event) ownedBy(owner string) Event {
+	objects := e.Objects
+	if objects == nil {
+		objects = e.TopObjects
+	}
+
+	e.Objects = nil
+	e.ResidualRecords, e.DeletedFields = 0, 0
+	for _, object := range objects {
+		if object.Owner == owner || object.OwnerEmail == owner {
+			e.Objects = append(e.Objects, object)
+			e.ResidualRecords += object.Records
+			e.DeletedFields += int64(object.DeletedFields)
+		}
+	}
+	e.ObjectsAffected = len(e.Objects)
+	e.TopObjects = e.Objects[:min(len(e.TopObjects), len(e.Objects))]
+	e.Changes = e.Changes.ownedBy(owner)
+	return e
+}
+
+func expandEnv(cfg Config) Config {
+	cfg.URL = os.ExpandEnv(cfg.URL)
+	cfg.SMTPHost = os.ExpandEnv(cfg.SMTPHost)
+	cfg.Username = os.ExpandEnv(cfg.Username)
+	cfg.Password = os.ExpandEnv(cfg.Password)
+	cfg.From = os.ExpandEnv(cfg.From)
+	cfg.Owner = os.ExpandEnv(cfg.Owner)
+	to := make([]string, len(cfg.To))
+	for i, address := range cfg.To {
+		to[i] = os.ExpandEnv(address)
+	}
+	cfg.To = to
+	return cfg
+}
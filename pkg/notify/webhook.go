@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+func init() {
+	Register("slack", newChatWebhook)
+	Register("teams", newChatWebhook)
+	Register("webhook", newWebhook)
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+func postJSON(ctx context.Context, url string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(data))
+	}
+	return nil
+}
+
+// chatWebhook posts the message to a Slack or Teams incoming webhook; both
+// accept a plain {"text": ...} payload.
+type chatWebhook struct {
+	url string
+}
+
+func newChatWebhook(cfg Config) (Notifier, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	return chatWebhook{url: cfg.URL}, nil
+}
+
+func (w chatWebhook) Notify(ctx context.Context, _ Event, message string) error {
+	return postJSON(ctx, w.url, map[string]string{"text": message})
+}
+
+// webhook posts the full event along with the rendered message, for
+// integrations that want the numbers rather than the prose.
+type webhook struct {
+	url string
+}
+
+func newWebhook(cfg Config) (Notifier, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	return webhook{url: cfg.URL}, nil
+}
+
+func (w webhook) Notify(ctx context.Context, event Event, message string) error {
+	return postJSON(ctx, w.url, struct {
+		Event
+		DurationSeconds float64 `json:"durationSeconds"`
+		Message         string  `json:"message"`
+	}{event, event.Duration.Seconds(), message})
+}
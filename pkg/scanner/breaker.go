@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// ErrCircuitOpen is returned by Run when Config.MaxConsecutiveFailures
+// calls failed in a row, e.g. because the session was revoked or the org
+// went down, and the scan stopped early. The records collected until then
+// are kept.
+var ErrCircuitOpen = errors.New("too many consecutive failures")
+
+// circuitBreaker stops a scan whose calls keep failing instead of letting
+// it grind through hundreds of doomed queries.
+type circuitBreaker struct {
+	max         int64
+	consecutive atomic.Int64
+	open        atomic.Bool
+	cancel      context.CancelCauseFunc
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+// observe counts a finished call, opening the breaker when it is the
+// max-th failure in a row. Calls failing because the scan was cancelled
+// are not the org's fault and are ignored.
+func (b *circuitBreaker) observe(ctx context.Context, err error) (opened bool) {
+	if err == nil {
+		b.consecutive.Store(0)
+		return false
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+
+	b.mu.Lock()
+	b.lastErr = err
+	b.mu.Unlock()
+	if b.consecutive.Add(1) < b.max || !b.open.CompareAndSwap(false, true) {
+		return false
+	}
+	b.cancel(ErrCircuitOpen)
+	return true
+}
+
+// err describes why the breaker opened.
+func (b *circuitBreaker) err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return fmt.Errorf("%w: %d calls failed in a row, the last with: %v", ErrCircuitOpen, b.max, b.lastErr)
+}
+
+// breakerExecutor feeds every query's outcome to the scan's breaker and
+// refuses new queries once it is open.
+type breakerExecutor struct {
+	scan     *Scan
+	executor sfclient.Executor
+}
+
+func (e breakerExecutor) Query(ctx context.Context, soql string, useToolingApi bool) (sfclient.Rows, error) {
+	if e.scan.breaker.open.Load() {
+		return sfclient.Rows{}, ErrCircuitOpen
+	}
+	rows, err := e.executor.Query(ctx, soql, useToolingApi)
+	e.scan.observeCall(ctx, err)
+	return rows, err
+}
+
+func (e breakerExecutor) StreamQuery(ctx context.Context, soql string, useToolingApi bool, handle func(row map[string]string) error) error {
+	if e.scan.breaker.open.Load() {
+		return ErrCircuitOpen
+	}
+	err := sfclient.Stream(ctx, e.executor, soql, useToolingApi, handle)
+	e.scan.observeCall(ctx, err)
+	return err
+}
+
+// observeCall reports a call's outcome to the breaker, logging when it
+// opens.
+func (s *Scan) observeCall(ctx context.Context, err error) {
+	if s.breaker.observe(ctx, err) {
+		s.log.Error("Stopping the scan after too many consecutive failures", "failures", s.breaker.max, "error", err)
+	}
+}
+
+// CircuitOpen reports whether the scan stopped early because its calls
+// kept failing; see Config.MaxConsecutiveFailures.
+func (s *Scan) CircuitOpen() bool {
+	return s.breaker.open.Load()
+}
@@ -0,0 +1,236 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// ErrApiBudget is returned by Run when the estimated API calls exceed
+// Config.MaxApiCalls and the scan was not allowed to go ahead.
+var ErrApiBudget = errors.New("estimated API calls exceed the budget")
+
+// ErrApiCallLimit is returned by Run when the scan made Config.MaxApiCalls
+// calls without finishing and was stopped. The records collected until
+// then are kept.
+var ErrApiCallLimit = errors.New("API call limit reached")
+
+// queryPageSize is the number of records the REST API returns per query
+// page.
+const queryPageSize = 2000
+
+// keysetChunkSize is the number of rows each chunk of a keyset-paginated
+// query asks for: a single page.
+const keysetChunkSize = queryPageSize
+
+// Estimate is how many API calls a scan is expected to use.
+type Estimate struct {
+	DeletedFields int
+	Used          int64
+	Metadata      int
+	Counts        int
+	Total         int64
+}
+
+// EstimateApiCalls counts the org's deleted fields with a single query and
+// works out the calls the rest of the scan will need in its counting mode.
+// Count calls assume one object per field, so the estimate errs high when
+// several deleted fields share an object.
+func (s *Scan) EstimateApiCalls(ctx context.Context) (Estimate, error) {
+	executor, err := s.executor()
+	if err != nil {
+		return Estimate{}, err
+	}
+
+	rows, err := executor.Query(ctx, "SELECT Count() FROM CustomField WHERE DeveloperName LIKE "+quoteSOQL(s.cfg.Pattern), true)
+	if err != nil {
+		return Estimate{}, fmt.Errorf("failed to count deleted fields: %w", err)
+	}
+
+	fields := rows.TotalSize
+	estimate := Estimate{
+		DeletedFields: fields,
+		Used:          s.apiCalls.Load(),
+		// Chunks of the deleted field query, the last one short, plus
+		// one EntityDefinition lookup per field in the worst case.
+		Metadata: fields/keysetChunkSize + 1 + fields,
+	}
+	if !s.cfg.NoCounts && !s.cfg.NoDescribe {
+		estimate.Metadata++
+	}
+	if !s.cfg.NoFieldDetails {
+		// One FieldDefinition query per object.
+		estimate.Metadata += fields
+	}
+
+	switch {
+	case s.cfg.NoCounts:
+	case s.cfg.ApproxCounts:
+		estimate.Counts = ceilDiv(fields, sfclient.RecordCountBatchMax)
+	case s.cfg.Composite:
+		estimate.Counts = ceilDiv(fields, sfclient.CompositeBatchMax)
+	default:
+		// One COUNT() per field, plus the org limits lookup of the
+		// adaptive limiter unless preflight has done it already.
+		estimate.Counts = fields
+		if s.cfg.Concurrency <= 0 && s.orgLimits == nil {
+			estimate.Counts++
+		}
+	}
+
+	if s.cfg.VerifyCounts && !s.cfg.ApproxCounts {
+		estimate.Counts *= 2
+	}
+
+	estimate.Total = estimate.Used + int64(estimate.Metadata+estimate.Counts)
+	return estimate, nil
+}
+
+// preflight estimates the scan's API calls before anything is counted when
+// Config.MaxApiCalls or Config.LargeScanFields asks for it, warning about a
+// large scan the org's remaining allowance may not cover and enforcing the
+// call budget.
+func (s *Scan) preflight(ctx context.Context) error {
+	checkLimits := s.cfg.LargeScanFields > 0 && !s.cfg.NoCounts
+	if s.cfg.MaxApiCalls <= 0 && !checkLimits {
+		return nil
+	}
+
+	estimate, err := s.EstimateApiCalls(ctx)
+	if err != nil {
+		if s.cfg.MaxApiCalls > 0 {
+			return err
+		}
+		s.log.Warn("Could not estimate API calls", "error", err)
+		return nil
+	}
+
+	if checkLimits && estimate.DeletedFields >= s.cfg.LargeScanFields {
+		s.checkOrgLimits(estimate)
+	}
+	return s.checkApiBudget(estimate)
+}
+
+// checkOrgLimits warns when the estimated calls would use up the org's
+// daily API allowance or eat into the reserve the adaptive limiter keeps.
+func (s *Scan) checkOrgLimits(estimate Estimate) {
+	s.apiCalls.Add(1)
+	limits, err := s.readOrgLimits()
+	if err != nil {
+		s.log.Warn("Could not read org limits", "error", err)
+		return
+	}
+	s.orgLimits = limits
+
+	api, ok := limits[sfclient.DailyApiRequests]
+	if !ok || api.Max <= 0 {
+		return
+	}
+	needed := estimate.Total - estimate.Used
+	left := int64(api.Remaining) - needed
+	switch {
+	case left < 0:
+		s.log.Warn("Scan may exhaust the daily API allowance", "deleted_fields", estimate.DeletedFields,
+			"calls", needed, "remaining", api.Remaining, "max", api.Max)
+	case float64(left) < float64(api.Max)*apiReserveRatio:
+		s.log.Warn("Scan will leave little of the daily API allowance", "deleted_fields", estimate.DeletedFields,
+			"calls", needed, "remaining", api.Remaining, "max", api.Max)
+	default:
+		s.log.Info("Daily API allowance covers the scan", "deleted_fields", estimate.DeletedFields,
+			"calls", needed, "remaining", api.Remaining, "max", api.Max)
+	}
+}
+
+// checkApiBudget stops the scan if estimate exceeds Config.MaxApiCalls,
+// unless Config.OnBudgetExceeded allows it to go ahead.
+func (s *Scan) checkApiBudget(estimate Estimate) error {
+	if s.cfg.MaxApiCalls <= 0 {
+		return nil
+	}
+
+	s.log.Info("Estimated API calls", "deleted_fields", estimate.DeletedFields, "calls", estimate.Total, "max", s.cfg.MaxApiCalls)
+
+	if estimate.Total <= int64(s.cfg.MaxApiCalls) {
+		return nil
+	}
+	if s.cfg.OnBudgetExceeded != nil && s.cfg.OnBudgetExceeded(s.org, estimate) {
+		s.log.Warn("Going ahead over the API call budget", "calls", estimate.Total, "max", s.cfg.MaxApiCalls)
+		s.callLimitLifted.Store(true)
+		return nil
+	}
+	return fmt.Errorf("%w: about %d calls, limit %d", ErrApiBudget, estimate.Total, s.cfg.MaxApiCalls)
+}
+
+// checkCallLimit refuses a call once the scan has made Config.MaxApiCalls
+// of them, stopping the scan the first time. The estimate is only a guess,
+// so this holds the scan to the limit if it turns out to need more. A scan
+// allowed to go ahead over the budget is not held to it.
+func (s *Scan) checkCallLimit() error {
+	if s.cfg.MaxApiCalls <= 0 || s.callLimitLifted.Load() {
+		return nil
+	}
+	if s.callLimitReached.Load() {
+		return ErrApiCallLimit
+	}
+	if s.apiCalls.Load() < int64(s.cfg.MaxApiCalls) {
+		return nil
+	}
+	if s.callLimitReached.CompareAndSwap(false, true) {
+		s.log.Error("Stopping the scan at the API call limit", "calls", s.apiCalls.Load(), "max", s.cfg.MaxApiCalls)
+		if s.stop != nil {
+			s.stop(ErrApiCallLimit)
+		}
+	}
+	return ErrApiCallLimit
+}
+
+// callLimitErr describes why the scan stopped at the call limit.
+func (s *Scan) callLimitErr() error {
+	return fmt.Errorf("%w: %d calls made, limit %d", ErrApiCallLimit, s.apiCalls.Load(), s.cfg.MaxApiCalls)
+}
+
+// CallLimitReached reports whether the scan stopped early because it made
+// Config.MaxApiCalls calls.
+func (s *Scan) CallLimitReached() bool {
+	return s.callLimitReached.Load()
+}
+
+// limitedExecutor holds every query to the scan's API call limit.
+type limitedExecutor struct {
+	scan     *Scan
+	executor sfclient.Executor
+}
+
+func (e limitedExecutor) Query(ctx context.Context, soql string, useToolingApi bool) (sfclient.Rows, error) {
+	if err := e.scan.checkCallLimit(); err != nil {
+		return sfclient.Rows{}, err
+	}
+	return e.executor.Query(ctx, soql, useToolingApi)
+}
+
+func (e limitedExecutor) StreamQuery(ctx context.Context, soql string, useToolingApi bool, handle func(row map[string]string) error) error {
+	if err := e.scan.checkCallLimit(); err != nil {
+		return err
+	}
+	return sfclient.Stream(ctx, e.executor, soql, useToolingApi, handle)
+}
+
+// limitBatchCount holds the batched count calls, which bypass the
+// executor, to the scan's API call limit.
+func (s *Scan) limitBatchCount(countObjects func(ctx context.Context, objects []string) (map[string]int, error)) func(ctx context.Context, objects []string) (map[string]int, error) {
+	if s.cfg.MaxApiCalls <= 0 {
+		return countObjects
+	}
+	return func(ctx context.Context, objects []string) (map[string]int, error) {
+		if err := s.checkCallLimit(); err != nil {
+			return nil, err
+		}
+		return countObjects(ctx, objects)
+	}
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
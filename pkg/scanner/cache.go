@@ -0,0 +1,166 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	Value    string `json:"value"`
+	CachedAt int64  `json:"cachedAt"`
+}
+
+// metadataCache persists EntityDefinition lookups (TableEnumOrId ->
+// QualifiedApiName) across runs. Object identities rarely change, so daily
+// runs can skip most of the resolution queries.
+type metadataCache struct {
+	path    string
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	dirty   bool
+
+	// refresh makes every lookup miss, so each is fetched and stored
+	// again; see Scan.Warm.
+	refresh bool
+}
+
+func cacheFilePath(org string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user cache directory: %w", err)
+	}
+
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, org)
+
+	return filepath.Join(dir, "sf-deleted-fields", name+".json"), nil
+}
+
+func loadMetadataCache(org string, ttl time.Duration) (*metadataCache, error) {
+	path, err := cacheFilePath(org)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &metadataCache{
+		path:    path,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		slog.Debug("No metadata cache found", "path", path)
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		slog.Warn("Ignoring unreadable metadata cache", "path", path, "error", err)
+		cache.entries = make(map[string]cacheEntry)
+		return cache, nil
+	}
+
+	slog.Debug("Loaded metadata cache", "entries", len(cache.entries), "path", path)
+	return cache, nil
+}
+
+func (c *metadataCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || c.refresh {
+		return "", false
+	}
+
+	if time.Since(time.Unix(entry.CachedAt, 0)) > c.ttl {
+		slog.Debug("Metadata cache entry expired", "key", key)
+		delete(c.entries, key)
+		c.dirty = true
+		return "", false
+	}
+
+	return entry.Value, true
+}
+
+func (c *metadataCache) set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = cacheEntry{Value: value, CachedAt: time.Now().Unix()}
+	c.dirty = true
+}
+
+func (c *metadataCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata cache: %w", err)
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write metadata cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to replace metadata cache: %w", err)
+	}
+
+	slog.Debug("Saved metadata cache", "entries", len(c.entries), "path", c.path)
+	c.dirty = false
+	return nil
+}
+
+// cachedQueryRows behaves like queryRows but serves metadata lookups from the
+// on-disk cache when one is loaded.
+func (s *Scan) cachedQueryRows(ctx context.Context, queryFile string, params queryParams, useToolingApi bool) ([]map[string]string, error) {
+	if s.cache == nil {
+		return s.queryRows(ctx, queryFile, params, useToolingApi)
+	}
+
+	key := params.cacheKey(queryFile)
+	if cached, ok := s.cache.get(key); ok {
+		var rows []map[string]string
+		if err := json.Unmarshal([]byte(cached), &rows); err == nil {
+			s.log.Debug("Metadata cache hit", "key", key)
+			return rows, nil
+		}
+	}
+
+	rows, err := s.queryRows(ctx, queryFile, params, useToolingApi)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	s.cache.set(key, string(data))
+	return rows, nil
+}
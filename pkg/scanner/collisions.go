@@ -0,0 +1,87 @@
+package scanner
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// CollisionKind tells the two ways deleted field names collide.
+type CollisionKind string
+
+const (
+	// AcrossObjects is one DeveloperName deleted on several objects.
+	AcrossObjects CollisionKind = "across_objects"
+	// Suffixed is one object holding a deleted field several times over,
+	// told apart only by the number Salesforce appends, e.g. Field_del and
+	// Field_del1.
+	Suffixed CollisionKind = "suffixed"
+	// ActiveField is a deleted field whose original API name was re-created
+	// as an active field.
+	ActiveField CollisionKind = "active_field"
+)
+
+// Collision is a group of deleted fields whose names collide, which makes
+// it easy to restore or purge the wrong one during cleanup.
+type Collision struct {
+	Kind CollisionKind
+	// Name is the shared DeveloperName, for Suffixed the object and the
+	// name without its number, e.g. Account.Field_del, and for ActiveField
+	// the object and the active field, e.g. Account.Field__c.
+	Name string
+	// Fields are the colliding fields as Object.DeveloperName.
+	Fields []string
+}
+
+// Collisions groups the deleted fields in records whose names collide,
+// with each other or with an active field, ordered by kind and name.
+func Collisions(records []export.DeleteCountRecord) []Collision {
+	byName := make(map[string][]string)
+	bySuffix := make(map[string][]string)
+	byActive := make(map[string][]string)
+	for _, record := range records {
+		field := export.FieldKey(record.QualifiedApiName, record.DeveloperName)
+		byName[record.DeveloperName] = appendUnique(byName[record.DeveloperName], field)
+
+		base := export.FieldKey(record.QualifiedApiName, strings.TrimRight(record.DeveloperName, "0123456789"))
+		bySuffix[base] = appendUnique(bySuffix[base], field)
+
+		if record.ActiveField != "" {
+			active := export.FieldKey(record.QualifiedApiName, record.ActiveField)
+			byActive[active] = appendUnique(byActive[active], field)
+		}
+	}
+
+	var collisions []Collision
+	for name, fields := range byName {
+		if len(fields) > 1 {
+			collisions = append(collisions, Collision{Kind: AcrossObjects, Name: name, Fields: fields})
+		}
+	}
+	for name, fields := range bySuffix {
+		if len(fields) > 1 {
+			collisions = append(collisions, Collision{Kind: Suffixed, Name: name, Fields: fields})
+		}
+	}
+
+	for name, fields := range byActive {
+		collisions = append(collisions, Collision{Kind: ActiveField, Name: name, Fields: fields})
+	}
+
+	for _, collision := range collisions {
+		slices.Sort(collision.Fields)
+	}
+	slices.SortFunc(collisions, func(a, b Collision) int {
+		return cmp.Or(cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Name, b.Name))
+	})
+	return collisions
+}
+
+func appendUnique(values []string, value string) []string {
+	if slices.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
@@ -0,0 +1,453 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+func (s *Scan) processDeletedFields(ctx context.Context) error {
+	var wg sync.WaitGroup
+
+	org := s.org
+	cfg := s.cfg
+
+	batchedCounts := cfg.Composite || cfg.ApproxCounts
+
+	var client *sfclient.Client
+	if batchedCounts && !cfg.NoCounts {
+		var err error
+		client, err = s.restClient()
+		if err != nil {
+			return fmt.Errorf("failed to open REST session: %w", err)
+		}
+	}
+
+	var limiter *adaptiveLimiter
+	if !batchedCounts && !cfg.NoCounts {
+		if cfg.Concurrency > 0 {
+			limiter = newFixedLimiter(cfg.Concurrency)
+		} else {
+			if s.orgLimits == nil {
+				s.apiCalls.Add(1)
+				limits, err := s.readOrgLimits()
+				if err != nil {
+					s.log.Warn("Could not read org limits", "workers", MaxAutoConcurrency/2, "error", err)
+				}
+				s.orgLimits = limits
+			}
+			limiter = newAdaptiveLimiter(org, s.orgLimits)
+		}
+		s.mu.Lock()
+		s.limiter = limiter
+		s.mu.Unlock()
+	}
+
+	var batched []deletedField
+	matches := patternMatcher(cfg.Pattern)
+
+	err := s.streamKeysetRows(ctx, "soql/deleted_fields.soql", queryParams{"Pattern": cfg.Pattern}, "Id", true, func(row map[string]string) error {
+		field := deletedFieldFromRow(row)
+		if !matches.MatchString(field.DeveloperName) {
+			s.log.Debug("Skipping non-deleted field", "field", field.DeveloperName, "table", field.TableEnumOrId)
+			return nil // Skip non-deleted fields
+		}
+
+		s.fieldsFound.Add(1)
+		s.emitProgress()
+		s.log.Debug("Processing deleted field", "field", field.DeveloperName, "table", field.TableEnumOrId)
+		if field.QualifiedApiName == "" {
+			s.log.Debug("Resolving EntityDefinition", "table", field.TableEnumOrId)
+			if err := s.resolveEntity(ctx, &field); err != nil {
+				return err
+			}
+		}
+		if !cfg.NoFieldDetails && field.QualifiedApiName != "" {
+			s.resolveFieldDetails(ctx, &field)
+		}
+		s.resolved.Add(1)
+		s.emitProgress()
+
+		if cfg.Incremental && export.ConfirmedEmpty(cfg.History, field.QualifiedApiName, field.DeveloperName, cfg.IncrementalWindow) {
+			s.log.Info("Skipping field confirmed empty on a recent run", "object", field.QualifiedApiName, "field", field.DeveloperName)
+			s.mu.Lock()
+			s.skipped = append(s.skipped, export.FieldKey(field.QualifiedApiName, field.DeveloperName))
+			s.mu.Unlock()
+			return nil
+		}
+
+		if !cfg.NoCounts && s.countable != nil && !s.countable[field.QualifiedApiName] {
+			s.log.Info("Skipping object that cannot be counted", "object", field.QualifiedApiName)
+			s.appendUncountedRecord(field, export.StatusNotQueryable, "object is not queryable")
+			return nil
+		}
+
+		if cfg.NoCounts {
+			s.log.Info("Deleted field", "object", field.QualifiedApiName, "field", field.DeveloperName)
+			s.appendSkippedRecord(field)
+			return nil
+		}
+
+		if cfg.ApproxCounts {
+			batched = append(batched, field)
+			return nil
+		}
+
+		if cfg.Composite {
+			batched = append(batched, field)
+			if len(batched) == sfclient.CompositeBatchMax {
+				s.countDeletedFieldsBatched(ctx, batched, client.CompositeCounts, false)
+				batched = nil
+			}
+			return nil
+		}
+
+		if skipSelectCountLineIfNeeded(field.QualifiedApiName) {
+			s.log.Info("Skipping select count line", "object", field.QualifiedApiName)
+			s.appendUncountedRecord(field, export.StatusNotQueryable, notQueryableReason(field))
+			return nil
+		}
+
+		// The object's count is claimed before taking a worker slot, so a
+		// field on an object already being counted waits for that count
+		// without holding a slot idle or having the wait taken for query
+		// latency by the limiter.
+		counted, claimed := s.claimCount(field.QualifiedApiName)
+		if !claimed {
+			s.log.Debug("Reusing object count", "object", field.QualifiedApiName)
+			wg.Add(1)
+			go func(field deletedField) {
+				defer wg.Done()
+				<-counted.ready
+				s.appendObjectCount(field, counted, false)
+			}(field)
+			return nil
+		}
+
+		limiter.acquire()
+		s.budget.acquire()
+		wg.Add(1)
+		go func(field deletedField) {
+			defer wg.Done()
+			s.log.Debug("Processing API name", "object", field.QualifiedApiName)
+			start := time.Now()
+			s.takeCount(ctx, field.QualifiedApiName, counted)
+			s.budget.release()
+			limiter.release(time.Since(start))
+			s.appendObjectCount(field, counted, false)
+		}(field)
+		return nil
+	})
+
+	s.setPhase("counting")
+	wg.Wait()
+	if err != nil {
+		return fmt.Errorf("failed to process deleted fields: %w", err)
+	}
+
+	if len(batched) > 0 {
+		if cfg.ApproxCounts {
+			s.countDeletedFieldsBatched(ctx, batched, client.ApproximateCounts, true)
+		} else {
+			s.countDeletedFieldsBatched(ctx, batched, client.CompositeCounts, false)
+		}
+	}
+	return nil
+}
+
+// countDeletedFieldsBatched counts the objects of several fields with a
+// single call to countObjects and records the results. Objects counted
+// earlier in the run are not queried again.
+func (s *Scan) countDeletedFieldsBatched(ctx context.Context, fields []deletedField, countObjects func(ctx context.Context, objects []string) (map[string]int, error), approximate bool) {
+	var objects []string
+	var countable []deletedField
+	for _, field := range fields {
+		if skipSelectCountLineIfNeeded(field.QualifiedApiName) {
+			s.log.Info("Skipping select count line", "object", field.QualifiedApiName)
+			s.appendUncountedRecord(field, export.StatusNotQueryable, notQueryableReason(field))
+			continue
+		}
+		countable = append(countable, field)
+		if _, ok := s.cachedCount(field.QualifiedApiName); ok || slices.Contains(objects, field.QualifiedApiName) {
+			continue
+		}
+		if _, filtered := s.cfg.CountFilters[field.QualifiedApiName]; filtered {
+			if !approximate {
+				// A composite batch runs plain COUNT() queries, so a
+				// filtered object is counted on its own.
+				s.countOnce(ctx, field.QualifiedApiName)
+				continue
+			}
+			s.log.Warn("Approximate counts cannot be filtered, counting every record", "object", field.QualifiedApiName)
+		}
+		objects = append(objects, field.QualifiedApiName)
+	}
+
+	if len(objects) > 0 {
+		s.countObjectsBatched(ctx, objects, countObjects, approximate)
+	}
+
+	for _, field := range countable {
+		counted, _ := s.cachedCount(field.QualifiedApiName)
+		s.appendObjectCount(field, counted, approximate)
+	}
+}
+
+// countObjectsBatched counts objects with a single call to countObjects,
+// and a second one when verifying, and caches the results.
+func (s *Scan) countObjectsBatched(ctx context.Context, objects []string, countObjects func(ctx context.Context, objects []string) (map[string]int, error), approximate bool) {
+	soql := fmt.Sprintf("SELECT Count() FROM {%s}", strings.Join(objects, ","))
+	countObjects = s.limitBatchCount(s.traceBatchCount(countObjects, soql, approximate))
+
+	s.budget.acquire()
+	done := s.trackQuery(soql)
+	start := time.Now()
+	counts, err := countObjects(ctx, objects)
+	done()
+	s.budget.release()
+	s.logIfSlow(soql, time.Since(start), "objects", len(objects))
+	// Objects whose own count query failed are marked as such, while the
+	// rest of the batch keeps its counts.
+	var failed sfclient.CountErrors
+	if errors.As(err, &failed) {
+		for object, objectErr := range failed {
+			s.log.Error("Failed to count object", "object", object, "error", objectErr)
+		}
+		err = nil
+	}
+	if err != nil {
+		s.log.Error("Failed to count objects", "objects", len(objects), "error", err)
+	}
+
+	var recounts map[string]int
+	if err == nil && s.cfg.VerifyCounts && !approximate {
+		var verifyErr error
+		s.budget.acquire()
+		recounts, verifyErr = countObjects(ctx, objects)
+		s.budget.release()
+		if verifyErr != nil {
+			s.log.Warn("Failed to verify counts", "objects", len(objects), "error", verifyErr)
+		}
+	}
+
+	for _, object := range objects {
+		counted := &objectCount{ready: make(chan struct{}), err: err}
+		if counted.err == nil {
+			counted.err = failed[object]
+		}
+		if counted.err == nil {
+			var ok bool
+			if counted.count, ok = counts[object]; !ok {
+				counted.err = fmt.Errorf("no count returned for %s", object)
+			}
+			counted.recount, counted.verified = recounts[object]
+		}
+		close(counted.ready)
+
+		s.countsMu.Lock()
+		s.objectCounts[object] = counted
+		s.countsMu.Unlock()
+	}
+}
+
+// objectCount is one object's count, taken once per run and shared by
+// every deleted field on the object.
+type objectCount struct {
+	ready chan struct{}
+	count int
+	err   error
+
+	// recount is the second read when verified, see Config.VerifyCounts.
+	recount  int
+	verified bool
+
+	// sampled marks an estimated count, see Config.Sample.
+	sampled bool
+}
+
+// countOnce returns object's count, querying it for the first field on
+// the object only; fields counted meanwhile wait for that query and share
+// its result.
+func (s *Scan) countOnce(ctx context.Context, object string) *objectCount {
+	counted, claimed := s.claimCount(object)
+	if !claimed {
+		s.log.Debug("Reusing object count", "object", object)
+		<-counted.ready
+		return counted
+	}
+	s.takeCount(ctx, object, counted)
+	return counted
+}
+
+// claimCount returns object's count and whether the caller claimed it, as
+// the first to ask for it this run, and must take it with takeCount. The
+// count of an object claimed before is returned to be waited for.
+func (s *Scan) claimCount(object string) (*objectCount, bool) {
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+	if counted, ok := s.objectCounts[object]; ok {
+		return counted, false
+	}
+	counted := &objectCount{ready: make(chan struct{})}
+	s.objectCounts[object] = counted
+	return counted, true
+}
+
+// takeCount queries the count of object claimed with claimCount, and
+// releases the fields waiting for it.
+func (s *Scan) takeCount(ctx context.Context, object string, counted *objectCount) {
+	defer close(counted.ready)
+
+	if s.cfg.Sample {
+		counted.count, counted.sampled, counted.err = s.sampleObject(ctx, object)
+	} else {
+		counted.count, counted.err = s.countObject(ctx, object)
+	}
+	if counted.err != nil {
+		s.log.Error("Failed to count object", "object", object, "error", counted.err)
+		return
+	}
+
+	if s.cfg.VerifyCounts && !counted.sampled {
+		recount, err := s.countObject(ctx, object)
+		if err != nil {
+			s.log.Warn("Failed to verify count", "object", object, "error", err)
+		} else {
+			counted.recount, counted.verified = recount, true
+		}
+	}
+}
+
+// cachedCount returns object's count if it has been taken this run.
+func (s *Scan) cachedCount(object string) (*objectCount, bool) {
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+	counted, ok := s.objectCounts[object]
+	return counted, ok
+}
+
+// appendObjectCount records field with its object's count.
+func (s *Scan) appendObjectCount(field deletedField, counted *objectCount, approximate bool) {
+	if counted.err != nil {
+		s.appendFailedRecord(field, counted.err)
+		return
+	}
+
+	record := s.newCountRecord(field, counted.count, approximate || counted.sampled)
+	record.Sampled = counted.sampled
+	if !approximate {
+		record.CountFilter = s.cfg.CountFilters[field.QualifiedApiName]
+	}
+	if counted.verified {
+		s.checkRecount(&record, counted.recount)
+	}
+	s.appendDeleteCountRecord(record)
+}
+
+// checkRecount compares a second read of the record's count with the first
+// and marks the record unstable when they differ by more than
+// Config.VerifyTolerance, a share of the larger read. A count that moves
+// between two reads is most likely being changed by a data load, so the
+// snapshot may not hold.
+func (s *Scan) checkRecount(record *export.DeleteCountRecord, recount int) {
+	diff := record.Count - recount
+	if diff < 0 {
+		diff = -diff
+	}
+	if float64(diff) <= s.cfg.VerifyTolerance*float64(max(record.Count, recount)) {
+		return
+	}
+
+	s.log.Warn("Count changed between reads", "object", record.QualifiedApiName, "field", record.DeveloperName, "first", record.Count, "second", recount)
+	record.Unstable = true
+	record.Recount = recount
+}
+
+func newDeleteCountRecord(field deletedField, at time.Time) export.DeleteCountRecord {
+	return export.DeleteCountRecord{
+		DeveloperName:     field.DeveloperName,
+		TableEnumOrId:     field.TableEnumOrId,
+		QualifiedApiName:  field.QualifiedApiName,
+		ApiName:           field.EntityName,
+		FieldLabel:        field.Label,
+		DataType:          field.DataType,
+		ReferenceTo:       field.ReferenceTo,
+		FormulaType:       field.FormulaType,
+		ObjectLabel:       field.ObjectLabel,
+		ObjectPluralLabel: field.ObjectPluralLabel,
+		DeleteCandidate:   field.DeleteCandidate,
+		ActiveField:       field.ActiveField,
+		Timestamp:         at.Unix(),
+		TimestampISO:      at.Format(time.RFC3339),
+	}
+}
+
+// appendSkippedRecord records a deleted field for the inventory without a
+// count, so it does not contribute to LastRunCount.
+func (s *Scan) appendSkippedRecord(field deletedField) {
+	s.appendUncountedRecord(field, export.StatusSkipped, "")
+}
+
+// appendUncountedRecord records a deleted field whose object was not
+// counted, with status saying why.
+func (s *Scan) appendUncountedRecord(field deletedField, status export.Status, reason string) {
+	record := newDeleteCountRecord(field, time.Now())
+	record.CountSkipped = true
+	record.Status = status
+	record.Error = reason
+	s.addRecord(record)
+}
+
+// appendFailedRecord records a deleted field whose count query failed, so
+// the export does not read as a zero count.
+func (s *Scan) appendFailedRecord(field deletedField, err error) {
+	s.failures.Add(1)
+	s.appendUncountedRecord(field, export.StatusCountFailed, strings.TrimSpace(err.Error()))
+}
+
+// notQueryableReason explains why skipSelectCountLineIfNeeded passed over
+// field's object.
+func notQueryableReason(field deletedField) string {
+	if field.QualifiedApiName == "" {
+		return "object could not be resolved"
+	}
+	return "platform event objects cannot be counted"
+}
+
+// newCountRecord returns the record of a successful count.
+func (s *Scan) newCountRecord(field deletedField, count int, approximate bool) export.DeleteCountRecord {
+	record := newDeleteCountRecord(field, time.Now())
+	record.Count = count
+	record.Approximate = approximate
+	record.Status = export.StatusOK
+	return record
+}
+
+func (s *Scan) appendDeleteCountRecord(record export.DeleteCountRecord) {
+	s.log.Debug("Appending delete count record", "object", record.QualifiedApiName, "field", record.DeveloperName, "count", record.Count)
+	s.addRecord(record)
+}
+
+// addRecord stores a finished record and hands it to Config.OnRecord.
+func (s *Scan) addRecord(record export.DeleteCountRecord) {
+	s.mu.Lock()
+	s.records = append(s.records, record)
+	s.mu.Unlock()
+	if record.Status != export.StatusCountFailed {
+		s.countsDone.Add(1)
+	}
+
+	if s.cfg.OnRecord != nil {
+		s.emitMu.Lock()
+		s.cfg.OnRecord(record)
+		s.emitMu.Unlock()
+	}
+	s.emitProgress()
+}
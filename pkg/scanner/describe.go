@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+const globalDescribeCacheKey = "describe|global"
+
+// loadGlobalDescribe returns the org's global describe, served from the
+// metadata cache when available.
+func (s *Scan) loadGlobalDescribe(ctx context.Context) ([]sfclient.SObjectDescribe, error) {
+	if s.cache != nil {
+		if cached, ok := s.cache.get(globalDescribeCacheKey); ok {
+			var sObjects []sfclient.SObjectDescribe
+			if err := json.Unmarshal([]byte(cached), &sObjects); err == nil {
+				s.log.Debug("Metadata cache hit", "key", globalDescribeCacheKey)
+				return sObjects, nil
+			}
+		}
+	}
+
+	describer, ok := s.cfg.Executor.(sfclient.Describer)
+	if !ok {
+		client, err := s.restClient()
+		if err != nil {
+			return nil, err
+		}
+		describer = client
+	}
+
+	started := time.Now()
+	sObjects, err := describer.DescribeGlobal(ctx)
+	s.traceCall(Call{Kind: CallDescribe, Started: started, Duration: time.Since(started), Rows: len(sObjects), Err: err})
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.Recorder != nil {
+		s.cfg.Recorder.RecordDescribe(sObjects)
+	}
+
+	if s.cache != nil {
+		data, err := json.Marshal(sObjects)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode global describe: %w", err)
+		}
+		s.cache.set(globalDescribeCacheKey, string(data))
+	}
+
+	return sObjects, nil
+}
+
+// countableObjects returns the set of objects that can be counted with
+// SELECT Count(), according to the global describe.
+func countableObjects(sObjects []sfclient.SObjectDescribe) map[string]bool {
+	countable := make(map[string]bool, len(sObjects))
+	for _, sObject := range sObjects {
+		// Big objects are queryable but reject aggregate queries.
+		if sObject.Queryable && !strings.HasSuffix(sObject.Name, "__b") {
+			countable[sObject.Name] = true
+		}
+	}
+	return countable
+}
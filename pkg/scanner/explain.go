@@ -0,0 +1,176 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExplainStep is one link of the chain from a deleted field to its count:
+// the query run, what it returned and what the scan makes of it.
+type ExplainStep struct {
+	Name     string
+	SOQL     string
+	Tooling  bool
+	Rows     []map[string]string
+	Duration time.Duration
+	Result   string
+	Err      error
+}
+
+// Explanation is how a scan resolves and counts a single deleted field.
+type Explanation struct {
+	Object        string
+	DeveloperName string
+	Steps         []ExplainStep
+}
+
+// ParseFieldName splits a field name such as Account.Legacy_Status_del__c
+// into its object and the developer name CustomField lists it under.
+func ParseFieldName(name string) (object, developerName string, err error) {
+	object, field, ok := strings.Cut(name, ".")
+	if !ok || object == "" || field == "" {
+		return "", "", fmt.Errorf("invalid field %q: use Object.Field, e.g. Account.Legacy_Status_del__c", name)
+	}
+	return object, strings.TrimSuffix(field, "__c"), nil
+}
+
+// Explain follows a single deleted field through the steps Run takes for
+// it: the CustomField row, its EntityDefinition, the object's queryability
+// and the count query. It records the actual SOQL and results of each, so
+// a field that goes missing or is miscounted can be debugged.
+// It stops at the first step that rules the field out. The metadata cache
+// is not used, so every answer is fresh.
+func (s *Scan) Explain(ctx context.Context, object, developerName string) Explanation {
+	explanation := Explanation{Object: object, DeveloperName: developerName}
+	add := func(step ExplainStep) ExplainStep {
+		explanation.Steps = append(explanation.Steps, step)
+		return step
+	}
+
+	step := add(s.explainQuery(ctx, "Find the deleted field", "soql/deleted_fields.soql", queryParams{"Pattern": developerName, "After": "", "Limit": strconv.Itoa(keysetChunkSize)}, true))
+	if step.Err != nil {
+		return explanation
+	}
+
+	var fields []deletedField
+	for _, row := range step.Rows {
+		if strings.EqualFold(row["DeveloperName"], developerName) {
+			fields = append(fields, deletedFieldFromRow(row))
+		}
+	}
+	last := &explanation.Steps[len(explanation.Steps)-1]
+	switch {
+	case len(fields) == 0:
+		last.Result = fmt.Sprintf("Salesforce lists no deleted field named %s; it was erased, never deleted, or is spelled differently", developerName)
+		return explanation
+	case !patternMatcher(s.cfg.Pattern).MatchString(fields[0].DeveloperName):
+		last.Result = fmt.Sprintf("Found %s, but it does not match the pattern %s, so the scan skips it", fields[0].DeveloperName, s.cfg.Pattern)
+		return explanation
+	default:
+		last.Result = fmt.Sprintf("Found %s on %d object(s)", developerName, len(fields))
+	}
+
+	var field *deletedField
+	var found []string
+	for i := range fields {
+		candidate := &fields[i]
+		if candidate.QualifiedApiName == "" {
+			step := add(s.explainQuery(ctx, "Resolve the object of TableEnumOrId "+candidate.TableEnumOrId, "soql/entity_definition.soql", queryParams{"DurableId": candidate.TableEnumOrId}, true))
+			switch {
+			case step.Err != nil:
+				continue
+			case len(step.Rows) == 0:
+				explanation.Steps[len(explanation.Steps)-1].Result = "No EntityDefinition has this DurableId; the scan records the field as not_queryable"
+				continue
+			}
+			candidate.EntityName = step.Rows[0]["DeveloperName"]
+			candidate.QualifiedApiName = step.Rows[0]["QualifiedApiName"]
+			explanation.Steps[len(explanation.Steps)-1].Result = "Resolved to " + candidate.QualifiedApiName
+		} else {
+			add(ExplainStep{
+				Name:   "Resolve the object of TableEnumOrId " + candidate.TableEnumOrId,
+				Result: "Resolved to " + candidate.QualifiedApiName + " through the CustomField row's EntityDefinition, no lookup needed",
+			})
+		}
+
+		found = append(found, candidate.QualifiedApiName)
+		if strings.EqualFold(candidate.QualifiedApiName, object) {
+			field = candidate
+		}
+	}
+	if field == nil {
+		add(ExplainStep{
+			Name:   "Match the object",
+			Result: fmt.Sprintf("None of the deleted fields named %s is on %s; they are on: %s", developerName, object, strings.Join(found, ", ")),
+		})
+		return explanation
+	}
+
+	if skipSelectCountLineIfNeeded(field.QualifiedApiName) {
+		add(ExplainStep{Name: "Check the object can be counted", Result: notQueryableReason(*field) + "; the scan records the field as not_queryable"})
+		return explanation
+	}
+	if !s.cfg.NoDescribe {
+		started := time.Now()
+		sObjects, err := s.loadGlobalDescribe(ctx)
+		step := ExplainStep{Name: "Check the object can be counted", Duration: time.Since(started), Err: err}
+		if err == nil {
+			if countableObjects(sObjects)[field.QualifiedApiName] {
+				step.Result = fmt.Sprintf("%s is queryable according to the global describe of %d objects", field.QualifiedApiName, len(sObjects))
+			} else {
+				step.Result = fmt.Sprintf("%s is not queryable, or is a big object, according to the global describe; the scan records the field as not_queryable", field.QualifiedApiName)
+				add(step)
+				return explanation
+			}
+		}
+		add(step)
+	}
+
+	soql := s.countQuery(field.QualifiedApiName)
+	count := ExplainStep{Name: "Count the object's records", SOQL: soql}
+	started := time.Now()
+	executor, err := s.executor()
+	if err == nil {
+		rows, queryErr := executor.Query(ctx, soql, false)
+		count.Rows, err = rows.Records, queryErr
+		if err == nil {
+			count.Result = fmt.Sprintf("%d records; every deleted field on %s reports this count", rows.TotalSize, field.QualifiedApiName)
+		}
+	}
+	count.Duration, count.Err = time.Since(started), err
+	add(count)
+
+	if !s.cfg.NoFieldDetails {
+		step := add(s.explainQuery(ctx, "Read the field's label and type", "soql/field_definitions.soql", queryParams{"Object": field.QualifiedApiName}, true))
+		if step.Err == nil {
+			result := "FieldDefinition no longer lists the field, so its label and type are left empty"
+			for _, row := range step.Rows {
+				if row["DeveloperName"] == field.DeveloperName {
+					result = fmt.Sprintf("Label %q, type %q", row["Label"], row["DataType"])
+				}
+			}
+			explanation.Steps[len(explanation.Steps)-1].Result = result
+		}
+	}
+	return explanation
+}
+
+// explainQuery runs one of the embedded queries for Explain, bypassing the
+// metadata cache.
+func (s *Scan) explainQuery(ctx context.Context, name, queryFile string, params queryParams, useToolingApi bool) ExplainStep {
+	step := ExplainStep{Name: name, Tooling: useToolingApi}
+	soql, err := s.loadQuery(queryFile, params)
+	if err != nil {
+		step.Err = err
+		return step
+	}
+	step.SOQL = soql
+
+	started := time.Now()
+	step.Rows, step.Err = s.queryRows(ctx, queryFile, params, useToolingApi)
+	step.Duration = time.Since(started)
+	return step
+}
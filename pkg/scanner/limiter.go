@@ -0,0 +1,136 @@
+package scanner
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+const (
+	// MaxAutoConcurrency is the largest worker pool an automatically tuned
+	// scan grows to.
+	MaxAutoConcurrency = 16
+
+	// Below this share of the daily API allowance the pool stops growing and
+	// falls back to a single worker.
+	apiReserveRatio = 0.10
+)
+
+// adaptiveLimiter bounds the number of in-flight count queries. In auto mode
+// the bound follows the org's remaining daily API calls and the observed
+// query latency: it grows while latency stays near the best seen and backs
+// off when queries slow down or the API allowance runs low.
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	inFlight int
+	waiting  int
+	fixed    bool
+	log      *slog.Logger
+
+	apiMax       int
+	apiRemaining int
+
+	baseline time.Duration
+	average  time.Duration
+}
+
+func newFixedLimiter(concurrency int) *adaptiveLimiter {
+	l := &adaptiveLimiter{limit: max(concurrency, 1), fixed: true, log: slog.Default()}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// newAdaptiveLimiter sizes the pool from the org's limits, starting at half
+// the maximum when they could not be read.
+func newAdaptiveLimiter(org string, limits map[string]sfclient.OrgLimit) *adaptiveLimiter {
+	l := &adaptiveLimiter{limit: MaxAutoConcurrency / 2, log: slog.With("org", org)}
+	l.cond = sync.NewCond(&l.mu)
+
+	if api, ok := limits[sfclient.DailyApiRequests]; ok && api.Max > 0 {
+		l.apiMax = api.Max
+		l.apiRemaining = api.Remaining
+		l.limit = l.ceiling()
+		l.log.Debug("Daily API requests remaining", "remaining", api.Remaining, "max", api.Max, "workers", l.limit)
+	}
+
+	return l
+}
+
+// ceiling scales the maximum pool size with the share of API calls left.
+func (l *adaptiveLimiter) ceiling() int {
+	if l.apiMax == 0 {
+		return MaxAutoConcurrency
+	}
+
+	ratio := float64(l.apiRemaining) / float64(l.apiMax)
+	if ratio <= apiReserveRatio {
+		return 1
+	}
+
+	return max(1, int(float64(MaxAutoConcurrency)*ratio))
+}
+
+func (l *adaptiveLimiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.waiting++
+	for l.inFlight >= l.limit {
+		l.cond.Wait()
+	}
+	l.waiting--
+	l.inFlight++
+}
+
+// state reports the queries running, the pool size and how many callers are
+// queued for a slot.
+func (l *adaptiveLimiter) state() (inFlight, limit, waiting int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.inFlight, l.limit, l.waiting
+}
+
+// release frees a slot and, in auto mode, feeds the query's latency back
+// into the pool size.
+func (l *adaptiveLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	defer l.cond.Broadcast()
+
+	if l.fixed {
+		return
+	}
+
+	if l.apiMax > 0 {
+		l.apiRemaining--
+	}
+
+	if l.average == 0 {
+		l.average = latency
+	} else {
+		l.average = (l.average*4 + latency) / 5
+	}
+	if l.baseline == 0 || l.average < l.baseline {
+		l.baseline = l.average
+	}
+
+	previous := l.limit
+	switch {
+	case l.average > l.baseline*2:
+		l.limit = max(1, l.limit/2)
+	case l.average < l.baseline*5/4:
+		l.limit++
+	}
+	l.limit = min(l.limit, l.ceiling())
+
+	if l.limit != previous {
+		l.log.Debug("Adjusted concurrency", "from", previous, "to", l.limit, "avg_latency", l.average, "baseline", l.baseline)
+	}
+}
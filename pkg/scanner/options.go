@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// DefaultPattern matches the API names Salesforce gives deleted custom
+// fields.
+const DefaultPattern = "%_del"
+
+// Option adjusts a Config. The entry points take options after a base
+// Config, so callers can start from NewConfig() or a Config of their own and
+// new settings can be added without breaking existing calls.
+type Option func(*Config)
+
+// NewConfig returns the defaults the command line uses, with opts applied.
+func NewConfig(opts ...Option) Config {
+	cfg := Config{
+		Pattern:           DefaultPattern,
+		IncrementalWindow: 7 * 24 * time.Hour,
+		CacheTTL:          7 * 24 * time.Hour,
+		SlowQuery:         30 * time.Second,
+	}
+	return cfg.With(opts...)
+}
+
+// With returns a copy of cfg with opts applied.
+func (cfg Config) With(opts ...Option) Config {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithOrg scans the org with this alias or username.
+func WithOrg(org string) Option {
+	return func(cfg *Config) { cfg.Org = org }
+}
+
+// WithConcurrency fixes the number of parallel count queries; zero tunes it
+// automatically.
+func WithConcurrency(n int) Option {
+	return func(cfg *Config) { cfg.Concurrency = n }
+}
+
+// WithPattern selects deleted fields by a SOQL LIKE pattern on their
+// developer name instead of DefaultPattern.
+func WithPattern(pattern string) Option {
+	return func(cfg *Config) { cfg.Pattern = pattern }
+}
+
+// WithExecutor runs every query through executor, e.g. a sfclient.Fake.
+func WithExecutor(executor sfclient.Executor) Option {
+	return func(cfg *Config) { cfg.Executor = executor }
+}
+
+// WithCli runs every query through the sf CLI instead of a REST session.
+func WithCli() Option {
+	return func(cfg *Config) { cfg.UseCli = true }
+}
+
+// WithoutCounts only inventories deleted fields.
+func WithoutCounts() Option {
+	return func(cfg *Config) { cfg.NoCounts = true }
+}
+
+// WithoutCache skips the on-disk metadata cache.
+func WithoutCache() Option {
+	return func(cfg *Config) { cfg.NoCache = true }
+}
+
+// WithIncremental skips fields that history shows were empty within window.
+func WithIncremental(history map[string]export.DeleteCountRecord, window time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.Incremental = true
+		cfg.History = history
+		cfg.IncrementalWindow = window
+	}
+}
+
+// WithBudget shares budget's worker limit with other scans.
+func WithBudget(budget WorkerBudget) Option {
+	return func(cfg *Config) { cfg.Budget = budget }
+}
+
+// WithQueriesDir overrides the embedded queries with the files in dir.
+func WithQueriesDir(dir string) Option {
+	return func(cfg *Config) { cfg.QueriesDir = dir }
+}
+
+// WithOnRecord calls fn with each record as it is counted.
+func WithOnRecord(fn func(export.DeleteCountRecord)) Option {
+	return func(cfg *Config) { cfg.OnRecord = fn }
+}
+
+// WithOnProgress calls fn with a progress snapshot whenever it changes.
+func WithOnProgress(fn func(Progress)) Option {
+	return func(cfg *Config) { cfg.OnProgress = fn }
+}
+
+// WithOnCall calls fn with every call the scan makes to Salesforce.
+func WithOnCall(fn func(Call)) Option {
+	return func(cfg *Config) { cfg.OnCall = fn }
+}
+
+// patternMatcher re-checks the rows the deleted field query returns. SOQL
+// LIKE treats _ as a wildcard, so %_del also matches names merely ending in
+// "del"; here only % is a wildcard and everything else is literal.
+func patternMatcher(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "%")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
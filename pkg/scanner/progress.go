@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	"sort"
+	"time"
+)
+
+// Progress is a snapshot of how far a scan has come.
+type Progress struct {
+	Phase    string
+	Started  time.Time
+	Finished time.Time
+
+	DeletedFields int64
+	Resolved      int64
+	Counted       int64
+	Failed        int64
+	ApiCalls      int64
+
+	// Workers, WorkersBusy and Queued describe the count worker pool; they
+	// stay zero when counts are batched or skipped.
+	Workers     int
+	WorkersBusy int
+	Queued      int
+
+	// InFlight lists the queries currently running, oldest first.
+	InFlight []InFlightQuery
+}
+
+// InFlightQuery is a query that has been sent but not yet answered.
+type InFlightQuery struct {
+	SOQL    string
+	Started time.Time
+}
+
+// Progress reports the scan's current state. It is safe to call while the
+// scan is running.
+func (s *Scan) Progress() Progress {
+	progress := Progress{
+		Phase:         s.currentPhase(),
+		Started:       s.started,
+		DeletedFields: s.fieldsFound.Load(),
+		Resolved:      s.resolved.Load(),
+		Counted:       s.countsDone.Load(),
+		Failed:        s.failures.Load(),
+		ApiCalls:      s.apiCalls.Load(),
+	}
+	if finished := s.finished.Load(); finished != 0 {
+		progress.Finished = time.Unix(0, finished)
+	}
+
+	s.mu.Lock()
+	limiter := s.limiter
+	s.mu.Unlock()
+	if limiter != nil {
+		progress.WorkersBusy, progress.Workers, progress.Queued = limiter.state()
+	}
+
+	s.queries.Range(func(_, value any) bool {
+		progress.InFlight = append(progress.InFlight, value.(InFlightQuery))
+		return true
+	})
+	sort.Slice(progress.InFlight, func(i, j int) bool {
+		return progress.InFlight[i].Started.Before(progress.InFlight[j].Started)
+	})
+
+	return progress
+}
@@ -0,0 +1,283 @@
+package scanner
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+//go:embed soql/*.soql
+var queries embed.FS
+
+// queryParams are the named values a query template is rendered with, as in
+// {{quote .DurableId}}.
+type queryParams map[string]string
+
+// cacheKey identifies a rendered query in the metadata cache. Parameter
+// values are joined in name order, so a single-parameter query keeps the
+// queryFile|value key used before templating.
+func (p queryParams) cacheKey(queryFile string) string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	key := queryFile
+	for _, name := range names {
+		key += "|" + p[name]
+	}
+	return key
+}
+
+// quoteSOQL renders value as a SOQL string literal, escaping the characters
+// that would otherwise end or alter it.
+func quoteSOQL(value string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range value {
+		switch r {
+		case '\\', '\'', '"':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// numberSOQL renders value as a SOQL integer literal, such as a LIMIT,
+// refusing anything that is not a number.
+func numberSOQL(value string) (string, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a number", value)
+	}
+	return strconv.Itoa(n), nil
+}
+
+var queryFuncs = template.FuncMap{"quote": quoteSOQL, "number": numberSOQL}
+
+// QueryFiles lists the names of the embedded queries a queries directory
+// can override.
+func QueryFiles() []string {
+	entries, _ := queries.ReadDir("soql")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// readQueryFile returns the query file's text, taking it from dir when dir
+// holds a file of the same name and from the embedded queries otherwise.
+func readQueryFile(dir, queryFile string) ([]byte, error) {
+	if dir != "" {
+		override := filepath.Join(dir, path.Base(queryFile))
+		data, err := os.ReadFile(override)
+		if err == nil {
+			slog.Debug("Using query override", "file", override)
+			return data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("query override read failed: %w", err)
+		}
+	}
+
+	return queries.ReadFile(queryFile)
+}
+
+// parseQuery parses a query template and checks that every value it
+// interpolates goes through quote or number, so no parameter reaches the
+// SOQL as bare text. It returns the names of the parameters the template refers to.
+func parseQuery(queryFile, text string) (*template.Template, map[string]bool, error) {
+	tmpl, err := template.New(path.Base(queryFile)).Funcs(queryFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query template %s: %w", queryFile, err)
+	}
+
+	refs := map[string]bool{}
+	if err := checkQuoted(tmpl.Tree.Root, refs); err != nil {
+		return nil, nil, fmt.Errorf("query template %s: %w", queryFile, err)
+	}
+	return tmpl, refs, nil
+}
+
+func checkQuoted(node parse.Node, refs map[string]bool) error {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		for _, child := range node.Nodes {
+			if err := checkQuoted(child, refs); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		collectRefs(node.Pipe, refs)
+		if len(node.Pipe.Decl) > 0 {
+			return nil
+		}
+		cmds := node.Pipe.Cmds
+		if ident, ok := cmds[len(cmds)-1].Args[0].(*parse.IdentifierNode); !ok || (ident.Ident != "quote" && ident.Ident != "number") {
+			return fmt.Errorf("line %d: %s must be passed through quote or number", node.Line, node)
+		}
+	case *parse.IfNode:
+		return checkBranch(&node.BranchNode, refs)
+	case *parse.RangeNode:
+		return checkBranch(&node.BranchNode, refs)
+	case *parse.WithNode:
+		return checkBranch(&node.BranchNode, refs)
+	}
+	return nil
+}
+
+func checkBranch(node *parse.BranchNode, refs map[string]bool) error {
+	collectRefs(node.Pipe, refs)
+	if err := checkQuoted(node.List, refs); err != nil {
+		return err
+	}
+	return checkQuoted(node.ElseList, refs)
+}
+
+// collectRefs records the parameters a pipeline reads, such as DurableId in
+// {{quote .DurableId}}.
+func collectRefs(pipe *parse.PipeNode, refs map[string]bool) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			switch arg := arg.(type) {
+			case *parse.FieldNode:
+				refs[arg.Ident[0]] = true
+			case *parse.PipeNode:
+				collectRefs(arg, refs)
+			}
+		}
+	}
+}
+
+// loadQuery renders a query file with params. Every parameter the template
+// refers to must be supplied; an override may leave parameters unused, e.g.
+// to hard-code its own WHERE clause.
+func (s *Scan) loadQuery(queryFile string, params queryParams) (string, error) {
+	slog.Debug("Reading query file", "file", queryFile)
+
+	queryData, err := readQueryFile(s.cfg.QueriesDir, queryFile)
+	if err != nil {
+		return "", fmt.Errorf("query file read failed: %w", err)
+	}
+
+	tmpl, refs, err := parseQuery(queryFile, string(queryData))
+	if err != nil {
+		return "", err
+	}
+	for name := range refs {
+		if _, ok := params[name]; !ok {
+			return "", fmt.Errorf("query template %s: parameter %q was not supplied", queryFile, name)
+		}
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, map[string]string(params)); err != nil {
+		return "", fmt.Errorf("query template %s: %w", queryFile, err)
+	}
+	return strings.ReplaceAll(b.String(), "\n", " "), nil
+}
+
+// keysetQueries are the queries streamKeysetRows pages, by the field each
+// is ordered by.
+var keysetQueries = map[string]string{"deleted_fields.soql": "Id"}
+
+// checkKeyset checks that a keyset-paged query reading its chunk's start
+// from After still ends in ORDER BY key and LIMIT {{number .Limit}}, without
+// which its chunks would skip or repeat rows. A query that ignores After is
+// run once, so needs neither.
+func checkKeyset(queryFile, key, text string, refs map[string]bool) error {
+	if !refs["After"] {
+		return nil
+	}
+	tail := regexp.MustCompile(`(?i)\bORDER\s+BY\s+` + regexp.QuoteMeta(key) + `(\s+ASC)?\s+LIMIT\s+\{\{-?\s*number\s+\.Limit\s*-?\}\}\s*$`)
+	if !tail.MatchString(text) {
+		return fmt.Errorf("query template %s: a query paged by After must end in ORDER BY %s LIMIT {{number .Limit}}", path.Base(queryFile), key)
+	}
+	return nil
+}
+
+// CheckQueryOverrides checks the .soql files in dir the way a scan would
+// load them, returning a problem for every file that overrides no embedded
+// query, does not parse, interpolates a value unquoted, refers to a
+// parameter the embedded query is not rendered with or breaks the paging of
+// a keyset-paged query.
+func CheckQueryOverrides(dir string) []error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return []error{err}
+	}
+
+	var problems []error
+	known := QueryFiles()
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".soql" {
+			continue
+		}
+		if !slices.Contains(known, entry.Name()) {
+			problems = append(problems, fmt.Errorf("%s overrides no built-in query: use one of %v", entry.Name(), known))
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		_, refs, err := parseQuery(entry.Name(), string(data))
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		builtin, _ := queries.ReadFile("soql/" + entry.Name())
+		_, supplied, err := parseQuery(entry.Name(), string(builtin))
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		if key, ok := keysetQueries[entry.Name()]; ok {
+			if err := checkKeyset(entry.Name(), key, string(data), refs); err != nil {
+				problems = append(problems, err)
+			}
+		}
+		var unknown []string
+		for name := range refs {
+			if !supplied[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		slices.Sort(unknown)
+		for _, name := range unknown {
+			problems = append(problems, fmt.Errorf("query template %s: parameter %q is never supplied", entry.Name(), name))
+		}
+	}
+	return problems
+}
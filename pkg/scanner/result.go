@@ -0,0 +1,211 @@
+package scanner
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// ObjectCount is the number of records on one object that still carry
+// deleted field data.
+type ObjectCount struct {
+	Object string
+	Count  int
+	Fields int
+}
+
+// Summary is the headline outcome of one org's scan.
+type Summary struct {
+	Org             string
+	Environment     sfclient.Environment
+	DeletedFields   int64
+	ResidualRecords int
+	Objects         []ObjectCount
+	Collisions      []Collision
+	Failures        int64
+	UnstableCounts  int
+	Duration        time.Duration
+	ApiCalls        int64
+
+	// Namespaces breaks the totals down by namespace prefix, unmanaged
+	// and standard objects under "".
+	Namespaces []export.NamespaceTotals
+
+	// DeleteCandidates are the custom objects with no custom fields left
+	// but deleted ones, which may be deleted as a whole.
+	DeleteCandidates []string
+
+	// CircuitOpen is set when the scan stopped early because its calls
+	// kept failing, so its records are incomplete.
+	CircuitOpen bool
+
+	// CallLimitReached is set when the scan stopped early because it made
+	// Config.MaxApiCalls calls, so its records are incomplete.
+	CallLimitReached bool
+}
+
+// Result is everything a finished scan produced.
+type Result struct {
+	Org      string
+	Records  []export.DeleteCountRecord
+	Summary  Summary
+	Started  time.Time
+	Finished time.Time
+}
+
+// Run scans cfg.Org, with opts applied to cfg, and returns its records and summary in memory, without
+// writing any export. A failed scan still returns the records collected
+// before the failure alongside the error.
+func Run(ctx context.Context, cfg Config, opts ...Option) (*Result, error) {
+	cfg = cfg.With(opts...)
+	scan := New(cfg.Org, cfg)
+	err := scan.Run(ctx)
+	return scan.Result(), err
+}
+
+// Result returns the scan's records and summary. Called before Run
+// finishes, it reflects the records collected so far.
+func (s *Scan) Result() *Result {
+	progress := s.Progress()
+	return &Result{
+		Org:      s.org,
+		Records:  s.Records(),
+		Summary:  s.Summary(),
+		Started:  progress.Started,
+		Finished: progress.Finished,
+	}
+}
+
+// Summary totals the scan's records per object.
+func (s *Scan) Summary() Summary {
+	progress := s.Progress()
+	records := s.Records()
+	objects := ObjectCounts(records)
+
+	residual := 0
+	for _, object := range objects {
+		residual += object.Count
+	}
+	unstable := 0
+	for _, record := range records {
+		if record.Unstable {
+			unstable++
+		}
+	}
+
+	summary := Summary{
+		Org:             s.org,
+		Environment:     s.Environment(),
+		DeletedFields:   progress.DeletedFields,
+		ResidualRecords: residual,
+		Objects:         objects,
+		Collisions:      Collisions(records),
+		Namespaces:      export.CalculateTotals(records).Namespaces,
+		Failures:        progress.Failed,
+		UnstableCounts:  unstable,
+		ApiCalls:        progress.ApiCalls,
+		CircuitOpen:     s.CircuitOpen(),
+
+		CallLimitReached: s.CallLimitReached(),
+		DeleteCandidates: DeleteCandidates(records),
+	}
+	if !progress.Finished.IsZero() {
+		summary.Duration = progress.Finished.Sub(progress.Started)
+	}
+	return summary
+}
+
+// ObjectCounts totals the records per object, largest first. Every deleted
+// field on an object reports the same object count, so each object is
+// counted once.
+func ObjectCounts(records []export.DeleteCountRecord) []ObjectCount {
+	index := make(map[string]int)
+	var objects []ObjectCount
+	for _, record := range records {
+		if record.CountSkipped {
+			continue
+		}
+
+		i, ok := index[record.QualifiedApiName]
+		if !ok {
+			i = len(objects)
+			index[record.QualifiedApiName] = i
+			objects = append(objects, ObjectCount{Object: record.QualifiedApiName})
+		}
+		objects[i].Count = max(objects[i].Count, record.Count)
+		objects[i].Fields++
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		if objects[i].Count != objects[j].Count {
+			return objects[i].Count > objects[j].Count
+		}
+		return objects[i].Object < objects[j].Object
+	})
+	return objects
+}
+
+// DeleteCandidates lists, sorted, the objects whose records are marked as
+// delete candidates.
+func DeleteCandidates(records []export.DeleteCountRecord) []string {
+	var objects []string
+	for _, record := range records {
+		if record.DeleteCandidate && !slices.Contains(objects, record.QualifiedApiName) {
+			objects = append(objects, record.QualifiedApiName)
+		}
+	}
+	slices.Sort(objects)
+	return objects
+}
+
+// Event is one update from Stream: a counted record, a progress snapshot,
+// or, as the last event, the finished scan's result and error.
+type Event struct {
+	Record   *export.DeleteCountRecord
+	Progress *Progress
+
+	Result *Result
+	Err    error
+}
+
+// Stream runs the scan of cfg.Org, with opts applied, in the background and delivers its records and
+// progress on the returned channel as they are produced. The final event
+// carries the Result, after which the channel is closed. The scan waits
+// for the consumer, so the channel must be drained; once ctx is cancelled
+// undelivered events are dropped instead. Callbacks already set in cfg
+// are still called.
+func Stream(ctx context.Context, cfg Config, opts ...Option) <-chan Event {
+	cfg = cfg.With(opts...)
+	events := make(chan Event, 64)
+	send := func(event Event) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+
+	onRecord, onProgress := cfg.OnRecord, cfg.OnProgress
+	cfg.OnRecord = func(record export.DeleteCountRecord) {
+		if onRecord != nil {
+			onRecord(record)
+		}
+		send(Event{Record: &record})
+	}
+	cfg.OnProgress = func(progress Progress) {
+		if onProgress != nil {
+			onProgress(progress)
+		}
+		send(Event{Progress: &progress})
+	}
+
+	go func() {
+		defer close(events)
+		result, err := Run(ctx, cfg)
+		send(Event{Result: result, Err: err})
+	}()
+	return events
+}
@@ -0,0 +1,756 @@
+// Package scanner finds deleted custom fields (the *_del fields Salesforce
+// keeps after a field is deleted) and counts the records still stored on
+// their objects.
+package scanner
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// Config selects how deleted fields are counted during a scan.
+type Config struct {
+	// Org is the alias or username of the org the package-level Run scans;
+	// New takes it as an argument instead.
+	Org string
+
+	// Pattern is the SOQL LIKE pattern deleted fields' developer names
+	// match; empty means DefaultPattern.
+	Pattern string
+
+	// UseCli spawns the sf CLI for every query instead of reusing one
+	// authenticated REST session.
+	UseCli bool
+
+	// Executor, when set, runs every query instead of the CLI or REST
+	// session, e.g. a sfclient.Fake. It also answers the global describe
+	// and org limits if it implements sfclient.Describer or
+	// sfclient.LimitsReader. Composite and approximate counts still need a
+	// REST session.
+	Executor sfclient.Executor
+
+	// Recorder, when set, keeps every query's answer, the global describe
+	// and the org limits the scan reads, so it can be replayed offline.
+	// Composite and approximate counts are not recorded.
+	Recorder *sfclient.Recorder
+
+	Composite    bool
+	NoCounts     bool
+	ApproxCounts bool
+
+	// Incremental skips fields whose last count in History was zero and
+	// taken within IncrementalWindow.
+	Incremental       bool
+	IncrementalWindow time.Duration
+	History           map[string]export.DeleteCountRecord
+
+	// NoDescribe counts every object instead of skipping those the global
+	// describe reports as not countable.
+	NoDescribe bool
+
+	// NoFieldDetails skips looking up deleted fields' labels and data
+	// types, one FieldDefinition query per object. Object labels come with
+	// the deleted fields query and are always filled in.
+	NoFieldDetails bool
+
+	// NoCache disables the on-disk metadata cache; cached entries otherwise
+	// stay valid for CacheTTL.
+	NoCache  bool
+	CacheTTL time.Duration
+
+	// Concurrency fixes the number of parallel count queries; zero tunes it
+	// automatically from the org's API limits and query latency.
+	Concurrency int
+
+	// Budget, when set, caps the count queries in flight across several
+	// scans.
+	Budget WorkerBudget
+
+	// SlowQuery logs any single query running longer than this with its
+	// SOQL; zero disables it.
+	SlowQuery time.Duration
+
+	// MaxApiCalls, when positive, makes Run estimate the calls the scan
+	// needs before counting and stop with ErrApiBudget if they exceed it.
+	// OnBudgetExceeded, when set, is asked instead and may let the scan go
+	// ahead anyway. A scan that was not let go over the budget but reaches
+	// MaxApiCalls all the same starts no new queries and Run returns
+	// ErrApiCallLimit with the records collected so far.
+	MaxApiCalls      int
+	OnBudgetExceeded func(org string, estimate Estimate) bool
+
+	// VerifyCounts reads every exact count twice and marks records whose
+	// reads differ by more than VerifyTolerance, a share of the larger
+	// read, as Unstable. It does not apply to ApproxCounts.
+	VerifyCounts    bool
+	VerifyTolerance float64
+
+	// CountFilters maps objects to a WHERE clause their count is
+	// restricted to, e.g. to leave out archived records, since an object's
+	// raw total can overstate the data worth cleaning up. Approximate
+	// counts cannot be filtered and stay whole.
+	CountFilters map[string]string
+
+	// Sample estimates the count of objects with at least SampleThreshold
+	// records from the records in a few Id ranges instead of counting
+	// every record, trading precision for far less query time on enormous
+	// objects. Sampled counts are Approximate. It does not apply to
+	// Composite or ApproxCounts.
+	Sample          bool
+	SampleThreshold int
+
+	// LargeScanFields, when positive, makes Run check the org's daily API
+	// allowance before counting a scan of at least this many deleted fields
+	// and warn if the scan could use up what is left.
+	LargeScanFields int
+
+	// QueriesDir, when set, holds .soql files that replace the embedded
+	// queries of the same name (see QueryFiles).
+	QueriesDir string
+
+	// OnRecord, when set, receives each record as soon as it is counted,
+	// and OnProgress a snapshot whenever the scan's phase or counters
+	// change. Calls are serialized, so neither needs its own locking, but
+	// both run on the scan's workers and should return quickly.
+	OnRecord   func(export.DeleteCountRecord)
+	OnProgress func(Progress)
+
+	// MaxConsecutiveFailures, when positive, stops the scan once this many
+	// queries in a row have failed: no new queries are started, those in
+	// flight are cancelled and Run returns ErrCircuitOpen with the records
+	// collected so far.
+	MaxConsecutiveFailures int
+
+	// OnCall, when set, receives every call the scan made to Salesforce
+	// once it has finished, serialized like OnRecord, e.g. to write a
+	// trace for profiling slow runs or auditing API use.
+	OnCall func(Call)
+}
+
+// Scan holds the state of a single organization's scan, so several orgs
+// can be scanned side by side.
+type Scan struct {
+	org    string
+	log    *slog.Logger
+	cfg    Config
+	cache  *metadataCache
+	budget WorkerBudget
+
+	// countable, when set, limits counting to the objects it contains.
+	countable map[string]bool
+
+	// orgLimits holds the org's limits when preflight has already read
+	// them, so the adaptive limiter need not read them again.
+	orgLimits map[string]sfclient.OrgLimit
+
+	// objectCounts holds every object counted this run, so deleted fields
+	// sharing an object cost a single COUNT().
+	countsMu     sync.Mutex
+	objectCounts map[string]*objectCount
+
+	// fieldDetails maps each object's field developer names to their
+	// FieldDefinition rows. It is only used while streaming deleted fields,
+	// so needs no lock.
+	fieldDetails map[string]map[string]map[string]string
+
+	// liveCustomFields counts the custom fields of each object that are
+	// not deleted, for objects whose FieldDefinitions could be read.
+	liveCustomFields map[string]int
+
+	breaker circuitBreaker
+
+	// stop cancels Run's context when the breaker opens or the call limit
+	// is reached.
+	stop             context.CancelCauseFunc
+	callLimitReached atomic.Bool
+	callLimitLifted  atomic.Bool
+
+	clientOnce sync.Once
+	client     *sfclient.Client
+	clientErr  error
+
+	mu      sync.Mutex
+	records []export.DeleteCountRecord
+	// skipped holds the FieldKey of every field an incremental scan
+	// found but did not count, as it was confirmed empty on a recent run.
+	skipped []string
+	limiter *adaptiveLimiter
+
+	// queries holds the SOQL of every query in flight, for progress dumps.
+	queries     sync.Map
+	nextQueryId atomic.Int64
+
+	// environment is the org's sfclient.Environment, set once Run starts.
+	environment atomic.Value
+
+	started  time.Time
+	finished atomic.Int64
+	apiCalls atomic.Int64
+
+	// emitMu serializes the OnRecord, OnProgress and OnCall callbacks.
+	emitMu sync.Mutex
+
+	phase       atomic.Value
+	fieldsFound atomic.Int64
+	resolved    atomic.Int64
+	countsDone  atomic.Int64
+	failures    atomic.Int64
+}
+
+// New prepares a scan of org, with opts applied to cfg. Call Run to
+// perform it.
+func New(org string, cfg Config, opts ...Option) *Scan {
+	cfg = cfg.With(opts...)
+	cfg.Org = org
+	if cfg.Pattern == "" {
+		cfg.Pattern = DefaultPattern
+	}
+	return &Scan{
+		org:     org,
+		log:     slog.With("org", org),
+		cfg:     cfg,
+		budget:  cfg.Budget,
+		started: time.Now(),
+
+		objectCounts: make(map[string]*objectCount),
+		fieldDetails: make(map[string]map[string]map[string]string),
+
+		liveCustomFields: make(map[string]int),
+	}
+}
+
+// Org returns the alias of the org being scanned.
+func (s *Scan) Org() string {
+	return s.org
+}
+
+// Logger returns the logger the scan writes to, tagged with the org.
+func (s *Scan) Logger() *slog.Logger {
+	return s.log
+}
+
+// Recorder returns Config.Recorder, or nil when the scan is not recorded.
+func (s *Scan) Recorder() *sfclient.Recorder {
+	return s.cfg.Recorder
+}
+
+// Records returns the records collected so far.
+func (s *Scan) Records() []export.DeleteCountRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]export.DeleteCountRecord(nil), s.records...)
+}
+
+// Skipped returns the FieldKey of every field an incremental scan left
+// out of Records, as it was confirmed empty on a recent run.
+func (s *Scan) Skipped() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.skipped...)
+}
+
+// Run scans the org: it loads cached metadata and the global describe,
+// streams the deleted fields and counts the records on their objects.
+func (s *Scan) Run(ctx context.Context) error {
+	s.log.Info("Starting scan")
+	ctx, s.stop = context.WithCancelCause(ctx)
+	defer s.stop(nil)
+	if s.cfg.MaxConsecutiveFailures > 0 {
+		s.breaker.max, s.breaker.cancel = int64(s.cfg.MaxConsecutiveFailures), s.stop
+	}
+	s.setPhase("loading metadata")
+
+	s.detectEnvironment(ctx)
+
+	switch {
+	case s.cfg.NoCache:
+	case s.Environment() == sfclient.Scratch:
+		// A scratch org's alias is soon reused for a different org, so
+		// metadata cached under it would go stale.
+		s.log.Info("Not caching metadata for a scratch org")
+	default:
+		var err error
+		s.cache, err = loadMetadataCache(s.org, s.cfg.CacheTTL)
+		if err != nil {
+			s.log.Warn("Metadata cache disabled", "error", err)
+		}
+	}
+
+	if err := s.preflight(ctx); err != nil {
+		s.finished.Store(time.Now().UnixNano())
+		s.setPhase("finished")
+		return err
+	}
+
+	if !s.cfg.NoCounts && !s.cfg.NoDescribe {
+		sObjects, err := s.loadGlobalDescribe(ctx)
+		if err != nil {
+			s.log.Warn("Global describe unavailable, counting every object", "error", err)
+		} else {
+			s.countable = countableObjects(sObjects)
+			s.log.Debug("Loaded global describe", "countable", len(s.countable), "objects", len(sObjects))
+		}
+	}
+
+	s.log.Debug("Streaming deleted fields data")
+	s.setPhase("scanning deleted fields")
+	err := s.processDeletedFields(ctx)
+	switch {
+	case s.CircuitOpen():
+		err = s.breaker.err()
+	case s.CallLimitReached():
+		err = s.callLimitErr()
+	}
+
+	if s.cache != nil {
+		if err := s.cache.save(); err != nil {
+			s.log.Warn("Failed to save metadata cache", "error", err)
+		}
+	}
+
+	s.finished.Store(time.Now().UnixNano())
+	s.setPhase("finished")
+	if err != nil {
+		return err
+	}
+
+	s.log.Info("Scan finished", "deleted_fields", s.fieldsFound.Load(), "records", len(s.records))
+	return nil
+}
+
+// detectEnvironment labels the scan production or sandbox. A failed lookup
+// leaves it unknown, which safety checks treat like production.
+func (s *Scan) detectEnvironment(ctx context.Context) {
+	environment := sfclient.UnknownEnvironment
+	executor, err := s.executor()
+	if err == nil {
+		environment, err = sfclient.DetectEnvironment(ctx, executor)
+	}
+	if err != nil {
+		s.log.Warn("Could not tell production from sandbox", "error", err)
+	} else {
+		s.log.Debug("Detected org environment", "environment", environment)
+	}
+	s.environment.Store(environment)
+}
+
+// Environment reports whether the org is production or a sandbox; it is
+// empty until Run has started.
+func (s *Scan) Environment() sfclient.Environment {
+	environment, _ := s.environment.Load().(sfclient.Environment)
+	return environment
+}
+
+// setPhase records what the scan is currently doing for heartbeat lines.
+func (s *Scan) setPhase(phase string) {
+	s.phase.Store(phase)
+	s.emitProgress()
+}
+
+// emitProgress hands the current progress to Config.OnProgress.
+func (s *Scan) emitProgress() {
+	if s.cfg.OnProgress == nil {
+		return
+	}
+	s.emitMu.Lock()
+	defer s.emitMu.Unlock()
+	s.cfg.OnProgress(s.Progress())
+}
+
+func (s *Scan) currentPhase() string {
+	phase, _ := s.phase.Load().(string)
+	return phase
+}
+
+// trackQuery registers soql as in flight until the returned func is called.
+func (s *Scan) trackQuery(soql string) func() {
+	id := s.nextQueryId.Add(1)
+	s.queries.Store(id, InFlightQuery{SOQL: soql, Started: time.Now()})
+	return func() { s.queries.Delete(id) }
+}
+
+// logIfSlow reports a query that ran longer than Config.SlowQuery, with its
+// full SOQL, so the object holding up a scan is easy to spot.
+func (s *Scan) logIfSlow(soql string, elapsed time.Duration, args ...any) {
+	if s.cfg.SlowQuery <= 0 || elapsed < s.cfg.SlowQuery {
+		return
+	}
+	s.log.Warn("Slow query", append([]any{"duration", elapsed.Round(time.Millisecond), "soql", soql}, args...)...)
+}
+
+// restClient returns the org's REST session, opening it on first use.
+func (s *Scan) restClient() (*sfclient.Client, error) {
+	s.clientOnce.Do(func() {
+		s.client, s.clientErr = sfclient.NewClient(s.org)
+		if s.client != nil {
+			s.client.Calls = &s.apiCalls
+		}
+	})
+	return s.client, s.clientErr
+}
+
+// executor returns what runs the scan's queries: Config.Executor, the sf
+// CLI when UseCli is set, or the org's REST session, recorded when
+// Config.Recorder is set.
+func (s *Scan) executor() (sfclient.Executor, error) {
+	var executor sfclient.Executor
+	switch {
+	case s.cfg.Executor != nil:
+		executor = s.cfg.Executor
+	case s.cfg.UseCli:
+		executor = &sfclient.CLI{Org: s.org, Calls: &s.apiCalls}
+	default:
+		client, err := s.restClient()
+		if err != nil {
+			return nil, err
+		}
+		executor = client
+	}
+
+	if s.cfg.Recorder != nil {
+		executor = s.cfg.Recorder.Wrap(executor)
+	}
+	if s.cfg.OnCall != nil {
+		executor = tracingExecutor{scan: s, executor: executor}
+	}
+	if s.cfg.MaxConsecutiveFailures > 0 {
+		executor = breakerExecutor{scan: s, executor: executor}
+	}
+	if s.cfg.MaxApiCalls > 0 {
+		executor = limitedExecutor{scan: s, executor: executor}
+	}
+	return executor, nil
+}
+
+// readOrgLimits reads the org's limits from Config.Executor when it can
+// answer them, and through sf otherwise.
+func (s *Scan) readOrgLimits() (map[string]sfclient.OrgLimit, error) {
+	var limits map[string]sfclient.OrgLimit
+	var err error
+	started := time.Now()
+	if reader, ok := s.cfg.Executor.(sfclient.LimitsReader); ok {
+		limits, err = reader.Limits(context.Background())
+	} else {
+		limits, err = sfclient.FetchOrgLimits(s.org)
+	}
+	s.traceCall(Call{Kind: CallLimits, Started: started, Duration: time.Since(started), Rows: len(limits), Err: err})
+	if err == nil && s.cfg.Recorder != nil {
+		s.cfg.Recorder.RecordLimits(limits)
+	}
+	return limits, err
+}
+
+// streamKeysetRows runs one of the embedded queries in chunks of
+// keysetChunkSize rows ordered by key, each chunk starting after the last
+// key of the one before, and hands each row to handle. The Tooling API
+// does not page metadata objects reliably with OFFSET or queryMore, so
+// large inventories are walked this way instead. The query reads the
+// chunk's start from After and its size from Limit; an override that
+// ignores After is run once, and one that reads After without keeping the
+// query's ORDER BY and LIMIT is refused.
+func (s *Scan) streamKeysetRows(ctx context.Context, queryFile string, params queryParams, key string, useToolingApi bool, handle func(row map[string]string) error) error {
+	text, err := readQueryFile(s.cfg.QueriesDir, queryFile)
+	if err != nil {
+		return fmt.Errorf("query file read failed: %w", err)
+	}
+	_, refs, err := parseQuery(queryFile, string(text))
+	if err != nil {
+		return err
+	}
+	if err := checkKeyset(queryFile, key, string(text), refs); err != nil {
+		return err
+	}
+
+	var after, previous string
+	// started holds the start of every chunk so far, so a query whose last
+	// key does not advance cannot page forever.
+	started := map[string]bool{"": true}
+	for chunk := 1; ; chunk++ {
+		chunkParams := queryParams{"After": after, "Limit": strconv.Itoa(keysetChunkSize)}
+		maps.Copy(chunkParams, params)
+		soql, err := s.loadQuery(queryFile, chunkParams)
+		if err != nil {
+			return err
+		}
+		if soql == previous {
+			return nil
+		}
+		previous = soql
+
+		rows, last := 0, ""
+		err = s.streamSOQL(ctx, soql, useToolingApi, func(row map[string]string) error {
+			rows++
+			last = row[key]
+			return handle(row)
+		})
+		if err != nil {
+			return err
+		}
+		if rows < keysetChunkSize || last == "" {
+			return nil
+		}
+		if started[last] {
+			s.log.Warn("Stopping paged query whose last key did not advance", "file", queryFile, "chunk", chunk, "after", after, "last", last)
+			return nil
+		}
+		started[last] = true
+		s.log.Debug("Reading next chunk", "file", queryFile, "chunk", chunk+1, "after", last)
+		after = last
+	}
+}
+
+// streamSOQL runs soql and hands each row to handle as it arrives.
+func (s *Scan) streamSOQL(ctx context.Context, soql string, useToolingApi bool, handle func(row map[string]string) error) error {
+	// Time spent in handle is the caller's work, not the query's.
+	var handling time.Duration
+	timed := func(row map[string]string) error {
+		start := time.Now()
+		defer func() { handling += time.Since(start) }()
+		return handle(row)
+	}
+
+	defer s.trackQuery(soql)()
+	start := time.Now()
+	defer func() { s.logIfSlow(soql, time.Since(start)-handling) }()
+
+	executor, err := s.executor()
+	if err != nil {
+		return err
+	}
+
+	s.log.Debug("Streaming query", "tooling", useToolingApi, "soql", soql)
+	return sfclient.Stream(ctx, executor, soql, useToolingApi, timed)
+}
+
+func (s *Scan) queryRows(ctx context.Context, queryFile string, params queryParams, useToolingApi bool) ([]map[string]string, error) {
+	soql, err := s.loadQuery(queryFile, params)
+	if err != nil {
+		return nil, err
+	}
+
+	executor, err := s.executor()
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.trackQuery(soql)()
+	start := time.Now()
+	rows, err := executor.Query(ctx, soql, useToolingApi)
+	if err != nil {
+		return nil, err
+	}
+	s.logIfSlow(soql, time.Since(start))
+	return rows.Records, nil
+}
+
+func (s *Scan) countObject(ctx context.Context, object string) (int, error) {
+	return s.countSOQL(ctx, object, s.countQuery(object))
+}
+
+// countQuery returns the COUNT() query of object, restricted by its
+// Config.CountFilters clause and any further conditions.
+func (s *Scan) countQuery(object string, conditions ...string) string {
+	if filter := s.cfg.CountFilters[object]; filter != "" {
+		conditions = append([]string{"(" + filter + ")"}, conditions...)
+	}
+	query := "SELECT Count() FROM " + object
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return query
+}
+
+// countSOQL runs a COUNT() query on object and returns its total.
+func (s *Scan) countSOQL(ctx context.Context, object, query string) (int, error) {
+	executor, err := s.executor()
+	if err != nil {
+		return 0, err
+	}
+
+	defer s.trackQuery(query)()
+	start := time.Now()
+	defer func() { s.logIfSlow(query, time.Since(start), "object", object) }()
+
+	s.log.Debug("Querying count", "object", object, "soql", query)
+	rows, err := executor.Query(ctx, query, false)
+	if err != nil {
+		return 0, err
+	}
+	return rows.TotalSize, nil
+}
+
+// WorkerBudget caps the number of count queries in flight across all orgs.
+// A nil budget imposes no limit.
+type WorkerBudget chan struct{}
+
+func NewWorkerBudget(size int) WorkerBudget {
+	if size <= 0 {
+		return nil
+	}
+	return make(WorkerBudget, size)
+}
+
+func (b WorkerBudget) acquire() {
+	if b != nil {
+		b <- struct{}{}
+	}
+}
+
+func (b WorkerBudget) release() {
+	if b != nil {
+		<-b
+	}
+}
+
+// deletedField is a single CustomField row from the deleted fields query,
+// already joined to its EntityDefinition through the relationship columns.
+type deletedField struct {
+	DeveloperName     string
+	TableEnumOrId     string
+	EntityName        string
+	QualifiedApiName  string
+	Label             string
+	ObjectLabel       string
+	ObjectPluralLabel string
+	DataType          string
+	ReferenceTo       string
+	FormulaType       string
+	DeleteCandidate   bool
+	ActiveField       string
+}
+
+func deletedFieldFromRow(row map[string]string) deletedField {
+	return deletedField{
+		DeveloperName:     row["DeveloperName"],
+		TableEnumOrId:     row["TableEnumOrId"],
+		EntityName:        row["EntityDefinition.DeveloperName"],
+		QualifiedApiName:  row["EntityDefinition.QualifiedApiName"],
+		ObjectLabel:       row["EntityDefinition.Label"],
+		ObjectPluralLabel: row["EntityDefinition.PluralLabel"],
+	}
+}
+
+// resolveEntity fills in the object names for fields whose EntityDefinition
+// relationship came back empty, using a single cached lookup by DurableId.
+func (s *Scan) resolveEntity(ctx context.Context, field *deletedField) error {
+	rows, err := s.cachedQueryRows(ctx, "soql/entity_definition.soql", queryParams{"DurableId": field.TableEnumOrId}, true)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no EntityDefinition found for TableEnumOrId=%s", field.TableEnumOrId)
+	}
+
+	field.EntityName = rows[0]["DeveloperName"]
+	field.QualifiedApiName = rows[0]["QualifiedApiName"]
+	field.ObjectLabel = rows[0]["Label"]
+	field.ObjectPluralLabel = rows[0]["PluralLabel"]
+	return nil
+}
+
+// resolveFieldDetails fills in the field's label and data type from the
+// FieldDefinitions of its object, read once per object. Salesforce may no
+// longer list a deleted field there, so missing details are not an error.
+// A custom object listing no custom fields but deleted ones is marked as
+// a candidate for deletion, and an active field re-created under the
+// deleted field's original name is noted, as the object's count then
+// reflects its data too.
+func (s *Scan) resolveFieldDetails(ctx context.Context, field *deletedField) {
+	definitions, ok := s.fieldDetails[field.QualifiedApiName]
+	if !ok {
+		rows, err := s.cachedQueryRows(ctx, "soql/field_definitions.soql", queryParams{"Object": field.QualifiedApiName}, true)
+		if err != nil {
+			s.log.Warn("Could not read field definitions", "object", field.QualifiedApiName, "error", err)
+		}
+		definitions = make(map[string]map[string]string, len(rows))
+		for _, row := range rows {
+			definitions[row["DeveloperName"]] = row
+		}
+		s.fieldDetails[field.QualifiedApiName] = definitions
+		if err == nil {
+			s.liveCustomFields[field.QualifiedApiName] = countLiveCustomFields(rows, patternMatcher(s.cfg.Pattern))
+		}
+	}
+
+	if live, ok := s.liveCustomFields[field.QualifiedApiName]; ok && live == 0 && strings.HasSuffix(field.QualifiedApiName, "__c") {
+		field.DeleteCandidate = true
+	}
+
+	if name, ok := originalName(field.DeveloperName); ok {
+		if active, ok := definitions[name]; ok {
+			field.ActiveField = cmp.Or(active["QualifiedApiName"], name+"__c")
+			s.log.Warn("Deleted field's API name was re-created as an active field; the object's count includes its data", "object", field.QualifiedApiName, "field", field.DeveloperName, "active_field", field.ActiveField)
+		}
+	}
+
+	definition := definitions[field.DeveloperName]
+	field.Label = definition["Label"]
+	field.DataType = definition["DataType"]
+	field.ReferenceTo, field.FormulaType = parseDataType(field.DataType)
+}
+
+// deletedSuffix is what Salesforce appends to a deleted field's name,
+// numbered when the name was deleted before.
+var deletedSuffix = regexp.MustCompile(`_del\d*$`)
+
+// originalName returns the name a deleted field had before it was deleted.
+func originalName(developerName string) (string, bool) {
+	name := deletedSuffix.ReplaceAllString(developerName, "")
+	return name, name != developerName && name != ""
+}
+
+// countLiveCustomFields counts the custom fields among an object's
+// FieldDefinitions that are not deleted.
+func countLiveCustomFields(rows []map[string]string, deleted *regexp.Regexp) int {
+	live := 0
+	for _, row := range rows {
+		if strings.HasSuffix(row["QualifiedApiName"], "__c") && !deleted.MatchString(row["DeveloperName"]) {
+			live++
+		}
+	}
+	return live
+}
+
+// parseDataType picks the referenced object out of a lookup's data type,
+// e.g. "Lookup(Account)" or "Master-Detail(Account)", and the return type
+// out of a formula's, e.g. "Formula (Currency)".
+func parseDataType(dataType string) (referenceTo, formulaType string) {
+	open := strings.Index(dataType, "(")
+	if open < 0 || !strings.HasSuffix(dataType, ")") {
+		return "", ""
+	}
+	kind := strings.TrimSpace(dataType[:open])
+	inner := strings.TrimSpace(dataType[open+1 : len(dataType)-1])
+
+	switch kind {
+	case "Lookup", "Master-Detail", "External Lookup", "Indirect Lookup", "Hierarchy":
+		return inner, ""
+	case "Formula":
+		return "", inner
+	}
+	return "", ""
+}
+
+func skipSelectCountLineIfNeeded(apiName string) bool {
+	if apiName == "" {
+		return true
+	}
+
+	if strings.HasSuffix(apiName, "__e") {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,177 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+const fixture = "../sfclient/testdata/deleted_fields.json"
+
+// runFixture scans the fixture org with opts and returns the scan.
+func runFixture(t *testing.T, opts ...Option) *Scan {
+	t.Helper()
+	fake, err := sfclient.LoadFake(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewConfig(append([]Option{WithExecutor(fake), WithoutCache(), WithConcurrency(2)}, opts...)...)
+	scan := New("fixture", cfg)
+	if err := scan.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return scan
+}
+
+func recordsByField(records []export.DeleteCountRecord) map[string]export.DeleteCountRecord {
+	byField := make(map[string]export.DeleteCountRecord, len(records))
+	for _, record := range records {
+		byField[export.FieldKey(record.QualifiedApiName, record.DeveloperName)] = record
+	}
+	return byField
+}
+
+func TestRunRecords(t *testing.T) {
+	scan := runFixture(t)
+	records := recordsByField(scan.Records())
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want 5: %v", len(records), scan.Records())
+	}
+
+	tests := []struct {
+		object, field string
+		count         int
+		status        export.Status
+		label         string
+		dataType      string
+	}{
+		{"Account", "Legacy_Status_del", 120, export.StatusOK, "Legacy Status", "Picklist"},
+		{"Account", "Region_del", 120, export.StatusOK, "Sales Region", "Lookup(Region__c)"},
+		{"Contact", "Notes_del", 55, export.StatusOK, "Notes", "Formula (Text)"},
+		{"Invoice__c", "Old_Flag_del", 0, export.StatusOK, "", ""},
+		{"Broken__c", "Broken_del", 0, export.StatusCountFailed, "", ""},
+	}
+	for _, test := range tests {
+		record, ok := records[export.FieldKey(test.object, test.field)]
+		if !ok {
+			t.Errorf("%s.%s: no record", test.object, test.field)
+			continue
+		}
+		if record.Count != test.count || record.CountStatus() != test.status {
+			t.Errorf("%s.%s: count %d, status %s; want %d, %s", test.object, test.field, record.Count, record.CountStatus(), test.count, test.status)
+		}
+		if record.FieldLabel != test.label || record.DataType != test.dataType {
+			t.Errorf("%s.%s: label %q, data type %q; want %q, %q", test.object, test.field, record.FieldLabel, record.DataType, test.label, test.dataType)
+		}
+	}
+
+	// The object of a field whose entity was looked up by Id is resolved.
+	if record := records[export.FieldKey("Invoice__c", "Old_Flag_del")]; record.ObjectLabel != "Invoice" {
+		t.Errorf("Invoice__c label %q, want Invoice", record.ObjectLabel)
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	summary := runFixture(t).Summary()
+
+	if summary.DeletedFields != 5 {
+		t.Errorf("DeletedFields = %d, want 5", summary.DeletedFields)
+	}
+	// Account's two fields share its 120 records.
+	if summary.ResidualRecords != 175 {
+		t.Errorf("ResidualRecords = %d, want 175", summary.ResidualRecords)
+	}
+	if summary.Failures != 1 {
+		t.Errorf("Failures = %d, want 1", summary.Failures)
+	}
+	if summary.Environment != sfclient.Sandbox {
+		t.Errorf("Environment = %s, want %s", summary.Environment, sfclient.Sandbox)
+	}
+	if want := []string{"Broken__c", "Invoice__c"}; !slices.Equal(summary.DeleteCandidates, want) {
+		t.Errorf("DeleteCandidates = %v, want %v", summary.DeleteCandidates, want)
+	}
+}
+
+func TestRunWithoutCounts(t *testing.T) {
+	scan := runFixture(t, WithoutCounts())
+	for _, record := range scan.Records() {
+		if record.CountStatus() != export.StatusSkipped {
+			t.Errorf("%s.%s: status %s, want %s", record.QualifiedApiName, record.DeveloperName, record.CountStatus(), export.StatusSkipped)
+		}
+	}
+	if summary := scan.Summary(); summary.ResidualRecords != 0 || summary.DeletedFields != 5 {
+		t.Errorf("summary has %d fields and %d records, want 5 and 0", summary.DeletedFields, summary.ResidualRecords)
+	}
+}
+
+func TestRunIncrementalSkipped(t *testing.T) {
+	empty := export.DeleteCountRecord{QualifiedApiName: "Invoice__c", DeveloperName: "Old_Flag_del", Status: export.StatusOK, Timestamp: time.Now().Unix()}
+	history := map[string]export.DeleteCountRecord{export.FieldKey(empty.QualifiedApiName, empty.DeveloperName): empty}
+	scan := runFixture(t, WithIncremental(history, 24*time.Hour))
+
+	if _, ok := recordsByField(scan.Records())[export.FieldKey("Invoice__c", "Old_Flag_del")]; ok {
+		t.Error("field confirmed empty was counted again")
+	}
+	if want := []string{"Invoice__c.Old_Flag_del"}; !slices.Equal(scan.Skipped(), want) {
+		t.Errorf("Skipped = %v, want %v", scan.Skipped(), want)
+	}
+}
+
+func TestCheckQueryOverridesKeyset(t *testing.T) {
+	dir := t.TempDir()
+	override := "SELECT Id,DeveloperName,TableEnumOrId FROM CustomField WHERE DeveloperName like {{quote .Pattern}}{{if .After}} AND Id > {{quote .After}}{{end}} LIMIT {{number .Limit}}"
+	if err := os.WriteFile(filepath.Join(dir, "deleted_fields.soql"), []byte(override), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if problems := CheckQueryOverrides(dir); len(problems) != 1 {
+		t.Errorf("got problems %v, want one for the missing ORDER BY", problems)
+	}
+
+	fake := sfclient.NewFake()
+	scan := New("fixture", NewConfig(WithExecutor(fake), WithoutCache(), WithQueriesDir(dir)))
+	err := scan.streamKeysetRows(context.Background(), "soql/deleted_fields.soql", queryParams{"Pattern": DefaultPattern}, "Id", true, func(map[string]string) error { return nil })
+	if err == nil {
+		t.Error("override without ORDER BY was run")
+	}
+}
+
+func TestStreamKeysetRowsStopsWithoutProgress(t *testing.T) {
+	chunk := func(first int) []map[string]string {
+		rows := make([]map[string]string, keysetChunkSize)
+		for i := range rows {
+			rows[i] = map[string]string{"Id": fmt.Sprintf("00N%012d", first+i)}
+		}
+		return rows
+	}
+	first, second := chunk(0), chunk(keysetChunkSize)
+	query := "SELECT Id,DeveloperName,TableEnumOrId,EntityDefinition.DeveloperName,EntityDefinition.QualifiedApiName,EntityDefinition.Label,EntityDefinition.PluralLabel FROM CustomField WHERE DeveloperName like '%_del'"
+	after := func(rows []map[string]string) string {
+		return query + " AND Id > '" + rows[len(rows)-1]["Id"] + "' ORDER BY Id LIMIT 2000"
+	}
+	// The third chunk ends where the first did, which would page forever.
+	fake := sfclient.NewFake(
+		sfclient.FakeQuery{SOQL: query + " ORDER BY Id LIMIT 2000", Tooling: true, TotalSize: len(first), Records: first},
+		sfclient.FakeQuery{SOQL: after(first), Tooling: true, TotalSize: len(second), Records: second},
+		sfclient.FakeQuery{SOQL: after(second), Tooling: true, TotalSize: len(first), Records: first},
+	)
+	scan := New("fixture", NewConfig(WithExecutor(fake), WithoutCache()))
+
+	rows := 0
+	err := scan.streamKeysetRows(context.Background(), "soql/deleted_fields.soql", queryParams{"Pattern": DefaultPattern}, "Id", true, func(map[string]string) error {
+		rows++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("streamKeysetRows: %v", err)
+	}
+	if rows != 3*keysetChunkSize {
+		t.Errorf("got %d rows, want %d", rows, 3*keysetChunkSize)
+	}
+}
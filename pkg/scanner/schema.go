@@ -0,0 +1,55 @@
+package scanner
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// ObjectSchema is the field list of an object holding deleted fields, as
+// the scan read it from FieldDefinition.
+type ObjectSchema struct {
+	Object string        `json:"object"`
+	Fields []FieldSchema `json:"fields"`
+}
+
+// FieldSchema is one field of an ObjectSchema.
+type FieldSchema struct {
+	Name     string `json:"name"`
+	Label    string `json:"label,omitempty"`
+	DataType string `json:"dataType,omitempty"`
+	Custom   bool   `json:"custom,omitempty"`
+	Deleted  bool   `json:"deleted,omitempty"`
+}
+
+// Schema returns the field lists the scan read for the objects holding
+// deleted fields, sorted by object and field. They are read along with
+// the fields' details, so there are none under NoFieldDetails. Call it
+// once Run has returned.
+func (s *Scan) Schema() []ObjectSchema {
+	deleted := patternMatcher(s.cfg.Pattern)
+
+	var objects []ObjectSchema
+	for object, definitions := range s.fieldDetails {
+		if _, ok := s.liveCustomFields[object]; !ok {
+			// The object's field definitions could not be read.
+			continue
+		}
+
+		schema := ObjectSchema{Object: object}
+		for developerName, row := range definitions {
+			name := cmp.Or(row["QualifiedApiName"], developerName)
+			schema.Fields = append(schema.Fields, FieldSchema{
+				Name:     name,
+				Label:    row["Label"],
+				DataType: row["DataType"],
+				Custom:   strings.HasSuffix(name, "__c"),
+				Deleted:  deleted.MatchString(developerName),
+			})
+		}
+		slices.SortFunc(schema.Fields, func(a, b FieldSchema) int { return cmp.Compare(a.Name, b.Name) })
+		objects = append(objects, schema)
+	}
+	slices.SortFunc(objects, func(a, b ObjectSchema) int { return cmp.Compare(a.Object, b.Object) })
+	return objects
+}
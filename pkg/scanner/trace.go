@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"context"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// Kinds of Call.
+const (
+	CallQuery       = "query"
+	CallDescribe    = "describe"
+	CallLimits      = "limits"
+	CallComposite   = "composite"
+	CallApproxCount = "approx_counts"
+)
+
+// Call is one request a scan made to Salesforce, as handed to
+// Config.OnCall. A query paged over several HTTP requests is one Call.
+type Call struct {
+	Org      string
+	Kind     string
+	Query    string
+	Tooling  bool
+	Started  time.Time
+	Duration time.Duration
+	Rows     int
+	Err      error
+}
+
+// traceCall hands a finished call to Config.OnCall.
+func (s *Scan) traceCall(call Call) {
+	if s.cfg.OnCall == nil {
+		return
+	}
+	call.Org = s.org
+	s.emitMu.Lock()
+	defer s.emitMu.Unlock()
+	s.cfg.OnCall(call)
+}
+
+// tracingExecutor reports every query it runs to the scan's Config.OnCall.
+type tracingExecutor struct {
+	scan     *Scan
+	executor sfclient.Executor
+}
+
+func (e tracingExecutor) Query(ctx context.Context, soql string, useToolingApi bool) (sfclient.Rows, error) {
+	started := time.Now()
+	rows, err := e.executor.Query(ctx, soql, useToolingApi)
+	e.scan.traceCall(Call{Kind: CallQuery, Query: soql, Tooling: useToolingApi, Started: started, Duration: time.Since(started), Rows: rows.TotalSize, Err: err})
+	return rows, err
+}
+
+// StreamQuery leaves the time spent handling rows out of the call's
+// duration, as that is the scan's work rather than Salesforce's.
+func (e tracingExecutor) StreamQuery(ctx context.Context, soql string, useToolingApi bool, handle func(row map[string]string) error) error {
+	started := time.Now()
+	var rows int
+	var handling time.Duration
+	err := sfclient.Stream(ctx, e.executor, soql, useToolingApi, func(row map[string]string) error {
+		rows++
+		start := time.Now()
+		defer func() { handling += time.Since(start) }()
+		return handle(row)
+	})
+	e.scan.traceCall(Call{Kind: CallQuery, Query: soql, Tooling: useToolingApi, Started: started, Duration: time.Since(started) - handling, Rows: rows, Err: err})
+	return err
+}
+
+// traceBatchCount wraps a batched count so each call to it is traced under
+// soql, the batch written as one query.
+func (s *Scan) traceBatchCount(countObjects func(ctx context.Context, objects []string) (map[string]int, error), soql string, approximate bool) func(ctx context.Context, objects []string) (map[string]int, error) {
+	if s.cfg.OnCall == nil {
+		return countObjects
+	}
+	kind := CallComposite
+	if approximate {
+		kind = CallApproxCount
+	}
+	return func(ctx context.Context, objects []string) (map[string]int, error) {
+		started := time.Now()
+		counts, err := countObjects(ctx, objects)
+		s.traceCall(Call{Kind: kind, Query: soql, Started: started, Duration: time.Since(started), Rows: len(counts), Err: err})
+		return counts, err
+	}
+}
@@ -0,0 +1,86 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// Warmed is what Warm stored in the metadata cache.
+type Warmed struct {
+	CacheFile string
+
+	// Objects is the number of objects in the global describe, Entities
+	// the EntityDefinition lookups and FieldDefinitions the objects whose
+	// field lists were read.
+	Objects          int
+	Entities         int
+	FieldDefinitions int
+
+	ApiCalls int64
+}
+
+// Warm fetches the metadata a scan reads before counting, the global
+// describe, the EntityDefinitions of the deleted fields' objects and,
+// unless Config.NoFieldDetails, their field lists, and stores it in the
+// metadata cache, replacing entries already there. Scans within
+// Config.CacheTTL then start without those queries, e.g. on CI runners
+// sharing a warmed cache directory. Scratch orgs are never cached.
+func (s *Scan) Warm(ctx context.Context) (Warmed, error) {
+	var warmed Warmed
+	if s.cfg.NoCache {
+		return warmed, errors.New("the metadata cache is disabled")
+	}
+
+	s.detectEnvironment(ctx)
+	if s.Environment() == sfclient.Scratch {
+		return warmed, errors.New("metadata is not cached for scratch orgs, whose aliases are soon reused")
+	}
+
+	var err error
+	s.cache, err = loadMetadataCache(s.org, s.cfg.CacheTTL)
+	if err != nil {
+		return warmed, err
+	}
+	s.cache.refresh = true
+	warmed.CacheFile = s.cache.path
+
+	if !s.cfg.NoDescribe {
+		sObjects, err := s.loadGlobalDescribe(ctx)
+		if err != nil {
+			return warmed, fmt.Errorf("failed to read the global describe: %w", err)
+		}
+		warmed.Objects = len(sObjects)
+	}
+
+	matches := patternMatcher(s.cfg.Pattern)
+	err = s.streamKeysetRows(ctx, "soql/deleted_fields.soql", queryParams{"Pattern": s.cfg.Pattern}, "Id", true, func(row map[string]string) error {
+		field := deletedFieldFromRow(row)
+		if !matches.MatchString(field.DeveloperName) {
+			return nil
+		}
+		if field.QualifiedApiName == "" {
+			if err := s.resolveEntity(ctx, &field); err != nil {
+				return err
+			}
+			warmed.Entities++
+		}
+		if _, ok := s.fieldDetails[field.QualifiedApiName]; !ok && !s.cfg.NoFieldDetails && field.QualifiedApiName != "" {
+			s.resolveFieldDetails(ctx, &field)
+			warmed.FieldDefinitions++
+		}
+		return nil
+	})
+	if err != nil {
+		return warmed, fmt.Errorf("failed to read deleted fields: %w", err)
+	}
+
+	if err := s.cache.save(); err != nil {
+		return warmed, err
+	}
+	warmed.ApiCalls = s.apiCalls.Load()
+	s.log.Info("Warmed metadata cache", "objects", warmed.Objects, "entities", warmed.Entities, "field_definitions", warmed.FieldDefinitions, "file", warmed.CacheFile)
+	return warmed, nil
+}
@@ -0,0 +1,233 @@
+package sfclient
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+)
+
+// AuthUrlEnv is the environment variable an SFDX auth URL is usually
+// passed in, as printed by sf org display --verbose.
+const AuthUrlEnv = "SFDX_AUTH_URL"
+
+// ErrInvalidAuthUrl is returned by ParseAuthUrl for anything but a
+// force://clientId:clientSecret:refreshToken@instance URL.
+var ErrInvalidAuthUrl = errors.New("invalid SFDX auth URL")
+
+// AuthUrl holds the OAuth client and refresh token of an SFDX auth URL,
+// which is enough to open sessions without the sf CLI or its auth files.
+type AuthUrl struct {
+	ClientId     string
+	ClientSecret string
+	RefreshToken string
+	InstanceUrl  string
+
+	// Persist, when set, saves the auth URL after Salesforce rotated its
+	// refresh token, for orgs with refresh token rotation, where the old
+	// token stops working once used. Without it the new token only lasts
+	// the run.
+	Persist func(AuthUrl) error
+}
+
+// ParseAuthUrl parses force://clientId:clientSecret:refreshToken@instance.
+// The client secret may be empty, as it is for the CLI's own connected app.
+func ParseAuthUrl(s string) (AuthUrl, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(s), "force://")
+	if !ok {
+		return AuthUrl{}, fmt.Errorf("%w: must start with force://", ErrInvalidAuthUrl)
+	}
+	credentials, instance, ok := cutLast(rest, "@")
+	if !ok || instance == "" {
+		return AuthUrl{}, fmt.Errorf("%w: no instance after @", ErrInvalidAuthUrl)
+	}
+	parts := strings.SplitN(credentials, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return AuthUrl{}, fmt.Errorf("%w: expected clientId:clientSecret:refreshToken", ErrInvalidAuthUrl)
+	}
+
+	if !strings.Contains(instance, "://") {
+		instance = "https://" + instance
+	}
+	return AuthUrl{
+		ClientId:     parts[0],
+		ClientSecret: parts[1],
+		RefreshToken: parts[2],
+		InstanceUrl:  strings.TrimSuffix(instance, "/"),
+	}, nil
+}
+
+// URL formats the auth URL back into force://clientId:clientSecret:
+// refreshToken@instance. It holds the refresh token, so keep it out of logs.
+func (a AuthUrl) URL() string {
+	instance := strings.TrimPrefix(a.InstanceUrl, "https://")
+	return fmt.Sprintf("force://%s:%s:%s@%s", a.ClientId, a.ClientSecret, a.RefreshToken, instance)
+}
+
+// cutLast is strings.Cut at the last occurrence of sep; refresh tokens may
+// contain characters that precede it.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+var (
+	authUrlsMu sync.RWMutex
+	authUrls   = make(map[string]AuthUrl)
+
+	// loginMu serializes logins, so no two sessions redeem the same
+	// refresh token after rotation has replaced it.
+	loginMu sync.Mutex
+)
+
+// UseAuthUrl makes every session opened for org authenticate with auth
+// instead of asking the sf CLI, including the token refresh of a long scan
+// and the org limits lookup.
+func UseAuthUrl(org string, auth AuthUrl) {
+	authUrlsMu.Lock()
+	defer authUrlsMu.Unlock()
+	authUrls[org] = auth
+}
+
+func authUrlFor(org string) (AuthUrl, bool) {
+	authUrlsMu.RLock()
+	defer authUrlsMu.RUnlock()
+	auth, ok := authUrls[org]
+	return auth, ok
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	InstanceUrl  string `json:"instance_url"`
+	Id           string `json:"id"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// loginWithAuthUrl logs in to org with its auth URL, holding loginMu so a
+// rotated refresh token is in place before the next login reads it.
+func loginWithAuthUrl(org string) (orgDisplayResult, error) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	auth, _ := authUrlFor(org)
+	return auth.login(org)
+}
+
+// rotate keeps the refresh token Salesforce issued in place of a's, for
+// this run and, through Persist, the next.
+func (a AuthUrl) rotate(org, refreshToken string) {
+	a.RefreshToken = refreshToken
+	authUrlsMu.Lock()
+	authUrls[org] = a
+	authUrlsMu.Unlock()
+
+	if a.Persist == nil {
+		slog.Warn("Salesforce rotated the refresh token; the auth URL you passed no longer works, so update it from sf org display --verbose", "org", org)
+		return
+	}
+	if err := a.Persist(a); err != nil {
+		slog.Error("Failed to save the rotated refresh token; update the auth URL from sf org display --verbose", "org", org, "error", err)
+		return
+	}
+	slog.Info("Saved the rotated refresh token", "org", org)
+}
+
+// login exchanges the refresh token for an access token, returned in the
+// shape sf org display gives so the REST session does not care which was
+// used. A refresh token rotated in the exchange replaces a's.
+func (a AuthUrl) login(org string) (orgDisplayResult, error) {
+	slog.Debug("Obtaining access token from auth URL", "org", org)
+
+	var display orgDisplayResult
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {a.ClientId},
+		"refresh_token": {a.RefreshToken},
+	}
+	if a.ClientSecret != "" {
+		form.Set("client_secret", a.ClientSecret)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", a.InstanceUrl+"/services/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return display, fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return display, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return display, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return display, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, string(data))
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(data, &token); err != nil {
+		return display, fmt.Errorf("JSON Unmarshal failed: %w", err)
+	}
+	if token.AccessToken == "" {
+		return display, fmt.Errorf("token response has no access token for %s", org)
+	}
+
+	if token.RefreshToken != "" && token.RefreshToken != a.RefreshToken {
+		a.rotate(org, token.RefreshToken)
+	}
+
+	display.Result.AccessToken = token.AccessToken
+	display.Result.InstanceUrl = cmp.Or(token.InstanceUrl, a.InstanceUrl)
+	// The identity URL ends in /id/<org ID>/<user ID>.
+	if id := strings.TrimSuffix(token.Id, "/"); id != "" {
+		display.Result.Id = path.Base(path.Dir(id))
+	}
+
+	redact.Add("id", display.Result.Id)
+	if len(display.Result.Id) == 18 {
+		redact.Add("id", display.Result.Id[:15])
+	}
+	if instance, err := url.Parse(display.Result.InstanceUrl); err == nil {
+		redact.Add("host", instance.Hostname())
+	}
+	return display, nil
+}
+
+type restLimit struct {
+	Max       int `json:"Max"`
+	Remaining int `json:"Remaining"`
+}
+
+// Limits reads the org's limits from the REST API, the counterpart of
+// FetchOrgLimits for sessions that do not go through sf.
+func (c *Client) Limits(ctx context.Context) (map[string]OrgLimit, error) {
+	var resp map[string]restLimit
+	if err := c.do(ctx, "GET", fmt.Sprintf("/services/data/v%s/limits", c.apiVersion), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	limits := make(map[string]OrgLimit, len(resp))
+	for name, limit := range resp {
+		limits[name] = OrgLimit{Name: name, Max: limit.Max, Remaining: limit.Remaining}
+	}
+	return limits, nil
+}
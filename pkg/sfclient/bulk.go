@@ -0,0 +1,88 @@
+package sfclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// bulkPollInterval is how often a Bulk API query job is checked while
+	// it runs.
+	bulkPollInterval = 2 * time.Second
+
+	// bulkPageSize is the number of records fetched per page of a Bulk
+	// API query job's results.
+	bulkPageSize = 50000
+)
+
+type bulkJob struct {
+	Id           string `json:"id"`
+	State        string `json:"state"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// BulkQueryAll runs soql as a Bulk API 2.0 queryAll job, which also reads
+// records in the Recycle Bin, and writes its results to w as CSV with a
+// single header row. It returns the number of records written. Bulk jobs
+// suit exports of millions of records that would take thousands of REST
+// query pages.
+func (c *Client) BulkQueryAll(ctx context.Context, soql string, w io.Writer) (int, error) {
+	base := fmt.Sprintf("/services/data/v%s/jobs/query", c.apiVersion)
+
+	var job bulkJob
+	body := map[string]string{"operation": "queryAll", "query": soql}
+	if err := c.do(ctx, "POST", base, body, &job); err != nil {
+		return 0, fmt.Errorf("failed to create bulk query job: %w", err)
+	}
+	c.log.Debug("Created bulk query job", "job", job.Id)
+
+	for job.State != "JobComplete" {
+		switch job.State {
+		case "Failed", "Aborted":
+			return 0, fmt.Errorf("bulk query job %s %s: %s", job.Id, job.State, job.ErrorMessage)
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(bulkPollInterval):
+		}
+		if err := c.do(ctx, "GET", base+"/"+job.Id, nil, &job); err != nil {
+			return 0, fmt.Errorf("failed to check bulk query job: %w", err)
+		}
+	}
+
+	records := 0
+	locator := ""
+	for page := 0; ; page++ {
+		path := fmt.Sprintf("%s/%s/results?maxRecords=%d", base, job.Id, bulkPageSize)
+		if locator != "" {
+			path += "&locator=" + url.QueryEscape(locator)
+		}
+		header, data, err := c.call(ctx, "GET", path, nil, "text/csv")
+		if err != nil {
+			return records, fmt.Errorf("failed to read bulk query results: %w", err)
+		}
+
+		// Every page repeats the header row.
+		if page > 0 {
+			if _, rest, ok := bytes.Cut(data, []byte("\n")); ok {
+				data = rest
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return records, err
+		}
+		n, _ := strconv.Atoi(header.Get("Sforce-NumberOfRecords"))
+		records += n
+
+		locator = header.Get("Sforce-Locator")
+		if locator == "" || locator == "null" {
+			return records, nil
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package sfclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+)
+
+// CheckInstalled verifies that sf can be run and is at least
+// MinimumCliVersion, returning its version. An error wrapping ErrCliTooOld
+// means sf runs but needs updating. When the version cannot be read it is
+// logged and the zero CliVersion returned, leaving later commands to fail
+// on their own if the CLI really is unsupported.
+func CheckInstalled() (CliVersion, error) {
+	slog.Debug("Checking Salesforce CLI installation")
+	cmd := Command(context.Background(), "version", "--json")
+	output, err := cmd.Output()
+	if err != nil {
+		return CliVersion{}, fmt.Errorf("sf is not installed or not found, set %s to its path: %w", CliEnv, err)
+	}
+
+	raw := cliVersionString(output)
+	version, err := ParseCliVersion(raw)
+	if err != nil {
+		slog.Warn("Could not determine the Salesforce CLI version", "output", raw, "error", err)
+		return CliVersion{}, nil
+	}
+	slog.Debug("Salesforce CLI version", "version", version, "minimum", MinimumCliVersion)
+
+	if version.Less(MinimumCliVersion) {
+		return version, fmt.Errorf("%w: found %s, need %s or later; update with `sf update` or `npm install -g @salesforce/cli`",
+			ErrCliTooOld, version, MinimumCliVersion)
+	}
+	return version, nil
+}
+
+// cliVersionString extracts the version from `sf version --json` output,
+// falling back to the last non-warning line for releases that ignore --json.
+func cliVersionString(output []byte) string {
+	var parsed struct {
+		CliVersion string `json:"cliVersion"`
+	}
+	if err := json.Unmarshal(skipFirstLineIfNeeded(output), &parsed); err == nil && parsed.CliVersion != "" {
+		return parsed.CliVersion
+	}
+
+	var version string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.Contains(line, "Warning:") {
+			version = line
+		}
+	}
+	return version
+}
+
+// CLI runs every query by spawning sf. It is slower than a REST session
+// but needs nothing beyond a working CLI login.
+type CLI struct {
+	Org string
+
+	// Calls, when set, is incremented for every sf query spawned.
+	Calls *atomic.Int64
+}
+
+func (c *CLI) queryArgs(soql, format string, useToolingApi bool) []string {
+	cmdArgs := []string{"data", "query", "-o", c.Org, "-r", format, "-q", soql}
+	if useToolingApi {
+		cmdArgs = append(cmdArgs, "-t")
+	}
+	return cmdArgs
+}
+
+func (c *CLI) command(ctx context.Context, cmdArgs []string) *exec.Cmd {
+	if c.Calls != nil {
+		c.Calls.Add(1)
+	}
+	return Command(ctx, cmdArgs...)
+}
+
+type cliQueryResult struct {
+	Result struct {
+		TotalSize int              `json:"totalSize"`
+		Records   []map[string]any `json:"records"`
+	} `json:"result"`
+}
+
+// Query runs soql through sf with JSON output.
+func (c *CLI) Query(ctx context.Context, soql string, useToolingApi bool) (Rows, error) {
+	cmdArgs := c.queryArgs(soql, "json", useToolingApi)
+	slog.Debug("Executing query", "org", c.Org, "tooling", useToolingApi, "args", cmdArgs)
+
+	output, err := c.command(ctx, cmdArgs).CombinedOutput()
+	if err != nil {
+		return Rows{}, fmt.Errorf("command execution failed: %w\nOUTPUT: %s", err, string(output))
+	}
+
+	output = skipFirstLineIfNeeded(output)
+	var result cliQueryResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return Rows{}, fmt.Errorf("JSON Unmarshal failed: %w\nOUTPUT: %s", err, string(output))
+	}
+
+	rows := Rows{TotalSize: result.Result.TotalSize, Records: make([]map[string]string, 0, len(result.Result.Records))}
+	for _, record := range result.Result.Records {
+		row := make(map[string]string, len(record))
+		flattenRecord("", record, row)
+		rows.Records = append(rows.Records, row)
+	}
+	return rows, nil
+}
+
+// StreamQuery runs a CSV query and hands each row to handle as soon as it is
+// read from the CLI, so large result sets never sit in memory in full.
+func (c *CLI) StreamQuery(ctx context.Context, soql string, useToolingApi bool, handle func(row map[string]string) error) error {
+	cmdArgs := c.queryArgs(soql, "csv", useToolingApi)
+	slog.Debug("Streaming query", "org", c.Org, "tooling", useToolingApi, "args", cmdArgs)
+
+	cmd := c.command(ctx, cmdArgs)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open query output: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("command execution failed: %w", err)
+	}
+
+	handleErr := readCSVStream(stdout, handle)
+	if handleErr != nil {
+		// Drain the pipe so the CLI can exit before we wait on it.
+		io.Copy(io.Discard, stdout)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("command execution failed: %w\nOUTPUT: %s", err, stderr.String())
+	}
+	return handleErr
+}
+
+// readCSVStream skips any CLI preamble (warnings, update notices) up to the
+// CSV header and then decodes the remaining rows one at a time. Output
+// relayed from Windows through cmd.exe or WSL may start with a byte order
+// mark and end its lines with \r\r\n, leaving a stray \r in the last
+// column that encoding/csv keeps; both are dropped.
+func readCSVStream(r io.Reader, handle func(row map[string]string) error) error {
+	buffered := bufio.NewReader(r)
+
+	var headerLine string
+	for first := true; ; first = false {
+		line, err := buffered.ReadString('\n')
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if strings.Contains(line, ",") {
+			headerLine = line
+			break
+		}
+		if err == io.EOF {
+			slog.Debug("Query returned no CSV data")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read query output: %w", err)
+		}
+	}
+
+	reader := csv.NewReader(io.MultiReader(strings.NewReader(headerLine), buffered))
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("CSV parse failed: %w", err)
+	}
+	header = append([]string(nil), header...)
+	header[len(header)-1] = strings.TrimSuffix(header[len(header)-1], "\r")
+
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("CSV parse failed: %w", err)
+		}
+
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(line) {
+				row[column] = line[i]
+			}
+		}
+		if len(line) > 0 {
+			last := min(len(line), len(header)) - 1
+			row[header[last]] = strings.TrimSuffix(line[last], "\r")
+		}
+		if err := handle(row); err != nil {
+			return err
+		}
+	}
+}
+
+// skipFirstLineIfNeeded drops an update notice printed ahead of the CLI's
+// output, and the byte order mark output relayed from Windows may carry.
+func skipFirstLineIfNeeded(output []byte) []byte {
+	output = bytes.TrimPrefix(output, []byte("\ufeff"))
+	outputStr := string(output)
+	if strings.Contains(outputStr, "»") || strings.Contains(outputStr, "update available") {
+		if index := strings.Index(outputStr, "\n"); index != -1 {
+			return []byte(outputStr[index+1:])
+		}
+	}
+	return output
+}
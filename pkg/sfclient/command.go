@@ -0,0 +1,136 @@
+package sfclient
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// CliEnv names the environment variable read when UseCli has not been
+// called; it takes the same values.
+const CliEnv = "SFDF_SF_CLI"
+
+// Values for UseCli that run sf across the WSL boundary.
+const (
+	// CliWsl runs, from a Windows binary, the sf installed in the default
+	// WSL distribution.
+	CliWsl = "wsl"
+	// CliWindows runs, from inside WSL, the sf installed on Windows.
+	CliWindows = "windows"
+)
+
+var (
+	cliMu      sync.Mutex
+	cliSpec    string
+	cliSpecSet bool
+	cliPrefix  []string
+)
+
+// UseCli sets how sf is run: the path to its executable, CliWsl or
+// CliWindows. An empty spec finds sf on the PATH and, failing that, in the
+// usual install locations and on the other side of WSL.
+func UseCli(spec string) {
+	cliMu.Lock()
+	defer cliMu.Unlock()
+	cliSpec, cliSpecSet, cliPrefix = spec, true, nil
+}
+
+// Command prepares sf with args, run the way UseCli or CliEnv says.
+func Command(ctx context.Context, args ...string) *exec.Cmd {
+	prefix := cliInvocation()
+	return exec.CommandContext(ctx, prefix[0], append(prefix[1:len(prefix):len(prefix)], args...)...)
+}
+
+// cliInvocation returns the command and leading arguments sf is run with,
+// resolving them on first use.
+func cliInvocation() []string {
+	cliMu.Lock()
+	defer cliMu.Unlock()
+
+	if cliPrefix == nil {
+		spec := cliSpec
+		if !cliSpecSet {
+			spec = os.Getenv(CliEnv)
+		}
+		cliPrefix = resolveCli(spec)
+		slog.Debug("Resolved Salesforce CLI", "command", strings.Join(cliPrefix, " "))
+	}
+	return cliPrefix
+}
+
+func resolveCli(spec string) []string {
+	switch spec {
+	case CliWsl:
+		// A login shell, so an sf installed through nvm or a user npm
+		// prefix is on the PATH; the arguments pass through untouched.
+		return []string{"wsl.exe", "-e", "bash", "-lc", `exec sf "$@"`, "sf"}
+	case CliWindows:
+		return []string{"cmd.exe", "/d", "/c", "sf"}
+	case "":
+	default:
+		return []string{spec}
+	}
+
+	if runtime.GOOS == "windows" {
+		if path := findWindowsCli(); path != "" {
+			return []string{path}
+		}
+		if _, err := exec.LookPath("wsl.exe"); err == nil {
+			slog.Debug("sf is not installed on Windows, running it inside WSL")
+			return resolveCli(CliWsl)
+		}
+		return []string{"sf"}
+	}
+
+	if _, err := exec.LookPath("sf"); err != nil && insideWsl() {
+		if _, err := exec.LookPath("cmd.exe"); err == nil {
+			slog.Debug("sf is not installed in WSL, running the Windows one")
+			return resolveCli(CliWindows)
+		}
+	}
+	return []string{"sf"}
+}
+
+// findWindowsCli looks for sf on the PATH, then where the installer and
+// npm put it. In each directory the native sf.exe wins over the sf.cmd
+// shim, whichever order PATHEXT lists them in.
+func findWindowsCli() string {
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	if programFiles := os.Getenv("ProgramFiles"); programFiles != "" {
+		dirs = append(dirs, filepath.Join(programFiles, "sf", "bin"), filepath.Join(programFiles, "Salesforce CLI", "bin"))
+	}
+	if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
+		dirs = append(dirs, filepath.Join(localAppData, "sf", "bin"))
+	}
+	if appData := os.Getenv("APPDATA"); appData != "" {
+		dirs = append(dirs, filepath.Join(appData, "npm"))
+	}
+
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		for _, name := range []string{"sf.exe", "sf.cmd", "sf.bat"} {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// insideWsl reports whether this Linux binary runs in WSL with Windows
+// interop available.
+func insideWsl() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	_, err := os.Stat("/proc/sys/fs/binfmt_misc/WSLInterop")
+	return err == nil
+}
@@ -0,0 +1,28 @@
+package sfclient
+
+import (
+	"context"
+	"fmt"
+)
+
+// SObjectDescribe is an object's entry in the global describe.
+type SObjectDescribe struct {
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	LabelPlural string `json:"labelPlural"`
+	Queryable   bool   `json:"queryable"`
+}
+
+type globalDescribeResponse struct {
+	SObjects []SObjectDescribe `json:"sobjects"`
+}
+
+// DescribeGlobal lists every object in the org.
+func (c *Client) DescribeGlobal(ctx context.Context) ([]SObjectDescribe, error) {
+	c.log.Debug("Fetching global describe")
+	var resp globalDescribeResponse
+	if err := c.do(ctx, "GET", fmt.Sprintf("/services/data/v%s/sobjects", c.apiVersion), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.SObjects, nil
+}
@@ -0,0 +1,5 @@
+// Package sfclient runs SOQL against orgs the Salesforce CLI (sf) is
+// authenticated against, either by spawning sf or through a REST session
+// that reuses the CLI's access token or, where sf is not installed, one
+// obtained from an SFDX auth URL.
+package sfclient
@@ -0,0 +1,50 @@
+package sfclient
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Environment tells production orgs from sandboxes and scratch orgs.
+type Environment string
+
+const (
+	Production Environment = "production"
+	Sandbox    Environment = "sandbox"
+
+	// Scratch orgs are short-lived sandboxes created from a Dev Hub; their
+	// aliases are often reused for a new org.
+	Scratch Environment = "scratch"
+
+	// UnknownEnvironment is reported when the org could not be queried;
+	// safety checks treat it like Production.
+	UnknownEnvironment Environment = "unknown"
+)
+
+const environmentQuery = "SELECT IsSandbox,TrialExpirationDate FROM Organization"
+
+// DetectEnvironment reads the Organization record to tell whether the org
+// behind executor is production, a sandbox, or a scratch org, which is a
+// sandbox with an expiration date.
+func DetectEnvironment(ctx context.Context, executor Executor) (Environment, error) {
+	rows, err := executor.Query(ctx, environmentQuery, false)
+	if err != nil {
+		return UnknownEnvironment, fmt.Errorf("failed to query Organization: %w", err)
+	}
+	if len(rows.Records) == 0 {
+		return UnknownEnvironment, fmt.Errorf("no Organization record returned")
+	}
+
+	isSandbox, err := strconv.ParseBool(rows.Records[0]["IsSandbox"])
+	if err != nil {
+		return UnknownEnvironment, fmt.Errorf("unexpected IsSandbox value %q", rows.Records[0]["IsSandbox"])
+	}
+	switch {
+	case isSandbox && rows.Records[0]["TrialExpirationDate"] != "":
+		return Scratch, nil
+	case isSandbox:
+		return Sandbox, nil
+	}
+	return Production, nil
+}
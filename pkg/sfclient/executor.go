@@ -0,0 +1,55 @@
+package sfclient
+
+import "context"
+
+// Rows is the result of a query: its records, flattened so relationship
+// fields appear as "Parent.Field" keys, and the total number of matching
+// records, which is all a SELECT Count() query returns.
+type Rows struct {
+	TotalSize int
+	Records   []map[string]string
+}
+
+// Executor runs SOQL against one org. The sf CLI runner (CLI), the REST
+// session (Client) and the canned Fake all implement it, so the scan does
+// not depend on how it reaches Salesforce.
+type Executor interface {
+	Query(ctx context.Context, soql string, useToolingApi bool) (Rows, error)
+}
+
+// Streamer is implemented by executors that can hand over records as they
+// arrive instead of collecting the whole result first.
+type Streamer interface {
+	StreamQuery(ctx context.Context, soql string, useToolingApi bool, handle func(row map[string]string) error) error
+}
+
+// Stream runs soql through the executor's StreamQuery when it has one, and
+// otherwise feeds handle from a regular Query.
+func Stream(ctx context.Context, executor Executor, soql string, useToolingApi bool, handle func(row map[string]string) error) error {
+	if streamer, ok := executor.(Streamer); ok {
+		return streamer.StreamQuery(ctx, soql, useToolingApi, handle)
+	}
+
+	rows, err := executor.Query(ctx, soql, useToolingApi)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows.Records {
+		if err := handle(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Describer is implemented by executors that can list the org's objects
+// themselves, such as the REST session and a Fake.
+type Describer interface {
+	DescribeGlobal(ctx context.Context) ([]SObjectDescribe, error)
+}
+
+// LimitsReader is implemented by executors that can read the org's limits
+// themselves, such as the REST session and a Fake.
+type LimitsReader interface {
+	Limits(ctx context.Context) (map[string]OrgLimit, error)
+}
@@ -0,0 +1,140 @@
+package sfclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FakeQuery is one canned answer of a Fake. Records are already flattened,
+// as Executor implementations return them.
+type FakeQuery struct {
+	SOQL      string              `json:"soql"`
+	Tooling   bool                `json:"tooling,omitempty"`
+	TotalSize int                 `json:"totalSize"`
+	Records   []map[string]string `json:"records,omitempty"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// Fake is an Executor answering from canned results instead of an org, so
+// the scan pipeline can be exercised without Salesforce. Queries match on
+// their SOQL with whitespace collapsed; anything unknown is an error. The
+// global describe and org limits are answered too when the fixture has
+// them.
+type Fake struct {
+	mu       sync.Mutex
+	answers  map[string]FakeQuery
+	queries  []string
+	describe []SObjectDescribe
+	limits   map[string]OrgLimit
+}
+
+// fakeFixture is the file LoadFake reads and Recorder.Save writes.
+type fakeFixture struct {
+	Queries  []FakeQuery         `json:"queries"`
+	Describe []SObjectDescribe   `json:"describe,omitempty"`
+	Limits   map[string]OrgLimit `json:"limits,omitempty"`
+}
+
+// NewFake returns a Fake answering the given queries.
+func NewFake(queries ...FakeQuery) *Fake {
+	f := &Fake{answers: make(map[string]FakeQuery, len(queries))}
+	for _, query := range queries {
+		f.Add(query)
+	}
+	return f
+}
+
+// LoadFake reads a fixture file of the form {"queries": [FakeQuery...]},
+// optionally with "describe", the global describe's objects, and "limits",
+// the org's limits keyed by name.
+func LoadFake(path string) (*Fake, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var fixture fakeFixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to decode fixture %s: %w", path, err)
+	}
+	fake := NewFake(fixture.Queries...)
+	fake.describe = fixture.Describe
+	fake.limits = fixture.Limits
+	return fake, nil
+}
+
+func fakeKey(soql string, useToolingApi bool) string {
+	key := strings.Join(strings.Fields(soql), " ")
+	if useToolingApi {
+		key = "tooling:" + key
+	}
+	return key
+}
+
+// Add registers or replaces the answer to a query.
+func (f *Fake) Add(query FakeQuery) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.answers[fakeKey(query.SOQL, query.Tooling)] = query
+}
+
+// Query returns the canned answer for soql.
+func (f *Fake) Query(ctx context.Context, soql string, useToolingApi bool) (Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return Rows{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.queries = append(f.queries, soql)
+	answer, ok := f.answers[fakeKey(soql, useToolingApi)]
+	if !ok {
+		return Rows{}, fmt.Errorf("fake: no answer for query (tooling=%t): %s", useToolingApi, soql)
+	}
+	if answer.Error != "" {
+		return Rows{}, errors.New(answer.Error)
+	}
+
+	rows := Rows{TotalSize: answer.TotalSize, Records: make([]map[string]string, 0, len(answer.Records))}
+	for _, record := range answer.Records {
+		row := make(map[string]string, len(record))
+		for key, value := range record {
+			row[key] = value
+		}
+		rows.Records = append(rows.Records, row)
+	}
+	if rows.TotalSize == 0 {
+		rows.TotalSize = len(rows.Records)
+	}
+	return rows, nil
+}
+
+// DescribeGlobal returns the fixture's global describe.
+func (f *Fake) DescribeGlobal(ctx context.Context) ([]SObjectDescribe, error) {
+	if f.describe == nil {
+		return nil, errors.New("fake: fixture has no global describe")
+	}
+	return append([]SObjectDescribe(nil), f.describe...), nil
+}
+
+// Limits returns the fixture's org limits.
+func (f *Fake) Limits(ctx context.Context) (map[string]OrgLimit, error) {
+	if f.limits == nil {
+		return nil, errors.New("fake: fixture has no org limits")
+	}
+	return maps.Clone(f.limits), nil
+}
+
+// Queries returns every query received so far, in order.
+func (f *Fake) Queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.queries...)
+}
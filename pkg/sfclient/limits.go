@@ -0,0 +1,65 @@
+package sfclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+// OrgLimit is one of the org's API and storage limits.
+type OrgLimit struct {
+	Name      string `json:"name"`
+	Max       int    `json:"max"`
+	Remaining int    `json:"remaining"`
+}
+
+// Names of the limits the scanner and the limits command look at.
+const (
+	DailyApiRequests = "DailyApiRequests"
+	DataStorageMB    = "DataStorageMB"
+	FileStorageMB    = "FileStorageMB"
+)
+
+// Used returns how much of the limit has been consumed.
+func (l OrgLimit) Used() int {
+	return l.Max - l.Remaining
+}
+
+type orgLimitsResult struct {
+	Result []OrgLimit `json:"result"`
+}
+
+// FetchOrgLimits returns the org's limits keyed by name, e.g.
+// DailyApiRequests. It costs one API call. Orgs authenticated with
+// UseAuthUrl are read through the REST API instead of sf.
+func FetchOrgLimits(org string) (map[string]OrgLimit, error) {
+	if _, ok := authUrlFor(org); ok {
+		client, err := NewClient(org)
+		if err != nil {
+			return nil, err
+		}
+		return client.Limits(context.Background())
+	}
+
+	cmdArgs := []string{"org", "list", "limits", "-o", org, "--json"}
+	slog.Debug("Fetching org limits", "org", org, "args", cmdArgs)
+
+	cmd := Command(context.Background(), cmdArgs...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("command execution failed: %w\nOUTPUT: %s", err, string(output))
+	}
+
+	output = skipFirstLineIfNeeded(output)
+	var result orgLimitsResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("JSON Unmarshal failed: %w\nOUTPUT: %s", err, string(output))
+	}
+
+	limits := make(map[string]OrgLimit, len(result.Result))
+	for _, limit := range result.Result {
+		limits[limit.Name] = limit
+	}
+	return limits, nil
+}
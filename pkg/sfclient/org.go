@@ -0,0 +1,94 @@
+package sfclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+)
+
+type orgDisplayResult struct {
+	Result struct {
+		AccessToken string `json:"accessToken"`
+		InstanceUrl string `json:"instanceUrl"`
+		ApiVersion  string `json:"apiVersion"`
+		Username    string `json:"username"`
+		Id          string `json:"id"`
+	} `json:"result"`
+}
+
+func displayOrg(org string) (orgDisplayResult, error) {
+	if _, ok := authUrlFor(org); ok {
+		return loginWithAuthUrl(org)
+	}
+
+	slog.Debug("Obtaining access token", "org", org)
+
+	var display orgDisplayResult
+	cmd := Command(context.Background(), "org", "display", "-o", org, "--json")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return display, fmt.Errorf("command execution failed: %w\nOUTPUT: %s", err, string(output))
+	}
+
+	output = skipFirstLineIfNeeded(output)
+	if err := json.Unmarshal(output, &display); err != nil {
+		return display, fmt.Errorf("JSON Unmarshal failed: %w\nOUTPUT: %s", err, string(output))
+	}
+
+	if display.Result.AccessToken == "" || display.Result.InstanceUrl == "" {
+		return display, fmt.Errorf("org display returned no access token for %s", org)
+	}
+
+	redact.Add("user", display.Result.Username)
+	redact.Add("id", display.Result.Id)
+	if len(display.Result.Id) == 18 {
+		redact.Add("id", display.Result.Id[:15])
+	}
+	if instance, err := url.Parse(display.Result.InstanceUrl); err == nil {
+		redact.Add("host", instance.Hostname())
+	}
+
+	return display, nil
+}
+
+type configGetResult struct {
+	Result []struct {
+		Name     string `json:"name"`
+		Value    string `json:"value"`
+		Location string `json:"location"`
+	} `json:"result"`
+}
+
+// DefaultOrg returns the org sf uses when none is given: its target-org
+// config, local or global, or the SF_TARGET_ORG environment variable.
+// source says where the value came from, as sf reports it.
+func DefaultOrg() (org, source string, err error) {
+	if org := os.Getenv("SF_TARGET_ORG"); org != "" {
+		return org, "SF_TARGET_ORG", nil
+	}
+
+	cmd := Command(context.Background(), "config", "get", "target-org", "--json")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", "", fmt.Errorf("command execution failed: %w\nOUTPUT: %s", err, string(output))
+	}
+
+	var config configGetResult
+	output = skipFirstLineIfNeeded(output)
+	if err := json.Unmarshal(output, &config); err != nil {
+		return "", "", fmt.Errorf("JSON Unmarshal failed: %w\nOUTPUT: %s", err, string(output))
+	}
+	for _, entry := range config.Result {
+		if entry.Name == "target-org" && entry.Value != "" {
+			return entry.Value, strings.ToLower(entry.Location), nil
+		}
+	}
+	return "", "", errors.New("sf has no default org; set one with sf config set target-org <alias>")
+}
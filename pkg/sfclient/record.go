@@ -0,0 +1,115 @@
+package sfclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+)
+
+// Recorder keeps every answer a scan receives from Salesforce, so the scan
+// can be replayed offline from the fixture Save writes, which LoadFake
+// reads. Wrap the scan's executor with it and hand it the global describe
+// and org limits as they are read.
+type Recorder struct {
+	mu       sync.Mutex
+	answers  map[string]FakeQuery
+	describe []SObjectDescribe
+	limits   map[string]OrgLimit
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{answers: make(map[string]FakeQuery)}
+}
+
+// Wrap returns an Executor running queries through executor and recording
+// their answers, errors included.
+func (r *Recorder) Wrap(executor Executor) Executor {
+	return recordingExecutor{recorder: r, executor: executor}
+}
+
+// RecordDescribe keeps the global describe.
+func (r *Recorder) RecordDescribe(sObjects []SObjectDescribe) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.describe = slices.Clone(sObjects)
+}
+
+// RecordLimits keeps the org's limits.
+func (r *Recorder) RecordLimits(limits map[string]OrgLimit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits = maps.Clone(limits)
+}
+
+func (r *Recorder) record(soql string, useToolingApi bool, rows Rows, err error) {
+	answer := FakeQuery{SOQL: soql, Tooling: useToolingApi, TotalSize: rows.TotalSize}
+	for _, row := range rows.Records {
+		answer.Records = append(answer.Records, maps.Clone(row))
+	}
+	if err != nil {
+		answer = FakeQuery{SOQL: soql, Tooling: useToolingApi, Error: err.Error()}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.answers[fakeKey(soql, useToolingApi)] = answer
+}
+
+// Save writes everything recorded so far as a fixture file, queries in a
+// stable order so recordings of the same org can be diffed.
+func (r *Recorder) Save(path string) error {
+	r.mu.Lock()
+	fixture := fakeFixture{Describe: r.describe, Limits: r.limits}
+	keys := make([]string, 0, len(r.answers))
+	for key := range r.answers {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fixture.Queries = append(fixture.Queries, r.answers[key])
+	}
+	r.mu.Unlock()
+
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fixture: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace fixture: %w", err)
+	}
+	return nil
+}
+
+type recordingExecutor struct {
+	recorder *Recorder
+	executor Executor
+}
+
+func (e recordingExecutor) Query(ctx context.Context, soql string, useToolingApi bool) (Rows, error) {
+	rows, err := e.executor.Query(ctx, soql, useToolingApi)
+	e.recorder.record(soql, useToolingApi, rows, err)
+	return rows, err
+}
+
+// StreamQuery streams from the wrapped executor, keeping a copy of every
+// row for the recording.
+func (e recordingExecutor) StreamQuery(ctx context.Context, soql string, useToolingApi bool, handle func(row map[string]string) error) error {
+	var rows Rows
+	err := Stream(ctx, e.executor, soql, useToolingApi, func(row map[string]string) error {
+		rows.Records = append(rows.Records, row)
+		return handle(row)
+	})
+	rows.TotalSize = len(rows.Records)
+	e.recorder.record(soql, useToolingApi, rows, err)
+	return err
+}
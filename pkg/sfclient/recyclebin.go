@@ -0,0 +1,168 @@
+package sfclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// EmptyRecycleBinMax is the number of records the SOAP API's
+// emptyRecycleBin call accepts at once.
+const EmptyRecycleBinMax = 200
+
+// RecycleBinIds returns the IDs of object's records that are in the
+// Recycle Bin: deleted, but not yet erased, so they still hold the data of
+// their deleted fields.
+func (c *Client) RecycleBinIds(ctx context.Context, object string) ([]string, error) {
+	soql := fmt.Sprintf("SELECT Id FROM %s WHERE IsDeleted = true", object)
+	path := fmt.Sprintf("/services/data/v%s/queryAll?q=%s", c.apiVersion, url.QueryEscape(soql))
+
+	var ids []string
+	for path != "" {
+		var resp queryResponse
+		if err := c.do(ctx, "GET", path, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, raw := range resp.Records {
+			var record struct {
+				Id string `json:"Id"`
+			}
+			if err := json.Unmarshal(raw, &record); err != nil {
+				return nil, fmt.Errorf("JSON Unmarshal failed: %w\nOUTPUT: %s", err, string(raw))
+			}
+			ids = append(ids, record.Id)
+		}
+
+		path = ""
+		if !resp.Done {
+			path = resp.NextRecordsUrl
+		}
+	}
+	return ids, nil
+}
+
+// RecycleBinError is a record emptyRecycleBin could not erase.
+type RecycleBinError struct {
+	Id         string
+	StatusCode string
+	Message    string
+}
+
+func (e RecycleBinError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Id, e.StatusCode, e.Message)
+}
+
+type emptyRecycleBinEnvelope struct {
+	Body struct {
+		Response struct {
+			Results []struct {
+				Id      string `xml:"id"`
+				Success bool   `xml:"success"`
+				Errors  []struct {
+					StatusCode string `xml:"statusCode"`
+					Message    string `xml:"message"`
+				} `xml:"errors"`
+			} `xml:"result"`
+		} `xml:"emptyRecycleBinResponse"`
+	} `xml:"Body"`
+}
+
+// EmptyRecycleBin erases the records with ids from the Recycle Bin for
+// good, EmptyRecycleBinMax at a time, through the SOAP API, which has the
+// only call for it. It returns how many were erased and the records that
+// were not; an error means a whole batch failed.
+func (c *Client) EmptyRecycleBin(ctx context.Context, ids []string) (int, []RecycleBinError, error) {
+	erased := 0
+	var failed []RecycleBinError
+	for start := 0; start < len(ids); start += EmptyRecycleBinMax {
+		batch := ids[start:min(start+EmptyRecycleBinMax, len(ids))]
+
+		c.log.Debug("Emptying recycle bin", "records", len(batch))
+		var envelope emptyRecycleBinEnvelope
+		if err := c.soap(ctx, "emptyRecycleBin", emptyRecycleBinBody(batch), &envelope); err != nil {
+			return erased, failed, err
+		}
+		for _, result := range envelope.Body.Response.Results {
+			if result.Success {
+				erased++
+				continue
+			}
+			for _, e := range result.Errors {
+				failed = append(failed, RecycleBinError{Id: result.Id, StatusCode: e.StatusCode, Message: e.Message})
+			}
+		}
+	}
+	return erased, failed, nil
+}
+
+func emptyRecycleBinBody(ids []string) string {
+	var body strings.Builder
+	body.WriteString("<urn:emptyRecycleBin>")
+	for _, id := range ids {
+		body.WriteString("<urn:ids>")
+		xml.EscapeText(&body, []byte(id))
+		body.WriteString("</urn:ids>")
+	}
+	body.WriteString("</urn:emptyRecycleBin>")
+	return body.String()
+}
+
+// soap sends a partner SOAP API call with the REST session's access token,
+// refreshing it once if rejected, and decodes the response envelope.
+func (c *Client) soap(ctx context.Context, action, body string, out any) error {
+	path := fmt.Sprintf("/services/Soap/u/%s", c.apiVersion)
+	for attempt := 0; ; attempt++ {
+		token := c.token()
+		if c.Calls != nil {
+			c.Calls.Add(1)
+		}
+
+		var envelope bytes.Buffer
+		envelope.WriteString(`<?xml version="1.0" encoding="UTF-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:urn="urn:partner.soap.sforce.com">`)
+		envelope.WriteString("<soapenv:Header><urn:SessionHeader><urn:sessionId>")
+		xml.EscapeText(&envelope, []byte(token))
+		envelope.WriteString("</urn:sessionId></urn:SessionHeader></soapenv:Header><soapenv:Body>")
+		envelope.WriteString(body)
+		envelope.WriteString("</soapenv:Body></soapenv:Envelope>")
+
+		req, err := http.NewRequestWithContext(ctx, "POST", c.instanceUrl+path, &envelope)
+		if err != nil {
+			return fmt.Errorf("failed to build request: %w", err)
+		}
+		req.Header.Set("Content-Type", "text/xml; charset=UTF-8")
+		req.Header.Set("SOAPAction", action)
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return fmt.Errorf("request %s %s failed: %w", action, path, err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+
+		// The SOAP API reports an expired session as a fault rather than
+		// a 401.
+		if resp.StatusCode >= 300 && bytes.Contains(data, []byte("INVALID_SESSION_ID")) && attempt == 0 {
+			c.log.Debug("Access token rejected, refreshing session")
+			if err := c.refreshToken(token); err != nil {
+				return err
+			}
+			continue
+		}
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("request %s %s failed with status %d: %s", action, path, resp.StatusCode, string(data))
+		}
+		if err := xml.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("XML Unmarshal failed: %w\nOUTPUT: %s", err, string(data))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,390 @@
+package sfclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultApiVersion = "60.0"
+
+	// CompositeBatchMax is the number of subrequests the Composite batch
+	// resource accepts per request.
+	CompositeBatchMax = 25
+
+	// maxIdleConnsPerHost matches the largest worker pool a scan runs.
+	maxIdleConnsPerHost = 16
+
+	// RecordCountBatchMax is the number of objects per recordCount
+	// request, keeping request URLs well under the server's length limit.
+	RecordCountBatchMax = 200
+)
+
+// Client talks to the Salesforce REST API directly using the access token
+// of an org the sf CLI is already authenticated against. The token is fetched
+// once and all requests share one pooled HTTP client, avoiding the Node
+// start-up cost of spawning sf for every query.
+type Client struct {
+	org         string
+	log         *slog.Logger
+	instanceUrl string
+	apiVersion  string
+	http        *http.Client
+
+	// Calls, when set, is incremented for every request sent.
+	Calls *atomic.Int64
+
+	mu          sync.Mutex
+	accessToken string
+}
+
+// NewClient opens a REST session with the access token sf holds for org.
+func NewClient(org string) (*Client, error) {
+	display, err := displayOrg(org)
+	if err != nil {
+		return nil, err
+	}
+
+	apiVersion := display.Result.ApiVersion
+	if apiVersion == "" {
+		apiVersion = defaultApiVersion
+	}
+
+	slog.Debug("Using REST API", "org", org, "version", apiVersion, "instance", display.Result.InstanceUrl)
+	return &Client{
+		org:         org,
+		log:         slog.With("org", org),
+		instanceUrl: strings.TrimSuffix(display.Result.InstanceUrl, "/"),
+		accessToken: display.Result.AccessToken,
+		apiVersion:  apiVersion,
+		http: &http.Client{
+			Timeout: 5 * time.Minute,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				MaxIdleConnsPerHost: maxIdleConnsPerHost,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+	}, nil
+}
+
+func (c *Client) token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accessToken
+}
+
+// refreshToken asks the CLI for a fresh access token after the current one
+// was rejected, e.g. because the session expired during a long scan.
+func (c *Client) refreshToken(rejected string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.accessToken != rejected {
+		return nil // another request already refreshed it
+	}
+
+	display, err := displayOrg(c.org)
+	if err != nil {
+		return err
+	}
+	c.accessToken = display.Result.AccessToken
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body any, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request body: %w", err)
+		}
+	}
+
+	_, data, err := c.call(ctx, method, path, payload, "application/json")
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("JSON Unmarshal failed: %w\nOUTPUT: %s", err, string(data))
+		}
+	}
+	return nil
+}
+
+// call sends a request, refreshing the session once if the access token
+// was rejected, and returns the response headers and body of a successful
+// response.
+func (c *Client) call(ctx context.Context, method, path string, payload []byte, accept string) (http.Header, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		token := c.token()
+		if c.Calls != nil {
+			c.Calls.Add(1)
+		}
+		status, header, data, err := c.send(ctx, method, path, payload, token, accept)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if status == http.StatusUnauthorized && attempt == 0 {
+			c.log.Debug("Access token rejected, refreshing session")
+			if err := c.refreshToken(token); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if status >= 300 {
+			return nil, nil, fmt.Errorf("request %s %s failed with status %d: %s", method, path, status, string(data))
+		}
+		return header, data, nil
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, payload []byte, token, accept string) (int, http.Header, []byte, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.instanceUrl+path, reqBody)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", accept)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("request %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp.StatusCode, resp.Header, data, nil
+}
+
+type queryResponse struct {
+	TotalSize      int               `json:"totalSize"`
+	Done           bool              `json:"done"`
+	NextRecordsUrl string            `json:"nextRecordsUrl"`
+	Records        []json.RawMessage `json:"records"`
+}
+
+// queryPage runs a single page of SOQL against the data or Tooling API.
+func (c *Client) queryPage(ctx context.Context, soql string, useToolingApi bool) (queryResponse, error) {
+	resource := "query"
+	if useToolingApi {
+		resource = "tooling/query"
+	}
+
+	var resp queryResponse
+	path := fmt.Sprintf("/services/data/v%s/%s?q=%s", c.apiVersion, resource, url.QueryEscape(soql))
+	err := c.do(ctx, "GET", path, nil, &resp)
+	return resp, err
+}
+
+// Query runs SOQL and returns every record, following pagination.
+func (c *Client) Query(ctx context.Context, soql string, useToolingApi bool) (Rows, error) {
+	var rows Rows
+	err := c.stream(ctx, soql, useToolingApi, func(totalSize int) { rows.TotalSize = totalSize }, func(row map[string]string) error {
+		rows.Records = append(rows.Records, row)
+		return nil
+	})
+	return rows, err
+}
+
+// StreamQuery runs SOQL and hands each record to handle page by page,
+// following nextRecordsUrl until the result set is exhausted. Records are
+// flattened so relationship fields appear as "Parent.Field" keys, matching
+// the CSV headers the CLI produces.
+func (c *Client) StreamQuery(ctx context.Context, soql string, useToolingApi bool, handle func(row map[string]string) error) error {
+	return c.stream(ctx, soql, useToolingApi, nil, handle)
+}
+
+func (c *Client) stream(ctx context.Context, soql string, useToolingApi bool, total func(totalSize int), handle func(row map[string]string) error) error {
+	resp, err := c.queryPage(ctx, soql, useToolingApi)
+	if err == nil && total != nil {
+		total(resp.TotalSize)
+	}
+	for {
+		if err != nil {
+			return err
+		}
+
+		for _, raw := range resp.Records {
+			var record map[string]any
+			if err := json.Unmarshal(raw, &record); err != nil {
+				return fmt.Errorf("JSON Unmarshal failed: %w\nOUTPUT: %s", err, string(raw))
+			}
+
+			row := make(map[string]string, len(record))
+			flattenRecord("", record, row)
+			if err := handle(row); err != nil {
+				return err
+			}
+		}
+
+		if resp.Done || resp.NextRecordsUrl == "" {
+			return nil
+		}
+
+		next := resp.NextRecordsUrl
+		resp = queryResponse{}
+		err = c.do(ctx, "GET", next, nil, &resp)
+	}
+}
+
+func flattenRecord(prefix string, record map[string]any, row map[string]string) {
+	for key, value := range record {
+		if key == "attributes" {
+			continue
+		}
+
+		switch v := value.(type) {
+		case nil:
+			row[prefix+key] = ""
+		case string:
+			row[prefix+key] = v
+		case map[string]any:
+			flattenRecord(prefix+key+".", v, row)
+		default:
+			row[prefix+key] = fmt.Sprint(v)
+		}
+	}
+}
+
+type compositeBatchResponse struct {
+	HasErrors bool `json:"hasErrors"`
+	Results   []struct {
+		StatusCode int             `json:"statusCode"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"results"`
+}
+
+// CountErrors is returned by CompositeCounts, along with the counts that
+// were taken, when the count queries of some objects failed; it holds why,
+// by object.
+type CountErrors map[string]error
+
+func (e CountErrors) Error() string {
+	objects := make([]string, 0, len(e))
+	for object := range e {
+		objects = append(objects, object)
+	}
+	sort.Strings(objects)
+	failures := make([]string, len(objects))
+	for i, object := range objects {
+		failures[i] = e[object].Error()
+	}
+	return fmt.Sprintf("%d count queries failed: %s", len(objects), strings.Join(failures, "; "))
+}
+
+// CompositeCounts runs SELECT Count() for every object, packing up to
+// CompositeBatchMax queries into each Composite batch request. The batch
+// does not halt on errors, so a query that fails only loses its object's
+// count: the others are returned with a CountErrors for the failed ones.
+func (c *Client) CompositeCounts(ctx context.Context, objects []string) (map[string]int, error) {
+	counts := make(map[string]int, len(objects))
+	failed := make(CountErrors)
+
+	for start := 0; start < len(objects); start += CompositeBatchMax {
+		end := min(start+CompositeBatchMax, len(objects))
+		batch := objects[start:end]
+
+		requests := make([]map[string]string, 0, len(batch))
+		for _, object := range batch {
+			query := url.QueryEscape(fmt.Sprintf("SELECT Count() FROM %s", object))
+			requests = append(requests, map[string]string{
+				"method": "GET",
+				"url":    fmt.Sprintf("v%s/query?q=%s", c.apiVersion, query),
+			})
+		}
+
+		c.log.Debug("Sending composite batch", "queries", len(batch))
+		var resp compositeBatchResponse
+		body := map[string]any{"batchRequests": requests, "haltOnError": false}
+		if err := c.do(ctx, "POST", fmt.Sprintf("/services/data/v%s/composite/batch", c.apiVersion), body, &resp); err != nil {
+			return nil, err
+		}
+
+		if len(resp.Results) != len(batch) {
+			return nil, fmt.Errorf("composite batch returned %d results for %d requests", len(resp.Results), len(batch))
+		}
+
+		for i, result := range resp.Results {
+			if result.StatusCode >= 300 {
+				failed[batch[i]] = fmt.Errorf("count query for %s failed with status %d: %s", batch[i], result.StatusCode, string(result.Result))
+				continue
+			}
+
+			var queryResult struct {
+				TotalSize int `json:"totalSize"`
+			}
+			if err := json.Unmarshal(result.Result, &queryResult); err != nil {
+				failed[batch[i]] = fmt.Errorf("count query for %s returned invalid JSON: %w\nOUTPUT: %s", batch[i], err, string(result.Result))
+				continue
+			}
+			counts[batch[i]] = queryResult.TotalSize
+		}
+	}
+
+	if len(failed) > 0 {
+		return counts, failed
+	}
+	return counts, nil
+}
+
+type recordCountResponse struct {
+	SObjects []struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	} `json:"sObjects"`
+}
+
+// ApproximateCounts reads the platform's cached record counts from the
+// recordCount limits resource. The numbers lag behind real data by up to a
+// day but cost one request for many objects. Objects without records are
+// omitted by the API and reported as zero.
+func (c *Client) ApproximateCounts(ctx context.Context, objects []string) (map[string]int, error) {
+	counts := make(map[string]int, len(objects))
+
+	for start := 0; start < len(objects); start += RecordCountBatchMax {
+		end := min(start+RecordCountBatchMax, len(objects))
+		batch := objects[start:end]
+
+		c.log.Debug("Requesting approximate record counts", "objects", len(batch))
+		var resp recordCountResponse
+		path := fmt.Sprintf("/services/data/v%s/limits/recordCount?sObjects=%s", c.apiVersion, url.QueryEscape(strings.Join(batch, ",")))
+		if err := c.do(ctx, "GET", path, nil, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, object := range batch {
+			counts[object] = 0
+		}
+		for _, sObject := range resp.SObjects {
+			counts[sObject.Name] = sObject.Count
+		}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,112 @@
+package sfclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// compositeServer answers Composite batch count queries with the size of
+// each object in sizes, and a 400 for objects that are not in it.
+func compositeServer(t *testing.T, sizes map[string]int) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			BatchRequests []struct {
+				Url string `json:"url"`
+			} `json:"batchRequests"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid batch request: %v", err)
+		}
+		var results []map[string]any
+		hasErrors := false
+		for _, request := range body.BatchRequests {
+			parsed, _ := url.Parse(request.Url)
+			object := strings.TrimPrefix(parsed.Query().Get("q"), "SELECT Count() FROM ")
+			if size, ok := sizes[object]; ok {
+				results = append(results, map[string]any{"statusCode": 200, "result": map[string]any{"totalSize": size, "done": true, "records": []any{}}})
+			} else {
+				hasErrors = true
+				results = append(results, map[string]any{"statusCode": 400, "result": []any{map[string]string{"errorCode": "INVALID_TYPE", "message": "sObject type is not supported."}}})
+			}
+		}
+		resp := map[string]any{"hasErrors": hasErrors, "results": results}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return &Client{
+		org:         "test",
+		log:         slog.Default(),
+		instanceUrl: server.URL,
+		apiVersion:  defaultApiVersion,
+		http:        server.Client(),
+		accessToken: "token",
+	}
+}
+
+func TestCompositeCounts(t *testing.T) {
+	sizes := map[string]int{"Account": 120, "Contact": 55, "Invoice__c": 0}
+	for i := range CompositeBatchMax {
+		sizes[fmt.Sprintf("Object%d__c", i)] = i
+	}
+
+	tests := []struct {
+		name    string
+		objects []string
+		failed  []string
+	}{
+		{"all counted", []string{"Account", "Contact", "Invoice__c"}, nil},
+		{"one failed", []string{"Account", "Broken__c", "Contact"}, []string{"Broken__c"}},
+		{"all failed", []string{"Broken__c", "Gone__c"}, []string{"Broken__c", "Gone__c"}},
+		{"failed in a later batch", append(objectNames(CompositeBatchMax), "Broken__c", "Account"), []string{"Broken__c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := compositeServer(t, sizes)
+			counts, err := client.CompositeCounts(context.Background(), tt.objects)
+
+			var failed CountErrors
+			if len(tt.failed) == 0 && err != nil {
+				t.Fatalf("CompositeCounts: %v", err)
+			}
+			if len(tt.failed) > 0 && !errors.As(err, &failed) {
+				t.Fatalf("got error %v, want CountErrors", err)
+			}
+			if len(failed) != len(tt.failed) {
+				t.Errorf("got %d failed objects, want %d: %v", len(failed), len(tt.failed), failed)
+			}
+			for _, object := range tt.failed {
+				if failed[object] == nil {
+					t.Errorf("%s is not among the failed objects: %v", object, failed)
+				}
+				if _, ok := counts[object]; ok {
+					t.Errorf("%s has a count although its query failed", object)
+				}
+			}
+			for _, object := range tt.objects {
+				if failed[object] != nil {
+					continue
+				}
+				if count, ok := counts[object]; !ok || count != sizes[object] {
+					t.Errorf("%s: got count %d (present %v), want %d", object, count, ok, sizes[object])
+				}
+			}
+		})
+	}
+}
+
+func objectNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("Object%d__c", i)
+	}
+	return names
+}
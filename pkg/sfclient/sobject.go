@@ -0,0 +1,40 @@
+package sfclient
+
+import (
+	"context"
+	"fmt"
+)
+
+// Create inserts a record of sobject with fields, through the Tooling API
+// for metadata such as CustomField, and returns its Id.
+func (c *Client) Create(ctx context.Context, sobject string, fields map[string]any, useToolingApi bool) (string, error) {
+	var resp struct {
+		Id      string `json:"id"`
+		Success bool   `json:"success"`
+	}
+	if err := c.do(ctx, "POST", c.sobjectPath(sobject, "", useToolingApi), fields, &resp); err != nil {
+		return "", err
+	}
+	if !resp.Success || resp.Id == "" {
+		return "", fmt.Errorf("failed to create %s", sobject)
+	}
+	return resp.Id, nil
+}
+
+// Delete deletes the record of sobject with id, through the Tooling API
+// for metadata.
+func (c *Client) Delete(ctx context.Context, sobject, id string, useToolingApi bool) error {
+	return c.do(ctx, "DELETE", c.sobjectPath(sobject, id, useToolingApi), nil, nil)
+}
+
+func (c *Client) sobjectPath(sobject, id string, useToolingApi bool) string {
+	resource := "sobjects"
+	if useToolingApi {
+		resource = "tooling/sobjects"
+	}
+	path := fmt.Sprintf("/services/data/v%s/%s/%s", c.apiVersion, resource, sobject)
+	if id != "" {
+		path += "/" + id
+	}
+	return path
+}
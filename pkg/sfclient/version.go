@@ -0,0 +1,63 @@
+package sfclient
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CliVersion is a Salesforce CLI release number.
+type CliVersion struct {
+	Major, Minor, Patch int
+}
+
+// MinimumCliVersion is the oldest sf release supported: earlier releases
+// lack `data query --result-format csv` and do not accept --json on every
+// command the scanner runs.
+var MinimumCliVersion = CliVersion{Major: 2}
+
+// ErrCliTooOld is returned by CheckInstalled when sf is older than
+// MinimumCliVersion.
+var ErrCliTooOld = errors.New("sf is too old")
+
+func (v CliVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v is an earlier release than other.
+func (v CliVersion) Less(other CliVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// ParseCliVersion reads a version out of sf's own formats, such as
+// "@salesforce/cli/2.50.0 linux-x64 node-v20.11.0" or plain "2.50.0".
+// Pre-release suffixes are ignored.
+func ParseCliVersion(s string) (CliVersion, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return CliVersion{}, fmt.Errorf("empty sf version")
+	}
+	number := fields[0][strings.LastIndex(fields[0], "/")+1:]
+	number, _, _ = strings.Cut(number, "-")
+
+	parts := strings.Split(number, ".")
+	if len(parts) != 3 {
+		return CliVersion{}, fmt.Errorf("unrecognized sf version %q", s)
+	}
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return CliVersion{}, fmt.Errorf("unrecognized sf version %q", s)
+		}
+		numbers[i] = n
+	}
+	return CliVersion{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
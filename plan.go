@@ -0,0 +1,344 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// erasureDelay is how long Salesforce keeps a deleted custom field, and
+// its data, before erasing it for good.
+const erasureDelay = 15 * 24 * time.Hour
+
+// planManifestApiVersion is the Metadata API version of the generated
+// manifests.
+const planManifestApiVersion = "60.0"
+
+// cleanupPlan is the document `plan` writes: one step per object, those
+// whose data is about to be erased first.
+type cleanupPlan struct {
+	Generated       string
+	Export          string
+	LatestRun       string
+	Objects         int
+	DeletedFields   int
+	ResidualRecords int
+	Steps           []planStep
+	Verify          []string
+}
+
+// planStep reviews and purges the deleted fields of one object.
+type planStep struct {
+	Number   int
+	Org      string
+	Object   string
+	Label    string
+	Fields   []planField
+	Records  int
+	Counted  bool
+	Deadline string
+	Overdue  bool
+
+	// DeleteCandidate is set when the object has no custom fields left
+	// but these, so it may be deleted instead.
+	DeleteCandidate bool
+
+	// Owner and OwnerEmail name the team the owners configuration assigns
+	// the object's cleanup to.
+	Owner      string
+	OwnerEmail string
+
+	// Manifest is the directory holding the step's package.xml and
+	// destructiveChanges.xml, and Command deploys them.
+	Manifest string
+	Command  string
+}
+
+type planField struct {
+	Name      string
+	ApiName   string
+	Label     string
+	FirstSeen string
+}
+
+// runPlan turns an export into an ordered cleanup plan, with a
+// destructiveChanges manifest and the sf command purging each step.
+func runPlan(args []string) {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	exportFile := flags.String("export", "deleted_fields.json", "Export file to plan the cleanup from")
+	output := flags.String("o", "", "File to write the plan to (default standard output)")
+	format := flags.String("format", "", "Plan format: markdown or html (default from the -o file extension, else markdown)")
+	manifests := flags.String("manifests", "cleanup", "Directory to write each step's destructiveChanges manifest to")
+	org := flags.String("org", "", "Org alias for records that do not name theirs")
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+	owners := settings.apply().Owners
+
+	if *format == "" {
+		*format = "markdown"
+		if ext := strings.ToLower(filepath.Ext(*output)); ext == ".html" || ext == ".htm" {
+			*format = "html"
+		}
+	}
+	if *format != "markdown" && *format != "html" {
+		fatal("Invalid --format: use markdown or html", "format", *format)
+	}
+
+	exportData, err := export.Read(*exportFile)
+	if err != nil {
+		fatal("Failed to read export", "file", *exportFile, "error", err)
+	}
+	if len(exportData.Results) == 0 {
+		fatal("Export has no results to plan from", "file", *exportFile)
+	}
+
+	plan := buildCleanupPlan(exportData.Results, *org, *manifests, time.Now())
+	plan.Export = *exportFile
+	for i, step := range plan.Steps {
+		if owner, ok := owners.owner(step.Object); ok {
+			plan.Steps[i].Owner, plan.Steps[i].OwnerEmail = owner.Team, owner.Email
+		}
+	}
+	for _, step := range plan.Steps {
+		if err := writePlanManifests(step); err != nil {
+			fatal("Failed to write manifests", "dir", step.Manifest, "error", err)
+		}
+	}
+
+	w := stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fatal("Failed to create plan", "file", *output, "error", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := writeCleanupPlan(w, plan, *format); err != nil {
+		fatal("Failed to write plan", "error", err)
+	}
+}
+
+// buildCleanupPlan groups the latest run's deleted fields by object.
+// Objects holding records come first, soonest erasure deadline first, as
+// their data is lost for good once the deadline passes; objects counted
+// empty can be purged at leisure and come last. Deadlines count from the
+// first run that saw a field, so the real one may be earlier.
+func buildCleanupPlan(records []export.DeleteCountRecord, defaultOrg, manifests string, now time.Time) cleanupPlan {
+	firstSeen := make(map[string]int64)
+	for _, record := range records {
+		key := record.Org + "/" + export.FieldKey(record.QualifiedApiName, record.DeveloperName)
+		if seen, ok := firstSeen[key]; !ok || record.Timestamp < seen {
+			firstSeen[key] = record.Timestamp
+		}
+	}
+
+	latest := export.LatestRunRecords(records)
+	plan := cleanupPlan{Generated: now.Format("2006-01-02")}
+
+	var steps []planStep
+	deadlines := make(map[int]time.Time)
+	index := make(map[string]int)
+	for _, record := range latest {
+		plan.LatestRun = time.Unix(record.Timestamp, 0).Format("2006-01-02")
+		org := cmp.Or(record.Org, defaultOrg)
+		key := org + "/" + record.QualifiedApiName
+		i, ok := index[key]
+		if !ok {
+			i = len(steps)
+			index[key] = i
+			steps = append(steps, planStep{Org: org, Object: record.QualifiedApiName, Label: record.ObjectLabel})
+		}
+
+		seen := time.Unix(firstSeen[record.Org+"/"+export.FieldKey(record.QualifiedApiName, record.DeveloperName)], 0)
+		if deadline, ok := deadlines[i]; !ok || seen.Add(erasureDelay).Before(deadline) {
+			deadlines[i] = seen.Add(erasureDelay)
+		}
+		steps[i].Fields = append(steps[i].Fields, planField{
+			Name:      record.DeveloperName,
+			ApiName:   record.DeveloperName + "__c",
+			Label:     record.FieldLabel,
+			FirstSeen: seen.Format("2006-01-02"),
+		})
+		steps[i].DeleteCandidate = steps[i].DeleteCandidate || record.DeleteCandidate
+		if !record.CountSkipped {
+			steps[i].Counted = true
+			steps[i].Records = max(steps[i].Records, record.Count)
+		}
+		plan.DeletedFields++
+	}
+
+	for i := range steps {
+		steps[i].Deadline = deadlines[i].Format("2006-01-02")
+		steps[i].Overdue = deadlines[i].Before(now)
+		slices.SortFunc(steps[i].Fields, func(a, b planField) int { return cmp.Compare(a.Name, b.Name) })
+		plan.ResidualRecords += steps[i].Records
+	}
+	hasData := func(step planStep) bool { return step.Records > 0 || !step.Counted }
+	slices.SortStableFunc(steps, func(a, b planStep) int {
+		if hasData(a) != hasData(b) {
+			if hasData(a) {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(cmp.Compare(a.Deadline, b.Deadline), cmp.Compare(b.Records, a.Records), cmp.Compare(a.Org, b.Org), cmp.Compare(a.Object, b.Object))
+	})
+
+	var orgs []string
+	for i := range steps {
+		step := &steps[i]
+		step.Number = i + 1
+		step.Manifest = filepath.Join(manifests, fmt.Sprintf("%02d-%s", step.Number, manifestDirName(step.Org, step.Object)))
+		step.Command = fmt.Sprintf("sf project deploy start --target-org %s --manifest %s --post-destructive-changes %s --purge-on-delete",
+			shellQuote(cmp.Or(step.Org, "<org>")), shellQuote(filepath.Join(step.Manifest, "package.xml")), shellQuote(filepath.Join(step.Manifest, "destructiveChanges.xml")))
+		if !slices.Contains(orgs, step.Org) {
+			orgs = append(orgs, step.Org)
+		}
+	}
+	for _, org := range orgs {
+		plan.Verify = append(plan.Verify, "sf-deleted-fields --org "+shellQuote(cmp.Or(org, "<org>"))+" --export "+shellQuote("verify.json"))
+	}
+
+	plan.Objects = len(steps)
+	plan.Steps = steps
+	return plan
+}
+
+// manifestDirName names a step's manifest directory after its org and
+// object, keeping to characters safe in any file system.
+func manifestDirName(org, object string) string {
+	name := object
+	if org != "" {
+		name = org + "-" + object
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// shellQuote quotes s for a POSIX shell when it needs it.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:@") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writePlanManifests writes the empty package.xml and the
+// destructiveChanges.xml deleting the step's fields that a destructive
+// deploy needs.
+func writePlanManifests(step planStep) error {
+	if err := os.MkdirAll(step.Manifest, 0o755); err != nil {
+		return err
+	}
+
+	pkg := fmt.Sprintf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Package xmlns=\"http://soap.sforce.com/2006/04/metadata\">\n    <version>%s</version>\n</Package>\n", planManifestApiVersion)
+	if err := os.WriteFile(filepath.Join(step.Manifest, "package.xml"), []byte(pkg), 0o644); err != nil {
+		return err
+	}
+
+	var destructive strings.Builder
+	destructive.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Package xmlns=\"http://soap.sforce.com/2006/04/metadata\">\n    <types>\n")
+	for _, field := range step.Fields {
+		fmt.Fprintf(&destructive, "        <members>%s.%s</members>\n", xmlEscape(step.Object), xmlEscape(field.ApiName))
+	}
+	fmt.Fprintf(&destructive, "        <name>CustomField</name>\n    </types>\n    <version>%s</version>\n</Package>\n", planManifestApiVersion)
+	return os.WriteFile(filepath.Join(step.Manifest, "destructiveChanges.xml"), []byte(destructive.String()), 0o644)
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+const planMarkdown = `# Deleted field cleanup plan
+
+Generated {{.Generated}} from {{.Export}}, latest run {{.LatestRun}}: {{.DeletedFields}} deleted fields on {{.Objects}} objects holding {{.ResidualRecords}} records.
+
+Salesforce erases a deleted field and its data for good 15 days after it was deleted. Deadlines count from the first run that saw each field, so the real one may be earlier. To keep a field's data, undelete it before its deadline from Setup, Object Manager, the object's Fields & Relationships, Deleted Fields. Purging erases it at once.
+{{range .Steps}}
+## Step {{.Number}}: {{if or (gt .Records 0) (not .Counted)}}Review and purge{{else}}Purge{{end}} {{.Object}}{{if .Org}} ({{.Org}}){{end}}
+
+{{if not .Counted}}Its records were not counted; check whether these fields held data before purging.{{else if gt .Records 0}}**{{.Records}} records** may hold data in these fields.{{else}}No records hold data in these fields.{{end}} {{if .Overdue}}**Erasure was due by {{.Deadline}}.**{{else}}Erased by {{.Deadline}}.{{end}}
+{{if or .Owner .OwnerEmail}}
+Owner: {{if .Owner}}{{.Owner}}{{with .OwnerEmail}} <{{.}}>{{end}}{{else}}{{.OwnerEmail}}{{end}}
+{{end}}{{if .DeleteCandidate}}
+{{.Object}} has no custom fields left but these, so consider deleting the whole object instead.
+{{end}}
+| Field | Label | First seen |
+|---|---|---|
+{{range .Fields}}| {{cell .ApiName}} | {{cell .Label}} | {{.FirstSeen}} |
+{{end}}
+Purge with the manifests in ` + "`{{.Manifest}}`" + `:
+
+` + "```sh\n{{.Command}}\n```" + `
+{{end}}
+## Step {{len .Steps | inc}}: Verify
+
+Scan again and check the purged fields are gone:
+
+` + "```sh\n{{range .Verify}}{{.}}\n{{end}}```" + `
+`
+
+const planHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Deleted field cleanup plan</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.5em; text-align: left; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; }
+.overdue { color: #b00; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Deleted field cleanup plan</h1>
+<p>Generated {{.Generated}} from {{.Export}}, latest run {{.LatestRun}}: {{.DeletedFields}} deleted fields on {{.Objects}} objects holding {{.ResidualRecords}} records.</p>
+<p>Salesforce erases a deleted field and its data for good 15 days after it was deleted. Deadlines count from the first run that saw each field, so the real one may be earlier. To keep a field's data, undelete it before its deadline from Setup, Object Manager, the object's Fields &amp; Relationships, Deleted Fields. Purging erases it at once.</p>
+{{range .Steps}}
+<h2>Step {{.Number}}: {{if or (gt .Records 0) (not .Counted)}}Review and purge{{else}}Purge{{end}} {{.Object}}{{if .Org}} ({{.Org}}){{end}}</h2>
+<p>{{if not .Counted}}Its records were not counted; check whether these fields held data before purging.{{else if gt .Records 0}}<strong>{{.Records}} records</strong> may hold data in these fields.{{else}}No records hold data in these fields.{{end}}
+{{if .Overdue}}<span class="overdue">Erasure was due by {{.Deadline}}.</span>{{else}}Erased by {{.Deadline}}.{{end}}</p>
+{{if or .Owner .OwnerEmail}}<p>Owner: {{.Owner}}{{if and .Owner .OwnerEmail}} {{end}}{{with .OwnerEmail}}<a href="mailto:{{.}}">{{.}}</a>{{end}}</p>
+{{end}}{{if .DeleteCandidate}}<p>{{.Object}} has no custom fields left but these, so consider deleting the whole object instead.</p>
+{{end}}<table>
+<tr><th>Field</th><th>Label</th><th>First seen</th></tr>
+{{range .Fields}}<tr><td>{{.ApiName}}</td><td>{{.Label}}</td><td>{{.FirstSeen}}</td></tr>
+{{end}}</table>
+<p>Purge with the manifests in <code>{{.Manifest}}</code>:</p>
+<pre>{{.Command}}</pre>
+{{end}}
+<h2>Step {{len .Steps | inc}}: Verify</h2>
+<p>Scan again and check the purged fields are gone:</p>
+<pre>{{range .Verify}}{{.}}
+{{end}}</pre>
+</body>
+</html>
+`
+
+func writeCleanupPlan(w io.Writer, plan cleanupPlan, format string) error {
+	inc := func(n int) int { return n + 1 }
+	if format == "html" {
+		tmpl := htmltemplate.Must(htmltemplate.New("plan").Funcs(htmltemplate.FuncMap{"inc": inc}).Parse(planHTML))
+		return tmpl.Execute(w, plan)
+	}
+	tmpl := template.Must(template.New("plan").Funcs(template.FuncMap{"inc": inc, "cell": markdownCell}).Parse(planMarkdown))
+	return tmpl.Execute(w, plan)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// Report sections an export profile can emit.
+const (
+	sectionSummary    = "summary"
+	sectionTopObjects = "top_objects"
+	sectionRecords    = "records"
+	sectionRunSummary = "run_summary"
+	sectionAudit      = "audit"
+)
+
+var profileSections = []string{sectionSummary, sectionTopObjects, sectionRecords, sectionRunSummary, sectionAudit}
+
+// exportProfile tailors a run's output to an audience: which sections are
+// emitted and, for exported records, which fields. The audit section keeps
+// the run ID and binary version on every record and writes the invocation
+// to the audit log even when the configuration disables it.
+type exportProfile struct {
+	Sections []string `yaml:"sections"`
+	Fields   []string `yaml:"fields"`
+}
+
+// builtinProfiles are available without configuration; profiles of the same
+// name in the config file replace them.
+var builtinProfiles = map[string]exportProfile{
+	"executive": {Sections: []string{sectionSummary, sectionTopObjects, sectionRunSummary}},
+	"admin":     {Sections: []string{sectionSummary, sectionTopObjects, sectionRecords, sectionRunSummary}},
+	"auditor":   {Sections: []string{sectionSummary, sectionTopObjects, sectionRecords, sectionRunSummary, sectionAudit}},
+}
+
+// selectProfile returns the named profile, or nil, meaning every section
+// and field, when name is empty.
+func selectProfile(name string, configured map[string]exportProfile) (*exportProfile, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	profile, ok := configured[name]
+	if !ok {
+		profile, ok = builtinProfiles[name]
+	}
+	if !ok {
+		var names []string
+		for name := range builtinProfiles {
+			names = append(names, name)
+		}
+		for name := range configured {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown profile %q: use one of %v", name, names)
+	}
+
+	for _, section := range profile.Sections {
+		if !slices.Contains(profileSections, section) {
+			return nil, fmt.Errorf("profile %s: unknown section %q: use %v", name, section, profileSections)
+		}
+	}
+	fields := export.RecordFields()
+	for _, field := range profile.Fields {
+		if !slices.Contains(fields, field) {
+			return nil, fmt.Errorf("profile %s: unknown field %q: use %v", name, field, fields)
+		}
+	}
+	return &profile, nil
+}
+
+// has reports whether the profile emits section. A nil profile emits
+// everything.
+func (p *exportProfile) has(section string) bool {
+	return p == nil || slices.Contains(p.Sections, section)
+}
+
+// fields returns the record fields to export, nil meaning all of them.
+func (p *exportProfile) fields() []string {
+	if p == nil {
+		return nil
+	}
+	return p.Fields
+}
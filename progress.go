@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+// console is the writer behind the logger. On a terminal it keeps a status
+// line pinned below the log output, clearing it before each log entry and
+// redrawing it afterwards so the two never garble each other.
+type console struct {
+	mu     sync.Mutex
+	w      io.Writer
+	tty    bool
+	colors palette
+	status string
+}
+
+var stderrConsole = &console{w: os.Stderr, tty: isTerminal(os.Stderr)}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (c *console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.status != "" {
+		fmt.Fprint(c.w, "\r\033[K")
+	}
+	var n int
+	var err error
+	if c.colors.enabled {
+		line := strings.TrimSuffix(string(p), "\n")
+		_, err = io.WriteString(c.w, c.colors.colorLogLine(line)+"\n")
+		n = len(p)
+	} else {
+		n, err = c.w.Write(p)
+	}
+	if c.status != "" {
+		fmt.Fprint(c.w, c.status)
+	}
+	return n, err
+}
+
+func (c *console) setStatus(status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprint(c.w, "\r\033[K"+status)
+	c.status = status
+}
+
+func (c *console) clearStatus() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.status != "" {
+		fmt.Fprint(c.w, "\r\033[K")
+		c.status = ""
+	}
+}
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// reportProgress shows how far each org's scan has come until done is
+// closed: a live status line on a terminal when status is set, and a
+// heartbeat log line with each org's current phase every heartbeat.
+func reportProgress(scans []*scanner.Scan, done <-chan struct{}, status bool, heartbeat time.Duration) {
+	var statusC, heartbeatC <-chan time.Time
+	if status && stderrConsole.tty {
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		defer stderrConsole.clearStatus()
+		statusC = ticker.C
+	}
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		heartbeatC = ticker.C
+	}
+
+	for frame := 0; ; {
+		select {
+		case <-done:
+			return
+		case <-heartbeatC:
+			for _, scan := range scans {
+				progress := scan.Progress()
+				scan.Logger().Info("Heartbeat", "phase", progress.Phase, "elapsed", time.Since(progress.Started).Round(time.Second),
+					"deleted_fields", progress.DeletedFields, "resolved", progress.Resolved, "counted", progress.Counted, "failed", progress.Failed)
+			}
+		case <-statusC:
+			parts := make([]string, 0, len(scans))
+			for _, scan := range scans {
+				parts = append(parts, progressSummary(scan))
+			}
+			stderrConsole.setStatus(spinnerFrames[frame%len(spinnerFrames)] + " " + strings.Join(parts, "  "))
+			frame++
+		}
+	}
+}
+
+func progressSummary(scan *scanner.Scan) string {
+	progress := scan.Progress()
+	return fmt.Sprintf("[%s] fields %d, resolved %d, counted %d, failed %d",
+		scan.Org(), progress.DeletedFields, progress.Resolved, progress.Counted, progress.Failed)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// recycleBinPurge is an object whose only records holding deleted field
+// data are in the Recycle Bin.
+type recycleBinPurge struct {
+	Object string
+	Ids    []string
+}
+
+// runEmptyRecycleBin finishes the cleanup of objects whose residual data
+// is entirely in the Recycle Bin by erasing those records for good. Objects
+// with live records are left alone: purging the bin would not clear them,
+// and their data may still be wanted.
+func runEmptyRecycleBin(args []string) {
+	flags := flag.NewFlagSet("empty-recycle-bin", flag.ExitOnError)
+	org := flags.String("org", "", "Salesforce organization to use (default: the sf CLI's target-org)")
+	exportFile := flags.String("export", "deleted_fields.json", "Export whose latest run lists the objects to check")
+	objects := flags.String("object", "", "Objects to check, comma-separated, instead of those in the export")
+	confirm := registerConfirmFlags(flags)
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+
+	if *org == "" {
+		*org = defaultOrg()
+	}
+	redact.Add("org", *org)
+
+	// Erasing records cannot be undone, so every attempt is audited.
+	audit = startAudit(settings.apply().Audit, "empty-recycle-bin", args)
+	audit.setOrgs([]string{*org})
+
+	var candidates, fields []string
+	for _, object := range strings.Split(*objects, ",") {
+		if object = strings.TrimSpace(object); object != "" {
+			candidates = append(candidates, object)
+		}
+	}
+	if len(candidates) == 0 {
+		exportData, err := export.Read(*exportFile)
+		if err != nil {
+			fatal("Failed to read export", "file", *exportFile, "error", err)
+		}
+		records, err := exportOrgRecords(export.LatestRunRecords(exportData.Results), *org, *exportFile)
+		if err != nil {
+			fatal("Failed to read export", "file", *exportFile, "error", err)
+		}
+		for _, record := range records {
+			fields = append(fields, record.QualifiedApiName+"."+record.DeveloperName)
+			if !slices.Contains(candidates, record.QualifiedApiName) {
+				candidates = append(candidates, record.QualifiedApiName)
+			}
+		}
+		slices.Sort(candidates)
+		slices.Sort(fields)
+	}
+	if len(candidates) == 0 {
+		fatal("No objects to check; the export has no deleted fields for the org", "org", *org, "file", *exportFile)
+	}
+	if fields != nil {
+		audit.setTargets(fields)
+	} else {
+		audit.setTargets(candidates)
+	}
+
+	ctx := context.Background()
+	client, err := sfclient.NewClient(*org)
+	if err != nil {
+		fatal("Failed to open REST session", "org", *org, "error", err)
+	}
+	environment, err := sfclient.DetectEnvironment(ctx, client)
+	if err != nil {
+		slog.Warn("Could not tell the org's environment", "org", *org, "error", err)
+	}
+	if err := confirm.guardProduction(redact.Apply(*org), environment); err != nil {
+		fatal("Cannot empty the recycle bin", "error", err)
+	}
+
+	var purges []recycleBinPurge
+	var changes []plannedChange
+	for _, object := range candidates {
+		live, err := client.Query(ctx, "SELECT Count() FROM "+object, false)
+		if err != nil {
+			slog.Warn("Skipping object that cannot be counted", "object", object, "error", err)
+			continue
+		}
+		if live.TotalSize > 0 {
+			slog.Info("Skipping object with live records", "object", object, "records", live.TotalSize)
+			continue
+		}
+
+		ids, err := client.RecycleBinIds(ctx, object)
+		if err != nil {
+			slog.Warn("Skipping object whose recycle bin cannot be read", "object", object, "error", err)
+			continue
+		}
+		if len(ids) == 0 {
+			slog.Debug("Recycle bin holds no records of the object", "object", object)
+			continue
+		}
+
+		purges = append(purges, recycleBinPurge{Object: object, Ids: ids})
+		changes = append(changes, plannedChange{Action: "empty recycle bin", Target: object, Detail: fmt.Sprintf("erase %d deleted records", len(ids))})
+	}
+
+	proceed, err := confirm.confirm("Empty the recycle bin of "+redact.Apply(*org), changes)
+	if err != nil {
+		fatal("Cannot empty the recycle bin", "error", err)
+	}
+	if !proceed {
+		audit.finish("declined", 0)
+		return
+	}
+
+	failures := 0
+	for _, purge := range purges {
+		erased, failed, err := client.EmptyRecycleBin(ctx, purge.Ids)
+		for _, e := range failed {
+			slog.Warn("Record not erased", "object", purge.Object, "id", e.Id, "status", e.StatusCode, "error", e.Message)
+		}
+		if err != nil {
+			slog.Error("Failed to empty the recycle bin", "object", purge.Object, "erased", erased, "error", err)
+			failures++
+			continue
+		}
+		if len(failed) > 0 {
+			failures++
+		}
+		slog.Info("Emptied the recycle bin", "object", purge.Object, "erased", erased, "failed", len(failed))
+	}
+	if failures > 0 {
+		audit.finish(outcomePartial, 1)
+		os.Exit(1)
+	}
+	audit.finish(outcomeOK, 0)
+}
+
+// exportOrgRecords returns the records of org among an export's records.
+// Exports written with --anonymize name pseudonyms, which the mapping kept
+// beside the export restores, and those written with --redact name the
+// org by its token rather than its alias.
+func exportOrgRecords(records []export.DeleteCountRecord, org, exportFile string) ([]export.DeleteCountRecord, error) {
+	mapPath := anonymizationMapPath("", exportFile)
+	if _, err := os.Stat(mapPath); err == nil {
+		anonymizer, err := export.LoadAnonymizer(mapPath)
+		if err != nil {
+			return nil, err
+		}
+		records = anonymizer.Deanonymize(records)
+	}
+
+	var matched []export.DeleteCountRecord
+	for _, record := range records {
+		if record.Org == "" || record.Org == org || record.Org == redact.Token("org", org) {
+			matched = append(matched, record)
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+const registryFileName = "orgs.yaml"
+
+// orgRegistry is the orgs.yaml file: the orgs a team scans, the groups they
+// belong to, and settings that differ from org to org.
+//
+//	orgs:
+//	  prod-eu:
+//	    concurrency: 4
+//	  dev1:
+//	    no_counts: true
+//	groups:
+//	  prod: [prod-eu, prod-us]
+//	  sandboxes: [dev1, dev2]
+type orgRegistry struct {
+	Orgs   map[string]orgSettings `yaml:"orgs"`
+	Groups map[string][]string    `yaml:"groups"`
+}
+
+// orgSettings override the command line for one org. Unset fields keep the
+// command line's value.
+type orgSettings struct {
+	Concurrency  *int    `yaml:"concurrency"`
+	Cli          *bool   `yaml:"cli"`
+	Composite    *bool   `yaml:"composite"`
+	ApproxCounts *bool   `yaml:"approx_counts"`
+	NoCounts     *bool   `yaml:"no_counts"`
+	NoDescribe   *bool   `yaml:"no_describe"`
+	QueriesDir   *string `yaml:"queries_dir"`
+	Pattern      *string `yaml:"pattern"`
+}
+
+func (s orgSettings) apply(cfg *scanner.Config) {
+	if s.Concurrency != nil {
+		cfg.Concurrency = *s.Concurrency
+	}
+	if s.Cli != nil {
+		cfg.UseCli = *s.Cli
+	}
+	if s.Composite != nil {
+		cfg.Composite = *s.Composite
+	}
+	if s.ApproxCounts != nil {
+		cfg.ApproxCounts = *s.ApproxCounts
+	}
+	if s.NoCounts != nil {
+		cfg.NoCounts = *s.NoCounts
+	}
+	if s.NoDescribe != nil {
+		cfg.NoDescribe = *s.NoDescribe
+	}
+	if s.QueriesDir != nil {
+		cfg.QueriesDir = *s.QueriesDir
+	}
+	if s.Pattern != nil {
+		cfg.Pattern = *s.Pattern
+	}
+}
+
+// defaultRegistryPaths are searched in order when --orgs-file is not given.
+func defaultRegistryPaths() []string {
+	paths := []string{registryFileName}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "sf-deleted-fields", registryFileName))
+	}
+	return paths
+}
+
+// loadRegistry reads the org registry at path, or from the first default
+// location that exists when path is empty, the same way loadConfig does.
+func loadRegistry(path string) (orgRegistry, string, error) {
+	var registry orgRegistry
+
+	candidates := defaultRegistryPaths()
+	if path != "" {
+		candidates = []string{path}
+	}
+
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate)
+		if errors.Is(err, os.ErrNotExist) && path == "" {
+			continue
+		}
+		if err != nil {
+			return registry, candidate, fmt.Errorf("failed to read org registry: %w", err)
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&registry); err != nil && err != io.EOF {
+			return registry, candidate, fmt.Errorf("failed to parse org registry %s: %w", candidate, err)
+		}
+		return registry, candidate, nil
+	}
+
+	return registry, "", nil
+}
+
+// groupOrgs returns the orgs of the named group. The group "all" holds every
+// org the registry mentions, unless the registry defines its own.
+func (r orgRegistry) groupOrgs(group string) ([]string, error) {
+	if orgs, ok := r.Groups[group]; ok {
+		return orgs, nil
+	}
+	if group == "all" {
+		var orgs []string
+		for org := range r.Orgs {
+			orgs = append(orgs, org)
+		}
+		for _, members := range r.Groups {
+			orgs = append(orgs, members...)
+		}
+		sort.Strings(orgs)
+		return slices.Compact(orgs), nil
+	}
+
+	groups := make([]string, 0, len(r.Groups))
+	for name := range r.Groups {
+		groups = append(groups, name)
+	}
+	sort.Strings(groups)
+	return nil, fmt.Errorf("unknown group %q: the org registry defines %v", group, groups)
+}
+
+// resolveOrgs combines the --org and --group selections, dropping
+// duplicates while keeping the order they were given in.
+func (r orgRegistry) resolveOrgs(orgs, groups []string) ([]string, error) {
+	selected := append([]string(nil), orgs...)
+	for _, group := range groups {
+		members, err := r.groupOrgs(group)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, members...)
+	}
+
+	var unique []string
+	for _, org := range selected {
+		if !slices.Contains(unique, org) {
+			unique = append(unique, org)
+		}
+	}
+	return unique, nil
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// reportCommands are the reports `report` can produce from an export.
+var reportCommands = map[string]func(args []string){
+	"digest":     runReportDigest,
+	"namespaces": runReportNamespaces,
+	"sarif":      runReportSarif,
+	"top":        runReportTop,
+}
+
+func runReport(args []string) {
+	if len(args) == 0 || reportCommands[args[0]] == nil {
+		names := make([]string, 0, len(reportCommands))
+		for name := range reportCommands {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		fmt.Fprintf(os.Stderr, "Usage: sf-deleted-fields report <%s> [flags]\n", strings.Join(names, "|"))
+		os.Exit(2)
+	}
+	reportCommands[args[0]](args[1:])
+}
+
+// topEntry is one row of the top report: an object, or a single field when
+// reporting by field.
+type topEntry struct {
+	Org     string
+	Object  string
+	Label   string
+	Fields  []string
+	Records int
+
+	// Candidate marks an object with no custom fields left but deleted
+	// ones.
+	Candidate bool
+	// Owner is the team owning the object's cleanup.
+	Owner string
+}
+
+// runReportTop lists the objects, or fields, holding the most residual
+// records in the export's latest run, as a Markdown table ready to paste
+// into a cleanup plan.
+func runReportTop(args []string) {
+	flags := flag.NewFlagSet("report top", flag.ExitOnError)
+	exportFile := flags.String("export", "deleted_fields.json", "Export file to report on")
+	n := flags.Int("n", 20, "Number of entries to list")
+	by := flags.String("by", "object", "What to rank: object or field")
+	format := flags.String("format", "markdown", "Output format: markdown or text")
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+	owners := settings.apply().Owners
+
+	if *by != "object" && *by != "field" {
+		fatal("Invalid --by: use object or field", "by", *by)
+	}
+	if *format != "markdown" && *format != "text" {
+		fatal("Invalid --format: use markdown or text", "format", *format)
+	}
+
+	exportData, err := export.Read(*exportFile)
+	if err != nil {
+		fatal("Failed to read export", "file", *exportFile, "error", err)
+	}
+	records := export.LatestRunRecords(exportData.Results)
+	if len(records) == 0 {
+		fatal("Export has no results to report on", "file", *exportFile)
+	}
+
+	entries := topEntries(records, *by == "field")
+	for i := range entries {
+		entries[i].Owner = owners.ownerName(entries[i].Object)
+	}
+	entries = entries[:min(max(*n, 0), len(entries))]
+
+	var newest int64
+	for _, record := range records {
+		newest = max(newest, record.Timestamp)
+	}
+	title := fmt.Sprintf("Top %d %ss by residual records (%s)", len(entries), *by, time.Unix(newest, 0).Format("2006-01-02"))
+
+	if *format == "markdown" {
+		writeTopMarkdown(stdout, title, entries, *by == "field")
+	} else {
+		writeTopText(stdout, title, entries, *by == "field")
+	}
+}
+
+// topEntries ranks the counted records' objects, or fields, by residual
+// records, largest first.
+func topEntries(records []export.DeleteCountRecord, byField bool) []topEntry {
+	var entries []topEntry
+	index := make(map[string]int)
+	for _, record := range records {
+		if record.CountSkipped {
+			continue
+		}
+
+		if byField {
+			// Generations of a field deleted more than once rank as one.
+			key := record.Org + "/" + export.FieldIdentity(record.QualifiedApiName, record.DeveloperName)
+			i, ok := index[key]
+			if !ok {
+				i = len(entries)
+				index[key] = i
+				entries = append(entries, topEntry{
+					Org:    record.Org,
+					Object: record.QualifiedApiName,
+					Label:  record.FieldLabel,
+					Fields: []string{export.LogicalName(record.DeveloperName)},
+
+					Candidate: record.DeleteCandidate,
+				})
+			}
+			entries[i].Records = max(entries[i].Records, record.Count)
+			continue
+		}
+
+		key := record.Org + "/" + record.QualifiedApiName
+		i, ok := index[key]
+		if !ok {
+			i = len(entries)
+			index[key] = i
+			entries = append(entries, topEntry{Org: record.Org, Object: record.QualifiedApiName, Label: record.ObjectLabel})
+		}
+		entries[i].Fields = append(entries[i].Fields, record.DeveloperName)
+		entries[i].Records = max(entries[i].Records, record.Count)
+		entries[i].Candidate = entries[i].Candidate || record.DeleteCandidate
+	}
+
+	for _, entry := range entries {
+		slices.Sort(entry.Fields)
+	}
+	slices.SortStableFunc(entries, func(a, b topEntry) int {
+		return cmp.Or(cmp.Compare(b.Records, a.Records), cmp.Compare(a.Object, b.Object), slices.Compare(a.Fields, b.Fields))
+	})
+	return entries
+}
+
+// multiOrg reports whether the entries come from a merged export of several
+// orgs, in which case the reports name the org of each.
+func multiOrg(entries []topEntry) bool {
+	return slices.ContainsFunc(entries, func(entry topEntry) bool { return entry.Org != entries[0].Org })
+}
+
+// anyCandidate reports whether any entry's object is a delete candidate, in
+// which case the reports mark them.
+func anyCandidate(entries []topEntry) bool {
+	return slices.ContainsFunc(entries, func(entry topEntry) bool { return entry.Candidate })
+}
+
+// anyOwner reports whether any entry has an owner, in which case the
+// reports name them.
+func anyOwner(entries []topEntry) bool {
+	return slices.ContainsFunc(entries, func(entry topEntry) bool { return entry.Owner != "" })
+}
+
+// candidateCell marks a delete candidate in a report column.
+func candidateCell(entry topEntry) string {
+	if entry.Candidate {
+		return "yes"
+	}
+	return ""
+}
+
+func writeTopMarkdown(w io.Writer, title string, entries []topEntry, byField bool) {
+	orgs := len(entries) > 0 && multiOrg(entries)
+	candidates := anyCandidate(entries)
+	owners := anyOwner(entries)
+
+	header := []string{"#"}
+	if orgs {
+		header = append(header, "Org")
+	}
+	if byField {
+		header = append(header, "Object", "Field", "Label", "Records")
+	} else {
+		header = append(header, "Object", "Label", "Records", "Deleted fields")
+	}
+	if candidates {
+		header = append(header, "Delete candidate")
+	}
+	if owners {
+		header = append(header, "Owner")
+	}
+
+	fmt.Fprintf(w, "## %s\n\n", title)
+	fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+	separators := make([]string, len(header))
+	for i, name := range header {
+		separators[i] = "---"
+		if name == "#" || name == "Records" {
+			separators[i] = "--:"
+		}
+	}
+	fmt.Fprintf(w, "|%s|\n", strings.Join(separators, "|"))
+
+	for i, entry := range entries {
+		row := []string{fmt.Sprint(i + 1)}
+		if orgs {
+			row = append(row, markdownCell(entry.Org))
+		}
+		if byField {
+			row = append(row, markdownCell(entry.Object), markdownCell(entry.Fields[0]), markdownCell(entry.Label), fmt.Sprint(entry.Records))
+		} else {
+			row = append(row, markdownCell(entry.Object), markdownCell(entry.Label), fmt.Sprint(entry.Records), markdownCell(strings.Join(entry.Fields, ", ")))
+		}
+		if candidates {
+			row = append(row, candidateCell(entry))
+		}
+		if owners {
+			row = append(row, markdownCell(entry.Owner))
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+	}
+}
+
+// markdownCell escapes the characters that would break a table row.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+func writeTopText(w io.Writer, title string, entries []topEntry, byField bool) {
+	orgs := len(entries) > 0 && multiOrg(entries)
+	candidates := anyCandidate(entries)
+	owners := anyOwner(entries)
+
+	fmt.Fprintln(w, title)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "#\t"
+	if orgs {
+		header += "ORG\t"
+	}
+	if byField {
+		header += "OBJECT\tFIELD\tLABEL\tRECORDS"
+	} else {
+		header += "OBJECT\tLABEL\tRECORDS\tDELETED FIELDS"
+	}
+	if candidates {
+		header += "\tDELETE CANDIDATE"
+	}
+	if owners {
+		header += "\tOWNER"
+	}
+	fmt.Fprintln(tw, header)
+
+	for i, entry := range entries {
+		row := fmt.Sprintf("%d\t", i+1)
+		if orgs {
+			row += entry.Org + "\t"
+		}
+		if byField {
+			row += fmt.Sprintf("%s\t%s\t%s\t%d", entry.Object, entry.Fields[0], entry.Label, entry.Records)
+		} else {
+			row += fmt.Sprintf("%s\t%s\t%d\t%s", entry.Object, entry.Label, entry.Records, strings.Join(entry.Fields, ", "))
+		}
+		if candidates {
+			row += "\t" + candidateCell(entry)
+		}
+		if owners {
+			row += "\t" + entry.Owner
+		}
+		fmt.Fprintln(tw, row)
+	}
+	tw.Flush()
+}
+
+// namespaceEntry is one row of the namespaces report.
+type namespaceEntry struct {
+	Org string
+	export.NamespaceTotals
+}
+
+// runReportNamespaces rolls the export's latest run up by namespace
+// prefix, unmanaged objects apart from each managed package, since
+// cleanup is usually owned package by package.
+func runReportNamespaces(args []string) {
+	flags := flag.NewFlagSet("report namespaces", flag.ExitOnError)
+	exportFile := flags.String("export", "deleted_fields.json", "Export file to report on")
+	format := flags.String("format", "markdown", "Output format: markdown or text")
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+
+	if *format != "markdown" && *format != "text" {
+		fatal("Invalid --format: use markdown or text", "format", *format)
+	}
+
+	exportData, err := export.Read(*exportFile)
+	if err != nil {
+		fatal("Failed to read export", "file", *exportFile, "error", err)
+	}
+	records := export.LatestRunRecords(exportData.Results)
+	if len(records) == 0 {
+		fatal("Export has no results to report on", "file", *exportFile)
+	}
+
+	var orgs []string
+	byOrg := make(map[string][]export.DeleteCountRecord)
+	var newest int64
+	for _, record := range records {
+		if _, ok := byOrg[record.Org]; !ok {
+			orgs = append(orgs, record.Org)
+		}
+		byOrg[record.Org] = append(byOrg[record.Org], record)
+		newest = max(newest, record.Timestamp)
+	}
+	var entries []namespaceEntry
+	for _, org := range orgs {
+		for _, ns := range export.CalculateTotals(byOrg[org]).Namespaces {
+			entries = append(entries, namespaceEntry{Org: org, NamespaceTotals: ns})
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b namespaceEntry) int {
+		return cmp.Or(cmp.Compare(b.ResidualRecords, a.ResidualRecords), cmp.Compare(b.DeletedFields, a.DeletedFields), cmp.Compare(a.Org, b.Org), cmp.Compare(a.Namespace, b.Namespace))
+	})
+
+	title := fmt.Sprintf("Deleted fields by namespace (%s)", time.Unix(newest, 0).Format("2006-01-02"))
+	if *format == "markdown" {
+		writeNamespacesMarkdown(stdout, title, entries, len(orgs) > 1)
+	} else {
+		writeNamespacesText(stdout, title, entries, len(orgs) > 1)
+	}
+}
+
+func writeNamespacesMarkdown(w io.Writer, title string, entries []namespaceEntry, orgs bool) {
+	fmt.Fprintf(w, "## %s\n\n", title)
+	if orgs {
+		fmt.Fprintln(w, "| Org | Namespace | Deleted fields | Records | Objects |")
+		fmt.Fprintln(w, "|---|---|--:|--:|--:|")
+	} else {
+		fmt.Fprintln(w, "| Namespace | Deleted fields | Records | Objects |")
+		fmt.Fprintln(w, "|---|--:|--:|--:|")
+	}
+	for _, entry := range entries {
+		row := []string{markdownCell(namespaceName(entry.Namespace)), fmt.Sprint(entry.DeletedFields), fmt.Sprint(entry.ResidualRecords), fmt.Sprint(entry.ObjectsAffected)}
+		if orgs {
+			row = append([]string{markdownCell(entry.Org)}, row...)
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+	}
+}
+
+func writeNamespacesText(w io.Writer, title string, entries []namespaceEntry, orgs bool) {
+	fmt.Fprintln(w, title)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "NAMESPACE\tDELETED FIELDS\tRECORDS\tOBJECTS"
+	if orgs {
+		header = "ORG\t" + header
+	}
+	fmt.Fprintln(tw, header)
+	for _, entry := range entries {
+		row := fmt.Sprintf("%s\t%d\t%d\t%d", namespaceName(entry.Namespace), entry.DeletedFields, entry.ResidualRecords, entry.ObjectsAffected)
+		if orgs {
+			row = entry.Org + "\t" + row
+		}
+		fmt.Fprintln(tw, row)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+const runSummaryFile = "run-summary.json"
+
+// Run and org outcomes reported in run-summary.json.
+const (
+	outcomeOK                = "ok"
+	outcomePartial           = "partial"
+	outcomeThresholdExceeded = "threshold_exceeded"
+	outcomeCircuitOpen       = "circuit_open"
+	outcomeCallLimit         = "api_call_limit"
+	outcomeError             = "error"
+)
+
+type orgRunSummary struct {
+	Org             string  `json:"org"`
+	Environment     string  `json:"environment,omitempty"`
+	Outcome         string  `json:"outcome"`
+	Export          string  `json:"export,omitempty"`
+	DeletedFields   int64   `json:"deletedFields"`
+	ResidualRecords int     `json:"residualRecords"`
+	ObjectsAffected int     `json:"objectsAffected"`
+	Failures        int64   `json:"failures"`
+	ApiCalls        int64   `json:"apiCalls"`
+	DurationSeconds float64 `json:"durationSeconds"`
+
+	Namespaces       []export.NamespaceTotals `json:"namespaces,omitempty"`
+	DeleteCandidates []string                 `json:"deleteCandidates,omitempty"`
+}
+
+// runSummary is a small status file for orchestration tools that should not
+// have to parse the full export history.
+type runSummary struct {
+	RunId           string          `json:"runId"`
+	Version         string          `json:"version"`
+	Commit          string          `json:"commit,omitempty"`
+	Outcome         string          `json:"outcome"`
+	StartedAt       string          `json:"startedAt"`
+	FinishedAt      string          `json:"finishedAt"`
+	DurationSeconds float64         `json:"durationSeconds"`
+	Failures        int64           `json:"failures"`
+	Orgs            []orgRunSummary `json:"orgs"`
+}
+
+func newRunSummary(started, finished time.Time) *runSummary {
+	return &runSummary{
+		RunId:           runID,
+		Version:         version,
+		Commit:          commit,
+		Outcome:         outcomeOK,
+		StartedAt:       started.Format(time.RFC3339),
+		FinishedAt:      finished.Format(time.RFC3339),
+		DurationSeconds: finished.Sub(started).Seconds(),
+	}
+}
+
+// orgOutcome classifies one org's scan for run-summary.json and notifiers.
+// A scan that failed, or whose export did, is an error.
+func orgOutcome(summary scanner.Summary, breached, failed bool) string {
+	switch {
+	case failed:
+		return outcomeError
+	case breached:
+		return outcomeThresholdExceeded
+	case summary.CircuitOpen:
+		return outcomeCircuitOpen
+	case summary.CallLimitReached:
+		return outcomeCallLimit
+	case summary.Failures > 0:
+		return outcomePartial
+	}
+	return outcomeOK
+}
+
+func (r *runSummary) addOrg(summary scanner.Summary, export, outcome string) {
+	r.Orgs = append(r.Orgs, orgRunSummary{
+		Org:             summary.Org,
+		Environment:     string(summary.Environment),
+		Outcome:         outcome,
+		Export:          export,
+		DeletedFields:   summary.DeletedFields,
+		ResidualRecords: summary.ResidualRecords,
+		ObjectsAffected: len(summary.Objects),
+		Failures:        summary.Failures,
+		ApiCalls:        summary.ApiCalls,
+		DurationSeconds: summary.Duration.Seconds(),
+		Namespaces:      summary.Namespaces,
+
+		DeleteCandidates: summary.DeleteCandidates,
+	})
+
+	r.Failures += summary.Failures
+	stoppedEarly := outcome == outcomeCircuitOpen || outcome == outcomeCallLimit
+	// An org that failed outright outranks every other outcome.
+	if r.Outcome != outcomeError && (outcome == outcomeError || outcome == outcomeThresholdExceeded || r.Outcome == outcomeOK || (r.Outcome == outcomePartial && stoppedEarly)) {
+		r.Outcome = outcome
+	}
+}
+
+// write stores the summary as run-summary.json in the export's directory.
+func (r *runSummary) write(export string) (string, error) {
+	path := filepath.Join(filepath.Dir(export), runSummaryFile)
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode run summary: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write run summary: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to replace run summary: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+// SARIF result levels, from most to least severe.
+const (
+	sarifError   = "error"
+	sarifWarning = "warning"
+	sarifNote    = "note"
+)
+
+// sarifRules are the kinds of finding a SARIF report holds, in rule index
+// order.
+var sarifRules = []sarifRule{
+	{
+		Id:               "SFDF001",
+		Name:             "DeletedFieldResidualData",
+		ShortDescription: sarifText{"Deleted field still holds data"},
+		FullDescription:  sarifText{"A deleted custom field's object still holds records, whose values in the field Salesforce erases for good 15 days after the deletion. Undelete the field to keep the data, or purge it."},
+	},
+	{
+		Id:               "SFDF002",
+		Name:             "DeletedFieldNotPurged",
+		ShortDescription: sarifText{"Deleted field awaits purging"},
+		FullDescription:  sarifText{"A deleted custom field holds no records but has not been purged, so it still counts towards the object's field limit."},
+	},
+	{
+		Id:               "SFDF003",
+		Name:             "DeletedFieldNotCounted",
+		ShortDescription: sarifText{"Deleted field's records were not counted"},
+		FullDescription:  sarifText{"The records of a deleted custom field's object could not be counted, so it may still hold data."},
+	},
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id               string    `json:"id"`
+	Name             string    `json:"name"`
+	ShortDescription sarifText `json:"shortDescription"`
+	FullDescription  sarifText `json:"fullDescription"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifText         `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+	Properties          sarifProperties   `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation struct {
+		Uri string `json:"uri"`
+	} `json:"artifactLocation"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+type sarifProperties struct {
+	Org         string `json:"org,omitempty"`
+	Object      string `json:"object"`
+	Field       string `json:"field"`
+	Status      string `json:"status"`
+	Records     *int   `json:"records,omitempty"`
+	Approximate bool   `json:"approximate,omitempty"`
+	FirstSeen   string `json:"firstSeen"`
+	AgeDays     int    `json:"ageDays"`
+}
+
+// sarifPolicy decides a finding's level from its count and age.
+type sarifPolicy struct {
+	// ErrorCount is the residual records from which a finding is an error
+	// rather than a warning, and ErrorAge the time since the field was
+	// first seen from which any residual records are.
+	ErrorCount int
+	ErrorAge   time.Duration
+}
+
+// runReportSarif writes the export's latest run as a SARIF log, one result
+// per deleted field, for code scanning platforms such as GitHub's to list
+// alongside other findings. Fields holding records are warnings, or errors
+// once they hold --error-count records or their data is about to be
+// erased; fields counted empty are notes.
+func runReportSarif(args []string) {
+	flags := flag.NewFlagSet("report sarif", flag.ExitOnError)
+	exportFile := flags.String("export", "deleted_fields.json", "Export file to report on")
+	output := flags.String("o", "", "File to write the SARIF log to (default standard output)")
+	sourceDir := flags.String("source-dir", "force-app/main/default", "Repository directory of the org's metadata source, which results point at")
+	errorCount := flags.Int("error-count", 1000, "Residual records from which a deleted field is an error rather than a warning")
+	errorAge := flags.Duration("error-age", erasureDelay-5*24*time.Hour, "Time since a deleted field was first seen from which any residual records are an error, as their erasure nears")
+	org := flags.String("org", "", "Org alias for records that do not name theirs")
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+	settings.apply()
+
+	exportData, err := export.Read(*exportFile)
+	if err != nil {
+		fatal("Failed to read export", "file", *exportFile, "error", err)
+	}
+	if len(exportData.Results) == 0 {
+		fatal("Export has no results to report on", "file", *exportFile)
+	}
+
+	policy := sarifPolicy{ErrorCount: *errorCount, ErrorAge: *errorAge}
+	log := buildSarifLog(exportData.Results, *org, *sourceDir, policy, time.Now())
+
+	w := stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fatal("Failed to create SARIF log", "file", *output, "error", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := writeSarif(w, log); err != nil {
+		fatal("Failed to write SARIF log", "error", err)
+	}
+}
+
+// buildSarifLog turns the latest run's records into results. A field's
+// age counts from the first run that saw it, so the real one may be
+// greater.
+func buildSarifLog(records []export.DeleteCountRecord, defaultOrg, sourceDir string, policy sarifPolicy, now time.Time) sarifLog {
+	firstSeen := make(map[string]int64)
+	for _, record := range records {
+		key := record.Org + "/" + export.FieldKey(record.QualifiedApiName, record.DeveloperName)
+		if seen, ok := firstSeen[key]; !ok || record.Timestamp < seen {
+			firstSeen[key] = record.Timestamp
+		}
+	}
+
+	latest := slices.Clone(export.LatestRunRecords(records))
+	slices.SortFunc(latest, func(a, b export.DeleteCountRecord) int {
+		return cmp.Or(cmp.Compare(a.Org, b.Org), cmp.Compare(a.QualifiedApiName, b.QualifiedApiName), cmp.Compare(a.DeveloperName, b.DeveloperName))
+	})
+
+	results := make([]sarifResult, 0, len(latest))
+	for _, record := range latest {
+		org := cmp.Or(record.Org, defaultOrg)
+		seen := time.Unix(firstSeen[record.Org+"/"+export.FieldKey(record.QualifiedApiName, record.DeveloperName)], 0)
+		age := now.Sub(seen)
+		field := record.QualifiedApiName + "." + record.DeveloperName + "__c"
+
+		result := sarifResult{
+			Properties: sarifProperties{
+				Org:         org,
+				Object:      record.QualifiedApiName,
+				Field:       record.DeveloperName,
+				Status:      string(record.CountStatus()),
+				Approximate: record.Approximate,
+				FirstSeen:   seen.Format("2006-01-02"),
+				AgeDays:     int(age / (24 * time.Hour)),
+			},
+		}
+		switch {
+		case record.CountStatus() != export.StatusOK:
+			result.RuleIndex, result.Level = 2, sarifWarning
+			result.Message.Text = fmt.Sprintf("Deleted field %s was not counted (%s); it may still hold data.", field, record.CountStatus())
+		case record.Count > 0:
+			result.RuleIndex, result.Level = 0, sarifWarning
+			if record.Count >= policy.ErrorCount || age >= policy.ErrorAge {
+				result.Level = sarifError
+			}
+			deadline := seen.Add(erasureDelay).Format("2006-01-02")
+			result.Message.Text = fmt.Sprintf("Deleted field %s still holds %d records, which Salesforce erases by %s at the latest.", field, record.Count, deadline)
+		default:
+			result.RuleIndex, result.Level = 1, sarifNote
+			result.Message.Text = fmt.Sprintf("Deleted field %s holds no records and can be purged.", field)
+		}
+		if record.CountStatus() == export.StatusOK {
+			count := record.Count
+			result.Properties.Records = &count
+		}
+		result.RuleId = sarifRules[result.RuleIndex].Id
+
+		location := sarifLocation{LogicalLocations: []sarifLogicalLocation{{
+			Name:               record.DeveloperName + "__c",
+			FullyQualifiedName: field,
+			Kind:               "member",
+		}}}
+		location.PhysicalLocation.ArtifactLocation.Uri = path.Join(sourceDir, "objects", record.QualifiedApiName, "fields", record.DeveloperName+"__c.field-meta.xml")
+		result.Locations = []sarifLocation{location}
+
+		// The fingerprint keeps a field's alert the same across runs, so
+		// platforms close it once the field is purged.
+		sum := sha256.Sum256([]byte(org + "/" + export.FieldKey(record.QualifiedApiName, record.DeveloperName)))
+		result.PartialFingerprints = map[string]string{"deletedField/v1": hex.EncodeToString(sum[:16])}
+
+		results = append(results, result)
+	}
+
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:    "sf-deleted-fields",
+				Version: version,
+				Rules:   sarifRules,
+			}},
+			Results: results,
+		}},
+	}
+}
+
+func writeSarif(w io.Writer, log sarifLog) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
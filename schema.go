@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+// schemaSnapshot is the field list of every object holding deleted fields
+// at the time of a scan, kept so later diffs can tell what else changed
+// on those objects around the deletions.
+type schemaSnapshot struct {
+	Org     string                 `json:"org"`
+	RunId   string                 `json:"runId"`
+	TakenAt string                 `json:"takenAt"`
+	Objects []scanner.ObjectSchema `json:"objects"`
+}
+
+// writeSchemaSnapshot stores the scan's snapshot as <org>-<date>.json in
+// dir, replacing one taken earlier the same day.
+func writeSchemaSnapshot(dir, org string, at time.Time, objects []scanner.ObjectSchema) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.json", org, at.Format("2006-01-02")))
+
+	snapshot := schemaSnapshot{Org: org, RunId: runID, TakenAt: at.Format(time.RFC3339), Objects: objects}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode schema snapshot: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write schema snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to replace schema snapshot: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// selftestPoll is how often selftest scans again while waiting for the
+// deleted field to show up.
+const selftestPoll = 10 * time.Second
+
+// selftestCheck is one assertion of a selftest run.
+type selftestCheck struct {
+	Name   string
+	Err    error
+	Detail string
+}
+
+// runSelftest validates the tool end to end against a real scratch org or
+// sandbox: it creates a disposable custom object with a field, adds
+// records, deletes the field, scans for it, checks what the scan found and
+// exported, and removes the object again.
+func runSelftest(args []string) {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	org := flags.String("org", "", "Scratch org or sandbox to test against (default: the sf CLI's target-org)")
+	records := flags.Int("records", 3, "Number of records to create on the test object")
+	wait := flags.Duration("wait", 2*time.Minute, "How long to wait for the deleted field to show up in the scan")
+	keep := flags.Bool("keep", false, "Leave the test object in the org, for debugging a failure")
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+
+	if *org == "" {
+		*org = defaultOrg()
+	}
+	redact.Add("org", *org)
+
+	// The test creates and deletes metadata in the org, so it is audited
+	// like any other change.
+	audit = startAudit(settings.apply().Audit, "selftest", args)
+	audit.setOrgs([]string{*org})
+	*records = max(*records, 1)
+
+	ctx := context.Background()
+	client, err := sfclient.NewClient(*org)
+	if err != nil {
+		fatal("Failed to open REST session", "org", *org, "error", err)
+	}
+	// The test changes the org's metadata, so never run it against
+	// production, nor an org that might be.
+	environment, err := sfclient.DetectEnvironment(ctx, client)
+	if err != nil {
+		fatal("Could not tell the org's environment", "org", *org, "error", err)
+	}
+	if environment != sfclient.Scratch && environment != sfclient.Sandbox {
+		fatal("selftest only runs against scratch orgs and sandboxes", "org", *org, "environment", environment)
+	}
+
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	test := selftest{
+		client:  client,
+		org:     *org,
+		object:  "SFDF_Selftest_" + hex.EncodeToString(suffix) + "__c",
+		field:   "SFDF_Probe",
+		records: *records,
+	}
+	slog.Info("Running selftest", "org", *org, "environment", environment, "object", test.object)
+	audit.setTargets([]string{test.object, test.object + "." + test.field + "__c"})
+
+	checks := test.run(ctx, *wait)
+	if *keep {
+		slog.Info("Keeping the test object", "object", test.object)
+	} else {
+		checks = append(checks, test.cleanup(ctx))
+	}
+
+	failed := writeSelftestChecks(stdout, checks)
+	if failed > 0 {
+		audit.finish("failed", 1)
+		os.Exit(1)
+	}
+	audit.finish(outcomeOK, 0)
+}
+
+type selftest struct {
+	client   *sfclient.Client
+	org      string
+	object   string
+	field    string
+	records  int
+	objectId string
+}
+
+// run performs the test up to the first failing step, which ends its list
+// of checks.
+func (t *selftest) run(ctx context.Context, wait time.Duration) []selftestCheck {
+	var checks []selftestCheck
+	step := func(name string, err error, detail string) bool {
+		checks = append(checks, selftestCheck{Name: name, Err: err, Detail: detail})
+		return err == nil
+	}
+
+	label := strings.TrimSuffix(t.object, "__c")
+	var err error
+	t.objectId, err = t.client.Create(ctx, "CustomObject", map[string]any{
+		"FullName": t.object,
+		"Metadata": map[string]any{
+			"label":            label,
+			"pluralLabel":      label,
+			"nameField":        map[string]any{"type": "Text", "label": "Name"},
+			"deploymentStatus": "Deployed",
+			"sharingModel":     "ReadWrite",
+		},
+	}, true)
+	if !step("Create test object", err, t.object) {
+		return checks
+	}
+
+	fieldId, err := t.client.Create(ctx, "CustomField", map[string]any{
+		"FullName": t.object + "." + t.field + "__c",
+		"Metadata": map[string]any{"label": t.field, "type": "Text", "length": 20},
+	}, true)
+	if !step("Create test field", err, t.field+"__c") {
+		return checks
+	}
+
+	for i := range t.records {
+		if _, err = t.client.Create(ctx, t.object, map[string]any{"Name": fmt.Sprintf("selftest %d", i+1)}, false); err != nil {
+			break
+		}
+	}
+	if !step("Create records", err, fmt.Sprintf("%d records", t.records)) {
+		return checks
+	}
+
+	err = t.client.Delete(ctx, "CustomField", fieldId, true)
+	if !step("Delete test field", err, "") {
+		return checks
+	}
+
+	record, err := t.scan(ctx, wait)
+	if !step("Scan finds the deleted field", err, record.DeveloperName) {
+		return checks
+	}
+
+	err = nil
+	if record.Status != export.StatusOK || record.Count != t.records {
+		err = fmt.Errorf("status %s, count %d; want %s, %d", record.Status, record.Count, export.StatusOK, t.records)
+	}
+	step("Scan counts the records", err, fmt.Sprintf("%d records", record.Count))
+
+	err = nil
+	if !record.DeleteCandidate {
+		err = errors.New("the object has no other custom fields but is not a delete candidate")
+	}
+	step("Scan marks the object a delete candidate", err, "")
+
+	err = t.exportRoundTrip(record)
+	step("Export writes and reads back the record", err, "")
+	return checks
+}
+
+// scan scans the org for the test field until it shows up, which takes a
+// while after it is deleted, or wait has passed.
+func (t *selftest) scan(ctx context.Context, wait time.Duration) (export.DeleteCountRecord, error) {
+	cfg := scanner.NewConfig(scanner.WithPattern(t.field+"_del%"), scanner.WithoutCache())
+	deadline := time.Now().Add(wait)
+	for {
+		scan := scanner.New(t.org, cfg)
+		if err := scan.Run(ctx); err != nil {
+			return export.DeleteCountRecord{}, err
+		}
+		for _, record := range scan.Records() {
+			if record.QualifiedApiName == t.object {
+				return record, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return export.DeleteCountRecord{}, fmt.Errorf("no deleted field on %s after %s", t.object, wait)
+		}
+		slog.Debug("Deleted field not listed yet, scanning again", "object", t.object, "in", selftestPoll)
+		time.Sleep(selftestPoll)
+	}
+}
+
+// exportRoundTrip writes record to a temporary export and checks it reads
+// back unchanged.
+func (t *selftest) exportRoundTrip(record export.DeleteCountRecord) error {
+	dir, err := os.MkdirTemp("", "sf-deleted-fields-selftest")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "deleted_fields.json")
+	exporter, err := export.ForPath(path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := exporter.Write(export.Run{Org: t.org, Started: now, Finished: now}, []export.DeleteCountRecord{record}); err != nil {
+		return err
+	}
+	data, err := export.Read(path)
+	if err != nil {
+		return err
+	}
+	if len(data.Results) != 1 {
+		return fmt.Errorf("read back %d records, want 1", len(data.Results))
+	}
+	got := data.Results[0]
+	if got.QualifiedApiName != record.QualifiedApiName || got.DeveloperName != record.DeveloperName || got.Count != record.Count {
+		return fmt.Errorf("read back %s.%s with %d records, want %s.%s with %d", got.QualifiedApiName, got.DeveloperName, got.Count, record.QualifiedApiName, record.DeveloperName, record.Count)
+	}
+	if n := len(data.LastRunCount); n == 0 || data.LastRunCount[n-1].Count != record.Count {
+		return fmt.Errorf("last run count is %v, want %d", data.LastRunCount, record.Count)
+	}
+	return nil
+}
+
+// cleanup deletes the test object with its records and field.
+func (t *selftest) cleanup(ctx context.Context) selftestCheck {
+	check := selftestCheck{Name: "Delete test object", Detail: t.object}
+	if t.objectId == "" {
+		check.Detail = "nothing to delete"
+		return check
+	}
+	check.Err = t.client.Delete(ctx, "CustomObject", t.objectId, true)
+	return check
+}
+
+// writeSelftestChecks prints the checks and returns how many failed.
+func writeSelftestChecks(w io.Writer, checks []selftestCheck) int {
+	failed := 0
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tRESULT\tDETAIL")
+	for _, check := range checks {
+		result, detail := "ok", check.Detail
+		if check.Err != nil {
+			result, detail = "FAIL", check.Err.Error()
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", check.Name, result, detail)
+	}
+	tw.Flush()
+	return failed
+}
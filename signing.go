@@ -0,0 +1,248 @@
+package main
+
+import (
+	"cmp"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// signatureSuffix names the detached signature kept beside a signed
+// artifact.
+const signatureSuffix = ".sig"
+
+// signingConfig names the Ed25519 keys artifacts are signed and verified
+// with, as PEM files. Key is the private key, which can also verify;
+// PublicKey is enough for machines that only verify.
+type signingConfig struct {
+	Key       string `yaml:"key"`
+	PublicKey string `yaml:"public_key"`
+}
+
+// runSign signs export artifacts, writing each one's signature to
+// <file>.sig, so their history can be shown not to have been edited since.
+func runSign(args []string) {
+	flags := flag.NewFlagSet("sign", flag.ExitOnError)
+	key := flags.String("key", "", "Private key to sign with (default: signing.key from the config file)")
+	generate := flags.Bool("generate-key", false, "Write a new key pair to --key and --key.pub instead of signing")
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	files := parseInterspersed(flags, args)
+	logging.apply()
+	cfg := settings.apply()
+
+	*key = cmp.Or(*key, cfg.Signing.Key)
+	if *key == "" {
+		fatal("Please provide the signing key; use --key or signing.key in the config file")
+	}
+
+	if *generate {
+		if err := generateSigningKey(*key); err != nil {
+			fatal("Failed to generate key", "error", err)
+		}
+		slog.Info("Generated signing key", "key", *key, "public_key", *key+".pub")
+		return
+	}
+
+	if len(files) == 0 {
+		fatal("Please name the files to sign")
+	}
+	private, err := loadSigningKey(*key)
+	if err != nil {
+		fatal("Cannot use the signing key", "error", err)
+	}
+	for _, file := range files {
+		if err := signFile(file, file+signatureSuffix, private); err != nil {
+			fatal("Failed to sign", "file", file, "error", err)
+		}
+		slog.Info("Signed", "file", file, "signature", file+signatureSuffix)
+	}
+}
+
+// runVerify checks artifacts against their signatures and exits 1 when any
+// is unsigned or does not match.
+func runVerify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	key := flags.String("key", "", "Public or private key to verify with (default: signing.public_key, else signing.key, from the config file)")
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	files := parseInterspersed(flags, args)
+	logging.apply()
+	cfg := settings.apply()
+
+	*key = cmp.Or(*key, cfg.Signing.PublicKey, cfg.Signing.Key)
+	if *key == "" {
+		fatal("Please provide the verification key; use --key or signing.public_key in the config file")
+	}
+	if len(files) == 0 {
+		fatal("Please name the files to verify")
+	}
+	public, err := loadVerifyKey(*key)
+	if err != nil {
+		fatal("Cannot use the verification key", "error", err)
+	}
+
+	failed := 0
+	for _, file := range files {
+		if err := verifyFile(file, file+signatureSuffix, public); err != nil {
+			slog.Error("Verification failed", "file", file, "error", err)
+			failed++
+			continue
+		}
+		slog.Info("Verified", "file", file)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func generateSigningKey(path string) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	privateDer, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	publicDer, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return err
+	}
+
+	// O_EXCL so an existing key, and everything signed with it, is never
+	// replaced by accident.
+	for _, file := range []struct {
+		path  string
+		block *pem.Block
+		mode  os.FileMode
+	}{
+		{path, &pem.Block{Type: "PRIVATE KEY", Bytes: privateDer}, 0o600},
+		{path + ".pub", &pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}, 0o644},
+	} {
+		f, err := os.OpenFile(file.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, file.mode)
+		if err != nil {
+			return err
+		}
+		err = pem.Encode(f, file.block)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.path, err)
+		}
+	}
+	return nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM key", path)
+	}
+	return block, nil
+}
+
+// loadSigningKey reads an Ed25519 private key in PKCS #8 PEM form.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key %s: %w", path, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return private, nil
+}
+
+// loadVerifyKey reads an Ed25519 public key, or takes the public half of a
+// private key.
+func loadVerifyKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "PRIVATE KEY" {
+		private, err := loadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return private.Public().(ed25519.PublicKey), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %w", path, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return public, nil
+}
+
+// signFile writes the signature of path's contents to signature, usually
+// path.sig.
+func signFile(path, signature string, key ed25519.PrivateKey) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)) + "\n"
+
+	tmp := signature + ".tmp"
+	if err := os.WriteFile(tmp, []byte(encoded), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, signature); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// verifyFile checks path's contents against signature, usually path.sig.
+func verifyFile(path, signature string, key ed25519.PublicKey) error {
+	encoded, err := os.ReadFile(signature)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("not signed: %s is missing", signature)
+	}
+	if err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("invalid signature file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, data, decoded) {
+		return errors.New("signature does not match: the file changed since it was signed, or was signed with another key")
+	}
+	return nil
+}
+
+// hasSignature reports whether path has a signature beside it.
+func hasSignature(path string) bool {
+	_, err := os.Stat(path + signatureSuffix)
+	return err == nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+const summaryTopObjects = 10
+
+// summarize returns the scan's summary with the org alias redacted for
+// reports.
+func summarize(scan *scanner.Scan) scanner.Summary {
+	summary := scan.Summary()
+	summary.Org = redact.Apply(summary.Org)
+	return summary
+}
+
+// printSummary prints the summary table followed by the top objects by
+// residual records, at most top of them.
+func printSummary(w io.Writer, summary scanner.Summary, top int, p palette) {
+	residual := fmt.Sprint(summary.ResidualRecords)
+	if summary.ResidualRecords > 0 {
+		residual = p.yellow(residual)
+	} else {
+		residual = p.green(residual)
+	}
+
+	failures := fmt.Sprint(summary.Failures)
+	if summary.Failures > 0 {
+		failures = p.red(failures)
+	}
+
+	environment := string(summary.Environment)
+	if summary.Environment == sfclient.Production {
+		environment = p.red(environment)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Org\t%s\n", p.bold(summary.Org))
+	if environment != "" {
+		fmt.Fprintf(tw, "Environment\t%s\n", environment)
+	}
+	fmt.Fprintf(tw, "Deleted fields\t%d\n", summary.DeletedFields)
+	fmt.Fprintf(tw, "Residual records\t%s\n", residual)
+	fmt.Fprintf(tw, "Objects affected\t%d\n", len(summary.Objects))
+	fmt.Fprintf(tw, "Failures\t%s\n", failures)
+	if summary.CircuitOpen {
+		fmt.Fprintf(tw, "Stopped early\t%s\n", p.red("too many consecutive failures"))
+	}
+	if summary.CallLimitReached {
+		fmt.Fprintf(tw, "Stopped early\t%s\n", p.red("API call limit reached"))
+	}
+	if summary.UnstableCounts > 0 {
+		fmt.Fprintf(tw, "Unstable counts\t%s\n", p.yellow(fmt.Sprint(summary.UnstableCounts)))
+	}
+	fmt.Fprintf(tw, "Duration\t%s\n", summary.Duration.Round(time.Second))
+	fmt.Fprintf(tw, "API calls\t%d\n", summary.ApiCalls)
+	tw.Flush()
+
+	if top = min(top, len(summary.Objects)); top > 0 {
+		fmt.Fprintln(w, p.bold(fmt.Sprintf("\nTop %d objects by residual records:", top)))
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "OBJECT\tRECORDS\tDELETED FIELDS")
+		for _, object := range summary.Objects[:top] {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", object.Object, object.Count, object.Fields)
+		}
+		tw.Flush()
+	}
+
+	// Cleanup ownership splits along package boundaries, so the rollup
+	// is only worth a table once a managed package is involved.
+	if len(summary.Namespaces) > 1 || (len(summary.Namespaces) == 1 && summary.Namespaces[0].Namespace != "") {
+		fmt.Fprintln(w, p.bold("\nBy namespace:"))
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAMESPACE\tDELETED FIELDS\tRECORDS\tOBJECTS")
+		for _, ns := range summary.Namespaces {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", namespaceName(ns.Namespace), ns.DeletedFields, ns.ResidualRecords, ns.ObjectsAffected)
+		}
+		tw.Flush()
+	}
+
+	if len(summary.DeleteCandidates) > 0 {
+		fmt.Fprintln(w, p.bold("\nDelete candidates (no custom fields left but deleted ones):"))
+		records := make(map[string]string)
+		for _, object := range summary.Objects {
+			records[object.Object] = fmt.Sprint(object.Count)
+		}
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "OBJECT\tRECORDS")
+		for _, object := range summary.DeleteCandidates {
+			fmt.Fprintf(tw, "%s\t%s\n", object, cmp.Or(records[object], "-"))
+		}
+		tw.Flush()
+	}
+
+	if len(summary.Collisions) > 0 {
+		fmt.Fprintln(w, p.bold("\nNaming collisions:"))
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "KIND\tNAME\tFIELDS")
+		for _, collision := range summary.Collisions {
+			kind := "across objects"
+			switch collision.Kind {
+			case scanner.Suffixed:
+				kind = "suffixed"
+			case scanner.ActiveField:
+				kind = "active field"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", kind, collision.Name, strings.Join(collision.Fields, ", "))
+		}
+		tw.Flush()
+	}
+	fmt.Fprintln(w)
+}
+
+// namespaceName names a namespace prefix in reports, where unmanaged and
+// standard objects have none.
+func namespaceName(namespace string) string {
+	return cmp.Or(namespace, "(unmanaged)")
+}
+
+// omitEmptyObjects returns the objects that still hold records, for
+// --omit-zero.
+func omitEmptyObjects(objects []scanner.ObjectCount) []scanner.ObjectCount {
+	return slices.DeleteFunc(slices.Clone(objects), func(object scanner.ObjectCount) bool { return object.Count == 0 })
+}
+
+// omitCountedEmpty returns the records not counted at zero, for --omit-zero.
+func omitCountedEmpty(records []export.DeleteCountRecord) []export.DeleteCountRecord {
+	return slices.DeleteFunc(records, export.DeleteCountRecord.CountedEmpty)
+}
+
+// printRecords lists every deleted field with its object's record count,
+// for runs that print their results instead of exporting them.
+func printRecords(w io.Writer, records []export.DeleteCountRecord, p palette) {
+	if len(records) == 0 {
+		return
+	}
+
+	records = slices.Clone(records)
+	slices.SortFunc(records, func(a, b export.DeleteCountRecord) int {
+		return cmp.Or(cmp.Compare(a.QualifiedApiName, b.QualifiedApiName), cmp.Compare(a.DeveloperName, b.DeveloperName))
+	})
+
+	fmt.Fprintln(w, p.bold("Deleted fields:"))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OBJECT\tFIELD\tRECORDS")
+	for _, record := range records {
+		count := fmt.Sprint(record.Count)
+		switch {
+		case record.Status == export.StatusCountFailed:
+			count = "failed"
+		case record.CountSkipped:
+			count = "-"
+		case record.Approximate:
+			count = "~" + count
+		case record.Unstable:
+			count = fmt.Sprintf("%d→%d", record.Count, record.Recount)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", record.QualifiedApiName, record.DeveloperName, count)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
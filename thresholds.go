@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log/slog"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+// exitThresholdExceeded is returned when a run finds more deleted fields or
+// residual records than the --fail-on-* policy allows.
+const exitThresholdExceeded = 3
+
+// exitCircuitOpen is returned when a scan was stopped early by the circuit
+// breaker; its partial results are still exported.
+const exitCircuitOpen = 4
+
+// exitCallLimit is returned when a scan was stopped early at the
+// --max-api-calls limit; its partial results are still exported.
+const exitCallLimit = 5
+
+// failThresholds holds the CI policy limits; a negative value disables a check.
+type failThresholds struct {
+	Count  int
+	Fields int
+}
+
+// breached reports whether the summary exceeds any configured limit, logging
+// each violation.
+func (t failThresholds) breached(summary scanner.Summary) bool {
+	breached := false
+
+	if t.Count >= 0 && summary.ResidualRecords > t.Count {
+		slog.Error("Residual record threshold exceeded", "org", summary.Org, "records", summary.ResidualRecords, "limit", t.Count)
+		breached = true
+	}
+
+	if t.Fields >= 0 && summary.DeletedFields > int64(t.Fields) {
+		slog.Error("Deleted field threshold exceeded", "org", summary.Org, "fields", summary.DeletedFields, "limit", t.Fields)
+		breached = true
+	}
+
+	return breached
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+)
+
+// traceEntry is one line of the --trace file.
+type traceEntry struct {
+	RunId      string  `json:"runId"`
+	Org        string  `json:"org"`
+	Call       string  `json:"call"`
+	Query      string  `json:"query,omitempty"`
+	Tooling    bool    `json:"tooling,omitempty"`
+	Started    string  `json:"started"`
+	DurationMs float64 `json:"durationMs"`
+	Rows       int     `json:"rows"`
+	Success    bool    `json:"success"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// traceFile writes every Salesforce call of a run to a file, one JSON line
+// each, so slow runs can be profiled and API use audited afterwards. Lines
+// are flushed as calls finish, so the trace of a run that dies is kept up
+// to its last call.
+type traceFile struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+	err  error
+}
+
+func openTraceFile(path string) (*traceFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace file: %w", err)
+	}
+	return &traceFile{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// add writes one call. Errors are kept for close to report, rather than
+// failing the scan over its trace.
+func (t *traceFile) add(call scanner.Call) {
+	entry := traceEntry{
+		RunId:      runID,
+		Org:        redact.Apply(call.Org),
+		Call:       call.Kind,
+		Query:      call.Query,
+		Tooling:    call.Tooling,
+		Started:    call.Started.Format(time.RFC3339Nano),
+		DurationMs: float64(call.Duration.Microseconds()) / 1000,
+		Rows:       call.Rows,
+		Success:    call.Err == nil,
+	}
+	if call.Err != nil {
+		entry.Error = redact.Apply(call.Err.Error())
+	}
+	line, err := json.Marshal(entry)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return
+	}
+	if err == nil {
+		_, err = t.w.Write(append(line, '\n'))
+	}
+	if err == nil {
+		err = t.w.Flush()
+	}
+	t.err = err
+}
+
+func (t *traceFile) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.file.Close(); t.err == nil {
+		t.err = err
+	}
+	if t.err != nil {
+		return fmt.Errorf("failed to write trace file: %w", t.err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/export"
+)
+
+const tuiPageSize = 20
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// fieldHistory is every record of one deleted field, oldest first.
+type fieldHistory struct {
+	Object  string
+	Field   string
+	Records []export.DeleteCountRecord
+}
+
+func (h fieldHistory) latest() export.DeleteCountRecord {
+	return h.Records[len(h.Records)-1]
+}
+
+func groupFieldHistories(records []export.DeleteCountRecord) []fieldHistory {
+	index := make(map[string]int)
+	var histories []fieldHistory
+	for _, record := range records {
+		key := export.FieldIdentity(record.QualifiedApiName, record.DeveloperName)
+		i, ok := index[key]
+		if !ok {
+			i = len(histories)
+			index[key] = i
+			histories = append(histories, fieldHistory{Object: record.QualifiedApiName, Field: export.LogicalName(record.DeveloperName)})
+		}
+		histories[i].Records = append(histories[i].Records, record)
+	}
+
+	for _, history := range histories {
+		sort.SliceStable(history.Records, func(a, b int) bool {
+			return history.Records[a].Timestamp < history.Records[b].Timestamp
+		})
+	}
+	return histories
+}
+
+func sparkline(records []export.DeleteCountRecord) string {
+	var counts []int
+	for _, record := range records {
+		if !record.CountSkipped {
+			counts = append(counts, record.Count)
+		}
+	}
+	if len(counts) == 0 {
+		return ""
+	}
+
+	lo, hi := counts[0], counts[0]
+	for _, count := range counts {
+		lo, hi = min(lo, count), max(hi, count)
+	}
+
+	var b strings.Builder
+	for _, count := range counts {
+		i := 0
+		if hi > lo {
+			i = (count - lo) * (len(sparkBlocks) - 1) / (hi - lo)
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+// resultsBrowser is a small line-driven browser over an export's history.
+type resultsBrowser struct {
+	all    []fieldHistory
+	view   []fieldHistory
+	filter string
+	sortBy string
+	page   int
+	out    io.Writer
+}
+
+func runTui(args []string) {
+	flags := flag.NewFlagSet("tui", flag.ExitOnError)
+	exportFile := flags.String("export", "deleted_fields.json", "Export file to browse")
+	settings := registerConfigFlags(flags)
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+	settings.apply()
+
+	exportData, err := export.Read(*exportFile)
+	if err != nil {
+		fatal("Failed to read export", "file", *exportFile, "error", err)
+	}
+	if len(exportData.Results) == 0 {
+		fatal("Export has no results to browse", "file", *exportFile)
+	}
+
+	browser := &resultsBrowser{all: groupFieldHistories(exportData.Results), sortBy: "count", out: stdout}
+	browser.refresh()
+	browser.render()
+	browser.loop(os.Stdin)
+}
+
+func (b *resultsBrowser) loop(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(b.out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(b.out)
+			return
+		}
+
+		command, arg, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		arg = strings.TrimSpace(arg)
+		switch command {
+		case "":
+			continue
+		case "q", "quit", "exit":
+			return
+		case "h", "help", "?":
+			b.help()
+		case "f", "filter":
+			b.filter = arg
+			b.refresh()
+			b.render()
+		case "s", "sort":
+			if arg != "count" && arg != "object" && arg != "field" {
+				fmt.Fprintln(b.out, "sort by count, object or field")
+				continue
+			}
+			b.sortBy = arg
+			b.refresh()
+			b.render()
+		case "n", "next":
+			if (b.page+1)*tuiPageSize < len(b.view) {
+				b.page++
+			}
+			b.render()
+		case "p", "prev":
+			b.page = max(b.page-1, 0)
+			b.render()
+		case "l", "list":
+			b.render()
+		case "v", "view":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 || n > len(b.view) {
+				fmt.Fprintf(b.out, "view needs a row number between 1 and %d\n", len(b.view))
+				continue
+			}
+			b.detail(b.view[n-1])
+		default:
+			fmt.Fprintf(b.out, "unknown command %q, type help\n", command)
+		}
+	}
+}
+
+func (b *resultsBrowser) help() {
+	fmt.Fprintln(b.out, `commands:
+  list               show the current page
+  next, prev         page through results
+  filter <text>      only show objects containing text (empty clears)
+  sort <key>         sort by count, object or field
+  view <row>         show one field's full history
+  quit               leave the browser`)
+}
+
+func (b *resultsBrowser) refresh() {
+	b.view = b.view[:0]
+	for _, history := range b.all {
+		if b.filter == "" || strings.Contains(strings.ToLower(history.Object), strings.ToLower(b.filter)) {
+			b.view = append(b.view, history)
+		}
+	}
+
+	sort.SliceStable(b.view, func(i, j int) bool {
+		switch b.sortBy {
+		case "object":
+			return b.view[i].Object < b.view[j].Object
+		case "field":
+			return b.view[i].Field < b.view[j].Field
+		default:
+			return b.view[i].latest().Count > b.view[j].latest().Count
+		}
+	})
+	b.page = 0
+}
+
+func (b *resultsBrowser) render() {
+	start := b.page * tuiPageSize
+	end := min(start+tuiPageSize, len(b.view))
+
+	w := tabwriter.NewWriter(b.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tOBJECT\tFIELD\tCOUNT\tHISTORY")
+	for i := start; i < end; i++ {
+		history := b.view[i]
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", i+1, history.Object, history.Field, history.latest().Count, sparkline(history.Records))
+	}
+	w.Flush()
+
+	filter := b.filter
+	if filter == "" {
+		filter = "none"
+	}
+	fmt.Fprintf(b.out, "rows %d-%d of %d, sorted by %s, filter: %s\n", min(start+1, end), end, len(b.view), b.sortBy, filter)
+}
+
+func (b *resultsBrowser) detail(history fieldHistory) {
+	fmt.Fprintf(b.out, "%s.%s  %s\n", history.Object, history.Field, sparkline(history.Records))
+
+	w := tabwriter.NewWriter(b.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATE\tCOUNT")
+	for _, record := range history.Records {
+		count := strconv.Itoa(record.Count)
+		if record.CountSkipped {
+			count = "-"
+		} else if record.Approximate {
+			count = "~" + count
+		}
+		fmt.Fprintf(w, "%s\t%s\n", time.Unix(record.Timestamp, 0).Format("2006-01-02 15:04"), count)
+	}
+	w.Flush()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"git.dmoruzzi.com/sf-deleted-fields/internal/redact"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/scanner"
+	"git.dmoruzzi.com/sf-deleted-fields/pkg/sfclient"
+)
+
+// runWarmCache fills the metadata cache ahead of a scan, so the scan starts
+// counting straight away. CI runners can warm a cache directory once
+// ($XDG_CACHE_HOME on Linux) and share it between jobs.
+func runWarmCache(args []string) {
+	flags := flag.NewFlagSet("warm-cache", flag.ExitOnError)
+	org := flags.String("org", "", "Salesforce organization to use (default: the sf CLI's target-org)")
+	useCli := flags.Bool("cli", false, "Run every query through the sf CLI instead of a shared REST session")
+	pattern := flags.String("pattern", scanner.DefaultPattern, "SOQL LIKE pattern the scan matches deleted field names with")
+	queriesDir := flags.String("queries-dir", "", "Directory of .soql files replacing the embedded queries of the same name")
+	noFieldDetails := flags.Bool("no-field-details", false, "Do not cache the deleted fields' objects' field lists")
+	logging := registerLogFlags(flags)
+	flags.Parse(args)
+	logging.apply()
+
+	if *org == "" {
+		*org = defaultOrg()
+	}
+	redact.Add("org", *org)
+	if *queriesDir != "" {
+		checkQueriesDir(*queriesDir)
+	}
+	if _, err := sfclient.CheckInstalled(); err != nil {
+		fatal("sf is not installed", "error", err)
+	}
+
+	started := time.Now()
+	cfg := scanner.NewConfig(scanner.WithPattern(*pattern), scanner.WithQueriesDir(*queriesDir))
+	cfg.UseCli = *useCli
+	cfg.NoFieldDetails = *noFieldDetails
+	warmed, err := scanner.New(*org, cfg).Warm(context.Background())
+	if err != nil {
+		fatal("Failed to warm the metadata cache", "org", *org, "error", err)
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Org\t%s\n", redact.Apply(*org))
+	fmt.Fprintf(w, "Objects described\t%d\n", warmed.Objects)
+	fmt.Fprintf(w, "EntityDefinitions\t%d\n", warmed.Entities)
+	fmt.Fprintf(w, "Field lists\t%d\n", warmed.FieldDefinitions)
+	fmt.Fprintf(w, "API calls\t%d\n", warmed.ApiCalls)
+	fmt.Fprintf(w, "Duration\t%s\n", time.Since(started).Round(time.Millisecond))
+	fmt.Fprintf(w, "Cache file\t%s\n", warmed.CacheFile)
+	w.Flush()
+}